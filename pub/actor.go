@@ -119,9 +119,85 @@ type FederatingActor interface {
 	//   - The activity is added to the specified outbox.
 	//   - The activity is prepared and delivered to recipients.
 	//
+	// If delivering to some recipients fails when using the
+	// HttpSigTransport, the error is a *BatchDeliveryError describing each
+	// failed recipient. The returned Activity is still valid in this case,
+	// as it has already been added to the outbox.
+	//
 	// Note that this function will only behave as expected if the
 	// implementation has been constructed to support federation. This
 	// method will guaranteed work for non-custom Actors. For custom actors,
 	// care should be used to not call this method if only C2S is supported.
 	Send(c context.Context, outbox *url.URL, t vocab.Type) (Activity, error)
+	// PostSharedInbox returns true if the request was handled as an
+	// ActivityPub POST to the shared inbox of the server. If false, the
+	// request was not an ActivityPub request and may still be handled by
+	// the caller in another way.
+	//
+	// If the error is nil, then the ResponseWriter's headers and response
+	// has already been written. If a non-nil error is returned, then no
+	// response has been written.
+	//
+	// The activity is handled as if it were POSTed to the inbox of each of
+	// the actors on this server it is addressed to, and of each of the
+	// actors on this server following its actor when it is addressed to
+	// the Public collection or to the actor's followers. The latter are
+	// found with the LocalFollowers of a Database implementing
+	// FollowingDatabase; otherwise the activity only goes to the actors it
+	// is addressed to. When it is not public, the peer actor is fetched to
+	// learn the id of its followers collection. The side effects on the
+	// objects of the activity are only applied once.
+	//
+	// If the Actor was constructed with a DelegateActor that does not
+	// implement SharedInboxDelegateActor, writes the
+	// http.StatusMethodNotAllowed status code in the response.
+	PostSharedInbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error)
+	// FollowRequests returns the Follow requests awaiting approval by the
+	// actor owning the outbox. They are recorded when a Follow is received
+	// with the OnFollowManuallyApprove behavior.
+	//
+	// Returns an error if the Actor was constructed with a DelegateActor
+	// that does not implement FollowRequestsDelegateActor.
+	FollowRequests(c context.Context, outbox *url.URL) ([]vocab.ActivityStreamsFollow, error)
+	// ApproveFollowRequest approves the pending Follow request with the
+	// given id. Its actors are added to the followers collection, and an
+	// Accept is sent to them in the same way as Send. The Accept is
+	// returned.
+	//
+	// Returns ErrNotFound if the Follow is not awaiting approval.
+	ApproveFollowRequest(c context.Context, outbox, follow *url.URL) (Activity, error)
+	// RejectFollowRequest rejects the pending Follow request with the
+	// given id, sending a Reject to its actors in the same way as Send.
+	// The Reject is returned.
+	//
+	// Returns ErrNotFound if the Follow is not awaiting approval.
+	RejectFollowRequest(c context.Context, outbox, follow *url.URL) (Activity, error)
+	// Reports returns the Flags received by the actor owning the outbox
+	// that are awaiting moderation.
+	//
+	// Returns an error if the Actor was constructed with a DelegateActor
+	// that does not implement ReportsDelegateActor.
+	Reports(c context.Context, outbox *url.URL) ([]vocab.ActivityStreamsFlag, error)
+	// ResolveReport removes the Flag with the given id from the ones
+	// awaiting moderation, once the application has acted on it. The Flag
+	// is returned.
+	//
+	// Returns ErrNotFound if the Flag is not awaiting moderation.
+	ResolveReport(c context.Context, outbox, flag *url.URL) (vocab.ActivityStreamsFlag, error)
+	// SendReport sends a Flag of the objects, such as the actors and posts
+	// of a peer, to the actor of that peer instance receiving reports. The
+	// content explains the report and may be empty. The Flag is sent in
+	// the same way as Send, and returned.
+	SendReport(c context.Context, outbox, instanceActor *url.URL, objects []*url.URL, content string) (Activity, error)
+	// FollowRelay subscribes the actor owning the outbox to a LitePub or
+	// Mastodon relay, sending it a Follow in the same way as Send. The
+	// Follow is returned.
+	//
+	// Once the relay accepts, the public objects it announces are stored
+	// if the FederatingProtocol implements Relay and reports the peer as
+	// one.
+	//
+	// Returns an error if the Actor was constructed with a DelegateActor
+	// that does not implement RelayDelegateActor.
+	FollowRelay(c context.Context, outbox, relay *url.URL) (Activity, error)
 }
@@ -3,6 +3,7 @@ package pub
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
@@ -195,28 +196,10 @@ func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r
 	// Begin processing the request, but have not yet applied
 	// authorization (ex: blocks). Obtain the activity reject unknown
 	// activities.
-	raw, err := ioutil.ReadAll(r.Body)
+	c, activity, err := b.readInboxActivity(c, w, r)
 	if err != nil {
 		return true, err
-	}
-	var m map[string]interface{}
-	if err = json.Unmarshal(raw, &m); err != nil {
-		return true, err
-	}
-	asValue, err := streams.ToType(c, m)
-	if err != nil && !streams.IsUnmatchedErr(err) {
-		return true, err
-	} else if streams.IsUnmatchedErr(err) {
-		// Respond with bad request -- we do not understand the type.
-		w.WriteHeader(http.StatusBadRequest)
-		return true, nil
-	}
-	activity, ok := asValue.(Activity)
-	if !ok {
-		return true, fmt.Errorf("activity streams value is not an Activity: %T", asValue)
-	}
-	if activity.GetJSONLDId() == nil {
-		w.WriteHeader(http.StatusBadRequest)
+	} else if activity == nil {
 		return true, nil
 	}
 	// Allow server implementations to set context data with a hook.
@@ -224,8 +207,9 @@ func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r
 	if err != nil {
 		return true, err
 	}
-	// Check authorization of the activity.
-	authorized, err := b.delegate.AuthorizePostInbox(c, w, activity)
+	// Check authorization of the activity, for the inbox it is posted to.
+	inboxId := requestId(r, scheme)
+	authorized, err := b.delegate.AuthorizePostInbox(context.WithValue(c, inboxIRIKey{}, inboxId), w, activity)
 	if err != nil {
 		return true, err
 	} else if !authorized {
@@ -234,7 +218,6 @@ func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r
 	// Post the activity to the actor's inbox and trigger side effects for
 	// that particular Activity type. It is up to the delegate to resolve
 	// the given map.
-	inboxId := requestId(r, scheme)
 	err = b.delegate.PostInbox(c, inboxId, activity)
 	if err != nil {
 		// Special case: We know it is a bad request if the object or
@@ -244,6 +227,11 @@ func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r
 		if err == ErrObjectRequired || err == ErrTargetRequired {
 			w.WriteHeader(http.StatusBadRequest)
 			return true, nil
+		} else if isForbidden(err) {
+			// The peer may not make this change, such as
+			// updating an object of another origin.
+			w.WriteHeader(http.StatusForbidden)
+			return true, nil
 		}
 		return true, err
 	}
@@ -259,6 +247,39 @@ func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r
 	return true, nil
 }
 
+// readInboxActivity obtains the Activity POSTed to an inbox. If the request
+// body is not an Activity with an id, responds with http.StatusBadRequest and
+// returns a nil Activity. The returned context carries the JSON of the
+// Activity.
+func (b *baseActor) readInboxActivity(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, Activity, error) {
+	raw, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return c, nil, err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(raw, &m); err != nil {
+		return c, nil, err
+	}
+	asValue, err := streams.ToType(c, m)
+	if err != nil && !streams.IsUnmatchedErr(err) {
+		return c, nil, err
+	} else if streams.IsUnmatchedErr(err) {
+		// Respond with bad request -- we do not understand the type.
+		w.WriteHeader(http.StatusBadRequest)
+		return c, nil, nil
+	}
+	activity, ok := asValue.(Activity)
+	if !ok {
+		return c, nil, fmt.Errorf("activity streams value is not an Activity: %T", asValue)
+	}
+	if activity.GetJSONLDId() == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return c, nil, nil
+	}
+	// Keep the JSON as received, to verify the proofs embedded in it.
+	return context.WithValue(c, inboxJSONKey{}, m), activity, nil
+}
+
 // GetInbox implements the generic algorithm for handling a GET request to an
 // actor's inbox independent on an application. It relies on a delegate to
 // implement application specific functionality.
@@ -492,3 +513,192 @@ func (b *baseActor) deliver(c context.Context, outbox *url.URL, asValue vocab.Ty
 func (b *baseActorFederating) Send(c context.Context, outbox *url.URL, t vocab.Type) (Activity, error) {
 	return b.deliver(c, outbox, t, nil)
 }
+
+// inboxIRIKey is the context key of the IRI of the inbox an activity is posted
+// to.
+type inboxIRIKey struct{}
+
+// InboxIRI returns the IRI of the inbox an activity is posted to, from the
+// context given to the FederatingProtocol when authorizing the activity. It is
+// not set for activities posted to the shared inbox, which are for several
+// inboxes.
+func InboxIRI(c context.Context) (inboxIRI *url.URL, ok bool) {
+	inboxIRI, ok = c.Value(inboxIRIKey{}).(*url.URL)
+	return
+}
+
+// inboxJSONKey is the context key of the JSON of an activity posted to an
+// inbox, as it was received.
+type inboxJSONKey struct{}
+
+// sharedInboxRepeatKey is the context key marking an activity from the shared
+// inbox that was already posted to the inbox of another local actor.
+type sharedInboxRepeatKey struct{}
+
+// errFollowRequestsUnsupported is returned when managing Follow requests with
+// an Actor whose delegate does not support it.
+var errFollowRequestsUnsupported = errors.New("follow requests are not supported by this actor")
+
+// FollowRequests is programmatically accessible if the federated protocol is
+// enabled and the delegate implements FollowRequestsDelegateActor.
+func (b *baseActorFederating) FollowRequests(c context.Context, outbox *url.URL) ([]vocab.ActivityStreamsFollow, error) {
+	fd, ok := b.delegate.(FollowRequestsDelegateActor)
+	if !b.enableFederatedProtocol || !ok {
+		return nil, errFollowRequestsUnsupported
+	}
+	return fd.FollowRequests(c, outbox)
+}
+
+// ApproveFollowRequest accepts a pending Follow request.
+func (b *baseActorFederating) ApproveFollowRequest(c context.Context, outbox, follow *url.URL) (Activity, error) {
+	return b.resolveFollowRequest(c, outbox, follow, true)
+}
+
+// RejectFollowRequest rejects a pending Follow request.
+func (b *baseActorFederating) RejectFollowRequest(c context.Context, outbox, follow *url.URL) (Activity, error) {
+	return b.resolveFollowRequest(c, outbox, follow, false)
+}
+
+// resolveFollowRequest removes a pending Follow request with the delegate, then
+// sends the Accept or Reject it returns.
+func (b *baseActorFederating) resolveFollowRequest(c context.Context, outbox, follow *url.URL, approve bool) (Activity, error) {
+	fd, ok := b.delegate.(FollowRequestsDelegateActor)
+	if !b.enableFederatedProtocol || !ok {
+		return nil, errFollowRequestsUnsupported
+	}
+	response, err := fd.ResolveFollowRequest(c, outbox, follow, approve)
+	if err != nil {
+		return nil, err
+	}
+	return b.deliver(c, outbox, response, nil)
+}
+
+// errReportsUnsupported is returned when moderating reports with an Actor whose
+// delegate does not support it.
+var errReportsUnsupported = errors.New("reports are not supported by this actor")
+
+// Reports is programmatically accessible if the federated protocol is enabled
+// and the delegate implements ReportsDelegateActor.
+func (b *baseActorFederating) Reports(c context.Context, outbox *url.URL) ([]vocab.ActivityStreamsFlag, error) {
+	rd, ok := b.delegate.(ReportsDelegateActor)
+	if !b.enableFederatedProtocol || !ok {
+		return nil, errReportsUnsupported
+	}
+	return rd.Reports(c, outbox)
+}
+
+// ResolveReport removes a Flag awaiting moderation.
+func (b *baseActorFederating) ResolveReport(c context.Context, outbox, flag *url.URL) (vocab.ActivityStreamsFlag, error) {
+	rd, ok := b.delegate.(ReportsDelegateActor)
+	if !b.enableFederatedProtocol || !ok {
+		return nil, errReportsUnsupported
+	}
+	return rd.ResolveReport(c, outbox, flag)
+}
+
+// SendReport sends a Flag created by the delegate.
+func (b *baseActorFederating) SendReport(c context.Context, outbox, instanceActor *url.URL, objects []*url.URL, content string) (Activity, error) {
+	rd, ok := b.delegate.(ReportsDelegateActor)
+	if !b.enableFederatedProtocol || !ok {
+		return nil, errReportsUnsupported
+	}
+	report, err := rd.NewReport(c, outbox, instanceActor, objects, content)
+	if err != nil {
+		return nil, err
+	}
+	return b.deliver(c, outbox, report, nil)
+}
+
+// errRelaysUnsupported is returned when subscribing to a relay with an Actor
+// whose delegate does not support it.
+var errRelaysUnsupported = errors.New("relays are not supported by this actor")
+
+// FollowRelay sends a Follow of the relay created by the delegate.
+func (b *baseActorFederating) FollowRelay(c context.Context, outbox, relay *url.URL) (Activity, error) {
+	rd, ok := b.delegate.(RelayDelegateActor)
+	if !b.enableFederatedProtocol || !ok {
+		return nil, errRelaysUnsupported
+	}
+	follow, err := rd.NewRelayFollow(c, outbox, relay)
+	if err != nil {
+		return nil, err
+	}
+	return b.deliver(c, outbox, follow, nil)
+}
+
+// PostSharedInbox implements handling a POST request to the shared inbox of
+// the server. It relies on a delegate implementing SharedInboxDelegateActor to
+// determine which actors the activity is for.
+//
+// The request is authenticated and authorized once, then the activity is
+// posted to the inbox of each of the actors. The side effects on the objects of
+// the activity, such as storing a created object or adding the activity to the
+// likes of its object, are only applied when posting to the first inbox.
+func (b *baseActorFederating) PostSharedInbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error) {
+	// Do nothing if it is not an ActivityPub POST request.
+	if !isActivityPubPost(r) {
+		return false, nil
+	}
+	// If the Federated Protocol is not enabled or the delegate does not
+	// support a shared inbox, then this endpoint is not enabled.
+	sd, ok := b.delegate.(SharedInboxDelegateActor)
+	if !b.enableFederatedProtocol || !ok {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return true, nil
+	}
+	// Check the peer request is authentic.
+	c, authenticated, err := b.delegate.AuthenticatePostInbox(c, w, r)
+	if err != nil {
+		return true, err
+	} else if !authenticated {
+		return true, nil
+	}
+	c, activity, err := b.readInboxActivity(c, w, r)
+	if err != nil {
+		return true, err
+	} else if activity == nil {
+		return true, nil
+	}
+	// Allow server implementations to set context data with a hook.
+	c, err = b.delegate.PostInboxRequestBodyHook(c, r, activity)
+	if err != nil {
+		return true, err
+	}
+	// Check authorization of the activity.
+	authorized, err := b.delegate.AuthorizePostInbox(c, w, activity)
+	if err != nil {
+		return true, err
+	} else if !authorized {
+		return true, nil
+	}
+	// Fan out to the inboxes of the local actors the activity is for.
+	inboxIRIs, err := sd.SharedInboxRecipients(c, activity)
+	if err != nil {
+		return true, err
+	}
+	for i, inboxId := range inboxIRIs {
+		pc := c
+		if i > 0 {
+			// The side effects on the objects of the activity were
+			// applied when posting it to the first inbox.
+			pc = context.WithValue(c, sharedInboxRepeatKey{}, true)
+		}
+		err = b.delegate.PostInbox(pc, inboxId, activity)
+		if err == ErrObjectRequired || err == ErrTargetRequired {
+			w.WriteHeader(http.StatusBadRequest)
+			return true, nil
+		} else if isForbidden(err) {
+			w.WriteHeader(http.StatusForbidden)
+			return true, nil
+		} else if err != nil {
+			return true, err
+		}
+	}
+	for _, inboxId := range inboxIRIs {
+		if err := b.delegate.InboxForwarding(c, inboxId, activity); err != nil {
+			return true, err
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	return true, nil
+}
@@ -2,6 +2,7 @@ package pub
 
 import (
 	"context"
+	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
 	"github.com/golang/mock/gomock"
 	"io/ioutil"
@@ -351,6 +352,8 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 	// Set up test case
 	setupData()
 	ctx := context.Background()
+	// inboxCtx is the context in which posts to the inbox are authorized.
+	inboxCtx := context.WithValue(ctx, inboxIRIKey{}, mustParse(testMyInboxIRI))
 	setupFn := func(ctl *gomock.Controller) (delegate *MockDelegateActor, clock *MockClock, a Actor) {
 		delegate = NewMockDelegateActor(ctl)
 		clock = NewMockClock(ctl)
@@ -432,8 +435,8 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		resp := httptest.NewRecorder()
 		req := toAPRequest(toPostInboxRequest(testCreate))
 		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
-		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
-		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).DoAndReturn(func(ctx context.Context, resp http.ResponseWriter, activity Activity) (bool, error) {
+		delegate.EXPECT().PostInboxRequestBodyHook(withInboxJSON(ctx, testCreate), req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(inboxCtx, resp, toDeserializedForm(testCreate)).DoAndReturn(func(ctx context.Context, resp http.ResponseWriter, activity Activity) (bool, error) {
 			resp.WriteHeader(http.StatusForbidden)
 			return false, nil
 		})
@@ -452,8 +455,8 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		resp := httptest.NewRecorder()
 		req := toAPRequest(toPostInboxRequest(testCreate))
 		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
-		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
-		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(withInboxJSON(ctx, testCreate), req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(inboxCtx, resp, toDeserializedForm(testCreate)).Return(true, nil)
 		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
 		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
 		// Run the test
@@ -471,8 +474,8 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		resp := httptest.NewRecorder()
 		req := toAPRequest(toPostInboxRequest(testCreate))
 		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
-		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
-		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(withInboxJSON(ctx, testCreate), req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(inboxCtx, resp, toDeserializedForm(testCreate)).Return(true, nil)
 		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(ErrObjectRequired)
 		// Run the test
 		handled, err := a.PostInbox(ctx, resp, req)
@@ -489,8 +492,8 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		resp := httptest.NewRecorder()
 		req := toAPRequest(toPostInboxRequest(testCreate))
 		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
-		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
-		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(withInboxJSON(ctx, testCreate), req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(inboxCtx, resp, toDeserializedForm(testCreate)).Return(true, nil)
 		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(ErrTargetRequired)
 		// Run the test
 		handled, err := a.PostInbox(ctx, resp, req)
@@ -499,6 +502,25 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		assertEqual(t, handled, true)
 		assertEqual(t, resp.Code, http.StatusBadRequest)
 	})
+	t.Run("PostInboxForbiddenForForbiddenError", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(withInboxJSON(ctx, testCreate), req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(inboxCtx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(
+			&ForbiddenError{Object: mustParse(testNoteId1), Reason: "test"})
+		// Run the test
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusForbidden)
+	})
 	t.Run("GetInboxIgnoresNonActivityPubRequest", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
@@ -666,6 +688,8 @@ func TestBaseActor(t *testing.T) {
 	// Set up test case
 	setupData()
 	ctx := context.Background()
+	// inboxCtx is the context in which posts to the inbox are authorized.
+	inboxCtx := context.WithValue(ctx, inboxIRIKey{}, mustParse(testMyInboxIRI))
 	setupFn := func(ctl *gomock.Controller) (delegate *MockDelegateActor, clock *MockClock, a Actor) {
 		delegate = NewMockDelegateActor(ctl)
 		clock = NewMockClock(ctl)
@@ -685,8 +709,8 @@ func TestBaseActor(t *testing.T) {
 		resp := httptest.NewRecorder()
 		req := toAPRequest(toPostInboxRequest(testCreate))
 		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
-		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
-		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(withInboxJSON(ctx, testCreate), req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(inboxCtx, resp, toDeserializedForm(testCreate)).Return(true, nil)
 		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
 		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
 		// Run the test
@@ -754,3 +778,324 @@ func TestBaseActor(t *testing.T) {
 		assertEqual(t, respV.Header.Get(locationHeader), testNewActivityIRI)
 	})
 }
+
+// TestBaseActorSharedInbox tests the shared inbox of the FederatingActor
+// returned with NewCustomActor.
+func TestBaseActorSharedInbox(t *testing.T) {
+	// Set up test case
+	setupData()
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (delegate *MockDelegateActor, sd *MockSharedInboxDelegateActor, a FederatingActor) {
+		delegate = NewMockDelegateActor(ctl)
+		sd = NewMockSharedInboxDelegateActor(ctl)
+		a = NewCustomActor(
+			sharedInboxDelegateActor{delegate, sd},
+			/*enableSocialProtocol=*/ false,
+			/*enableFederatedProtocol=*/ true,
+			NewMockClock(ctl))
+		return
+	}
+	// Run tests
+	t.Run("IgnoresNonActivityPubRequest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toPostInboxRequest(testCreate)
+		// Run the test
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, false)
+	})
+	t.Run("NotAllowedWithoutSharedInboxDelegate", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		a := NewCustomActor(
+			NewMockDelegateActor(ctl),
+			/*enableSocialProtocol=*/ false,
+			/*enableFederatedProtocol=*/ true,
+			NewMockClock(ctl))
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		// Run the test
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusMethodNotAllowed)
+	})
+	t.Run("PostsToEachInbox", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, sd, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(withInboxJSON(ctx, testCreate), req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		sd.EXPECT().SharedInboxRecipients(ctx, toDeserializedForm(testCreate)).Return(
+			[]*url.URL{mustParse(testMyInboxIRI), mustParse(testMyInboxIRI2)}, nil)
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
+		delegate.EXPECT().PostInbox(context.WithValue(ctx, sharedInboxRepeatKey{}, true), mustParse(testMyInboxIRI2), toDeserializedForm(testCreate)).Return(nil)
+		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
+		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI2), toDeserializedForm(testCreate)).Return(nil)
+		// Run the test
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("RespondsOKWithoutRecipients", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, sd, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(withInboxJSON(ctx, testCreate), req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		sd.EXPECT().SharedInboxRecipients(ctx, toDeserializedForm(testCreate)).Return(nil, nil)
+		// Run the test
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("BadRequestForErrObjectRequired", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, sd, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(withInboxJSON(ctx, testCreate), req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		sd.EXPECT().SharedInboxRecipients(ctx, toDeserializedForm(testCreate)).Return(
+			[]*url.URL{mustParse(testMyInboxIRI)}, nil)
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(ErrObjectRequired)
+		// Run the test
+		handled, err := a.PostSharedInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusBadRequest)
+	})
+}
+
+// TestBaseActorFollowRequests tests managing Follow requests with the
+// FederatingActor returned with NewCustomActor.
+func TestBaseActorFollowRequests(t *testing.T) {
+	// Set up test case
+	setupData()
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (delegate *MockDelegateActor, fd *MockFollowRequestsDelegateActor, a FederatingActor) {
+		delegate = NewMockDelegateActor(ctl)
+		fd = NewMockFollowRequestsDelegateActor(ctl)
+		a = NewCustomActor(
+			followRequestsDelegateActor{delegate, fd},
+			/*enableSocialProtocol=*/ false,
+			/*enableFederatedProtocol=*/ true,
+			NewMockClock(ctl))
+		return
+	}
+	// Run tests
+	t.Run("ErrorsWithoutFollowRequestsDelegate", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		a := NewCustomActor(
+			NewMockDelegateActor(ctl),
+			/*enableSocialProtocol=*/ false,
+			/*enableFederatedProtocol=*/ true,
+			NewMockClock(ctl))
+		// Run the test
+		_, err := a.FollowRequests(ctx, mustParse(testMyOutboxIRI))
+		_, approveErr := a.ApproveFollowRequest(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI))
+		// Verify results
+		assertNotEqual(t, err, nil)
+		assertNotEqual(t, approveErr, nil)
+	})
+	t.Run("ListsFollowRequests", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, fd, a := setupFn(ctl)
+		fd.EXPECT().FollowRequests(ctx, mustParse(testMyOutboxIRI)).Return(
+			[]vocab.ActivityStreamsFollow{testFollow}, nil)
+		// Run the test
+		follows, err := a.FollowRequests(ctx, mustParse(testMyOutboxIRI))
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, len(follows), 1)
+		assertEqual(t, follows[0], testFollow)
+	})
+	t.Run("ApproveSendsAccept", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, fd, a := setupFn(ctl)
+		accept := streams.NewActivityStreamsAccept()
+		fd.EXPECT().ResolveFollowRequest(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI), true).Return(
+			accept, nil)
+		delegate.EXPECT().AddNewIDs(ctx, accept).Return(nil)
+		delegate.EXPECT().PostOutbox(ctx, accept, mustParse(testMyOutboxIRI), gomock.Any()).Return(true, nil)
+		delegate.EXPECT().Deliver(ctx, mustParse(testMyOutboxIRI), accept).Return(nil)
+		// Run the test
+		got, err := a.ApproveFollowRequest(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI))
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, got, accept)
+	})
+	t.Run("RejectSendsReject", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, fd, a := setupFn(ctl)
+		reject := streams.NewActivityStreamsReject()
+		fd.EXPECT().ResolveFollowRequest(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI), false).Return(
+			reject, nil)
+		delegate.EXPECT().AddNewIDs(ctx, reject).Return(nil)
+		delegate.EXPECT().PostOutbox(ctx, reject, mustParse(testMyOutboxIRI), gomock.Any()).Return(true, nil)
+		delegate.EXPECT().Deliver(ctx, mustParse(testMyOutboxIRI), reject).Return(nil)
+		// Run the test
+		got, err := a.RejectFollowRequest(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI))
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, got, reject)
+	})
+	t.Run("DoesNotSendIfNotPending", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, fd, a := setupFn(ctl)
+		fd.EXPECT().ResolveFollowRequest(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI), true).Return(
+			nil, ErrNotFound)
+		// Run the test
+		_, err := a.ApproveFollowRequest(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI))
+		// Verify results
+		assertEqual(t, err, ErrNotFound)
+	})
+}
+
+// relayDelegateActor is a mock DelegateActor that also implements the optional
+// RelayDelegateActor interface.
+type relayDelegateActor struct {
+	*MockDelegateActor
+	*MockRelayDelegateActor
+}
+
+func TestBaseActorFollowRelay(t *testing.T) {
+	// Set up test case
+	setupData()
+	ctx := context.Background()
+	// Run tests
+	t.Run("ErrorsWithoutRelayDelegate", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		a := NewCustomActor(
+			NewMockDelegateActor(ctl),
+			/*enableSocialProtocol=*/ false,
+			/*enableFederatedProtocol=*/ true,
+			NewMockClock(ctl))
+		// Run the test
+		_, err := a.FollowRelay(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActorIRI))
+		// Verify results
+		assertNotEqual(t, err, nil)
+	})
+	t.Run("SendsFollow", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate := NewMockDelegateActor(ctl)
+		rd := NewMockRelayDelegateActor(ctl)
+		a := NewCustomActor(
+			relayDelegateActor{delegate, rd},
+			/*enableSocialProtocol=*/ false,
+			/*enableFederatedProtocol=*/ true,
+			NewMockClock(ctl))
+		follow := streams.NewActivityStreamsFollow()
+		rd.EXPECT().NewRelayFollow(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActorIRI)).Return(
+			follow, nil)
+		delegate.EXPECT().AddNewIDs(ctx, follow).Return(nil)
+		delegate.EXPECT().PostOutbox(ctx, follow, mustParse(testMyOutboxIRI), gomock.Any()).Return(true, nil)
+		delegate.EXPECT().Deliver(ctx, mustParse(testMyOutboxIRI), follow).Return(nil)
+		// Run the test
+		got, err := a.FollowRelay(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActorIRI))
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, got, follow)
+	})
+}
+
+func TestBaseActorReports(t *testing.T) {
+	// Set up test case
+	setupData()
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (delegate *MockDelegateActor, rd *MockReportsDelegateActor, a FederatingActor) {
+		delegate = NewMockDelegateActor(ctl)
+		rd = NewMockReportsDelegateActor(ctl)
+		a = NewCustomActor(
+			reportsDelegateActor{delegate, rd},
+			/*enableSocialProtocol=*/ false,
+			/*enableFederatedProtocol=*/ true,
+			NewMockClock(ctl))
+		return
+	}
+	// Run tests
+	t.Run("ErrorsWithoutReportsDelegate", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		a := NewCustomActor(
+			NewMockDelegateActor(ctl),
+			/*enableSocialProtocol=*/ false,
+			/*enableFederatedProtocol=*/ true,
+			NewMockClock(ctl))
+		// Run the test
+		_, err := a.Reports(ctx, mustParse(testMyOutboxIRI))
+		_, sendErr := a.SendReport(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActorIRI2), nil, "")
+		// Verify results
+		assertNotEqual(t, err, nil)
+		assertNotEqual(t, sendErr, nil)
+	})
+	t.Run("ResolvesReport", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, rd, a := setupFn(ctl)
+		f := newTestFlag()
+		rd.EXPECT().ResolveReport(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI)).Return(f, nil)
+		// Run the test
+		got, err := a.ResolveReport(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI))
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, got, f)
+	})
+	t.Run("SendReportSendsFlag", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, rd, a := setupFn(ctl)
+		objects := []*url.URL{mustParse(testFederatedActorIRI)}
+		flag := streams.NewActivityStreamsFlag()
+		rd.EXPECT().NewReport(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActorIRI2), objects, "spam").Return(
+			flag, nil)
+		delegate.EXPECT().AddNewIDs(ctx, flag).Return(nil)
+		delegate.EXPECT().PostOutbox(ctx, flag, mustParse(testMyOutboxIRI), gomock.Any()).Return(true, nil)
+		delegate.EXPECT().Deliver(ctx, mustParse(testMyOutboxIRI), flag).Return(nil)
+		// Run the test
+		got, err := a.SendReport(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActorIRI2), objects, "spam")
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, got, flag)
+	})
+}
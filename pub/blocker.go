@@ -0,0 +1,88 @@
+package pub
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// Blocker is a ready implementation of the Blocked method of the
+// FederatingProtocol. A FederatingProtocol may simply call it:
+//
+//	func (p *myProtocol) Blocked(c context.Context, actorIRIs []*url.URL) (bool, error) {
+//		return p.blocker.Blocked(c, actorIRIs)
+//	}
+//
+// Actors are blocked when their domain is on the instance-level blocklist, or
+// when the local actor owning the inbox has blocked them. The latter requires
+// the Database to implement BlockedDatabase.
+type Blocker struct {
+	db      Database
+	domains []string
+}
+
+// NewBlocker creates a Blocker with the instance-level blocklist of domains.
+//
+// A domain starting with "*." blocks all of its subdomains, at any depth, but
+// not the domain itself. For example, "*.example.com" blocks
+// "social.example.com" and "a.b.example.com" but not "example.com". Other
+// domains only block the exact host.
+func NewBlocker(db Database, domains []string) *Blocker {
+	b := &Blocker{db: db}
+	for _, d := range domains {
+		b.domains = append(b.domains, strings.ToLower(strings.TrimSuffix(d, ".")))
+	}
+	return b
+}
+
+// Blocked determines whether any of the actors is blocked, by domain or by the
+// local actor owning the inbox given by InboxIRI. Activities posted to the
+// shared inbox are only checked against the domain blocklist here; their
+// recipients that blocked the actors are left out when fanning out instead.
+func (b *Blocker) Blocked(c context.Context, actorIRIs []*url.URL) (blocked bool, err error) {
+	for _, actorIRI := range actorIRIs {
+		if b.BlocksDomain(actorIRI.Hostname()) {
+			return true, nil
+		}
+	}
+	bdb, ok := b.db.(BlockedDatabase)
+	if !ok {
+		return false, nil
+	}
+	inboxIRI, ok := InboxIRI(c)
+	if !ok {
+		return false, nil
+	}
+	err = b.db.Lock(c, inboxIRI)
+	if err != nil {
+		return
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := b.db.ActorForInbox(c, inboxIRI)
+	b.db.Unlock(c, inboxIRI)
+	if err != nil {
+		return
+	}
+	// Unlock must be called by now and every branch above.
+	err = b.db.Lock(c, actorIRI)
+	if err != nil {
+		return
+	}
+	defer b.db.Unlock(c, actorIRI)
+	return hasBlocked(c, bdb, actorIRI, actorIRIs)
+}
+
+// BlocksDomain determines whether the host is on the instance-level blocklist.
+func (b *Blocker) BlocksDomain(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, d := range b.domains {
+		if strings.HasPrefix(d, "*.") {
+			if strings.HasSuffix(host, d[1:]) {
+				return true
+			}
+		} else if host == d {
+			return true
+		}
+	}
+	return false
+}
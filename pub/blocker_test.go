@@ -0,0 +1,75 @@
+package pub
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestBlocker(t *testing.T) {
+	ctx := context.Background()
+	inboxCtx := context.WithValue(ctx, inboxIRIKey{}, mustParse(testMyInboxIRI))
+	t.Run("BlocksDomains", func(t *testing.T) {
+		b := NewBlocker(nil, []string{"blocked.example", "*.Wildcard.example"})
+		assertEqual(t, b.BlocksDomain("blocked.example"), true)
+		assertEqual(t, b.BlocksDomain("BLOCKED.example."), true)
+		assertEqual(t, b.BlocksDomain("sub.blocked.example"), false)
+		assertEqual(t, b.BlocksDomain("sub.wildcard.example"), true)
+		assertEqual(t, b.BlocksDomain("a.b.wildcard.example"), true)
+		assertEqual(t, b.BlocksDomain("wildcard.example"), false)
+		assertEqual(t, b.BlocksDomain("notwildcard.example"), false)
+	})
+	t.Run("BlocksActorsOfBlockedDomain", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := NewMockDatabase(ctl)
+		b := NewBlocker(db, []string{"*.example.com"})
+		blocked, err := b.Blocked(inboxCtx, []*url.URL{mustParse(testFederatedActorIRI), mustParse(testPersonIRI)})
+		assertEqual(t, err, nil)
+		assertEqual(t, blocked, true)
+	})
+	t.Run("BlocksActorsBlockedByInboxOwner", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := NewMockDatabase(ctl)
+		bdb := NewMockBlockedDatabase(ctl)
+		b := NewBlocker(blockedDatabase{db, bdb}, nil)
+		db.EXPECT().Lock(inboxCtx, mustParse(testMyInboxIRI))
+		db.EXPECT().ActorForInbox(inboxCtx, mustParse(testMyInboxIRI)).Return(mustParse(testPersonIRI), nil)
+		db.EXPECT().Unlock(inboxCtx, mustParse(testMyInboxIRI))
+		db.EXPECT().Lock(inboxCtx, mustParse(testPersonIRI))
+		bdb.EXPECT().Blocked(inboxCtx, mustParse(testPersonIRI)).Return(newBlockedCollection(testFederatedActorIRI2), nil)
+		db.EXPECT().Unlock(inboxCtx, mustParse(testPersonIRI))
+		blocked, err := b.Blocked(inboxCtx, []*url.URL{mustParse(testFederatedActorIRI), mustParse(testFederatedActorIRI2)})
+		assertEqual(t, err, nil)
+		assertEqual(t, blocked, true)
+	})
+	t.Run("PermitsActorsNotBlocked", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := NewMockDatabase(ctl)
+		bdb := NewMockBlockedDatabase(ctl)
+		b := NewBlocker(blockedDatabase{db, bdb}, []string{"blocked.example"})
+		db.EXPECT().Lock(inboxCtx, mustParse(testMyInboxIRI))
+		db.EXPECT().ActorForInbox(inboxCtx, mustParse(testMyInboxIRI)).Return(mustParse(testPersonIRI), nil)
+		db.EXPECT().Unlock(inboxCtx, mustParse(testMyInboxIRI))
+		db.EXPECT().Lock(inboxCtx, mustParse(testPersonIRI))
+		bdb.EXPECT().Blocked(inboxCtx, mustParse(testPersonIRI)).Return(newBlockedCollection(testFederatedActorIRI2), nil)
+		db.EXPECT().Unlock(inboxCtx, mustParse(testPersonIRI))
+		blocked, err := b.Blocked(inboxCtx, []*url.URL{mustParse(testFederatedActorIRI)})
+		assertEqual(t, err, nil)
+		assertEqual(t, blocked, false)
+	})
+	t.Run("OnlyChecksDomainsWithoutInbox", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := NewMockDatabase(ctl)
+		bdb := NewMockBlockedDatabase(ctl)
+		b := NewBlocker(blockedDatabase{db, bdb}, nil)
+		blocked, err := b.Blocked(ctx, []*url.URL{mustParse(testFederatedActorIRI)})
+		assertEqual(t, err, nil)
+		assertEqual(t, blocked, false)
+	})
+}
@@ -137,3 +137,230 @@ type Database interface {
 	// The library makes this call only after acquiring a lock first.
 	Liked(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error)
 }
+
+// CollectionDatabase is an optional interface a Database may implement to
+// modify a Collection or OrderedCollection one item at a time.
+//
+// Without it, the library reads the entire inbox, outbox, or other collection,
+// modifies it in memory, and writes the entire collection back. This becomes
+// expensive for collections with many items. When the Database given to the
+// library also implements CollectionDatabase, these methods are used instead.
+//
+// The collection IRI given is the id of an inbox, outbox, the target of an
+// Add or Remove, an actor's followers, following, or liked collection, or the
+// IRI of an object's likes or shares collection.
+type CollectionDatabase interface {
+	// PrependToCollection adds the id to the front of the 'items' or
+	// 'orderedItems' of the collection at the specified IRI. The new
+	// item must not be added as an independent database entry. Separate
+	// calls to Create will do that.
+	//
+	// The library makes this call only after acquiring a lock first.
+	PrependToCollection(c context.Context, collectionIRI, id *url.URL) error
+	// AppendToCollection adds the id to the end of the 'items' or
+	// 'orderedItems' of the collection at the specified IRI.
+	//
+	// The library makes this call only after acquiring a lock first.
+	AppendToCollection(c context.Context, collectionIRI, id *url.URL) error
+	// RemoveFromCollection removes all occurrences of the id from the
+	// 'items' or 'orderedItems' of the collection at the specified IRI.
+	// It does not delete the database entry for the id.
+	//
+	// The library makes this call only after acquiring a lock first.
+	RemoveFromCollection(c context.Context, collectionIRI, id *url.URL) error
+}
+
+// TransactionalDatabase is an optional interface a Database may implement so
+// that the side effects of handling a single activity are applied atomically.
+//
+// When the Database given to the library also implements
+// TransactionalDatabase, the library begins a transaction before adding an
+// activity to an inbox or outbox and applying its side effects, and before
+// inbox forwarding. All Database calls for that work are made with a context
+// derived from the one returned by Begin. If any step fails the transaction is
+// rolled back, otherwise it is committed. For example, receiving a Follow that
+// is automatically accepted either adds the Follow to the inbox, updates the
+// followers collection, and adds the Accept to the outbox, or does none of
+// these. Activities delivered to peers during that work, such as the Accept,
+// are only sent once the transaction is committed.
+//
+// The library continues to call Lock and Unlock within a transaction. Since
+// the transaction already isolates its work, implementations are encouraged
+// to treat Lock and Unlock as no-ops for a context returned by Begin. This
+// also prevents deadlocks when multiple entries are locked at once.
+type TransactionalDatabase interface {
+	// Begin starts a new transaction, returning a context that carries it.
+	//
+	// A context derived from the returned one is passed to every Database
+	// call that is part of the transaction. The returned context is then
+	// passed to exactly one call of either Commit or Rollback.
+	Begin(c context.Context) (tx context.Context, err error)
+	// Commit applies the transaction carried by the context.
+	Commit(tx context.Context) error
+	// Rollback discards the transaction carried by the context.
+	Rollback(tx context.Context) error
+}
+
+// FollowRequestsDatabase is an optional interface a Database may implement to
+// store the Follow requests awaiting approval by an actor. It is required when
+// using OnFollowManuallyApprove.
+//
+// The collection of Follow requests is not expected to be served to peers.
+type FollowRequestsDatabase interface {
+	// FollowRequests obtains the Follow requests awaiting approval by the
+	// actor. The 'items' of the collection are the Follow activities.
+	//
+	// If the actor has no pending Follow requests, an empty collection is
+	// returned.
+	//
+	// The library makes this call only after acquiring a lock first.
+	FollowRequests(c context.Context, actorIRI *url.URL) (followRequests vocab.ActivityStreamsCollection, err error)
+	// SetFollowRequests saves the Follow requests awaiting approval by the
+	// actor.
+	//
+	// The library makes this call only after acquiring a lock first.
+	SetFollowRequests(c context.Context, actorIRI *url.URL, followRequests vocab.ActivityStreamsCollection) error
+}
+
+// ActorDeletionDatabase is an optional interface a Database may implement to
+// have the data referring to a peer actor cleaned up when the actor deletes
+// itself.
+type ActorDeletionDatabase interface {
+	// ActorReferences finds the data on this server that refers to the
+	// actor.
+	//
+	// The library makes this call only after acquiring a lock first.
+	ActorReferences(c context.Context, actorIRI *url.URL) (refs ActorReferences, err error)
+}
+
+// ActorReferences lists the data on this server that refers to a peer actor.
+type ActorReferences struct {
+	// Followed are the local actors whose followers collection contains
+	// the actor.
+	Followed []*url.URL
+	// Following are the local actors whose following collection contains
+	// the actor.
+	Following []*url.URL
+	// Objects are the ids of the stored objects attributed to the actor.
+	Objects []*url.URL
+	// Likes are the actor's Likes in the likes collections of local
+	// objects.
+	Likes []ActivityReference
+	// Shares are the actor's Announces in the shares collections of local
+	// objects.
+	Shares []ActivityReference
+}
+
+// ActivityReference identifies an activity in a collection of an object, such
+// as a Like in the object's likes collection.
+type ActivityReference struct {
+	// Object is the id of the object.
+	Object *url.URL
+	// Activity is the id of the activity.
+	Activity *url.URL
+}
+
+// BlockedDatabase is an optional interface a Database may implement to keep
+// the actors blocked by each local actor. The library then maintains these
+// collections when a local actor sends a Block, or an Undo of one, and a
+// Blocker consults them.
+type BlockedDatabase interface {
+	// Blocked obtains the collection of the actors blocked by the local
+	// actor. It is not federated.
+	//
+	// If the actor has not blocked anyone, an empty collection is returned.
+	//
+	// The library makes this call only after acquiring a lock first.
+	Blocked(c context.Context, actorIRI *url.URL) (blocked vocab.ActivityStreamsCollection, err error)
+	// SetBlocked saves the collection of the actors blocked by the local
+	// actor.
+	//
+	// The library makes this call only after acquiring a lock first.
+	SetBlocked(c context.Context, actorIRI *url.URL, blocked vocab.ActivityStreamsCollection) error
+}
+
+// ReportsDatabase is an optional interface a Database may implement to keep a
+// moderation queue of the Flags received by each local actor, typically the
+// instance actor that peers send their reports to.
+type ReportsDatabase interface {
+	// Reports obtains the collection of the Flags received by the local
+	// actor that are awaiting moderation. The Flags are embedded in the
+	// collection's items. It is not federated.
+	//
+	// If there are none, an empty collection is returned.
+	//
+	// The library makes this call only after acquiring a lock first.
+	Reports(c context.Context, actorIRI *url.URL) (reports vocab.ActivityStreamsCollection, err error)
+	// SetReports saves the collection of the Flags awaiting moderation by
+	// the local actor.
+	//
+	// The library makes this call only after acquiring a lock first.
+	SetReports(c context.Context, actorIRI *url.URL, reports vocab.ActivityStreamsCollection) error
+}
+
+// VotesDatabase is an optional interface a Database may implement to tally the
+// votes peers cast on the Questions of local actors.
+type VotesDatabase interface {
+	// Votes obtains the collection of the votes cast on the local
+	// Question. The vote Notes are embedded in the collection's items. It
+	// is not federated, so that who voted for which option stays private.
+	//
+	// If there are none, an empty collection is returned.
+	//
+	// The library makes this call only after acquiring a lock first.
+	Votes(c context.Context, questionIRI *url.URL) (votes vocab.ActivityStreamsCollection, err error)
+	// SetVotes saves the collection of the votes cast on the local
+	// Question.
+	//
+	// The library makes this call only after acquiring a lock first.
+	SetVotes(c context.Context, questionIRI *url.URL, votes vocab.ActivityStreamsCollection) error
+}
+
+// RSVP enumerates the responses of actors to an Event.
+type RSVP int
+
+const (
+	// RSVPGoing is the response of actors that Accepted or Joined the
+	// Event.
+	RSVPGoing RSVP = iota
+	// RSVPInterested is the response of actors that TentativeAccepted the
+	// Event.
+	RSVPInterested
+	// RSVPDeclined is the response of actors that Rejected the Event.
+	RSVPDeclined
+)
+
+// EventsDatabase is an optional interface a Database may implement to keep the
+// attendance of the Events on this server, as actors respond to them or to
+// Invites to them.
+type EventsDatabase interface {
+	// Attendees obtains the collection of the actors that gave the
+	// response to the local Event. The actors are IRIs in the collection's
+	// items.
+	//
+	// If there are none, an empty collection is returned.
+	//
+	// The library makes this call only after acquiring a lock first.
+	Attendees(c context.Context, eventIRI *url.URL, rsvp RSVP) (attendees vocab.ActivityStreamsCollection, err error)
+	// SetAttendees saves the collection of the actors that gave the
+	// response to the local Event.
+	//
+	// The library makes this call only after acquiring a lock first.
+	SetAttendees(c context.Context, eventIRI *url.URL, rsvp RSVP, attendees vocab.ActivityStreamsCollection) error
+}
+
+// FollowingDatabase is an optional interface a Database may implement to find
+// the local actors following a peer actor. The shared inbox then also delivers
+// the peer's activities to them, when the activity is public or addresses the
+// peer's followers.
+//
+// The library adds a peer actor to the following collection of a local actor
+// when the peer accepts its Follow, so implementations may keep an index of the
+// following collections to answer it.
+type FollowingDatabase interface {
+	// LocalFollowers returns the IRIs of the actors on this server whose
+	// following collection contains the peer actor.
+	//
+	// The library makes this call only after acquiring a lock first.
+	LocalFollowers(c context.Context, actorIRI *url.URL) (followers []*url.URL, err error)
+}
@@ -246,3 +246,68 @@ type DelegateActor interface {
 	// API is enabled.
 	GetInbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error)
 }
+
+// SharedInboxDelegateActor is an optional interface a DelegateActor may
+// implement to support receiving activities in a server-wide shared inbox.
+//
+// The DelegateActor provided by NewFederatingActor and NewActor implements it.
+type SharedInboxDelegateActor interface {
+	// SharedInboxRecipients determines the inboxes of the actors on this
+	// server that an activity POSTed to the shared inbox is for. Each of
+	// them then has PostInbox and InboxForwarding called for it.
+	//
+	// Returns no inboxes if the activity has already been received, so
+	// that it is only processed once.
+	SharedInboxRecipients(c context.Context, activity Activity) (inboxIRIs []*url.URL, err error)
+}
+
+// FollowRequestsDelegateActor is an optional interface a DelegateActor may
+// implement to support approving Follow requests manually.
+//
+// The DelegateActor provided by NewFederatingActor and NewActor implements it,
+// relying on the Database implementing FollowRequestsDatabase.
+type FollowRequestsDelegateActor interface {
+	// FollowRequests returns the Follow requests awaiting approval by the
+	// actor owning the outbox.
+	FollowRequests(c context.Context, outboxIRI *url.URL) (follows []vocab.ActivityStreamsFollow, err error)
+	// ResolveFollowRequest removes the Follow with the given id from the
+	// requests awaiting approval by the actor owning the outbox. When
+	// approved, the actors of the Follow are added to the actor's
+	// followers collection.
+	//
+	// Returns the Accept or Reject to send in response, which is then
+	// handled like an activity passed to Send. Returns ErrNotFound if the
+	// Follow is not awaiting approval.
+	ResolveFollowRequest(c context.Context, outboxIRI, followIRI *url.URL, approve bool) (response Activity, err error)
+}
+
+// ReportsDelegateActor is an optional interface a DelegateActor may implement to
+// support moderating the Flags received from peers and reporting to them.
+//
+// The DelegateActor provided by NewFederatingActor and NewActor implements it,
+// relying on the Database implementing ReportsDatabase.
+type ReportsDelegateActor interface {
+	// Reports returns the Flags awaiting moderation by the actor owning the
+	// outbox.
+	Reports(c context.Context, outboxIRI *url.URL) (reports []vocab.ActivityStreamsFlag, err error)
+	// ResolveReport removes the Flag with the given id from the ones
+	// awaiting moderation by the actor owning the outbox, and returns it.
+	//
+	// Returns ErrNotFound if the Flag is not awaiting moderation.
+	ResolveReport(c context.Context, outboxIRI, flagIRI *url.URL) (report vocab.ActivityStreamsFlag, err error)
+	// NewReport creates a Flag of the objects by the actor owning the
+	// outbox, addressed to the actor of a peer instance that receives its
+	// reports. The Flag is then handled like an activity passed to Send.
+	NewReport(c context.Context, outboxIRI, instanceActorIRI *url.URL, objects []*url.URL, content string) (report vocab.ActivityStreamsFlag, err error)
+}
+
+// RelayDelegateActor is an optional interface a DelegateActor may implement to
+// support subscribing to relays.
+//
+// The DelegateActor provided by NewFederatingActor and NewActor implements it.
+type RelayDelegateActor interface {
+	// NewRelayFollow creates a Follow of the peer relay by the actor
+	// owning the outbox. The Follow is then handled like an activity
+	// passed to Send.
+	NewRelayFollow(c context.Context, outboxIRI, relayIRI *url.URL) (follow vocab.ActivityStreamsFollow, err error)
+}
@@ -0,0 +1,225 @@
+package pub
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DeliveryLimits bounds the outbound deliveries made through a
+// DeliveryLimiter. Zero values mean no limit is applied.
+type DeliveryLimits struct {
+	// MaxConcurrent is the maximum number of deliveries in progress at
+	// once, across all hosts.
+	MaxConcurrent int
+	// MaxConcurrentPerHost is the maximum number of deliveries in progress
+	// at once to a single host.
+	MaxConcurrentPerHost int
+	// PerHostRate is the sustained number of deliveries per second started
+	// to a single host.
+	PerHostRate float64
+	// PerHostBurst is the number of deliveries to a single host that may
+	// be started at once before PerHostRate applies. Defaults to 1 when
+	// PerHostRate is set.
+	PerHostBurst int
+}
+
+// DeliveryLimiter limits the concurrency and rate of deliveries to peers.
+//
+// A single DeliveryLimiter is meant to be shared by all of the Transports of
+// an application, so that the limits apply to the application as a whole
+// instead of to each Transport separately. It is safe for concurrent use.
+type DeliveryLimiter struct {
+	limits DeliveryLimits
+	clock  Clock
+	// global has a buffer of MaxConcurrent, or is nil if unlimited.
+	global chan struct{}
+	// mu guards hosts and swept.
+	mu    sync.Mutex
+	hosts map[string]*hostLimiter
+	// swept is when the unused hostLimiters were last forgotten.
+	swept time.Time
+}
+
+// hostLimiter tracks the deliveries to a single host.
+type hostLimiter struct {
+	// sem has a buffer of MaxConcurrentPerHost, or is nil if unlimited.
+	sem chan struct{}
+	// tokens is the number of deliveries that may be started right away,
+	// as of last.
+	tokens float64
+	last   time.Time
+	// refs is the number of deliveries using this hostLimiter.
+	refs int
+}
+
+// NewDeliveryLimiter creates a DeliveryLimiter enforcing the limits, using the
+// clock to refill the per-host rate limits.
+func NewDeliveryLimiter(limits DeliveryLimits, clock Clock) *DeliveryLimiter {
+	if limits.PerHostRate > 0 && limits.PerHostBurst <= 0 {
+		limits.PerHostBurst = 1
+	}
+	l := &DeliveryLimiter{
+		limits: limits,
+		clock:  clock,
+		hosts:  make(map[string]*hostLimiter),
+	}
+	if limits.MaxConcurrent > 0 {
+		l.global = make(chan struct{}, limits.MaxConcurrent)
+	}
+	return l
+}
+
+// Acquire blocks until a delivery to the IRI is permitted by the limits or the
+// context is done. On success, the returned function must be called once the
+// delivery is complete.
+//
+// The per-host limits are waited on before the global limit, so that a slow
+// host does not occupy the global limit while waiting for its own.
+func (l *DeliveryLimiter) Acquire(c context.Context, to *url.URL) (release func(), err error) {
+	host := to.Host
+	h := l.host(host)
+	if err = l.take(c, h); err != nil {
+		l.releaseHost(host, h)
+		return
+	}
+	if h.sem != nil {
+		select {
+		case h.sem <- struct{}{}:
+		case <-c.Done():
+			l.releaseHost(host, h)
+			return nil, c.Err()
+		}
+	}
+	if l.global != nil {
+		select {
+		case l.global <- struct{}{}:
+		case <-c.Done():
+			if h.sem != nil {
+				<-h.sem
+			}
+			l.releaseHost(host, h)
+			return nil, c.Err()
+		}
+	}
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			if l.global != nil {
+				<-l.global
+			}
+			if h.sem != nil {
+				<-h.sem
+			}
+			l.releaseHost(host, h)
+		})
+	}
+	return
+}
+
+// host obtains the hostLimiter for the host, creating it if needed, and adds a
+// reference to it.
+func (l *DeliveryLimiter) host(host string) *hostLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep()
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostLimiter{
+			tokens: float64(l.limits.PerHostBurst),
+			last:   l.clock.Now(),
+		}
+		if l.limits.MaxConcurrentPerHost > 0 {
+			h.sem = make(chan struct{}, l.limits.MaxConcurrentPerHost)
+		}
+		l.hosts[host] = h
+	}
+	h.refs++
+	return h
+}
+
+// sweep forgets the unused hostLimiters whose rate limit has fully recovered,
+// which releaseHost leaves behind while they recover. It does so at most once
+// per the time an exhausted rate limit takes to recover.
+//
+// Must be called with mu held.
+func (l *DeliveryLimiter) sweep() {
+	if l.limits.PerHostRate <= 0 {
+		return
+	}
+	now := l.clock.Now()
+	recovery := time.Duration(float64(l.limits.PerHostBurst) / l.limits.PerHostRate * float64(time.Second))
+	if now.Sub(l.swept) < recovery {
+		return
+	}
+	l.swept = now
+	for host, h := range l.hosts {
+		if h.refs > 0 {
+			continue
+		}
+		l.refill(h)
+		if h.tokens >= float64(l.limits.PerHostBurst) {
+			delete(l.hosts, host)
+		}
+	}
+}
+
+// releaseHost drops a reference to the hostLimiter, forgetting it once it is
+// unused and its rate limit has fully recovered. Otherwise it is forgotten by
+// a later sweep.
+func (l *DeliveryLimiter) releaseHost(host string, h *hostLimiter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	h.refs--
+	if h.refs > 0 {
+		return
+	}
+	if l.limits.PerHostRate > 0 {
+		l.refill(h)
+		if h.tokens < float64(l.limits.PerHostBurst) {
+			return
+		}
+	}
+	delete(l.hosts, host)
+}
+
+// take blocks until the host's rate limit permits starting a delivery or the
+// context is done.
+func (l *DeliveryLimiter) take(c context.Context, h *hostLimiter) error {
+	if l.limits.PerHostRate <= 0 {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		l.refill(h)
+		if h.tokens >= 1 {
+			h.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - h.tokens) / l.limits.PerHostRate * float64(time.Second))
+		l.mu.Unlock()
+		t := time.NewTimer(wait)
+		select {
+		case <-c.Done():
+			t.Stop()
+			return c.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// refill adds the tokens accrued since they were last refilled.
+//
+// Must be called with mu held.
+func (l *DeliveryLimiter) refill(h *hostLimiter) {
+	now := l.clock.Now()
+	if elapsed := now.Sub(h.last); elapsed > 0 {
+		h.tokens += elapsed.Seconds() * l.limits.PerHostRate
+		if burst := float64(l.limits.PerHostBurst); h.tokens > burst {
+			h.tokens = burst
+		}
+	}
+	h.last = now
+}
@@ -0,0 +1,195 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+// manualClock is a Clock whose time only changes when advanced.
+type manualClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// Now returns the current time of the clock.
+func (m *manualClock) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.t
+}
+
+// Advance moves the clock forward.
+func (m *manualClock) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.t = m.t.Add(d)
+}
+
+// concurrencyClient is an HttpClient that records the most requests it has
+// had in progress at once, overall and per host.
+type concurrencyClient struct {
+	mu         sync.Mutex
+	delay      time.Duration
+	inFlight   int
+	perHost    map[string]int
+	max        int
+	maxPerHost map[string]int
+}
+
+// newConcurrencyClient creates a concurrencyClient that takes the delay to
+// respond to each request.
+func newConcurrencyClient(delay time.Duration) *concurrencyClient {
+	return &concurrencyClient{
+		delay:      delay,
+		perHost:    make(map[string]int),
+		maxPerHost: make(map[string]int),
+	}
+}
+
+// Do records the request while it is in progress and responds with OK.
+func (cc *concurrencyClient) Do(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	cc.mu.Lock()
+	cc.inFlight++
+	cc.perHost[host]++
+	if cc.inFlight > cc.max {
+		cc.max = cc.inFlight
+	}
+	if cc.perHost[host] > cc.maxPerHost[host] {
+		cc.maxPerHost[host] = cc.perHost[host]
+	}
+	cc.mu.Unlock()
+	time.Sleep(cc.delay)
+	cc.mu.Lock()
+	cc.inFlight--
+	cc.perHost[host]--
+	cc.mu.Unlock()
+	resp := httptest.NewRecorder()
+	resp.WriteHeader(http.StatusOK)
+	return resp.Result(), nil
+}
+
+func TestDeliveryLimiter(t *testing.T) {
+	ctx := context.Background()
+	to := mustParse(testFederatedInboxIRI)
+	t.Run("LimitsConcurrencyPerHost", func(t *testing.T) {
+		l := NewDeliveryLimiter(DeliveryLimits{MaxConcurrentPerHost: 1}, &manualClock{t: now()})
+		release, err := l.Acquire(ctx, to)
+		assertEqual(t, err, nil)
+		// Other hosts are not limited.
+		release2, err := l.Acquire(ctx, mustParse(testToIRI))
+		assertEqual(t, err, nil)
+		release2()
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = l.Acquire(cctx, to)
+		assertEqual(t, err, context.DeadlineExceeded)
+		release()
+		release, err = l.Acquire(ctx, to)
+		assertEqual(t, err, nil)
+		release()
+		assertEqual(t, len(l.hosts), 0)
+	})
+	t.Run("LimitsConcurrency", func(t *testing.T) {
+		l := NewDeliveryLimiter(DeliveryLimits{MaxConcurrent: 1}, &manualClock{t: now()})
+		release, err := l.Acquire(ctx, to)
+		assertEqual(t, err, nil)
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = l.Acquire(cctx, mustParse(testToIRI))
+		assertEqual(t, err, context.DeadlineExceeded)
+		release()
+		// Releasing twice has no effect.
+		release()
+		assertEqual(t, len(l.global), 0)
+	})
+	t.Run("LimitsRatePerHost", func(t *testing.T) {
+		clock := &manualClock{t: now()}
+		l := NewDeliveryLimiter(DeliveryLimits{PerHostRate: 1, PerHostBurst: 2}, clock)
+		for i := 0; i < 2; i++ {
+			release, err := l.Acquire(ctx, to)
+			assertEqual(t, err, nil)
+			release()
+		}
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err := l.Acquire(cctx, to)
+		assertEqual(t, err, context.DeadlineExceeded)
+		// Other hosts have their own rate.
+		release, err := l.Acquire(ctx, mustParse(testToIRI))
+		assertEqual(t, err, nil)
+		release()
+		clock.Advance(time.Second)
+		release, err = l.Acquire(ctx, to)
+		assertEqual(t, err, nil)
+		release()
+	})
+	t.Run("ForgetsIdleHosts", func(t *testing.T) {
+		clock := &manualClock{t: now()}
+		l := NewDeliveryLimiter(DeliveryLimits{PerHostRate: 1}, clock)
+		for _, iri := range []string{testFederatedInboxIRI, testToIRI} {
+			release, err := l.Acquire(ctx, mustParse(iri))
+			assertEqual(t, err, nil)
+			release()
+		}
+		// Their rate limits are still recovering.
+		assertEqual(t, len(l.hosts), 2)
+		clock.Advance(time.Second)
+		release, err := l.Acquire(ctx, mustParse(testKnownSharedInbox))
+		assertEqual(t, err, nil)
+		release()
+		assertEqual(t, len(l.hosts), 1)
+	})
+}
+
+func TestHttpSigTransportBatchDeliverWithLimiter(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	c := NewMockClock(ctl)
+	ps := NewMockSigner(ctl)
+	hc := newConcurrencyClient(5 * time.Millisecond)
+	l := NewDeliveryLimiter(DeliveryLimits{
+		MaxConcurrent:        4,
+		MaxConcurrentPerHost: 2,
+	}, c)
+	tp := NewHttpSigTransportWithLimiter(
+		hc,
+		testAppAgent,
+		c,
+		NewMockSigner(ctl),
+		ps,
+		testPubKeyId,
+		testPrivKey,
+		l)
+	var recipients []*url.URL
+	for i := 0; i < 10; i++ {
+		recipients = append(recipients, mustParse(fmt.Sprintf("https://one.example.com/%d/inbox", i)))
+		recipients = append(recipients, mustParse(fmt.Sprintf("https://two.example.com/%d/inbox", i)))
+		recipients = append(recipients, mustParse(fmt.Sprintf("https://three.example.com/%d/inbox", i)))
+	}
+	// Mock
+	c.EXPECT().Now().Return(now()).AnyTimes()
+	ps.EXPECT().SignRequest(testPrivKey, testPubKeyId, gomock.Any(), testRespBody).Times(len(recipients))
+	// Run
+	err := tp.BatchDeliver(ctx, testRespBody, recipients)
+	// Verify
+	assertEqual(t, err, nil)
+	if hc.max > 4 {
+		t.Errorf("expected at most 4 concurrent requests, got %d", hc.max)
+	}
+	for host, max := range hc.maxPerHost {
+		if max > 2 {
+			t.Errorf("expected at most 2 concurrent requests to %s, got %d", host, max)
+		}
+	}
+}
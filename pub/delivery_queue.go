@@ -0,0 +1,250 @@
+package pub
+
+import (
+	"context"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultInitialBackoff is the default delay before the first retry.
+	defaultInitialBackoff = time.Minute
+	// defaultMaxBackoff is the default upper bound of the delay between
+	// retries.
+	defaultMaxBackoff = 6 * time.Hour
+	// defaultHorizon is the default duration after which a delivery is
+	// abandoned.
+	defaultHorizon = 72 * time.Hour
+	// defaultJitter is the default fraction of randomness in each delay.
+	defaultJitter = 0.2
+	// defaultBatchSize is the default number of deliveries attempted at a
+	// time.
+	defaultBatchSize = 100
+	// defaultPollInterval is the default delay between checks for due
+	// deliveries.
+	defaultPollInterval = 10 * time.Second
+)
+
+// DeliveryPolicy determines how a DeliveryQueue retries deliveries. Zero
+// values are replaced with defaults.
+type DeliveryPolicy struct {
+	// InitialBackoff is the delay before the first retry. The delay
+	// doubles after every failed attempt. Defaults to one minute.
+	InitialBackoff time.Duration
+	// MaxBackoff is the upper bound of the delay between attempts.
+	// Defaults to six hours.
+	MaxBackoff time.Duration
+	// Jitter is the fraction of each delay that is randomized, between 0
+	// and 1, so that retries to a peer are spread out. Defaults to 0.2.
+	Jitter float64
+	// NoJitter disables the randomization of delays, ignoring Jitter, so
+	// that retries happen exactly after the backoff.
+	NoJitter bool
+	// Horizon is how long after it was first enqueued that a delivery is
+	// abandoned instead of retried. Defaults to 72 hours.
+	Horizon time.Duration
+	// BatchSize is the maximum number of deliveries attempted at once.
+	// Defaults to 100.
+	BatchSize int
+	// PollInterval is how often Run checks for due deliveries. Defaults
+	// to ten seconds.
+	PollInterval time.Duration
+}
+
+// withDefaults returns a copy of the policy with zero values replaced by the
+// defaults.
+func (p DeliveryPolicy) withDefaults() DeliveryPolicy {
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultMaxBackoff
+	}
+	if p.NoJitter {
+		p.Jitter = 0
+	} else if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = defaultJitter
+	}
+	if p.Horizon <= 0 {
+		p.Horizon = defaultHorizon
+	}
+	if p.BatchSize <= 0 {
+		p.BatchSize = defaultBatchSize
+	}
+	if p.PollInterval <= 0 {
+		p.PollInterval = defaultPollInterval
+	}
+	return p
+}
+
+// DeliveryQueuer is an optional interface a FederatingProtocol may implement
+// so that deliveries to peers are persisted and retried by a DeliveryQueue,
+// instead of being attempted only once while handling the request.
+type DeliveryQueuer interface {
+	// DeliveryQueue returns the queue to add deliveries to. If nil, the
+	// deliveries are attempted only once, immediately.
+	DeliveryQueue(c context.Context) *DeliveryQueue
+}
+
+// DeliveryQueue delivers activities to peers in the background, retrying
+// failed deliveries with exponential backoff. A delivery that fails with a
+// DeliveryError that is not Retryable is abandoned.
+//
+// Pending deliveries are kept in a DeliveryStore, so that they are attempted
+// again after a restart if the store is persistent. Applications must call
+// Run for deliveries to be attempted.
+type DeliveryQueue struct {
+	store  DeliveryStore
+	common CommonBehavior
+	clock  Clock
+	policy DeliveryPolicy
+	wake   chan struct{}
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+// NewDeliveryQueue creates a DeliveryQueue keeping pending deliveries in the
+// store.
+//
+// The CommonBehavior creates the Transport used for each attempt, on behalf of
+// the actor whose box is being delivered from.
+func NewDeliveryQueue(store DeliveryStore, common CommonBehavior, clock Clock, policy DeliveryPolicy) *DeliveryQueue {
+	return &DeliveryQueue{
+		store:  store,
+		common: common,
+		clock:  clock,
+		policy: policy.withDefaults(),
+		wake:   make(chan struct{}, 1),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Enqueue persists a delivery of the serialized activity to each of the
+// recipients, on behalf of the actor whose inbox or outbox is given. The
+// deliveries are attempted as soon as possible by Run.
+func (q *DeliveryQueue) Enqueue(c context.Context, boxIRI *url.URL, b []byte, recipients []*url.URL) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+	now := q.clock.Now()
+	deliveries := make([]*Delivery, 0, len(recipients))
+	for _, r := range recipients {
+		deliveries = append(deliveries, &Delivery{
+			BoxIRI:      boxIRI,
+			Recipient:   r,
+			Body:        b,
+			Created:     now,
+			NextAttempt: now,
+		})
+	}
+	if err := q.store.Enqueue(c, deliveries); err != nil {
+		return err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run attempts deliveries as they become due, until the context is done or
+// the DeliveryStore returns an error.
+//
+// Deliveries already in the store, such as those persisted before a restart,
+// are attempted first.
+func (q *DeliveryQueue) Run(c context.Context) error {
+	for {
+		if err := c.Err(); err != nil {
+			return err
+		}
+		n, err := q.deliverDue(c)
+		if err != nil {
+			return err
+		}
+		// Keep going while there is a backlog.
+		if n == q.policy.BatchSize {
+			continue
+		}
+		t := time.NewTimer(q.policy.PollInterval)
+		select {
+		case <-c.Done():
+			t.Stop()
+			return c.Err()
+		case <-q.wake:
+			t.Stop()
+		case <-t.C:
+		}
+	}
+}
+
+// deliverDue concurrently attempts one batch of due deliveries, returning the
+// number attempted.
+func (q *DeliveryQueue) deliverDue(c context.Context) (int, error) {
+	due, err := q.store.Due(c, q.clock.Now(), q.policy.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(due))
+	for _, d := range due {
+		wg.Add(1)
+		go func(d *Delivery) {
+			defer wg.Done()
+			if err := q.attempt(c, d); err != nil {
+				errCh <- err
+			}
+		}(d)
+	}
+	wg.Wait()
+	select {
+	case err = <-errCh:
+	default:
+	}
+	return len(due), err
+}
+
+// attempt makes a single attempt at the delivery, then removes it from the
+// store or schedules the next attempt. Deliveries that fail permanently are not
+// retried.
+func (q *DeliveryQueue) attempt(c context.Context, d *Delivery) error {
+	tp, err := q.common.NewTransport(c, d.BoxIRI, goFedUserAgent())
+	if err == nil {
+		err = tp.Deliver(c, d.Body, d.Recipient)
+	}
+	if err == nil {
+		return q.store.Remove(c, d.ID)
+	}
+	de, isDeliveryErr := err.(*DeliveryError)
+	if isDeliveryErr && !de.Retryable() {
+		return q.store.Remove(c, d.ID)
+	}
+	now := q.clock.Now()
+	d.Attempts++
+	d.LastError = err.Error()
+	d.NextAttempt = now.Add(q.backoff(d.Attempts))
+	if isDeliveryErr && de.RetryAfter.After(d.NextAttempt) {
+		d.NextAttempt = de.RetryAfter
+	}
+	if d.NextAttempt.Sub(d.Created) > q.policy.Horizon {
+		return q.store.Remove(c, d.ID)
+	}
+	return q.store.Update(c, d)
+}
+
+// backoff determines the randomized delay after the given number of failed
+// attempts.
+func (q *DeliveryQueue) backoff(attempts int) time.Duration {
+	delay := q.policy.MaxBackoff
+	if shift := uint(attempts - 1); shift < 32 {
+		if d := q.policy.InitialBackoff << shift; d > 0 && d < delay {
+			delay = d
+		}
+	}
+	q.randMu.Lock()
+	f := q.rand.Float64()
+	q.randMu.Unlock()
+	// Scale the delay by a random factor in [1-Jitter, 1+Jitter).
+	return time.Duration(float64(delay) * (1 - q.policy.Jitter + 2*q.policy.Jitter*f))
+}
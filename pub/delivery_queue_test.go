@@ -0,0 +1,246 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+// queuedFederatingProtocol is a mock FederatingProtocol that also implements
+// the optional DeliveryQueuer interface.
+type queuedFederatingProtocol struct {
+	*MockFederatingProtocol
+	q *DeliveryQueue
+}
+
+// DeliveryQueue returns the queue.
+func (q queuedFederatingProtocol) DeliveryQueue(c context.Context) *DeliveryQueue {
+	return q.q
+}
+
+func TestDeliveryQueue(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (q *DeliveryQueue, store *MemoryDeliveryStore, cm *MockCommonBehavior, cl *MockClock, tp *MockTransport) {
+		store = NewMemoryDeliveryStore()
+		cm = NewMockCommonBehavior(ctl)
+		cl = NewMockClock(ctl)
+		tp = NewMockTransport(ctl)
+		q = NewDeliveryQueue(store, cm, cl, DeliveryPolicy{
+			InitialBackoff: time.Minute,
+			MaxBackoff:     time.Hour,
+			Jitter:         0.5,
+			Horizon:        24 * time.Hour,
+		})
+		return
+	}
+	recipients := []*url.URL{mustParse(testFederatedInboxIRI), mustParse(testFederatedInboxIRI2)}
+	t.Run("RemovesSuccessfulDeliveries", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		q, store, cm, cl, tp := setupFn(ctl)
+		cl.EXPECT().Now().Return(now()).AnyTimes()
+		cm.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(tp, nil).Times(2)
+		tp.EXPECT().Deliver(ctx, testRespBody, mustParse(testFederatedInboxIRI))
+		tp.EXPECT().Deliver(ctx, testRespBody, mustParse(testFederatedInboxIRI2))
+		// Run
+		err := q.Enqueue(ctx, mustParse(testMyOutboxIRI), testRespBody, recipients)
+		assertEqual(t, err, nil)
+		n, err := q.deliverDue(ctx)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, n, 2)
+		assertEqual(t, store.Len(), 0)
+	})
+	t.Run("RetriesWithBackoff", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		q, store, cm, cl, tp := setupFn(ctl)
+		start := now()
+		cl.EXPECT().Now().Return(start).AnyTimes()
+		cm.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Deliver(ctx, testRespBody, mustParse(testFederatedInboxIRI)).Return(fmt.Errorf("test error"))
+		// Run
+		err := q.Enqueue(ctx, mustParse(testMyOutboxIRI), testRespBody, recipients[:1])
+		assertEqual(t, err, nil)
+		_, err = q.deliverDue(ctx)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, store.Len(), 1)
+		due, err := store.Due(ctx, start.Add(2*time.Minute), 10)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(due), 1)
+		assertEqual(t, due[0].Attempts, 1)
+		assertEqual(t, due[0].LastError, "test error")
+		delay := due[0].NextAttempt.Sub(start)
+		if delay < 30*time.Second || delay >= 90*time.Second {
+			t.Fatalf("unexpected backoff: %s", delay)
+		}
+		// Not due before its next attempt.
+		n, err := q.deliverDue(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, n, 0)
+	})
+	t.Run("HonorsRetryAfter", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		q, store, cm, cl, tp := setupFn(ctl)
+		start := now()
+		retry := start.Add(3 * time.Hour)
+		cl.EXPECT().Now().Return(start).AnyTimes()
+		cm.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Deliver(ctx, testRespBody, mustParse(testFederatedInboxIRI)).Return(&DeliveryError{
+			Recipient:  mustParse(testFederatedInboxIRI),
+			StatusCode: http.StatusTooManyRequests,
+			RetryAfter: retry,
+		})
+		// Run
+		err := q.Enqueue(ctx, mustParse(testMyOutboxIRI), testRespBody, recipients[:1])
+		assertEqual(t, err, nil)
+		_, err = q.deliverDue(ctx)
+		// Verify
+		assertEqual(t, err, nil)
+		due, err := store.Due(ctx, retry, 10)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(due), 1)
+		assertEqual(t, due[0].NextAttempt.Equal(retry), true)
+	})
+	t.Run("AbandonsPermanentFailures", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		q, store, cm, cl, tp := setupFn(ctl)
+		cl.EXPECT().Now().Return(now()).AnyTimes()
+		cm.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Deliver(ctx, testRespBody, mustParse(testFederatedInboxIRI)).Return(&DeliveryError{
+			Recipient:  mustParse(testFederatedInboxIRI),
+			StatusCode: http.StatusGone,
+		})
+		// Run
+		err := q.Enqueue(ctx, mustParse(testMyOutboxIRI), testRespBody, recipients[:1])
+		assertEqual(t, err, nil)
+		_, err = q.deliverDue(ctx)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, store.Len(), 0)
+	})
+	t.Run("AbandonsAfterHorizon", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		q, store, cm, cl, tp := setupFn(ctl)
+		start := now()
+		gomock.InOrder(
+			cl.EXPECT().Now().Return(start),
+			cl.EXPECT().Now().Return(start.Add(24*time.Hour)).AnyTimes(),
+		)
+		cm.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Deliver(ctx, testRespBody, mustParse(testFederatedInboxIRI)).Return(fmt.Errorf("test error"))
+		// Run
+		err := q.Enqueue(ctx, mustParse(testMyOutboxIRI), testRespBody, recipients[:1])
+		assertEqual(t, err, nil)
+		_, err = q.deliverDue(ctx)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, store.Len(), 0)
+	})
+	t.Run("RunDeliversEnqueued", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		q, store, cm, cl, tp := setupFn(ctl)
+		cctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		cl.EXPECT().Now().Return(now()).AnyTimes()
+		cm.EXPECT().NewTransport(cctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(tp, nil)
+		delivered := make(chan struct{})
+		tp.EXPECT().Deliver(cctx, testRespBody, mustParse(testFederatedInboxIRI)).Do(
+			func(c context.Context, b []byte, to *url.URL) {
+				close(delivered)
+			})
+		done := make(chan error)
+		go func() {
+			done <- q.Run(cctx)
+		}()
+		// Run
+		err := q.Enqueue(ctx, mustParse(testMyOutboxIRI), testRespBody, recipients[:1])
+		assertEqual(t, err, nil)
+		// Verify
+		select {
+		case <-delivered:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("delivery was not attempted")
+		}
+		cancel()
+		assertEqual(t, <-done, context.Canceled)
+		assertEqual(t, store.Len(), 0)
+	})
+}
+
+func TestDeliveryQueueBackoff(t *testing.T) {
+	q := NewDeliveryQueue(nil, nil, nil, DeliveryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Jitter:         0.1,
+	})
+	for attempts, expect := range map[int]time.Duration{
+		1:   time.Second,
+		2:   2 * time.Second,
+		6:   32 * time.Second,
+		7:   time.Minute,
+		100: time.Minute,
+	} {
+		d := q.backoff(attempts)
+		if d < expect*9/10 || d >= expect*11/10 {
+			t.Errorf("backoff after %d attempts: expected about %s, got %s", attempts, expect, d)
+		}
+	}
+}
+
+func TestDeliveryQueueBackoffWithoutJitter(t *testing.T) {
+	q := NewDeliveryQueue(nil, nil, nil, DeliveryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		NoJitter:       true,
+	})
+	for attempts, expect := range map[int]time.Duration{
+		1: time.Second,
+		3: 4 * time.Second,
+		7: time.Minute,
+	} {
+		if d := q.backoff(attempts); d != expect {
+			t.Errorf("backoff after %d attempts: expected %s, got %s", attempts, expect, d)
+		}
+	}
+}
+
+func TestDeliverToRecipientsEnqueues(t *testing.T) {
+	// Setup
+	ctx := context.Background()
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	setupData()
+	cm := NewMockCommonBehavior(ctl)
+	cl := NewMockClock(ctl)
+	store := NewMemoryDeliveryStore()
+	q := NewDeliveryQueue(store, cm, cl, DeliveryPolicy{})
+	a := &sideEffectActor{
+		common: cm,
+		s2s:    queuedFederatingProtocol{NewMockFederatingProtocol(ctl), q},
+		db:     NewMockDatabase(ctl),
+		clock:  cl,
+	}
+	cl.EXPECT().Now().Return(now())
+	// Run
+	err := a.deliverToRecipients(ctx, mustParse(testMyOutboxIRI), testListen, []*url.URL{mustParse(testFederatedInboxIRI)})
+	// Verify
+	assertEqual(t, err, nil)
+	assertEqual(t, store.Len(), 1)
+}
@@ -0,0 +1,126 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Delivery is a pending delivery of an activity to a single recipient.
+type Delivery struct {
+	// ID uniquely identifies the delivery within a DeliveryStore. It is
+	// assigned by the DeliveryStore when the delivery is enqueued.
+	ID string
+	// BoxIRI is the inbox or outbox of the actor on whose behalf the
+	// activity is delivered. It is used to create the Transport.
+	BoxIRI *url.URL
+	// Recipient is the inbox IRI the activity is delivered to.
+	Recipient *url.URL
+	// Body is the serialized activity.
+	Body []byte
+	// Created is when the delivery was first enqueued.
+	Created time.Time
+	// Attempts is the number of failed attempts made so far.
+	Attempts int
+	// NextAttempt is the earliest time the delivery is next attempted.
+	NextAttempt time.Time
+	// LastError describes the failure of the most recent attempt.
+	LastError string
+}
+
+// DeliveryStore persists pending deliveries for a DeliveryQueue.
+//
+// Deliveries that are persisted outside of the process are retried after the
+// process restarts.
+type DeliveryStore interface {
+	// Enqueue saves new deliveries, assigning each of them a unique ID.
+	Enqueue(c context.Context, deliveries []*Delivery) error
+	// Due returns at most n deliveries whose NextAttempt is not after the
+	// given time, with the earliest NextAttempt first.
+	Due(c context.Context, now time.Time, n int) ([]*Delivery, error)
+	// Update saves the Attempts, NextAttempt, and LastError of a delivery
+	// that failed and will be retried.
+	Update(c context.Context, d *Delivery) error
+	// Remove deletes a delivery that succeeded or was abandoned.
+	Remove(c context.Context, id string) error
+}
+
+// DeliveryStore must be implemented by MemoryDeliveryStore.
+var _ DeliveryStore = &MemoryDeliveryStore{}
+
+// MemoryDeliveryStore is a DeliveryStore that keeps pending deliveries in
+// memory. They are lost when the process exits.
+type MemoryDeliveryStore struct {
+	mu         sync.Mutex
+	deliveries map[string]Delivery
+	nextID     uint64
+}
+
+// NewMemoryDeliveryStore creates an empty MemoryDeliveryStore.
+func NewMemoryDeliveryStore() *MemoryDeliveryStore {
+	return &MemoryDeliveryStore{
+		deliveries: make(map[string]Delivery),
+	}
+}
+
+// Enqueue saves copies of the deliveries.
+func (m *MemoryDeliveryStore) Enqueue(c context.Context, deliveries []*Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range deliveries {
+		m.nextID++
+		d.ID = strconv.FormatUint(m.nextID, 10)
+		m.deliveries[d.ID] = *d
+	}
+	return nil
+}
+
+// Due returns copies of the deliveries that are due.
+func (m *MemoryDeliveryStore) Due(c context.Context, now time.Time, n int) ([]*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []*Delivery
+	for _, d := range m.deliveries {
+		if !d.NextAttempt.After(now) {
+			d := d
+			due = append(due, &d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttempt.Before(due[j].NextAttempt)
+	})
+	if len(due) > n {
+		due = due[:n]
+	}
+	return due, nil
+}
+
+// Update saves a copy of the delivery.
+func (m *MemoryDeliveryStore) Update(c context.Context, d *Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.deliveries[d.ID]; !ok {
+		return fmt.Errorf("no delivery with id %s", d.ID)
+	}
+	m.deliveries[d.ID] = *d
+	return nil
+}
+
+// Remove deletes the delivery.
+func (m *MemoryDeliveryStore) Remove(c context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.deliveries, id)
+	return nil
+}
+
+// Len returns the number of pending deliveries.
+func (m *MemoryDeliveryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.deliveries)
+}
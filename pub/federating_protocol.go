@@ -122,3 +122,124 @@ type FederatingProtocol interface {
 	// API is enabled.
 	GetInbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error)
 }
+
+// SharedInboxDirectory is an optional interface a FederatingProtocol may
+// implement to have activities addressed to the Public collection delivered to
+// every sharedInbox it knows of, as permitted by the specification.
+//
+// Without it, public activities are only delivered to their explicit
+// recipients.
+type SharedInboxDirectory interface {
+	// KnownSharedInboxes returns the sharedInbox IRIs of peer servers that
+	// a public activity sent from the outbox is delivered to.
+	KnownSharedInboxes(c context.Context, outboxIRI *url.URL) ([]*url.URL, error)
+}
+
+// ActivityProofSigner is an optional interface a FederatingProtocol may
+// implement to embed proofs in the activities sent from its outboxes, such as
+// with AddEddsaJcs2022Proof or AddRsaSignature2017. Peers are then able to
+// authenticate the activities when they are forwarded by another server.
+//
+// Activities forwarded from an inbox are not signed.
+type ActivityProofSigner interface {
+	// SignActivity adds proofs to the serialized activity, on behalf of
+	// the actor of the outbox.
+	SignActivity(c context.Context, outboxIRI *url.URL, activity map[string]interface{}) error
+}
+
+// ProofAuthenticator is an optional interface a FederatingProtocol may
+// implement to trust the proofs embedded in the activities posted to its
+// inboxes, such as those added by an ActivityProofSigner.
+//
+// When the request was not signed by an actor of the activity, as when another
+// server forwards it, an activity whose proof the ProofVerifier verifies is
+// handled as if the actor had signed the request: HttpSigKeyOwner returns the
+// actor in the context given to the rest of the FederatingProtocol and to the
+// callbacks. Otherwise the signer of the request is kept, and the activity is
+// authorized as before.
+type ProofAuthenticator interface {
+	// ProofVerifier returns the ProofVerifier of the activities posted to
+	// inboxes. If nil, proofs are not verified.
+	ProofVerifier(c context.Context) *ProofVerifier
+}
+
+// OriginAuthorizer is an optional interface a FederatingProtocol may implement
+// to replace the default policy deciding which objects a federated Create,
+// Update, or Delete may modify.
+//
+// By default, the actors of the activity must share the origin of the object,
+// unless the object is the actor itself or is stored attributed to the actor.
+// When the request was authenticated by an HttpSigAuthenticator, the actors
+// must also share the origin of the signer.
+type OriginAuthorizer interface {
+	// AuthorizeOrigin determines whether the activity may create, update,
+	// or delete the object with the given id. The lock for the object is
+	// held when it is called.
+	//
+	// If authorized is false, the activity is rejected with a
+	// ForbiddenError and no side effects are applied for the object.
+	AuthorizeOrigin(c context.Context, activity Activity, objectId *url.URL) (authorized bool, err error)
+}
+
+// CollectionAuthorizer is an optional interface a FederatingProtocol may
+// implement to decide which peers may modify the collections on this server
+// with Add and Remove activities.
+//
+// By default, only the actors a collection is attributed to may modify it. An
+// owner grants other actors access by listing them in the collection's
+// 'attributedTo' as well. A collection without 'attributedTo' may only be
+// modified by the local actor having it as its followers, following, liked, or
+// featured collection.
+type CollectionAuthorizer interface {
+	// AuthorizeCollectionChange determines whether the Add or Remove
+	// activity may modify the collection with the given id. The lock for
+	// the collection is held when it is called.
+	//
+	// If authorized is false, the activity is rejected with a
+	// ForbiddenError and the collection is not modified.
+	AuthorizeCollectionChange(c context.Context, activity Activity, collectionId *url.URL) (authorized bool, err error)
+}
+
+// GroupModerator is an optional interface a FederatingProtocol may implement to
+// have the local actors that are Groups behave like forums, as described in
+// FEP-1b12. The followers of a Group are its members.
+//
+// A Create, Update, Delete, Like, or Dislike that a member addresses to the
+// Group is wrapped in an Announce by the Group and delivered to its followers.
+// A Join of the Group makes its actors members, and a Leave removes them.
+type GroupModerator interface {
+	// AcceptGroupActivity determines whether the Group announces the
+	// activity of one of its members to its followers.
+	//
+	// If accept is false, the activity is still received in the Group's
+	// inbox, but not redistributed.
+	AcceptGroupActivity(c context.Context, groupIRI *url.URL, activity Activity) (accept bool, err error)
+	// AcceptGroupMember determines whether the actor may Join the Group.
+	// The Join is answered with an Accept or a Reject accordingly.
+	AcceptGroupMember(c context.Context, groupIRI, actorIRI *url.URL) (accept bool, err error)
+}
+
+// Relay is an optional interface a FederatingProtocol may implement to take
+// part in relays, which redistribute public activities among the instances
+// subscribed to them.
+//
+// A local actor that is a relay accepts every Follow, of itself as done by
+// LitePub or of the Public collection as done by Mastodon. The objects of the
+// public Create or Announce activities it receives from the instances of its
+// followers are then announced by it, by id, to all of its followers.
+//
+// A local actor subscribes to a peer relay with FollowRelay. Once the relay
+// is in its following collection, the objects the relay announces to it are
+// fetched from their origin and stored when they are public.
+type Relay interface {
+	// IsRelay determines whether the actor is a relay: either a local
+	// actor that runs as one, or a peer relay that local actors subscribe
+	// to.
+	IsRelay(c context.Context, actorIRI *url.URL) (relay bool, err error)
+	// AcceptRelayActivity determines whether the local relay announces
+	// the public activity of one of its subscribers to the others.
+	//
+	// If accept is false, the activity is still received in the relay's
+	// inbox, but not redistributed.
+	AcceptRelayActivity(c context.Context, relayIRI *url.URL, activity Activity) (accept bool, err error)
+}
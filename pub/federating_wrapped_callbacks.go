@@ -23,6 +23,11 @@ const (
 	// OnFollowAutomaticallyAccept triggers the side effect of sending a
 	// Reject of this Follow request in response.
 	OnFollowAutomaticallyReject
+	// OnFollowManuallyApprove records the Follow request as awaiting
+	// approval, without sending a response. The Database must implement
+	// FollowRequestsDatabase. The request is later approved or rejected
+	// with the FederatingActor.
+	OnFollowManuallyApprove
 )
 
 // FederatingWrappedCallbacks lists the callback functions that already have
@@ -37,6 +42,18 @@ type FederatingWrappedCallbacks struct {
 	// 'object' property is created in the database.
 	//
 	// Create calls Create for each object in the federated Activity.
+	// Objects in reply to an object on this server are added to its
+	// 'replies' collection, which is created if absent.
+	//
+	// Objects that the actor may not create, by default those of another
+	// origin, cause a ForbiddenError. See OriginAuthorizer.
+	//
+	// If the Database is a VotesDatabase, a Note voting on a Question of
+	// the actor owning the inbox is tallied before it is created, and an
+	// Update of the Question is sent to its audience and voters. Votes on
+	// a closed Question, for an option it does not have, by an actor that
+	// already voted, or attributed to someone other than the actor of the
+	// Create and the signer of the request cause a ForbiddenError.
 	Create func(context.Context, vocab.ActivityStreamsCreate) error
 	// Update handles additional side effects for the Update ActivityStreams
 	// type, specific to the application using go-fed.
@@ -45,18 +62,34 @@ type FederatingWrappedCallbacks struct {
 	// 'object' property is updated in the database.
 	//
 	// Update calls Update on the federated entry from the database, with a
-	// new value.
+	// new value. Like Create, it is subject to the OriginAuthorizer policy.
 	Update func(context.Context, vocab.ActivityStreamsUpdate) error
 	// Delete handles additional side effects for the Delete ActivityStreams
 	// type, specific to the application using go-fed.
 	//
-	// Delete removes the federated entry from the database.
+	// Delete removes the federated entry from the database, unless the
+	// OriginAuthorizer policy forbids it. A deleted reply is also removed
+	// from the 'replies' collection of the object it was in reply to.
+	//
+	// When a peer actor deletes itself and the Database implements
+	// ActorDeletionDatabase, the actor is also removed from the followers
+	// and following collections of local actors, its Likes and Announces
+	// are removed from the likes and shares collections of local objects,
+	// and its stored objects are replaced with Tombstones.
 	Delete func(context.Context, vocab.ActivityStreamsDelete) error
+	// DeleteActor handles additional side effects when a peer actor deletes
+	// itself, specific to the application using go-fed, such as removing
+	// data the library does not know about. It is called before Delete.
+	DeleteActor func(c context.Context, a vocab.ActivityStreamsDelete, actorIRI *url.URL) error
+	// PurgeDeletedActorObjects deletes the stored objects of a peer actor
+	// that deleted itself, instead of replacing them with Tombstones.
+	PurgeDeletedActorObjects bool
 	// Follow handles additional side effects for the Follow ActivityStreams
 	// type, specific to the application using go-fed.
 	//
 	// The wrapping function can have one of several default behaviors,
-	// depending on the value of the OnFollow setting.
+	// depending on the value of the OnFollow setting. A local relay always
+	// accepts, as described by Relay.
 	Follow func(context.Context, vocab.ActivityStreamsFollow) error
 	// OnFollow determines what action to take for this particular callback
 	// if a Follow Activity is handled.
@@ -68,8 +101,20 @@ type FederatingWrappedCallbacks struct {
 	// 'Follow'. If so, then the 'actor' is added to the original 'actor's
 	// 'following' collection.
 	//
+	// If the Database implements EventsDatabase, the actors of an Accept
+	// of an Event on this server, or of an Invite to one, are recorded as
+	// going to it.
+	//
 	// Otherwise, no side effects are done by go-fed.
 	Accept func(context.Context, vocab.ActivityStreamsAccept) error
+	// TentativeAccept handles additional side effects for the
+	// TentativeAccept ActivityStreams type, specific to the application
+	// using go-fed.
+	//
+	// If the Database implements EventsDatabase, the actors of a
+	// TentativeAccept of an Event on this server, or of an Invite to one,
+	// are recorded as interested in it.
+	TentativeAccept func(context.Context, vocab.ActivityStreamsTentativeAccept) error
 	// Reject handles additional side effects for the Reject ActivityStreams
 	// type, specific to the application using go-fed.
 	//
@@ -77,20 +122,26 @@ type FederatingWrappedCallbacks struct {
 	// 'Reject' is in response to a 'Follow' then the client MUST NOT go
 	// forward with adding the 'actor' to the original 'actor's 'following'
 	// collection by the client application.
+	//
+	// If the Database implements EventsDatabase, the actors of a Reject of
+	// an Event on this server, or of an Invite to one, are recorded as
+	// having declined it.
 	Reject func(context.Context, vocab.ActivityStreamsReject) error
 	// Add handles additional side effects for the Add ActivityStreams
 	// type, specific to the application using go-fed.
 	//
 	// The wrapping function will add the 'object' IRIs to a specific
 	// 'target' collection if the 'target' collection(s) live on this
-	// server.
+	// server. By default, only the actors a collection is attributed to
+	// may add to it, otherwise a ForbiddenError is returned. See
+	// CollectionAuthorizer.
 	Add func(context.Context, vocab.ActivityStreamsAdd) error
 	// Remove handles additional side effects for the Remove ActivityStreams
 	// type, specific to the application using go-fed.
 	//
 	// The wrapping function will remove all 'object' IRIs from a specific
 	// 'target' collection if the 'target' collection(s) live on this
-	// server.
+	// server. It is authorized in the same manner as Add.
 	Remove func(context.Context, vocab.ActivityStreamsRemove) error
 	// Like handles additional side effects for the Like ActivityStreams
 	// type, specific to the application using go-fed.
@@ -102,7 +153,9 @@ type FederatingWrappedCallbacks struct {
 	// ActivityStreams type, specific to the application using go-fed.
 	//
 	// The wrapping function will add the activity to the "shares"
-	// collection on all 'object' targets owned by this server.
+	// collection on all 'object' targets owned by this server. If it is
+	// from a relay the actor subscribed to, the public objects it announces
+	// are fetched and stored, as described by Relay.
 	Announce func(context.Context, vocab.ActivityStreamsAnnounce) error
 	// Undo handles additional side effects for the Undo ActivityStreams
 	// type, specific to the application using go-fed.
@@ -112,8 +165,14 @@ type FederatingWrappedCallbacks struct {
 	// It enforces that the actors on the Undo must correspond to all of the
 	// 'object' actors in some manner.
 	//
+	// The wrapping function reverses the side effects it applies when
+	// receiving a Follow, Like, or Announce: the actors of an undone Follow
+	// of this actor are removed from its followers collection, and an
+	// undone Like or Announce is removed from the "likes" or "shares"
+	// collection of the 'object' targets owned by this server.
+	//
 	// It is expected that the application will implement the proper
-	// reversal of activities that are being undone.
+	// reversal of any other activities that are being undone.
 	Undo func(context.Context, vocab.ActivityStreamsUndo) error
 	// Block handles additional side effects for the Block ActivityStreams
 	// type, specific to the application using go-fed.
@@ -123,6 +182,47 @@ type FederatingWrappedCallbacks struct {
 	// received from a federated peer, as delivering Blocks explicitly
 	// deviates from the original ActivityPub specification.
 	Block func(context.Context, vocab.ActivityStreamsBlock) error
+	// Move handles additional side effects for the Move ActivityStreams
+	// type, specific to the application using go-fed.
+	//
+	// The wrapping function ensures the 'actor' moves itself, and that the
+	// 'target' actor lists the 'actor' in its 'alsoKnownAs' property. The
+	// moving actor must also share the origin of the signer of the request
+	// and list the 'target' in its 'movedTo' property. Otherwise a
+	// ForbiddenError is returned. If this actor follows the
+	// moving actor, it is removed from the 'following' collection and a
+	// Follow of the 'target' actor is sent in its place. The 'target' is
+	// added to 'following' once the Follow is accepted.
+	Move func(context.Context, vocab.ActivityStreamsMove) error
+	// Flag handles additional side effects for the Flag ActivityStreams
+	// type, specific to the application using go-fed.
+	//
+	// The wrapping function ensures every 'object' is on this server,
+	// otherwise a ForbiddenError is returned. If the Database implements
+	// ReportsDatabase, the Flag is then added to the moderation queue of
+	// this actor, to be listed and resolved with the FederatingActor.
+	Flag func(context.Context, vocab.ActivityStreamsFlag) error
+	// Join handles additional side effects for the Join ActivityStreams
+	// type, specific to the application using go-fed.
+	//
+	// If the FederatingProtocol is a GroupModerator and this actor is a
+	// Group, the wrapping function asks it whether to accept the actors
+	// of the Join as members. Accepted actors are added to the followers
+	// collection, and an Accept or Reject is sent in response.
+	//
+	// If the Database implements EventsDatabase, the actors of a Join of
+	// an Event on this server are recorded as going to it.
+	Join func(context.Context, vocab.ActivityStreamsJoin) error
+	// Leave handles additional side effects for the Leave ActivityStreams
+	// type, specific to the application using go-fed.
+	//
+	// If the FederatingProtocol is a GroupModerator and this actor is a
+	// Group, the wrapping function removes the actors of the Leave from
+	// its followers collection.
+	//
+	// If the Database implements EventsDatabase, the actors of a Leave of
+	// an Event on this server no longer attend it.
+	Leave func(context.Context, vocab.ActivityStreamsLeave) error
 
 	// Sidechannel data -- this is set at request handling time. These must
 	// be set before the callbacks are used.
@@ -138,6 +238,24 @@ type FederatingWrappedCallbacks struct {
 	deliver func(c context.Context, outboxIRI *url.URL, activity Activity) error
 	// newTransport creates a new Transport.
 	newTransport func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (t Transport, err error)
+	// clock is the server's clock.
+	clock Clock
+	// authorizeOrigin replaces the same-origin policy for the objects of
+	// Create, Update, and Delete activities, if set.
+	authorizeOrigin func(c context.Context, activity Activity, objectId *url.URL) (authorized bool, err error)
+	// authorizeCollectionChange replaces the collection owner policy for
+	// the targets of Add and Remove activities, if set.
+	authorizeCollectionChange func(c context.Context, activity Activity, collectionId *url.URL) (authorized bool, err error)
+	// acceptGroupMember decides whether an actor may Join a local Group,
+	// if set.
+	acceptGroupMember func(c context.Context, groupIRI, actorIRI *url.URL) (accept bool, err error)
+	// isRelay determines whether a local or peer actor is a relay, if
+	// set.
+	isRelay func(c context.Context, actorIRI *url.URL) (relay bool, err error)
+	// repeated is set when the activity came in the shared inbox and was
+	// already posted to the inbox of another local actor, which applied
+	// the side effects on its objects.
+	repeated bool
 }
 
 // callbacks returns the WrappedCallbacks members into a single interface slice
@@ -151,6 +269,7 @@ func (w FederatingWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 	enableDelete := true
 	enableFollow := true
 	enableAccept := true
+	enableTentativeAccept := true
 	enableReject := true
 	enableAdd := true
 	enableRemove := true
@@ -158,6 +277,10 @@ func (w FederatingWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 	enableAnnounce := true
 	enableUndo := true
 	enableBlock := true
+	enableMove := true
+	enableFlag := true
+	enableJoin := true
+	enableLeave := true
 	for _, fn := range fns {
 		switch fn.(type) {
 		default:
@@ -172,6 +295,8 @@ func (w FederatingWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 			enableFollow = false
 		case func(context.Context, vocab.ActivityStreamsAccept) error:
 			enableAccept = false
+		case func(context.Context, vocab.ActivityStreamsTentativeAccept) error:
+			enableTentativeAccept = false
 		case func(context.Context, vocab.ActivityStreamsReject) error:
 			enableReject = false
 		case func(context.Context, vocab.ActivityStreamsAdd) error:
@@ -186,6 +311,14 @@ func (w FederatingWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 			enableUndo = false
 		case func(context.Context, vocab.ActivityStreamsBlock) error:
 			enableBlock = false
+		case func(context.Context, vocab.ActivityStreamsMove) error:
+			enableMove = false
+		case func(context.Context, vocab.ActivityStreamsFlag) error:
+			enableFlag = false
+		case func(context.Context, vocab.ActivityStreamsJoin) error:
+			enableJoin = false
+		case func(context.Context, vocab.ActivityStreamsLeave) error:
+			enableLeave = false
 		}
 	}
 	if enableCreate {
@@ -203,6 +336,9 @@ func (w FederatingWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 	if enableAccept {
 		fns = append(fns, w.accept)
 	}
+	if enableTentativeAccept {
+		fns = append(fns, w.tentativeAccept)
+	}
 	if enableReject {
 		fns = append(fns, w.reject)
 	}
@@ -224,6 +360,18 @@ func (w FederatingWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 	if enableBlock {
 		fns = append(fns, w.block)
 	}
+	if enableMove {
+		fns = append(fns, w.move)
+	}
+	if enableFlag {
+		fns = append(fns, w.flag)
+	}
+	if enableJoin {
+		fns = append(fns, w.join)
+	}
+	if enableLeave {
+		fns = append(fns, w.leave)
+	}
 	return fns
 }
 
@@ -233,6 +381,7 @@ func (w FederatingWrappedCallbacks) create(c context.Context, a vocab.ActivitySt
 	if op == nil || op.Len() == 0 {
 		return ErrObjectRequired
 	}
+	var updates []vocab.ActivityStreamsUpdate
 	// Create anonymous loop function to be able to properly scope the defer
 	// for the database lock at each iteration.
 	loopFn := func(iter vocab.ActivityStreamsObjectPropertyIterator) error {
@@ -267,22 +416,187 @@ func (w FederatingWrappedCallbacks) create(c context.Context, a vocab.ActivitySt
 			return err
 		}
 		defer w.db.Unlock(c, id)
+		if err := w.mustBeAuthorizedByOrigin(c, a, id); err != nil {
+			return err
+		}
+		if vdb, ok := w.db.(VotesDatabase); ok {
+			update, err := w.tallyVote(c, vdb, a, t)
+			if err != nil {
+				return err
+			} else if update != nil {
+				updates = append(updates, update)
+			}
+		}
+		if w.repeated {
+			return nil
+		}
 		if err := w.db.Create(c, t); err != nil {
 			return err
 		}
-		return nil
+		return addToReplies(c, w.db, t)
 	}
 	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
 		if err := loopFn(iter); err != nil {
 			return err
 		}
 	}
+	if len(updates) > 0 {
+		if err := w.db.Lock(c, w.inboxIRI); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		outboxIRI, err := w.db.OutboxForInbox(c, w.inboxIRI)
+		if err != nil {
+			w.db.Unlock(c, w.inboxIRI)
+			return err
+		}
+		w.db.Unlock(c, w.inboxIRI)
+		// Unlock must be called by now and every branch above.
+		for _, update := range updates {
+			if err := w.addNewIds(c, update); err != nil {
+				return err
+			} else if err := w.deliver(c, outboxIRI, update); err != nil {
+				return err
+			}
+		}
+	}
 	if w.Create != nil {
 		return w.Create(c, a)
 	}
 	return nil
 }
 
+// tallyVote counts the value created by the activity if it is a vote on a
+// Question of the actor owning the inbox, and returns the Update of the
+// Question to send. The Update is nil if the value is not such a vote, or was
+// already counted. The caller must hold the lock for the value.
+func (w FederatingWrappedCallbacks) tallyVote(c context.Context, vdb VotesDatabase, a Activity, t vocab.Type) (vocab.ActivityStreamsUpdate, error) {
+	questionIRI, voterIRI, choice, err := voteOf(t)
+	if err != nil || questionIRI == nil {
+		return nil, err
+	}
+	voteIRI, err := GetId(t)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.db.Lock(c, w.inboxIRI); err != nil {
+		return nil, err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := w.db.ActorForInbox(c, w.inboxIRI)
+	w.db.Unlock(c, w.inboxIRI)
+	if err != nil {
+		return nil, err
+	}
+	// Unlock must be called by now and every branch above.
+	if err := w.db.Lock(c, questionIRI); err != nil {
+		return nil, err
+	}
+	defer w.db.Unlock(c, questionIRI)
+	if owns, err := w.db.Owns(c, questionIRI); err != nil || !owns {
+		return nil, err
+	}
+	qt, err := w.db.Get(c, questionIRI)
+	if err != nil {
+		return nil, err
+	}
+	q, ok := qt.(vocab.ActivityStreamsQuestion)
+	if !ok {
+		return nil, nil
+	}
+	authors, err := getAuthors(q)
+	if err != nil {
+		return nil, err
+	} else if !containsIRI(authors, actorIRI) {
+		// Another local actor tallies the votes on its own Question.
+		return nil, nil
+	}
+	// The voter must be the one creating the vote, or a peer could vote as
+	// any number of made-up actors.
+	if actors, err := activityActorIds(a); err != nil {
+		return nil, err
+	} else if !containsIRI(actors, voterIRI) {
+		return nil, &ForbiddenError{Object: voteIRI, Reason: "the vote is not attributed to an actor of the activity"}
+	}
+	if signer, signed := HttpSigKeyOwner(c); signed && signer.String() != voterIRI.String() {
+		return nil, &ForbiddenError{Object: voteIRI, Reason: fmt.Sprintf("the vote is not attributed to signer %s", signer)}
+	}
+	if questionIsClosed(q, w.clock.Now()) {
+		return nil, &ForbiddenError{Object: questionIRI, Reason: "the question is closed"}
+	}
+	option, anyOf := questionOption(q, choice)
+	if option == nil {
+		return nil, &ForbiddenError{Object: questionIRI, Reason: "the question has no such option"}
+	}
+	votes, err := vdb.Votes(c, questionIRI)
+	if err != nil {
+		return nil, err
+	}
+	items := votes.GetActivityStreamsItems()
+	if items == nil {
+		items = streams.NewActivityStreamsItemsProperty()
+		votes.SetActivityStreamsItems(items)
+	}
+	voters := []*url.URL{voterIRI}
+	for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+		vote := iter.GetType()
+		if vote == nil {
+			continue
+		}
+		id, err := GetId(vote)
+		if err != nil {
+			return nil, err
+		} else if id.String() == voteIRI.String() {
+			// The vote was delivered again.
+			return nil, nil
+		}
+		_, voter, votedChoice, err := voteOf(vote)
+		if err != nil {
+			return nil, err
+		} else if voter == nil {
+			continue
+		}
+		if voter.String() == voterIRI.String() && (!anyOf || votedChoice == choice) {
+			return nil, &ForbiddenError{Object: questionIRI, Reason: "the actor has already voted"}
+		}
+		if !containsIRI(voters, voter) {
+			voters = append(voters, voter)
+		}
+	}
+	if err := incrementRepliesCount(option); err != nil {
+		return nil, err
+	}
+	votersCount := streams.NewTootVotersCountProperty()
+	votersCount.Set(len(voters))
+	q.SetTootVotersCount(votersCount)
+	if err := items.AppendType(t); err != nil {
+		return nil, err
+	}
+	if err := vdb.SetVotes(c, questionIRI, votes); err != nil {
+		return nil, err
+	}
+	if err := w.db.Update(c, q); err != nil {
+		return nil, err
+	}
+	return newQuestionUpdate(actorIRI, q, voters), nil
+}
+
+// mustBeAuthorizedByOrigin ensures the activity may create, update, or delete
+// the object, using the FederatingProtocol's OriginAuthorizer if it has one.
+// The caller must hold the lock for the object.
+func (w FederatingWrappedCallbacks) mustBeAuthorizedByOrigin(c context.Context, a Activity, objId *url.URL) error {
+	if w.authorizeOrigin == nil {
+		return mustBeSameOriginAsObject(c, w.db, a, objId)
+	}
+	authorized, err := w.authorizeOrigin(c, a, objId)
+	if err != nil {
+		return err
+	} else if !authorized {
+		return &ForbiddenError{Object: objId, Reason: "not authorized by the OriginAuthorizer"}
+	}
+	return nil
+}
+
 // update implements the federating Update activity side effects.
 func (w FederatingWrappedCallbacks) update(c context.Context, a vocab.ActivityStreamsUpdate) error {
 	op := a.GetActivityStreamsObject()
@@ -308,10 +622,12 @@ func (w FederatingWrappedCallbacks) update(c context.Context, a vocab.ActivitySt
 			return err
 		}
 		defer w.db.Unlock(c, id)
-		if err := w.db.Update(c, t); err != nil {
+		if err := w.mustBeAuthorizedByOrigin(c, a, id); err != nil {
 			return err
+		} else if w.repeated {
+			return nil
 		}
-		return nil
+		return w.db.Update(c, t)
 	}
 	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
 		if err := loopFn(iter); err != nil {
@@ -333,6 +649,19 @@ func (w FederatingWrappedCallbacks) deleteFn(c context.Context, a vocab.Activity
 	if err := mustHaveActivityOriginMatchObjects(a); err != nil {
 		return err
 	}
+	// Note the actors of the Delete, to determine whether one deletes
+	// itself.
+	actorIds := make(map[string]bool)
+	if actors := a.GetActivityStreamsActor(); actors != nil {
+		for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+			id, err := ToId(iter)
+			if err != nil {
+				return err
+			}
+			actorIds[id.String()] = true
+		}
+	}
+	var deletedActors []*url.URL
 	// Create anonymous loop function to be able to properly scope the defer
 	// for the database lock at each iteration.
 	loopFn := func(iter vocab.ActivityStreamsObjectPropertyIterator) error {
@@ -345,9 +674,31 @@ func (w FederatingWrappedCallbacks) deleteFn(c context.Context, a vocab.Activity
 			return err
 		}
 		defer w.db.Unlock(c, id)
+		if err := w.mustBeAuthorizedByOrigin(c, a, id); err != nil {
+			return err
+		}
+		if actorIds[id.String()] {
+			deletedActors = append(deletedActors, id)
+		}
+		if w.repeated {
+			return nil
+		}
+		// Keep the object to remove it from the replies of the
+		// objects it is in reply to.
+		var t vocab.Type
+		if exists, err := w.db.Exists(c, id); err != nil {
+			return err
+		} else if exists {
+			if t, err = w.db.Get(c, id); err != nil {
+				return err
+			}
+		}
 		if err := w.db.Delete(c, id); err != nil {
 			return err
 		}
+		if t != nil {
+			return removeFromReplies(c, w.db, t)
+		}
 		return nil
 	}
 	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
@@ -355,12 +706,95 @@ func (w FederatingWrappedCallbacks) deleteFn(c context.Context, a vocab.Activity
 			return err
 		}
 	}
+	for _, actorIRI := range deletedActors {
+		if err := w.deleteActor(c, a, actorIRI); err != nil {
+			return err
+		}
+	}
 	if w.Delete != nil {
 		return w.Delete(c, a)
 	}
 	return nil
 }
 
+// deleteActor cleans up the data referring to a peer actor that deleted
+// itself, then calls the DeleteActor callback. The data is only cleaned up for
+// the first inbox the Delete is posted to.
+func (w FederatingWrappedCallbacks) deleteActor(c context.Context, a vocab.ActivityStreamsDelete, actorIRI *url.URL) error {
+	if adb, ok := w.db.(ActorDeletionDatabase); ok && !w.repeated {
+		if err := w.db.Lock(c, actorIRI); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		refs, err := adb.ActorReferences(c, actorIRI)
+		if err != nil {
+			w.db.Unlock(c, actorIRI)
+			return err
+		}
+		w.db.Unlock(c, actorIRI)
+		// Unlock must be called by now and every branch above.
+		for _, localIRI := range refs.Followed {
+			if err := w.removeFromLocalActor(c, localIRI, actorIRI, followersProperty, w.db.Followers); err != nil {
+				return err
+			}
+		}
+		for _, localIRI := range refs.Following {
+			if err := w.removeFromLocalActor(c, localIRI, actorIRI, followingProperty, w.db.Following); err != nil {
+				return err
+			}
+		}
+		for _, r := range refs.Likes {
+			if err := removeFromObjectCollection(c, w.db, r.Object, r.Activity, likesProperty); err != nil {
+				return err
+			}
+		}
+		for _, r := range refs.Shares {
+			if err := removeFromObjectCollection(c, w.db, r.Object, r.Activity, sharesProperty); err != nil {
+				return err
+			}
+		}
+		for _, id := range refs.Objects {
+			if err := w.deleteActorObject(c, id); err != nil {
+				return err
+			}
+		}
+	}
+	if w.DeleteActor != nil {
+		return w.DeleteActor(c, a, actorIRI)
+	}
+	return nil
+}
+
+// removeFromLocalActor removes a deleted actor from one of the collections of a
+// local actor, such as its followers.
+func (w FederatingWrappedCallbacks) removeFromLocalActor(c context.Context,
+	localIRI, actorIRI *url.URL,
+	prop func(t vocab.Type) IdProperty,
+	get func(c context.Context, actorIRI *url.URL) (vocab.ActivityStreamsCollection, error)) error {
+	if err := w.db.Lock(c, localIRI); err != nil {
+		return err
+	}
+	defer w.db.Unlock(c, localIRI)
+	return removeFromActorCollection(c, w.db, localIRI, []*url.URL{actorIRI}, prop, get)
+}
+
+// deleteActorObject replaces a stored object of a deleted actor with a
+// Tombstone, or deletes it if PurgeDeletedActorObjects is set.
+func (w FederatingWrappedCallbacks) deleteActorObject(c context.Context, id *url.URL) error {
+	if err := w.db.Lock(c, id); err != nil {
+		return err
+	}
+	defer w.db.Unlock(c, id)
+	if w.PurgeDeletedActorObjects {
+		return w.db.Delete(c, id)
+	}
+	t, err := w.db.Get(c, id)
+	if err != nil {
+		return err
+	}
+	return w.db.Update(c, toTombstone(t, id, w.clock.Now()))
+}
+
 // follow implements the federating Follow activity side effects.
 func (w FederatingWrappedCallbacks) follow(c context.Context, a vocab.ActivityStreamsFollow) error {
 	op := a.GetActivityStreamsObject()
@@ -383,51 +817,57 @@ func (w FederatingWrappedCallbacks) follow(c context.Context, a vocab.ActivitySt
 	}
 	w.db.Unlock(c, w.inboxIRI)
 	// Unlock must be called by now and every branch above.
+	// A relay accepts its subscribers automatically, including the
+	// Mastodon ones following the Public collection instead of the relay.
+	onFollow := w.OnFollow
+	relay := false
+	if w.isRelay != nil {
+		if relay, err = w.isRelay(c, actorIRI); err != nil {
+			return err
+		} else if relay {
+			onFollow = OnFollowAutomaticallyAccept
+		}
+	}
 	isMe := false
-	if w.OnFollow != OnFollowDoNothing {
+	if onFollow != OnFollowDoNothing {
 		for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
 			id, err := ToId(iter)
 			if err != nil {
 				return err
 			}
-			if id.String() == actorIRI.String() {
+			if id.String() == actorIRI.String() || relay && IsPublic(id.String()) {
 				isMe = true
 				break
 			}
 		}
 	}
-	if isMe {
+	if isMe && onFollow == OnFollowManuallyApprove {
+		// Record the Follow request so it can be approved or rejected
+		// later.
+		frdb, ok := w.db.(FollowRequestsDatabase)
+		if !ok {
+			return fmt.Errorf("OnFollowManuallyApprove requires a Database implementing FollowRequestsDatabase")
+		}
+		if err := w.db.Lock(c, actorIRI); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		if err := prependFollowRequest(c, frdb, actorIRI, a); err != nil {
+			w.db.Unlock(c, actorIRI)
+			return err
+		}
+		w.db.Unlock(c, actorIRI)
+		// Unlock must be called by now and every branch above.
+	} else if isMe {
 		// Prepare the response.
-		var response Activity
-		if w.OnFollow == OnFollowAutomaticallyAccept {
-			response = streams.NewActivityStreamsAccept()
-		} else if w.OnFollow == OnFollowAutomaticallyReject {
-			response = streams.NewActivityStreamsReject()
-		} else {
-			return fmt.Errorf("unknown OnFollowBehavior: %d", w.OnFollow)
-		}
-		// Set us as the 'actor'.
-		me := streams.NewActivityStreamsActorProperty()
-		response.SetActivityStreamsActor(me)
-		me.AppendIRI(actorIRI)
-		// Set the Follow as the 'object' property.
-		op := streams.NewActivityStreamsObjectProperty()
-		response.SetActivityStreamsObject(op)
-		op.AppendActivityStreamsFollow(a)
-		// Add all actors on the original Follow to the 'to' property.
-		recipients := make([]*url.URL, 0)
-		to := streams.NewActivityStreamsToProperty()
-		response.SetActivityStreamsTo(to)
-		followActors := a.GetActivityStreamsActor()
-		for iter := followActors.Begin(); iter != followActors.End(); iter = iter.Next() {
-			id, err := ToId(iter)
-			if err != nil {
-				return err
-			}
-			to.AppendIRI(id)
-			recipients = append(recipients, id)
+		if onFollow != OnFollowAutomaticallyAccept && onFollow != OnFollowAutomaticallyReject {
+			return fmt.Errorf("unknown OnFollowBehavior: %d", onFollow)
+		}
+		response, recipients, err := newResponse(onFollow == OnFollowAutomaticallyAccept, actorIRI, a)
+		if err != nil {
+			return err
 		}
-		if w.OnFollow == OnFollowAutomaticallyAccept {
+		if onFollow == OnFollowAutomaticallyAccept {
 			// If automatically accepting, then also update our
 			// followers collection with the new actors.
 			//
@@ -437,20 +877,7 @@ func (w FederatingWrappedCallbacks) follow(c context.Context, a vocab.ActivitySt
 				return err
 			}
 			// WARNING: Unlock not deferred.
-			followers, err := w.db.Followers(c, actorIRI)
-			if err != nil {
-				w.db.Unlock(c, actorIRI)
-				return err
-			}
-			items := followers.GetActivityStreamsItems()
-			if items == nil {
-				items = streams.NewActivityStreamsItemsProperty()
-				followers.SetActivityStreamsItems(items)
-			}
-			for _, elem := range recipients {
-				items.PrependIRI(elem)
-			}
-			if err = w.db.Update(c, followers); err != nil {
+			if err := prependToActorCollection(c, w.db, actorIRI, recipients, followersProperty, w.db.Followers); err != nil {
 				w.db.Unlock(c, actorIRI)
 				return err
 			}
@@ -629,29 +1056,19 @@ func (w FederatingWrappedCallbacks) accept(c context.Context, a vocab.ActivitySt
 				return err
 			}
 			// Add the peer to our following collection.
-			if err := w.db.Lock(c, actorIRI); err != nil {
-				return err
-			}
-			// WARNING: Unlock not deferred.
-			following, err := w.db.Following(c, actorIRI)
-			if err != nil {
-				w.db.Unlock(c, actorIRI)
-				return err
-			}
-			items := following.GetActivityStreamsItems()
-			if items == nil {
-				items = streams.NewActivityStreamsItemsProperty()
-				following.SetActivityStreamsItems(items)
-			}
+			peers := make([]*url.URL, 0, activityActors.Len())
 			for iter := activityActors.Begin(); iter != activityActors.End(); iter = iter.Next() {
 				id, err := ToId(iter)
 				if err != nil {
-					w.db.Unlock(c, actorIRI)
 					return err
 				}
-				items.PrependIRI(id)
+				peers = append(peers, id)
+			}
+			if err := w.db.Lock(c, actorIRI); err != nil {
+				return err
 			}
-			if err = w.db.Update(c, following); err != nil {
+			// WARNING: Unlock not deferred.
+			if err := prependToActorCollection(c, w.db, actorIRI, peers, followingProperty, w.db.Following); err != nil {
 				w.db.Unlock(c, actorIRI)
 				return err
 			}
@@ -659,14 +1076,32 @@ func (w FederatingWrappedCallbacks) accept(c context.Context, a vocab.ActivitySt
 			// Unlock must be called by now and every branch above.
 		}
 	}
+	if err := respondToEvents(c, w.db, a, RSVPGoing); err != nil {
+		return err
+	}
 	if w.Accept != nil {
 		return w.Accept(c, a)
 	}
 	return nil
 }
 
+// tentativeAccept implements the federating TentativeAccept activity side
+// effects.
+func (w FederatingWrappedCallbacks) tentativeAccept(c context.Context, a vocab.ActivityStreamsTentativeAccept) error {
+	if err := respondToEvents(c, w.db, a, RSVPInterested); err != nil {
+		return err
+	}
+	if w.TentativeAccept != nil {
+		return w.TentativeAccept(c, a)
+	}
+	return nil
+}
+
 // reject implements the federating Reject activity side effects.
 func (w FederatingWrappedCallbacks) reject(c context.Context, a vocab.ActivityStreamsReject) error {
+	if err := respondToEvents(c, w.db, a, RSVPDeclined); err != nil {
+		return err
+	}
 	if w.Reject != nil {
 		return w.Reject(c, a)
 	}
@@ -683,8 +1118,12 @@ func (w FederatingWrappedCallbacks) add(c context.Context, a vocab.ActivityStrea
 	if target == nil || target.Len() == 0 {
 		return ErrTargetRequired
 	}
-	if err := add(c, op, target, w.db); err != nil {
-		return err
+	if !w.repeated {
+		if err := add(c, op, target, w.db, func(c context.Context, collectionId *url.URL) error {
+			return w.mustBeAuthorizedToChangeCollection(c, a, collectionId)
+		}); err != nil {
+			return err
+		}
 	}
 	if w.Add != nil {
 		return w.Add(c, a)
@@ -702,8 +1141,12 @@ func (w FederatingWrappedCallbacks) remove(c context.Context, a vocab.ActivitySt
 	if target == nil || target.Len() == 0 {
 		return ErrTargetRequired
 	}
-	if err := remove(c, op, target, w.db); err != nil {
-		return err
+	if !w.repeated {
+		if err := remove(c, op, target, w.db, func(c context.Context, collectionId *url.URL) error {
+			return w.mustBeAuthorizedToChangeCollection(c, a, collectionId)
+		}); err != nil {
+			return err
+		}
 	}
 	if w.Remove != nil {
 		return w.Remove(c, a)
@@ -711,6 +1154,22 @@ func (w FederatingWrappedCallbacks) remove(c context.Context, a vocab.ActivitySt
 	return nil
 }
 
+// mustBeAuthorizedToChangeCollection ensures the Add or Remove may modify the
+// collection, using the FederatingProtocol's CollectionAuthorizer if it has
+// one. The caller must hold the lock for the collection.
+func (w FederatingWrappedCallbacks) mustBeAuthorizedToChangeCollection(c context.Context, a Activity, collectionId *url.URL) error {
+	if w.authorizeCollectionChange == nil {
+		return mustBeCollectionOwner(c, w.db, a, collectionId)
+	}
+	authorized, err := w.authorizeCollectionChange(c, a, collectionId)
+	if err != nil {
+		return err
+	} else if !authorized {
+		return &ForbiddenError{Object: collectionId, Reason: "not authorized by the CollectionAuthorizer"}
+	}
+	return nil
+}
+
 // like implements the federating Like activity side effects.
 func (w FederatingWrappedCallbacks) like(c context.Context, a vocab.ActivityStreamsLike) error {
 	op := a.GetActivityStreamsObject()
@@ -748,6 +1207,9 @@ func (w FederatingWrappedCallbacks) like(c context.Context, a vocab.ActivityStre
 		// Get 'likes' property on the object, creating default if
 		// necessary.
 		likes := l.GetActivityStreamsLikes()
+		if cdb, ok := w.db.(CollectionDatabase); ok && likes != nil && likes.IsIRI() {
+			return cdb.PrependToCollection(c, likes.GetIRI(), id)
+		}
 		if likes == nil {
 			likes = streams.NewActivityStreamsLikesProperty()
 			l.SetActivityStreamsLikes(likes)
@@ -784,9 +1246,11 @@ func (w FederatingWrappedCallbacks) like(c context.Context, a vocab.ActivityStre
 		}
 		return nil
 	}
-	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
-		if err := loopFn(iter); err != nil {
-			return err
+	if !w.repeated {
+		for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+			if err := loopFn(iter); err != nil {
+				return err
+			}
 		}
 	}
 	if w.Like != nil {
@@ -829,6 +1293,9 @@ func (w FederatingWrappedCallbacks) announce(c context.Context, a vocab.Activity
 		// Get 'shares' property on the object, creating default if
 		// necessary.
 		shares := s.GetActivityStreamsShares()
+		if cdb, ok := w.db.(CollectionDatabase); ok && shares != nil && shares.IsIRI() {
+			return cdb.PrependToCollection(c, shares.GetIRI(), id)
+		}
 		if shares == nil {
 			shares = streams.NewActivityStreamsSharesProperty()
 			s.SetActivityStreamsShares(shares)
@@ -865,36 +1332,259 @@ func (w FederatingWrappedCallbacks) announce(c context.Context, a vocab.Activity
 		}
 		return nil
 	}
-	if op != nil {
+	if op != nil && !w.repeated {
 		for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
 			if err := loopFn(iter); err != nil {
 				return err
 			}
 		}
 	}
+	// Whether the objects are stored depends on the actor of the inbox
+	// subscribing to the relay, so it is checked for each inbox.
+	if op != nil && w.isRelay != nil {
+		if err := w.storeRelayed(c, a); err != nil {
+			return err
+		}
+	}
 	if w.Announce != nil {
 		return w.Announce(c, a)
 	}
 	return nil
 }
 
-// undo implements the federating Undo activity side effects.
-func (w FederatingWrappedCallbacks) undo(c context.Context, a vocab.ActivityStreamsUndo) error {
-	op := a.GetActivityStreamsObject()
-	if op == nil || op.Len() == 0 {
-		return ErrObjectRequired
+// storeRelayed stores the objects of an Announce by a relay that the actor
+// owning this inbox subscribed to. The relay is not trusted with their
+// contents, so each object is fetched from its origin, and only stored if it
+// is new and public.
+func (w FederatingWrappedCallbacks) storeRelayed(c context.Context, a vocab.ActivityStreamsAnnounce) error {
+	if err := w.db.Lock(c, w.inboxIRI); err != nil {
+		return err
 	}
-	actors := a.GetActivityStreamsActor()
-	if err := mustHaveActivityActorsMatchObjectActors(c, actors, op, w.newTransport, w.inboxIRI); err != nil {
+	// WARNING: Unlock not deferred.
+	actorIRI, err := w.db.ActorForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
 		return err
 	}
-	if w.Undo != nil {
-		return w.Undo(c, a)
+	w.db.Unlock(c, w.inboxIRI)
+	// Unlock must be called by now and every branch above.
+	relayIRIs, err := activityActorIds(a)
+	if err != nil {
+		return err
 	}
-	return nil
-}
-
-// block implements the federating Block activity side effects.
+	subscribed := false
+	for _, relayIRI := range relayIRIs {
+		if subscribed, err = w.isSubscribedRelay(c, actorIRI, relayIRI); err != nil {
+			return err
+		} else if subscribed {
+			break
+		}
+	}
+	if !subscribed {
+		return nil
+	}
+	// Create anonymous loop function to be able to properly scope the defer
+	// for the database lock at each iteration.
+	loopFn := func(iter vocab.ActivityStreamsObjectPropertyIterator) error {
+		id, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		if err := w.db.Lock(c, id); err != nil {
+			return err
+		}
+		defer w.db.Unlock(c, id)
+		if exists, err := w.db.Exists(c, id); err != nil {
+			return err
+		} else if exists {
+			return nil
+		}
+		// Relays routinely announce objects that have since been
+		// deleted, or that cannot be fetched for other reasons. They
+		// are skipped rather than failing the whole Announce.
+		t, err := w.fetchRelayed(c, id)
+		if err != nil || t == nil {
+			return nil
+		}
+		return w.db.Create(c, t)
+	}
+	op := a.GetActivityStreamsObject()
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		if err := loopFn(iter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchRelayed fetches an object announced by a relay from its origin. Returns
+// nil if the origin serves it under another id, or if it is not public.
+func (w FederatingWrappedCallbacks) fetchRelayed(c context.Context, id *url.URL) (vocab.Type, error) {
+	tport, err := w.newTransport(c, w.inboxIRI, goFedUserAgent())
+	if err != nil {
+		return nil, err
+	}
+	b, err := tport.Dereference(c, id)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		return nil, err
+	}
+	// The origin must serve the object under the announced id.
+	if got, err := GetId(t); err != nil || got.String() != id.String() {
+		return nil, err
+	}
+	addressees, err := getVisibleAddressees(t)
+	if err != nil || !hasPublic(addressees) {
+		return nil, err
+	}
+	return t, nil
+}
+
+// isSubscribedRelay determines whether the peer is a relay that the local actor
+// follows.
+func (w FederatingWrappedCallbacks) isSubscribedRelay(c context.Context, actorIRI, relayIRI *url.URL) (bool, error) {
+	if relay, err := w.isRelay(c, relayIRI); err != nil || !relay {
+		return false, err
+	}
+	if err := w.db.Lock(c, actorIRI); err != nil {
+		return false, err
+	}
+	defer w.db.Unlock(c, actorIRI)
+	following, err := w.db.Following(c, actorIRI)
+	if err != nil {
+		return false, err
+	}
+	return collectionHasId(following, relayIRI)
+}
+
+// undo implements the federating Undo activity side effects.
+func (w FederatingWrappedCallbacks) undo(c context.Context, a vocab.ActivityStreamsUndo) error {
+	op := a.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		return ErrObjectRequired
+	}
+	actors := a.GetActivityStreamsActor()
+	undone, err := mustHaveActivityActorsMatchObjectActors(c, actors, op, w.newTransport, w.inboxIRI)
+	if err != nil {
+		return err
+	}
+	// Reverse the side effects of the undone activities that were applied
+	// when they were received.
+	for _, t := range undone {
+		activity, ok := t.(Activity)
+		if !ok {
+			continue
+		}
+		if streams.IsOrExtendsActivityStreamsFollow(t) {
+			err = w.undoFollow(c, activity)
+		} else if streams.IsOrExtendsActivityStreamsLike(t) {
+			err = w.undoObjectCollection(c, activity, likesProperty)
+		} else if streams.IsOrExtendsActivityStreamsAnnounce(t) {
+			err = w.undoObjectCollection(c, activity, sharesProperty)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if w.Undo != nil {
+		return w.Undo(c, a)
+	}
+	return nil
+}
+
+// undoFollow removes the actors of an undone Follow from the followers
+// collection, if the Follow was of the actor owning this inbox. If the Follow
+// is still awaiting approval, it is no longer pending.
+func (w FederatingWrappedCallbacks) undoFollow(c context.Context, follow Activity) error {
+	op := follow.GetActivityStreamsObject()
+	if op == nil {
+		return nil
+	}
+	if err := w.db.Lock(c, w.inboxIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := w.db.ActorForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
+		return err
+	}
+	w.db.Unlock(c, w.inboxIRI)
+	// Unlock must be called by now and every branch above.
+	isMe := false
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		id, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		if id.String() == actorIRI.String() {
+			isMe = true
+			break
+		}
+	}
+	if !isMe {
+		return nil
+	}
+	var followers []*url.URL
+	if actors := follow.GetActivityStreamsActor(); actors != nil {
+		for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+			id, err := ToId(iter)
+			if err != nil {
+				return err
+			}
+			followers = append(followers, id)
+		}
+	}
+	if err := w.db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	defer w.db.Unlock(c, actorIRI)
+	if frdb, ok := w.db.(FollowRequestsDatabase); ok {
+		followId, err := GetId(follow)
+		if err != nil {
+			return err
+		}
+		if _, err := removeFollowRequest(c, frdb, actorIRI, followId); err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+	if len(followers) == 0 {
+		return nil
+	}
+	return removeFromActorCollection(c, w.db, actorIRI, followers, followersProperty, w.db.Followers)
+}
+
+// undoObjectCollection removes an undone activity from the collection, such as
+// 'likes' or 'shares', of each of its 'object' values owned by this server.
+func (w FederatingWrappedCallbacks) undoObjectCollection(c context.Context, activity Activity, prop func(t vocab.Type) IdProperty) error {
+	op := activity.GetActivityStreamsObject()
+	if op == nil {
+		return nil
+	}
+	id, err := GetId(activity)
+	if err != nil {
+		return err
+	}
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		objId, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		if err := removeFromObjectCollection(c, w.db, objId, id, prop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// block implements the federating Block activity side effects.
 func (w FederatingWrappedCallbacks) block(c context.Context, a vocab.ActivityStreamsBlock) error {
 	op := a.GetActivityStreamsObject()
 	if op == nil || op.Len() == 0 {
@@ -905,3 +1595,289 @@ func (w FederatingWrappedCallbacks) block(c context.Context, a vocab.ActivityStr
 	}
 	return nil
 }
+
+// move implements the federating Move activity side effects.
+func (w FederatingWrappedCallbacks) move(c context.Context, a vocab.ActivityStreamsMove) error {
+	from, to, err := verifyMove(c, a, w.newTransport, w.inboxIRI)
+	if err != nil {
+		return err
+	}
+	// Unlike in the outbox, the actor of the Move is only as trustworthy
+	// as the signer of the request, and the move must be visible on the
+	// moving actor itself.
+	if signer, signed := HttpSigKeyOwner(c); signed && !sameOrigin(signer, from) {
+		return &ForbiddenError{
+			Object: from,
+			Reason: fmt.Sprintf("the moving actor does not share the origin of signer %s", signer),
+		}
+	}
+	if err := mustHaveMovedTo(c, from, to, w.newTransport, w.inboxIRI); err != nil {
+		return err
+	}
+	if err := w.db.Lock(c, w.inboxIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := w.db.ActorForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
+		return err
+	}
+	w.db.Unlock(c, w.inboxIRI)
+	// Unlock must be called by now and every branch above.
+	//
+	// Stop following the actor that moved, if we did.
+	if err := w.db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	following, err := w.db.Following(c, actorIRI)
+	if err != nil {
+		w.db.Unlock(c, actorIRI)
+		return err
+	}
+	isFollowing, err := collectionHasId(following, from)
+	if err != nil {
+		w.db.Unlock(c, actorIRI)
+		return err
+	}
+	if isFollowing {
+		if err := removeFromActorCollection(c, w.db, actorIRI, []*url.URL{from}, followingProperty, w.db.Following); err != nil {
+			w.db.Unlock(c, actorIRI)
+			return err
+		}
+	}
+	w.db.Unlock(c, actorIRI)
+	// Unlock must be called by now and every branch above.
+	if isFollowing {
+		// Follow the actor moved to instead. The Follow is kept so
+		// that its Accept can be verified.
+		follow := newFollow(actorIRI, to)
+		if err := w.addNewIds(c, follow); err != nil {
+			return err
+		}
+		followId, err := GetId(follow)
+		if err != nil {
+			return err
+		}
+		if err := w.db.Lock(c, followId); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		if err := w.db.Create(c, follow); err != nil {
+			w.db.Unlock(c, followId)
+			return err
+		}
+		w.db.Unlock(c, followId)
+		// Unlock must be called by now and every branch above.
+		if err := w.db.Lock(c, w.inboxIRI); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		outboxIRI, err := w.db.OutboxForInbox(c, w.inboxIRI)
+		if err != nil {
+			w.db.Unlock(c, w.inboxIRI)
+			return err
+		}
+		w.db.Unlock(c, w.inboxIRI)
+		// Unlock must be called by now and every branch above.
+		if err := w.deliver(c, outboxIRI, follow); err != nil {
+			return err
+		}
+	}
+	if w.Move != nil {
+		return w.Move(c, a)
+	}
+	return nil
+}
+
+// flag implements the federating Flag activity side effects.
+func (w FederatingWrappedCallbacks) flag(c context.Context, a vocab.ActivityStreamsFlag) error {
+	op := a.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		return ErrObjectRequired
+	}
+	// Only objects on this server may be reported to it.
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		id, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		if err := w.db.Lock(c, id); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		owns, err := w.db.Owns(c, id)
+		w.db.Unlock(c, id)
+		if err != nil {
+			return err
+		} else if !owns {
+			return &ForbiddenError{Object: id, Reason: "a reported object is not on this server"}
+		}
+		// Unlock must be called by now and every branch above.
+	}
+	if rdb, ok := w.db.(ReportsDatabase); ok {
+		if err := w.db.Lock(c, w.inboxIRI); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		actorIRI, err := w.db.ActorForInbox(c, w.inboxIRI)
+		if err != nil {
+			w.db.Unlock(c, w.inboxIRI)
+			return err
+		}
+		w.db.Unlock(c, w.inboxIRI)
+		// Unlock must be called by now and every branch above.
+		if err := w.db.Lock(c, actorIRI); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		if err := prependReport(c, rdb, actorIRI, a); err != nil {
+			w.db.Unlock(c, actorIRI)
+			return err
+		}
+		w.db.Unlock(c, actorIRI)
+		// Unlock must be called by now and every branch above.
+	}
+	if w.Flag != nil {
+		return w.Flag(c, a)
+	}
+	return nil
+}
+
+// join implements the federating Join activity side effects.
+func (w FederatingWrappedCallbacks) join(c context.Context, a vocab.ActivityStreamsJoin) error {
+	op := a.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		return ErrObjectRequired
+	}
+	if w.acceptGroupMember != nil {
+		groupIRI, err := w.joinedGroup(c, op)
+		if err != nil {
+			return err
+		} else if groupIRI != nil {
+			if err := w.joinGroup(c, a, groupIRI); err != nil {
+				return err
+			}
+		}
+	}
+	if err := respondToEvents(c, w.db, a, RSVPGoing); err != nil {
+		return err
+	}
+	if w.Join != nil {
+		return w.Join(c, a)
+	}
+	return nil
+}
+
+// joinGroup accepts or rejects the actors of the Join as members of the local
+// Group, and sends the response.
+func (w FederatingWrappedCallbacks) joinGroup(c context.Context, a vocab.ActivityStreamsJoin, groupIRI *url.URL) error {
+	members, err := activityActorIds(a)
+	if err != nil {
+		return err
+	}
+	accept := len(members) > 0
+	for _, member := range members {
+		if accept, err = w.acceptGroupMember(c, groupIRI, member); err != nil {
+			return err
+		} else if !accept {
+			break
+		}
+	}
+	response, _, err := newResponse(accept, groupIRI, a)
+	if err != nil {
+		return err
+	}
+	if accept {
+		if err := w.db.Lock(c, groupIRI); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		if err := prependToActorCollection(c, w.db, groupIRI, members, followersProperty, w.db.Followers); err != nil {
+			w.db.Unlock(c, groupIRI)
+			return err
+		}
+		w.db.Unlock(c, groupIRI)
+		// Unlock must be called by now and every branch above.
+	}
+	if err := w.db.Lock(c, w.inboxIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	outboxIRI, err := w.db.OutboxForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
+		return err
+	}
+	w.db.Unlock(c, w.inboxIRI)
+	// Unlock must be called by now and every branch above.
+	if err := w.addNewIds(c, response); err != nil {
+		return err
+	}
+	return w.deliver(c, outboxIRI, response)
+}
+
+// leave implements the federating Leave activity side effects.
+func (w FederatingWrappedCallbacks) leave(c context.Context, a vocab.ActivityStreamsLeave) error {
+	op := a.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		return ErrObjectRequired
+	}
+	if w.acceptGroupMember != nil {
+		groupIRI, err := w.joinedGroup(c, op)
+		if err != nil {
+			return err
+		} else if groupIRI != nil {
+			members, err := activityActorIds(a)
+			if err != nil {
+				return err
+			}
+			if err := w.db.Lock(c, groupIRI); err != nil {
+				return err
+			}
+			// WARNING: Unlock not deferred.
+			if err := removeFromActorCollection(c, w.db, groupIRI, members, followersProperty, w.db.Followers); err != nil {
+				w.db.Unlock(c, groupIRI)
+				return err
+			}
+			w.db.Unlock(c, groupIRI)
+			// Unlock must be called by now and every branch above.
+		}
+	}
+	if err := respondToEvents(c, w.db, a, noRSVP); err != nil {
+		return err
+	}
+	if w.Leave != nil {
+		return w.Leave(c, a)
+	}
+	return nil
+}
+
+// joinedGroup returns the id of the actor owning the inbox if it is a Group
+// among the objects of a Join or Leave, or nil otherwise.
+func (w FederatingWrappedCallbacks) joinedGroup(c context.Context, op vocab.ActivityStreamsObjectProperty) (*url.URL, error) {
+	if err := w.db.Lock(c, w.inboxIRI); err != nil {
+		return nil, err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := w.db.ActorForInbox(c, w.inboxIRI)
+	w.db.Unlock(c, w.inboxIRI)
+	if err != nil {
+		return nil, err
+	}
+	// Unlock must be called by now and every branch above.
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		id, err := ToId(iter)
+		if err != nil {
+			return nil, err
+		} else if id.String() != actorIRI.String() {
+			continue
+		}
+		if group, err := getGroup(c, w.db, actorIRI); err != nil || group == nil {
+			return nil, err
+		}
+		return actorIRI, nil
+	}
+	return nil, nil
+}
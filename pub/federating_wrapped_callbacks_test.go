@@ -2,8 +2,10 @@ package pub
 
 import (
 	"context"
+	"errors"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
@@ -221,6 +223,86 @@ func TestFederatedCallbacks(t *testing.T) {
 			t.Fatalf("could not find overridden function")
 		}
 	})
+	t.Run("OverridesJoin", func(t *testing.T) {
+		ok := false
+		o := func(context.Context, vocab.ActivityStreamsJoin) error {
+			ok = true
+			return nil
+		}
+		var w FederatingWrappedCallbacks
+		for _, f := range w.callbacks([]interface{}{o}) {
+			if fn, ok := f.(func(context.Context, vocab.ActivityStreamsJoin) error); ok {
+				fn(nil, nil)
+			}
+		}
+		if !ok {
+			t.Fatalf("could not find overridden function")
+		}
+	})
+	t.Run("OverridesLeave", func(t *testing.T) {
+		ok := false
+		o := func(context.Context, vocab.ActivityStreamsLeave) error {
+			ok = true
+			return nil
+		}
+		var w FederatingWrappedCallbacks
+		for _, f := range w.callbacks([]interface{}{o}) {
+			if fn, ok := f.(func(context.Context, vocab.ActivityStreamsLeave) error); ok {
+				fn(nil, nil)
+			}
+		}
+		if !ok {
+			t.Fatalf("could not find overridden function")
+		}
+	})
+	t.Run("OverridesTentativeAccept", func(t *testing.T) {
+		ok := false
+		o := func(context.Context, vocab.ActivityStreamsTentativeAccept) error {
+			ok = true
+			return nil
+		}
+		var w FederatingWrappedCallbacks
+		for _, f := range w.callbacks([]interface{}{o}) {
+			if fn, ok := f.(func(context.Context, vocab.ActivityStreamsTentativeAccept) error); ok {
+				fn(nil, nil)
+			}
+		}
+		if !ok {
+			t.Fatalf("could not find overridden function")
+		}
+	})
+	t.Run("OverridesFlag", func(t *testing.T) {
+		ok := false
+		o := func(context.Context, vocab.ActivityStreamsFlag) error {
+			ok = true
+			return nil
+		}
+		var w FederatingWrappedCallbacks
+		for _, f := range w.callbacks([]interface{}{o}) {
+			if fn, ok := f.(func(context.Context, vocab.ActivityStreamsFlag) error); ok {
+				fn(nil, nil)
+			}
+		}
+		if !ok {
+			t.Fatalf("could not find overridden function")
+		}
+	})
+	t.Run("OverridesMove", func(t *testing.T) {
+		ok := false
+		o := func(context.Context, vocab.ActivityStreamsMove) error {
+			ok = true
+			return nil
+		}
+		var w FederatingWrappedCallbacks
+		for _, f := range w.callbacks([]interface{}{o}) {
+			if fn, ok := f.(func(context.Context, vocab.ActivityStreamsMove) error); ok {
+				fn(nil, nil)
+			}
+		}
+		if !ok {
+			t.Fatalf("could not find overridden function")
+		}
+	})
 }
 
 func TestFederatedCreate(t *testing.T) {
@@ -242,6 +324,7 @@ func TestFederatedCreate(t *testing.T) {
 		mockDB = NewMockDatabase(ctl)
 		mockTp = NewMockTransport(ctl)
 		w.db = mockDB
+		w.authorizeOrigin = authorizeAnyOrigin
 		w.newTransport = func(c context.Context, a *url.URL, s string) (Transport, error) {
 			return mockTp, nil
 		}
@@ -278,6 +361,19 @@ func TestFederatedCreate(t *testing.T) {
 			t.Fatalf("got error %s", err)
 		}
 	})
+	t.Run("DoesNotCreateObjectAgainForAnotherInbox", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		w.repeated = true
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		c := newCreateFn()
+		err := w.create(ctx, c)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
 	t.Run("CreatesAllFederatedObjects", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
@@ -295,6 +391,99 @@ func TestFederatedCreate(t *testing.T) {
 			t.Fatalf("got error %s", err)
 		}
 	})
+	t.Run("AddsReplyToRepliesOfOwnedObject", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		reply := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId1))
+		reply.SetJSONLDId(id)
+		irt := streams.NewActivityStreamsInReplyToProperty()
+		irt.AppendIRI(mustParse(testNoteId2))
+		reply.SetActivityStreamsInReplyTo(irt)
+		parent := streams.NewActivityStreamsNote()
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Create(ctx, reply)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId2)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId2)).Return(parent, nil)
+		mockDB.EXPECT().Update(ctx, parent)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		c := newCreateFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsNote(reply)
+		c.SetActivityStreamsObject(op)
+		err := w.create(ctx, c)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		items := parent.GetActivityStreamsReplies().GetActivityStreamsCollection().GetActivityStreamsItems()
+		assertEqual(t, items.Len(), 1)
+		assertEqual(t, items.At(0).GetIRI().String(), testNoteId1)
+	})
+	t.Run("AddsReplyToOrderedReplies", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		reply := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId1))
+		reply.SetJSONLDId(id)
+		irt := streams.NewActivityStreamsInReplyToProperty()
+		irt.AppendIRI(mustParse(testNoteId2))
+		reply.SetActivityStreamsInReplyTo(irt)
+		parent := streams.NewActivityStreamsNote()
+		replies := streams.NewActivityStreamsRepliesProperty()
+		replies.SetActivityStreamsOrderedCollection(streams.NewActivityStreamsOrderedCollection())
+		parent.SetActivityStreamsReplies(replies)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Create(ctx, reply)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId2)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId2)).Return(parent, nil)
+		mockDB.EXPECT().Update(ctx, parent)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		c := newCreateFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsNote(reply)
+		c.SetActivityStreamsObject(op)
+		err := w.create(ctx, c)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		oItems := replies.GetActivityStreamsOrderedCollection().GetActivityStreamsOrderedItems()
+		assertEqual(t, oItems.Len(), 1)
+		assertEqual(t, oItems.At(0).GetIRI().String(), testNoteId1)
+	})
+	t.Run("IgnoresRepliesToObjectNotOwned", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		reply := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId1))
+		reply.SetJSONLDId(id)
+		irt := streams.NewActivityStreamsInReplyToProperty()
+		irt.AppendIRI(mustParse(testNoteId2))
+		reply.SetActivityStreamsInReplyTo(irt)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Create(ctx, reply)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId2)).Return(false, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		c := newCreateFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsNote(reply)
+		c.SetActivityStreamsObject(op)
+		err := w.create(ctx, c)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
 	t.Run("DereferencesIRIObject", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
@@ -355,6 +544,7 @@ func TestFederatedUpdate(t *testing.T) {
 	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockDB *MockDatabase) {
 		mockDB = NewMockDatabase(ctl)
 		w.db = mockDB
+		w.authorizeOrigin = authorizeAnyOrigin
 		return
 	}
 	t.Run("ErrorIfNoObject", func(t *testing.T) {
@@ -449,6 +639,41 @@ func TestFederatedUpdate(t *testing.T) {
 		assertEqual(t, ctx, gotc)
 		assertEqual(t, u, got)
 	})
+	t.Run("ForbidsObjectOfAnotherOrigin", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		w.authorizeOrigin = nil
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Exists(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(testMyNote, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		u := newUpdateFn()
+		err := w.update(ctx, u)
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+	})
+	t.Run("UpdatesObjectOwnedByActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		w.authorizeOrigin = nil
+		stored := streams.NewActivityStreamsNote()
+		attrTo := streams.NewActivityStreamsAttributedToProperty()
+		attrTo.AppendIRI(mustParse(testFederatedActorIRI))
+		stored.SetActivityStreamsAttributedTo(attrTo)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Exists(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(stored, nil)
+		mockDB.EXPECT().Update(ctx, testFederatedNote)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		u := newUpdateFn()
+		err := w.update(ctx, u)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
 }
 
 func TestFederatedDelete(t *testing.T) {
@@ -469,6 +694,7 @@ func TestFederatedDelete(t *testing.T) {
 	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockDB *MockDatabase) {
 		mockDB = NewMockDatabase(ctl)
 		w.db = mockDB
+		w.authorizeOrigin = authorizeAnyOrigin
 		return
 	}
 	t.Run("ErrorIfNoObject", func(t *testing.T) {
@@ -505,6 +731,7 @@ func TestFederatedDelete(t *testing.T) {
 		defer ctl.Finish()
 		w, mockDB := setupFn(ctl)
 		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Exists(ctx, mustParse(testNoteId1)).Return(false, nil)
 		mockDB.EXPECT().Delete(ctx, mustParse(testNoteId1))
 		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
 		d := newDeleteFn()
@@ -518,9 +745,11 @@ func TestFederatedDelete(t *testing.T) {
 		defer ctl.Finish()
 		w, mockDB := setupFn(ctl)
 		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Exists(ctx, mustParse(testNoteId1)).Return(false, nil)
 		mockDB.EXPECT().Delete(ctx, mustParse(testNoteId1))
 		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
 		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Exists(ctx, mustParse(testNoteId2)).Return(false, nil)
 		mockDB.EXPECT().Delete(ctx, mustParse(testNoteId2))
 		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId2))
 		d := newDeleteFn()
@@ -530,11 +759,47 @@ func TestFederatedDelete(t *testing.T) {
 			t.Fatalf("got error %s", err)
 		}
 	})
+	t.Run("RemovesReplyFromRepliesOfOwnedObject", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		reply := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId1))
+		reply.SetJSONLDId(id)
+		irt := streams.NewActivityStreamsInReplyToProperty()
+		irt.AppendIRI(mustParse(testNoteId2))
+		reply.SetActivityStreamsInReplyTo(irt)
+		parent := streams.NewActivityStreamsNote()
+		col := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testNoteId1))
+		col.SetActivityStreamsItems(items)
+		replies := streams.NewActivityStreamsRepliesProperty()
+		replies.SetActivityStreamsCollection(col)
+		parent.SetActivityStreamsReplies(replies)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Exists(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(reply, nil)
+		mockDB.EXPECT().Delete(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId2)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId2)).Return(parent, nil)
+		mockDB.EXPECT().Update(ctx, parent)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		err := w.deleteFn(ctx, newDeleteFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, items.Len(), 0)
+	})
 	t.Run("CallsCustomCallback", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
 		w, mockDB := setupFn(ctl)
 		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Exists(ctx, mustParse(testNoteId1)).Return(false, nil)
 		mockDB.EXPECT().Delete(ctx, mustParse(testNoteId1))
 		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
 		d := newDeleteFn()
@@ -552,6 +817,167 @@ func TestFederatedDelete(t *testing.T) {
 		assertEqual(t, ctx, gotc)
 		assertEqual(t, d, got)
 	})
+	t.Run("ForbidsSignerOfAnotherOrigin", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		w.authorizeOrigin = nil
+		c := context.WithValue(ctx, httpSigOwnerKey{}, mustParse(testPersonIRI))
+		mockDB.EXPECT().Lock(c, mustParse(testNoteId1))
+		mockDB.EXPECT().Unlock(c, mustParse(testNoteId1))
+		d := newDeleteFn()
+		err := w.deleteFn(c, d)
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+	})
+	t.Run("ForbidsWhenNotAuthorizedByOriginAuthorizer", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		var gotId *url.URL
+		w.authorizeOrigin = func(c context.Context, activity Activity, objectId *url.URL) (bool, error) {
+			gotId = objectId
+			return false, nil
+		}
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		d := newDeleteFn()
+		err := w.deleteFn(ctx, d)
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+		assertEqual(t, gotId.String(), testNoteId1)
+	})
+	newActorDeleteFn := func() vocab.ActivityStreamsDelete {
+		d := newDeleteFn()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		d.SetJSONLDId(id)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI))
+		d.SetActivityStreamsObject(op)
+		return d
+	}
+	t.Run("CleansUpDeletedActorData", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockADB := NewMockActorDeletionDatabase(ctl)
+		w.db = actorDeletionDatabase{mockDB, mockADB}
+		w.clock = &manualClock{t: now()}
+		followers := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		followers.SetActivityStreamsItems(items)
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI)).Times(2)
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActorIRI)).Return(false, nil)
+		mockDB.EXPECT().Delete(ctx, mustParse(testFederatedActorIRI))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI)).Times(2)
+		mockADB.EXPECT().ActorReferences(ctx, mustParse(testFederatedActorIRI)).Return(ActorReferences{
+			Followed: []*url.URL{mustParse(testPersonIRI)},
+			Objects:  []*url.URL{mustParse(testNoteId2)},
+		}, nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Followers(ctx, mustParse(testPersonIRI)).Return(followers, nil)
+		mockDB.EXPECT().Update(ctx, gomock.Any()).DoAndReturn(func(c context.Context, v vocab.Type) error {
+			assertEqual(t, v.(vocab.ActivityStreamsCollection).GetActivityStreamsItems().Len(), 0)
+			return nil
+		})
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId2)).Return(testFederatedNote, nil)
+		mockDB.EXPECT().Update(ctx, gomock.Any()).DoAndReturn(func(c context.Context, v vocab.Type) error {
+			assertEqual(t, v.GetTypeName(), "Tombstone")
+			assertEqual(t, v.GetJSONLDId().Get().String(), testNoteId2)
+			return nil
+		})
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId2))
+		d := newActorDeleteFn()
+		err := w.deleteFn(ctx, d)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("PurgesDeletedActorObjects", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockADB := NewMockActorDeletionDatabase(ctl)
+		w.db = actorDeletionDatabase{mockDB, mockADB}
+		w.PurgeDeletedActorObjects = true
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI)).Times(2)
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActorIRI)).Return(false, nil)
+		mockDB.EXPECT().Delete(ctx, mustParse(testFederatedActorIRI))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI)).Times(2)
+		mockADB.EXPECT().ActorReferences(ctx, mustParse(testFederatedActorIRI)).Return(ActorReferences{
+			Objects: []*url.URL{mustParse(testNoteId2)},
+		}, nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Delete(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId2))
+		d := newActorDeleteFn()
+		err := w.deleteFn(ctx, d)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("CleansUpDeletedActorOnceForSharedInboxFanOut", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockADB := NewMockActorDeletionDatabase(ctl)
+		w.db = actorDeletionDatabase{mockDB, mockADB}
+		w.PurgeDeletedActorObjects = true
+		var calls int
+		w.DeleteActor = func(c context.Context, v vocab.ActivityStreamsDelete, actorIRI *url.URL) error {
+			calls++
+			return nil
+		}
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI)).Times(3)
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActorIRI)).Return(false, nil)
+		mockDB.EXPECT().Delete(ctx, mustParse(testFederatedActorIRI))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI)).Times(3)
+		mockADB.EXPECT().ActorReferences(ctx, mustParse(testFederatedActorIRI)).Return(ActorReferences{
+			Objects: []*url.URL{mustParse(testNoteId2)},
+		}, nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Delete(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId2))
+		d := newActorDeleteFn()
+		// The first inbox, then another one of the same shared inbox POST.
+		if err := w.deleteFn(ctx, d); err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		w.repeated = true
+		if err := w.deleteFn(ctx, d); err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, calls, 2)
+	})
+	t.Run("CallsDeleteActorCallback", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActorIRI)).Return(false, nil)
+		mockDB.EXPECT().Delete(ctx, mustParse(testFederatedActorIRI))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		d := newActorDeleteFn()
+		var gotActor *url.URL
+		var got vocab.ActivityStreamsDelete
+		w.DeleteActor = func(c context.Context, v vocab.ActivityStreamsDelete, actorIRI *url.URL) error {
+			gotActor = actorIRI
+			got = v
+			return nil
+		}
+		err := w.deleteFn(ctx, d)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, gotActor.String(), testFederatedActorIRI)
+		assertEqual(t, d, got)
+	})
 }
 
 func TestFederatedFollow(t *testing.T) {
@@ -643,21 +1069,27 @@ func TestFederatedFollow(t *testing.T) {
 			t.Fatalf("got error %s", err)
 		}
 	})
-	t.Run("OnFollowAutomaticallyAcceptDelivers", func(t *testing.T) {
+	t.Run("RelayAcceptsFollowOfPublic", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
 		w, mockDB := setupFn(ctl)
-		w.OnFollow = OnFollowAutomaticallyAccept
+		w.OnFollow = OnFollowManuallyApprove
+		w.isRelay = func(c context.Context, actorIRI *url.URL) (bool, error) {
+			return actorIRI.String() == testFederatedActorIRI2, nil
+		}
 		w.addNewIds = func(c context.Context, activity Activity) error {
 			return nil
 		}
+		var response Activity
 		w.deliver = func(c context.Context, outboxIRI *url.URL, activity Activity) error {
-			if !streams.IsOrExtendsActivityStreamsAccept(activity) {
-				t.Fatalf("expected Accept, got %T", activity)
-			}
+			response = activity
 			return nil
 		}
 		followers := streams.NewActivityStreamsCollection()
+		expectFollowers := streams.NewActivityStreamsCollection()
+		expectItems := streams.NewActivityStreamsItemsProperty()
+		expectItems.AppendIRI(mustParse(testFederatedActorIRI))
+		expectFollowers.SetActivityStreamsItems(expectItems)
 		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
 		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
 			mustParse(testFederatedActorIRI2), nil)
@@ -665,28 +1097,152 @@ func TestFederatedFollow(t *testing.T) {
 		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
 		mockDB.EXPECT().Followers(ctx, mustParse(testFederatedActorIRI2)).Return(
 			followers, nil)
-		mockDB.EXPECT().Update(ctx, gomock.Any())
+		mockDB.EXPECT().Update(ctx, expectFollowers)
 		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
 		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
 		mockDB.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(
 			mustParse(testMyOutboxIRI), nil)
 		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
 		f := newFollowFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(PublicActivityPubIRI))
+		f.SetActivityStreamsObject(op)
 		err := w.follow(ctx, f)
 		if err != nil {
 			t.Fatalf("got error %s", err)
 		}
+		if _, ok := response.(vocab.ActivityStreamsAccept); !ok {
+			t.Fatalf("expected an Accept, got %T", response)
+		}
 	})
-	t.Run("OnFollowAutomaticallyRejectDelivers", func(t *testing.T) {
+	t.Run("OnFollowAutomaticallyAcceptPrependsToFollowersCollection", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
 		w, mockDB := setupFn(ctl)
-		w.OnFollow = OnFollowAutomaticallyReject
+		mockCDB := NewMockCollectionDatabase(ctl)
+		w.db = collectionDatabase{mockDB, mockCDB}
+		w.OnFollow = OnFollowAutomaticallyAccept
 		w.addNewIds = func(c context.Context, activity Activity) error {
 			return nil
 		}
 		w.deliver = func(c context.Context, outboxIRI *url.URL, activity Activity) error {
-			if !streams.IsOrExtendsActivityStreamsReject(activity) {
+			return nil
+		}
+		me := streams.NewActivityStreamsPerson()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActorIRI2))
+		me.SetJSONLDId(id)
+		followers := streams.NewActivityStreamsFollowersProperty()
+		followers.SetIRI(mustParse(testAudienceIRI))
+		me.SetActivityStreamsFollowers(followers)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Get(ctx, mustParse(testFederatedActorIRI2)).Return(
+			me, nil)
+		mockCDB.EXPECT().PrependToCollection(ctx, mustParse(testAudienceIRI), mustParse(testFederatedActorIRI))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testMyOutboxIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		f := newFollowFn()
+		err := w.follow(ctx, f)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("OnFollowManuallyApproveRecordsFollowRequest", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockFRDB := NewMockFollowRequestsDatabase(ctl)
+		w.db = followRequestsDatabase{mockDB, mockFRDB}
+		w.OnFollow = OnFollowManuallyApprove
+		w.deliver = func(c context.Context, outboxIRI *url.URL, activity Activity) error {
+			t.Fatalf("unexpected delivery of %T", activity)
+			return nil
+		}
+		f := newFollowFn()
+		expectPending := streams.NewActivityStreamsCollection()
+		expectItems := streams.NewActivityStreamsItemsProperty()
+		expectItems.AppendActivityStreamsFollow(f)
+		expectPending.SetActivityStreamsItems(expectItems)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockFRDB.EXPECT().FollowRequests(ctx, mustParse(testFederatedActorIRI2)).Return(
+			streams.NewActivityStreamsCollection(), nil)
+		mockFRDB.EXPECT().SetFollowRequests(ctx, mustParse(testFederatedActorIRI2), expectPending)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
+		err := w.follow(ctx, f)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("OnFollowManuallyApproveErrorsWithoutFollowRequestsDatabase", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		w.OnFollow = OnFollowManuallyApprove
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		f := newFollowFn()
+		err := w.follow(ctx, f)
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("OnFollowAutomaticallyAcceptDelivers", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		w.OnFollow = OnFollowAutomaticallyAccept
+		w.addNewIds = func(c context.Context, activity Activity) error {
+			return nil
+		}
+		w.deliver = func(c context.Context, outboxIRI *url.URL, activity Activity) error {
+			if !streams.IsOrExtendsActivityStreamsAccept(activity) {
+				t.Fatalf("expected Accept, got %T", activity)
+			}
+			return nil
+		}
+		followers := streams.NewActivityStreamsCollection()
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Followers(ctx, mustParse(testFederatedActorIRI2)).Return(
+			followers, nil)
+		mockDB.EXPECT().Update(ctx, gomock.Any())
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testMyOutboxIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		f := newFollowFn()
+		err := w.follow(ctx, f)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("OnFollowAutomaticallyRejectDelivers", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		w.OnFollow = OnFollowAutomaticallyReject
+		w.addNewIds = func(c context.Context, activity Activity) error {
+			return nil
+		}
+		w.deliver = func(c context.Context, outboxIRI *url.URL, activity Activity) error {
+			if !streams.IsOrExtendsActivityStreamsReject(activity) {
 				t.Fatalf("expected Reject, got %T", activity)
 			}
 			return nil
@@ -897,6 +1453,36 @@ func TestFederatedAccept(t *testing.T) {
 
 func TestFederatedReject(t *testing.T) {
 	ctx := context.Background()
+	t.Run("RecordsDeclinedInviteToLocalEvent", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockDatabase(ctl)
+		mockEDB := NewMockEventsDatabase(ctl)
+		w := FederatingWrappedCallbacks{db: eventsDatabase{mockDB, mockEDB}}
+		invite := streams.NewActivityStreamsInvite()
+		iop := streams.NewActivityStreamsObjectProperty()
+		iop.AppendIRI(mustParse(testNoteId2))
+		invite.SetActivityStreamsObject(iop)
+		r := streams.NewActivityStreamsReject()
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		r.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsInvite(invite)
+		r.SetActivityStreamsObject(op)
+		expectRSVP(ctx, mockDB, mockEDB,
+			map[RSVP]vocab.ActivityStreamsCollection{
+				RSVPGoing: newAttendees(testFederatedActorIRI),
+			},
+			map[RSVP]vocab.ActivityStreamsCollection{
+				RSVPGoing:    newAttendees(),
+				RSVPDeclined: newAttendees(testFederatedActorIRI),
+			})
+		err := w.reject(ctx, r)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
 	t.Run("CallsCustomCallback", func(t *testing.T) {
 		r := streams.NewActivityStreamsReject()
 		var w FederatingWrappedCallbacks
@@ -916,6 +1502,67 @@ func TestFederatedReject(t *testing.T) {
 	})
 }
 
+func TestFederatedTentativeAccept(t *testing.T) {
+	ctx := context.Background()
+	newTentativeAcceptFn := func() vocab.ActivityStreamsTentativeAccept {
+		ta := streams.NewActivityStreamsTentativeAccept()
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		ta.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testNoteId2))
+		ta.SetActivityStreamsObject(op)
+		return ta
+	}
+	t.Run("RecordsInterestedInLocalEvent", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockDatabase(ctl)
+		mockEDB := NewMockEventsDatabase(ctl)
+		w := FederatingWrappedCallbacks{db: eventsDatabase{mockDB, mockEDB}}
+		expectRSVP(ctx, mockDB, mockEDB,
+			map[RSVP]vocab.ActivityStreamsCollection{
+				RSVPInterested: newAttendees(testFederatedActorIRI),
+			}, nil)
+		err := w.tentativeAccept(ctx, newTentativeAcceptFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("IgnoresObjectsThatAreNotEvents", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockDatabase(ctl)
+		mockEDB := NewMockEventsDatabase(ctl)
+		w := FederatingWrappedCallbacks{db: eventsDatabase{mockDB, mockEDB}}
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId2)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId2)).Return(testMyNote, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId2))
+		err := w.tentativeAccept(ctx, newTentativeAcceptFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("CallsCustomCallback", func(t *testing.T) {
+		var w FederatingWrappedCallbacks
+		var gotc context.Context
+		var got vocab.ActivityStreamsTentativeAccept
+		w.TentativeAccept = func(ctx context.Context, v vocab.ActivityStreamsTentativeAccept) error {
+			gotc = ctx
+			got = v
+			return nil
+		}
+		ta := newTentativeAcceptFn()
+		err := w.tentativeAccept(ctx, ta)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, ctx, gotc)
+		assertEqual(t, ta, got)
+	})
+}
+
 func TestFederatedAdd(t *testing.T) {
 	newAddFn := func() vocab.ActivityStreamsAdd {
 		a := streams.NewActivityStreamsAdd()
@@ -937,6 +1584,7 @@ func TestFederatedAdd(t *testing.T) {
 	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockDB *MockDatabase) {
 		mockDB = NewMockDatabase(ctl)
 		w.db = mockDB
+		w.authorizeCollectionChange = authorizeAnyCollectionChange
 		return
 	}
 	t.Run("ErrorIfNoObject", func(t *testing.T) {
@@ -999,6 +1647,27 @@ func TestFederatedAdd(t *testing.T) {
 			t.Fatalf("got error %s", err)
 		}
 	})
+	t.Run("AppendsAllObjectIdsToCollectionDatabase", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockCDB := NewMockCollectionDatabase(ctl)
+		w.db = collectionDatabase{mockDB, mockCDB}
+		mockDB.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testAudienceIRI)).Return(
+			true, nil)
+		gomock.InOrder(
+			mockCDB.EXPECT().AppendToCollection(ctx, mustParse(testAudienceIRI), mustParse(testNoteId1)),
+			mockCDB.EXPECT().AppendToCollection(ctx, mustParse(testAudienceIRI), mustParse(testNoteId2)),
+		)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
+		a := newAddFn()
+		a.GetActivityStreamsObject().AppendActivityStreamsNote(testFederatedNote2)
+		err := w.add(ctx, a)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
 	t.Run("AddsAllObjectIdsToOrderedCollection", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
@@ -1102,6 +1771,104 @@ func TestFederatedAdd(t *testing.T) {
 		assertEqual(t, ctx, gotc)
 		assertEqual(t, a, got)
 	})
+	t.Run("ForbidsCollectionNotAttributedToActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		w.authorizeCollectionChange = nil
+		mockDB.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testAudienceIRI)).Return(
+			true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testAudienceIRI)).Return(
+			streams.NewActivityStreamsCollection(), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
+		a := newAddFn()
+		err := w.add(ctx, a)
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+	})
+	t.Run("AddsToCollectionAttributedToActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		w.authorizeCollectionChange = nil
+		newColFn := func() vocab.ActivityStreamsCollection {
+			col := streams.NewActivityStreamsCollection()
+			attrTo := streams.NewActivityStreamsAttributedToProperty()
+			attrTo.AppendIRI(mustParse(testFederatedActorIRI))
+			col.SetActivityStreamsAttributedTo(attrTo)
+			return col
+		}
+		expectCol := newColFn()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testNoteId1))
+		expectCol.SetActivityStreamsItems(items)
+		mockDB.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testAudienceIRI)).Return(
+			true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testAudienceIRI)).Return(
+			newColFn(), nil).Times(2)
+		mockDB.EXPECT().Update(ctx, expectCol).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
+		a := newAddFn()
+		err := w.add(ctx, a)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("AddsToFollowersCollectionOfActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		w.authorizeCollectionChange = nil
+		expectCol := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testNoteId1))
+		expectCol.SetActivityStreamsItems(items)
+		mockDB.EXPECT().Lock(ctx, mustParse(testGroupFollowersIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testGroupFollowersIRI)).Return(
+			true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testGroupFollowersIRI)).DoAndReturn(
+			func(c context.Context, id *url.URL) (vocab.Type, error) {
+				return streams.NewActivityStreamsCollection(), nil
+			}).Times(2)
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			newTestGroup(), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Update(ctx, expectCol).Return(nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testGroupFollowersIRI))
+		a := newAddFn()
+		a.GetActivityStreamsActor().SetIRI(0, mustParse(testPersonIRI))
+		a.GetActivityStreamsTarget().SetIRI(0, mustParse(testGroupFollowersIRI))
+		err := w.add(ctx, a)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("ForbidsCollectionNotOfActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		w.authorizeCollectionChange = nil
+		mockDB.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testAudienceIRI)).Return(
+			true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testAudienceIRI)).Return(
+			streams.NewActivityStreamsCollection(), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			newTestGroup(), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
+		a := newAddFn()
+		a.GetActivityStreamsActor().SetIRI(0, mustParse(testPersonIRI))
+		err := w.add(ctx, a)
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+	})
 }
 
 func TestFederatedRemove(t *testing.T) {
@@ -1125,6 +1892,7 @@ func TestFederatedRemove(t *testing.T) {
 	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockDB *MockDatabase) {
 		mockDB = NewMockDatabase(ctl)
 		w.db = mockDB
+		w.authorizeCollectionChange = authorizeAnyCollectionChange
 		return
 	}
 	t.Run("ErrorIfNoObject", func(t *testing.T) {
@@ -1136,6 +1904,22 @@ func TestFederatedRemove(t *testing.T) {
 			t.Fatalf("expected error, got none")
 		}
 	})
+	t.Run("DoesNotRemoveAgainForAnotherInbox", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _ := setupFn(ctl)
+		w.repeated = true
+		var gotCallback bool
+		w.Remove = func(ctx context.Context, r vocab.ActivityStreamsRemove) error {
+			gotCallback = true
+			return nil
+		}
+		err := w.remove(ctx, newRemoveFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, gotCallback, true)
+	})
 	t.Run("ErrorIfObjectLengthZero", func(t *testing.T) {
 		r := newRemoveFn()
 		r.GetActivityStreamsObject().Remove(0)
@@ -1193,6 +1977,25 @@ func TestFederatedRemove(t *testing.T) {
 			t.Fatalf("got error %s", err)
 		}
 	})
+	t.Run("RemovesAllObjectIdsFromCollectionDatabase", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockCDB := NewMockCollectionDatabase(ctl)
+		w.db = collectionDatabase{mockDB, mockCDB}
+		mockDB.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testAudienceIRI)).Return(
+			true, nil)
+		mockCDB.EXPECT().RemoveFromCollection(ctx, mustParse(testAudienceIRI), mustParse(testNoteId1))
+		mockCDB.EXPECT().RemoveFromCollection(ctx, mustParse(testAudienceIRI), mustParse(testNoteId2))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
+		r := newRemoveFn()
+		r.GetActivityStreamsObject().AppendActivityStreamsNote(testFederatedNote2)
+		err := w.remove(ctx, r)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
 	t.Run("RemovesAllObjectIdsFromOrderedCollection", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
@@ -1314,6 +2117,26 @@ func TestFederatedRemove(t *testing.T) {
 		assertEqual(t, ctx, gotc)
 		assertEqual(t, r, got)
 	})
+	t.Run("ForbidsWhenNotAuthorizedByCollectionAuthorizer", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		var gotId *url.URL
+		w.authorizeCollectionChange = func(c context.Context, activity Activity, collectionId *url.URL) (bool, error) {
+			gotId = collectionId
+			return false, nil
+		}
+		mockDB.EXPECT().Lock(ctx, mustParse(testAudienceIRI))
+		mockDB.EXPECT().Owns(ctx, mustParse(testAudienceIRI)).Return(
+			true, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testAudienceIRI))
+		r := newRemoveFn()
+		err := w.remove(ctx, r)
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+		assertEqual(t, gotId.String(), testAudienceIRI)
+	})
 }
 
 func TestFederatedLike(t *testing.T) {
@@ -1367,6 +2190,23 @@ func TestFederatedLike(t *testing.T) {
 			t.Fatalf("got error %s", err)
 		}
 	})
+	t.Run("DoesNotAddToLikesAgainForAnotherInbox", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _ := setupFn(ctl)
+		w.repeated = true
+		var gotCallback bool
+		w.Like = func(ctx context.Context, l vocab.ActivityStreamsLike) error {
+			gotCallback = true
+			return nil
+		}
+		l := newLikeFn()
+		err := w.like(ctx, l)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, gotCallback, true)
+	})
 	t.Run("AddsToNewLikesCollection", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
@@ -1537,10 +2377,169 @@ func TestFederatedAnnounce(t *testing.T) {
 			t.Fatalf("got error %s", err)
 		}
 	})
-	t.Run("AddsToNewSharesCollection", func(t *testing.T) {
-		ctl := gomock.NewController(t)
-		defer ctl.Finish()
-		w, mockDB := setupFn(ctl)
+	newRelayAnnounceFn := func() vocab.ActivityStreamsAnnounce {
+		a := newAnnounceFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActivityIRI2))
+		a.SetActivityStreamsObject(op)
+		return a
+	}
+	newRelayedNoteFn := func(public bool) vocab.ActivityStreamsNote {
+		note := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI2))
+		note.SetJSONLDId(id)
+		to := streams.NewActivityStreamsToProperty()
+		if public {
+			to.AppendIRI(mustParse(PublicActivityPubIRI))
+		} else {
+			to.AppendIRI(mustParse(testFederatedFollowersIRI))
+		}
+		note.SetActivityStreamsTo(to)
+		return note
+	}
+	setupRelayFn := func(mockDB *MockDatabase, w *FederatingWrappedCallbacks, following vocab.ActivityStreamsCollection) {
+		w.inboxIRI = mustParse(testMyInboxIRI)
+		w.isRelay = func(c context.Context, actorIRI *url.URL) (bool, error) {
+			return actorIRI.String() == testFederatedActorIRI, nil
+		}
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Owns(ctx, mustParse(testFederatedActivityIRI2)).Return(
+			false, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Following(ctx, mustParse(testPersonIRI)).Return(
+			following, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+	}
+	newFollowingFn := func(ids ...string) vocab.ActivityStreamsCollection {
+		col := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		for _, id := range ids {
+			items.AppendIRI(mustParse(id))
+		}
+		col.SetActivityStreamsItems(items)
+		return col
+	}
+	t.Run("StoresPublicObjectAnnouncedBySubscribedRelay", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockTp := NewMockTransport(ctl)
+		w.newTransport = func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (Transport, error) {
+			return mockTp, nil
+		}
+		setupRelayFn(mockDB, &w, newFollowingFn(testFederatedActorIRI))
+		note := newRelayedNoteFn(true)
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI2)).Return(
+			false, nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI2)).Return(
+			mustSerializeToBytes(note), nil)
+		mockDB.EXPECT().Create(ctx, gomock.Any()).DoAndReturn(
+			func(c context.Context, v vocab.Type) error {
+				if _, ok := v.(vocab.ActivityStreamsNote); !ok {
+					t.Errorf("expected a Note, got %T", v)
+				}
+				return nil
+			})
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI2))
+		err := w.announce(ctx, newRelayAnnounceFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("SkipsNonPublicObjectAnnouncedBySubscribedRelay", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockTp := NewMockTransport(ctl)
+		w.newTransport = func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (Transport, error) {
+			return mockTp, nil
+		}
+		setupRelayFn(mockDB, &w, newFollowingFn(testFederatedActorIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI2)).Return(
+			false, nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI2)).Return(
+			mustSerializeToBytes(newRelayedNoteFn(false)), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI2))
+		err := w.announce(ctx, newRelayAnnounceFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("SkipsObjectThatCannotBeFetched", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockTp := NewMockTransport(ctl)
+		w.newTransport = func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (Transport, error) {
+			return mockTp, nil
+		}
+		setupRelayFn(mockDB, &w, newFollowingFn(testFederatedActorIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI2)).Return(
+			false, nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI2)).Return(
+			nil, errors.New("410 Gone"))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI2))
+		err := w.announce(ctx, newRelayAnnounceFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("StoresRelayedObjectForSubscriberOfAnotherInbox", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockTp := NewMockTransport(ctl)
+		w.newTransport = func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (Transport, error) {
+			return mockTp, nil
+		}
+		w.repeated = true
+		w.inboxIRI = mustParse(testMyInboxIRI)
+		w.isRelay = func(c context.Context, actorIRI *url.URL) (bool, error) {
+			return actorIRI.String() == testFederatedActorIRI, nil
+		}
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Following(ctx, mustParse(testPersonIRI)).Return(
+			newFollowingFn(testFederatedActorIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI2)).Return(
+			false, nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI2)).Return(
+			mustSerializeToBytes(newRelayedNoteFn(true)), nil)
+		mockDB.EXPECT().Create(ctx, gomock.Any())
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI2))
+		err := w.announce(ctx, newRelayAnnounceFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("SkipsObjectsAnnouncedByUnsubscribedRelay", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		setupRelayFn(mockDB, &w, newFollowingFn(testFederatedActorIRI2))
+		err := w.announce(ctx, newRelayAnnounceFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("AddsToNewSharesCollection", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
 		note := streams.NewActivityStreamsNote()
 		expectNote := streams.NewActivityStreamsNote()
 		expectShares := streams.NewActivityStreamsSharesProperty()
@@ -1731,6 +2730,23 @@ func TestFederatedUndo(t *testing.T) {
 			t.Fatalf("expected error, got none")
 		}
 	})
+	t.Run("ForbidsObjectServedUnderAnotherId", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockTp := setupFn(ctl)
+		// The actor serves, at an IRI it controls, an activity with the
+		// id of another one.
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI2)).Return(
+			mustSerializeToBytes(testListen), nil)
+		u := newUndoFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActivityIRI2))
+		u.SetActivityStreamsObject(op)
+		err := w.undo(ctx, u)
+		if !isForbidden(err) {
+			t.Fatalf("expected a ForbiddenError, got %v", err)
+		}
+	})
 	t.Run("DereferencesWhenUndoValue", func(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
@@ -1779,6 +2795,229 @@ func TestFederatedUndo(t *testing.T) {
 		assertEqual(t, ctx, gotc)
 		assertEqual(t, u, got)
 	})
+	t.Run("RemovesFollowerWhenUndoingFollow", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockTp := setupFn(ctl)
+		mockDB := NewMockDatabase(ctl)
+		w.db = mockDB
+		followers := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI2))
+		items.AppendIRI(mustParse(testFederatedActorIRI3))
+		followers.SetActivityStreamsItems(items)
+		expectFollowers := streams.NewActivityStreamsCollection()
+		expectItems := streams.NewActivityStreamsItemsProperty()
+		expectItems.AppendIRI(mustParse(testFederatedActorIRI3))
+		expectFollowers.SetActivityStreamsItems(expectItems)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(testFollow), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDB.EXPECT().Followers(ctx, mustParse(testFederatedActorIRI)).Return(
+			followers, nil)
+		mockDB.EXPECT().Update(ctx, expectFollowers)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		u := newUndoFn()
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI2))
+		u.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActivityIRI))
+		u.SetActivityStreamsObject(op)
+		err := w.undo(ctx, u)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("RemovesFollowerFromCollectionDatabaseWhenUndoingFollow", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockTp := setupFn(ctl)
+		mockDB := NewMockDatabase(ctl)
+		mockCDB := NewMockCollectionDatabase(ctl)
+		w.db = collectionDatabase{mockDB, mockCDB}
+		me := streams.NewActivityStreamsPerson()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActorIRI))
+		me.SetJSONLDId(id)
+		followers := streams.NewActivityStreamsFollowersProperty()
+		followers.SetIRI(mustParse(testAudienceIRI))
+		me.SetActivityStreamsFollowers(followers)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(testFollow), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockDB.EXPECT().Get(ctx, mustParse(testFederatedActorIRI)).Return(
+			me, nil)
+		mockCDB.EXPECT().RemoveFromCollection(ctx, mustParse(testAudienceIRI), mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		u := newUndoFn()
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI2))
+		u.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActivityIRI))
+		u.SetActivityStreamsObject(op)
+		err := w.undo(ctx, u)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("RemovesFollowRequestWhenUndoingFollow", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockTp := setupFn(ctl)
+		mockDB := NewMockDatabase(ctl)
+		mockFRDB := NewMockFollowRequestsDatabase(ctl)
+		w.db = followRequestsDatabase{mockDB, mockFRDB}
+		pending := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendActivityStreamsFollow(testFollow)
+		pending.SetActivityStreamsItems(items)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(testFollow), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		mockFRDB.EXPECT().FollowRequests(ctx, mustParse(testFederatedActorIRI)).Return(
+			pending, nil)
+		mockFRDB.EXPECT().SetFollowRequests(ctx, mustParse(testFederatedActorIRI), gomock.Any()).DoAndReturn(
+			func(c context.Context, actorIRI *url.URL, col vocab.ActivityStreamsCollection) error {
+				assertEqual(t, col.GetActivityStreamsItems().Len(), 0)
+				return nil
+			})
+		mockDB.EXPECT().Followers(ctx, mustParse(testFederatedActorIRI)).Return(
+			streams.NewActivityStreamsCollection(), nil)
+		mockDB.EXPECT().Update(ctx, streams.NewActivityStreamsCollection())
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+		u := newUndoFn()
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI2))
+		u.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActivityIRI))
+		u.SetActivityStreamsObject(op)
+		err := w.undo(ctx, u)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("IgnoresUndoneFollowOfOtherActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockTp := setupFn(ctl)
+		mockDB := NewMockDatabase(ctl)
+		w.db = mockDB
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(testFollow), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI3), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		u := newUndoFn()
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI2))
+		u.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActivityIRI))
+		u.SetActivityStreamsObject(op)
+		err := w.undo(ctx, u)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("RemovesFromLikesCollectionWhenUndoingLike", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockTp := setupFn(ctl)
+		mockDB := NewMockDatabase(ctl)
+		w.db = mockDB
+		like := streams.NewActivityStreamsLike()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		like.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		like.SetActivityStreamsActor(actor)
+		likeOp := streams.NewActivityStreamsObjectProperty()
+		likeOp.AppendIRI(mustParse(testNoteId1))
+		like.SetActivityStreamsObject(likeOp)
+		newNote := func(ids ...string) vocab.ActivityStreamsNote {
+			note := streams.NewActivityStreamsNote()
+			likes := streams.NewActivityStreamsLikesProperty()
+			col := streams.NewActivityStreamsOrderedCollection()
+			oItems := streams.NewActivityStreamsOrderedItemsProperty()
+			for _, id := range ids {
+				oItems.AppendIRI(mustParse(id))
+			}
+			col.SetActivityStreamsOrderedItems(oItems)
+			likes.SetActivityStreamsOrderedCollection(col)
+			note.SetActivityStreamsLikes(likes)
+			return note
+		}
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(like), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(
+			newNote(testFederatedActivityIRI, testFederatedActivityIRI2), nil)
+		mockDB.EXPECT().Update(ctx, newNote(testFederatedActivityIRI2))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		u := newUndoFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActivityIRI))
+		u.SetActivityStreamsObject(op)
+		err := w.undo(ctx, u)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("RemovesFromSharesCollectionWhenUndoingAnnounce", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockTp := setupFn(ctl)
+		mockDB := NewMockDatabase(ctl)
+		mockCDB := NewMockCollectionDatabase(ctl)
+		w.db = collectionDatabase{mockDB, mockCDB}
+		announce := streams.NewActivityStreamsAnnounce()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		announce.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		announce.SetActivityStreamsActor(actor)
+		announceOp := streams.NewActivityStreamsObjectProperty()
+		announceOp.AppendIRI(mustParse(testNoteId1))
+		announce.SetActivityStreamsObject(announceOp)
+		note := streams.NewActivityStreamsNote()
+		shares := streams.NewActivityStreamsSharesProperty()
+		shares.SetIRI(mustParse(testAudienceIRI))
+		note.SetActivityStreamsShares(shares)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(announce), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil)
+		mockCDB.EXPECT().RemoveFromCollection(ctx, mustParse(testAudienceIRI), mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		u := newUndoFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActivityIRI))
+		u.SetActivityStreamsObject(op)
+		err := w.undo(ctx, u)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
 }
 
 func TestFederatedBlock(t *testing.T) {
@@ -1832,3 +3071,814 @@ func TestFederatedBlock(t *testing.T) {
 		assertEqual(t, b, got)
 	})
 }
+
+func TestFederatedMove(t *testing.T) {
+	newMoveFn := func() vocab.ActivityStreamsMove {
+		m := streams.NewActivityStreamsMove()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		m.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		m.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testFederatedActorIRI))
+		m.SetActivityStreamsObject(op)
+		target := streams.NewActivityStreamsTargetProperty()
+		target.AppendIRI(mustParse(testFederatedActorIRI2))
+		m.SetActivityStreamsTarget(target)
+		return m
+	}
+	newTargetFn := func(alsoKnownAs string) vocab.ActivityStreamsPerson {
+		p := streams.NewActivityStreamsPerson()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActorIRI2))
+		p.SetJSONLDId(id)
+		aka := streams.NewActivityStreamsAlsoKnownAsProperty()
+		aka.AppendIRI(mustParse(alsoKnownAs))
+		p.SetActivityStreamsAlsoKnownAs(aka)
+		return p
+	}
+	newMovedFn := func(movedTo string) vocab.ActivityStreamsPerson {
+		p := streams.NewActivityStreamsPerson()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActorIRI))
+		p.SetJSONLDId(id)
+		mt := streams.NewActivityStreamsMovedToProperty()
+		mt.SetIRI(mustParse(movedTo))
+		p.SetActivityStreamsMovedTo(mt)
+		return p
+	}
+	newFollowingFn := func(ids ...string) vocab.ActivityStreamsCollection {
+		following := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		for _, id := range ids {
+			items.AppendIRI(mustParse(id))
+		}
+		following.SetActivityStreamsItems(items)
+		return following
+	}
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockDB *MockDatabase, mockTp *MockTransport) {
+		mockDB = NewMockDatabase(ctl)
+		mockTp = NewMockTransport(ctl)
+		w.db = mockDB
+		w.inboxIRI = mustParse(testMyInboxIRI)
+		w.newTransport = func(c context.Context, a *url.URL, s string) (Transport, error) {
+			return mockTp, nil
+		}
+		return
+	}
+	t.Run("ErrorIfNoObject", func(t *testing.T) {
+		m := newMoveFn()
+		m.SetActivityStreamsObject(nil)
+		var w FederatingWrappedCallbacks
+		err := w.move(ctx, m)
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("ErrorIfNoTarget", func(t *testing.T) {
+		m := newMoveFn()
+		m.SetActivityStreamsTarget(nil)
+		var w FederatingWrappedCallbacks
+		err := w.move(ctx, m)
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("ForbidsMovingAnotherActor", func(t *testing.T) {
+		m := newMoveFn()
+		m.GetActivityStreamsObject().SetIRI(0, mustParse(testFederatedActorIRI3))
+		var w FederatingWrappedCallbacks
+		err := w.move(ctx, m)
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+	})
+	t.Run("ForbidsTargetNotAlsoKnownAsActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _, mockTp := setupFn(ctl)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
+			mustSerializeToBytes(newTargetFn(testFederatedActorIRI3)), nil)
+		m := newMoveFn()
+		err := w.move(ctx, m)
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+	})
+	t.Run("ForbidsSignerOfAnotherOrigin", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _, mockTp := setupFn(ctl)
+		// The signer claims to move an actor of another server.
+		sctx := context.WithValue(ctx, httpSigOwnerKey{}, mustParse(testPersonIRI))
+		mockTp.EXPECT().Dereference(sctx, mustParse(testFederatedActorIRI2)).Return(
+			mustSerializeToBytes(newTargetFn(testFederatedActorIRI)), nil)
+		m := newMoveFn()
+		err := w.move(sctx, m)
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+	})
+	t.Run("ForbidsActorNotMovedToTarget", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _, mockTp := setupFn(ctl)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
+			mustSerializeToBytes(newTargetFn(testFederatedActorIRI)), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(newMovedFn(testFederatedActorIRI3)), nil)
+		m := newMoveFn()
+		err := w.move(ctx, m)
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+	})
+	t.Run("FollowsTargetOfFollowedActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockTp := setupFn(ctl)
+		w.addNewIds = func(c context.Context, activity Activity) error {
+			id := streams.NewJSONLDIdProperty()
+			id.Set(mustParse(testNewActivityIRI))
+			activity.SetJSONLDId(id)
+			return nil
+		}
+		var gotOutbox *url.URL
+		var got Activity
+		w.deliver = func(c context.Context, outboxIRI *url.URL, activity Activity) error {
+			gotOutbox = outboxIRI
+			got = activity
+			return nil
+		}
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
+			mustSerializeToBytes(newTargetFn(testFederatedActorIRI)), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(newMovedFn(testFederatedActorIRI2)), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI)).Times(2)
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI)).Times(2)
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Following(ctx, mustParse(testPersonIRI)).DoAndReturn(func(c context.Context, actorIRI *url.URL) (vocab.ActivityStreamsCollection, error) {
+			return newFollowingFn(testFederatedActorIRI), nil
+		}).Times(2)
+		mockDB.EXPECT().Update(ctx, gomock.Any()).DoAndReturn(func(c context.Context, v vocab.Type) error {
+			assertEqual(t, v.(vocab.ActivityStreamsCollection).GetActivityStreamsItems().Len(), 0)
+			return nil
+		})
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testNewActivityIRI))
+		mockDB.EXPECT().Create(ctx, gomock.Any())
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNewActivityIRI))
+		mockDB.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testMyOutboxIRI), nil)
+		m := newMoveFn()
+		err := w.move(ctx, m)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, gotOutbox.String(), testMyOutboxIRI)
+		follow, ok := got.(vocab.ActivityStreamsFollow)
+		if !ok {
+			t.Fatalf("expected Follow, got %T", got)
+		}
+		assertEqual(t, follow.GetActivityStreamsActor().At(0).GetIRI().String(), testPersonIRI)
+		assertEqual(t, follow.GetActivityStreamsObject().At(0).GetIRI().String(), testFederatedActorIRI2)
+	})
+	t.Run("DoesNotFollowTargetIfNotFollowingActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockTp := setupFn(ctl)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
+			mustSerializeToBytes(newTargetFn(testFederatedActorIRI)), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(newMovedFn(testFederatedActorIRI2)), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Following(ctx, mustParse(testPersonIRI)).Return(
+			newFollowingFn(testFederatedActorIRI3), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		m := newMoveFn()
+		err := w.move(ctx, m)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("CallsCustomCallback", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockTp := setupFn(ctl)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
+			mustSerializeToBytes(newTargetFn(testFederatedActorIRI)), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(newMovedFn(testFederatedActorIRI2)), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Following(ctx, mustParse(testPersonIRI)).Return(
+			newFollowingFn(), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		var gotc context.Context
+		var got vocab.ActivityStreamsMove
+		w.Move = func(ctx context.Context, v vocab.ActivityStreamsMove) error {
+			gotc = ctx
+			got = v
+			return nil
+		}
+		m := newMoveFn()
+		err := w.move(ctx, m)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, ctx, gotc)
+		assertEqual(t, m, got)
+	})
+}
+
+func TestFederatedFlag(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockDB *MockDatabase) {
+		mockDB = NewMockDatabase(ctl)
+		w.db = mockDB
+		w.inboxIRI = mustParse(testMyInboxIRI)
+		return
+	}
+	expectOwnsFn := func(mockDB *MockDatabase, owns bool) {
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId1)).Return(owns, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+	}
+	t.Run("ErrorIfNoObject", func(t *testing.T) {
+		f := newTestFlag()
+		f.SetActivityStreamsObject(nil)
+		var w FederatingWrappedCallbacks
+		err := w.flag(ctx, f)
+		if err != ErrObjectRequired {
+			t.Fatalf("expected ErrObjectRequired, got %v", err)
+		}
+	})
+	t.Run("ForbidsObjectNotOnServer", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		expectOwnsFn(mockDB, false)
+		err := w.flag(ctx, newTestFlag())
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+	})
+	t.Run("QueuesReport", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		mockRDB := NewMockReportsDatabase(ctl)
+		w.db = reportsDatabase{mockDB, mockRDB}
+		f := newTestFlag()
+		expectOwnsFn(mockDB, true)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockRDB.EXPECT().Reports(ctx, mustParse(testPersonIRI)).Return(newReportsCollection(), nil)
+		mockRDB.EXPECT().SetReports(ctx, mustParse(testPersonIRI), newReportsCollection(f))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		err := w.flag(ctx, f)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("CallsCustomCallback", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB := setupFn(ctl)
+		expectOwnsFn(mockDB, true)
+		var gotc context.Context
+		var got vocab.ActivityStreamsFlag
+		w.Flag = func(ctx context.Context, v vocab.ActivityStreamsFlag) error {
+			gotc = ctx
+			got = v
+			return nil
+		}
+		f := newTestFlag()
+		err := w.flag(ctx, f)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, ctx, gotc)
+		assertEqual(t, f, got)
+	})
+}
+
+func TestFederatedVote(t *testing.T) {
+	ctx := context.Background()
+	newVoteFn := func(id, choice string) vocab.ActivityStreamsNote {
+		n := streams.NewActivityStreamsNote()
+		idp := streams.NewJSONLDIdProperty()
+		idp.Set(mustParse(id))
+		n.SetJSONLDId(idp)
+		name := streams.NewActivityStreamsNameProperty()
+		name.AppendXMLSchemaString(choice)
+		n.SetActivityStreamsName(name)
+		attrTo := streams.NewActivityStreamsAttributedToProperty()
+		attrTo.AppendIRI(mustParse(testFederatedActorIRI))
+		n.SetActivityStreamsAttributedTo(attrTo)
+		irt := streams.NewActivityStreamsInReplyToProperty()
+		irt.AppendIRI(mustParse(testNoteId2))
+		n.SetActivityStreamsInReplyTo(irt)
+		return n
+	}
+	newQuestionFn := func(anyOf bool) vocab.ActivityStreamsQuestion {
+		q := streams.NewActivityStreamsQuestion()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId2))
+		q.SetJSONLDId(id)
+		attrTo := streams.NewActivityStreamsAttributedToProperty()
+		attrTo.AppendIRI(mustParse(testPersonIRI))
+		q.SetActivityStreamsAttributedTo(attrTo)
+		oneOf := streams.NewActivityStreamsOneOfProperty()
+		anyOfProp := streams.NewActivityStreamsAnyOfProperty()
+		for _, choice := range []string{"yes", "no"} {
+			option := streams.NewActivityStreamsNote()
+			name := streams.NewActivityStreamsNameProperty()
+			name.AppendXMLSchemaString(choice)
+			option.SetActivityStreamsName(name)
+			if anyOf {
+				anyOfProp.AppendActivityStreamsNote(option)
+			} else {
+				oneOf.AppendActivityStreamsNote(option)
+			}
+		}
+		if anyOf {
+			q.SetActivityStreamsAnyOf(anyOfProp)
+		} else {
+			q.SetActivityStreamsOneOf(oneOf)
+		}
+		return q
+	}
+	newCreateFn := func(vote vocab.ActivityStreamsNote) vocab.ActivityStreamsCreate {
+		c := streams.NewActivityStreamsCreate()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		c.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		c.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsNote(vote)
+		c.SetActivityStreamsObject(op)
+		return c
+	}
+	votesFn := func(votes ...vocab.ActivityStreamsNote) vocab.ActivityStreamsCollection {
+		col := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		for _, v := range votes {
+			items.AppendActivityStreamsNote(v)
+		}
+		col.SetActivityStreamsItems(items)
+		return col
+	}
+	repliesCountFn := func(q vocab.ActivityStreamsQuestion, choice string) int {
+		option, _ := questionOption(q, choice)
+		replies := option.(replieser).GetActivityStreamsReplies()
+		if replies == nil {
+			return 0
+		}
+		return replies.GetActivityStreamsCollection().GetActivityStreamsTotalItems().Get()
+	}
+	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockDB *MockDatabase, mockVDB *MockVotesDatabase) {
+		mockDB = NewMockDatabase(ctl)
+		mockVDB = NewMockVotesDatabase(ctl)
+		w.db = votesDatabase{mockDB, mockVDB}
+		w.inboxIRI = mustParse(testMyInboxIRI)
+		w.authorizeOrigin = authorizeAnyOrigin
+		w.clock = &manualClock{t: now()}
+		return
+	}
+	expectQuestionFn := func(mockDB *MockDatabase, q vocab.ActivityStreamsQuestion) {
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Owns(ctx, mustParse(testNoteId2)).Return(true, nil)
+		mockDB.EXPECT().Get(ctx, mustParse(testNoteId2)).Return(q, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNoteId2))
+	}
+	expectDeliveryFn := func(mockDB *MockDatabase) {
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testMyOutboxIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+	}
+	t.Run("TalliesVoteAndSendsUpdate", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockVDB := setupFn(ctl)
+		q := newQuestionFn(false)
+		vote := newVoteFn(testFederatedActivityIRI2, "yes")
+		var delivered Activity
+		w.addNewIds = func(c context.Context, a Activity) error {
+			return nil
+		}
+		w.deliver = func(c context.Context, outboxIRI *url.URL, a Activity) error {
+			assertEqual(t, outboxIRI.String(), testMyOutboxIRI)
+			delivered = a
+			return nil
+		}
+		expectQuestionFn(mockDB, q)
+		mockVDB.EXPECT().Votes(ctx, mustParse(testNoteId2)).Return(votesFn(), nil)
+		mockVDB.EXPECT().SetVotes(ctx, mustParse(testNoteId2), votesFn(vote))
+		mockDB.EXPECT().Update(ctx, q)
+		mockDB.EXPECT().Create(ctx, vote)
+		expectDeliveryFn(mockDB)
+		err := w.create(ctx, newCreateFn(vote))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, repliesCountFn(q, "yes"), 1)
+		assertEqual(t, repliesCountFn(q, "no"), 0)
+		assertEqual(t, q.GetTootVotersCount().Get(), 1)
+		update, ok := delivered.(vocab.ActivityStreamsUpdate)
+		if !ok {
+			t.Fatalf("expected an Update, got %T", delivered)
+		}
+		assertEqual(t, update.GetActivityStreamsTo().At(0).GetIRI().String(), testFederatedActorIRI)
+	})
+	t.Run("KeepsRepliesIRIOfOption", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockVDB := setupFn(ctl)
+		q := newQuestionFn(false)
+		option, _ := questionOption(q, "yes")
+		replies := streams.NewActivityStreamsRepliesProperty()
+		replies.SetIRI(mustParse(testAudienceIRI))
+		option.(replieser).SetActivityStreamsReplies(replies)
+		vote := newVoteFn(testFederatedActivityIRI2, "yes")
+		w.addNewIds = func(c context.Context, a Activity) error {
+			return nil
+		}
+		w.deliver = func(c context.Context, outboxIRI *url.URL, a Activity) error {
+			return nil
+		}
+		expectQuestionFn(mockDB, q)
+		mockVDB.EXPECT().Votes(ctx, mustParse(testNoteId2)).Return(votesFn(), nil)
+		mockVDB.EXPECT().SetVotes(ctx, mustParse(testNoteId2), votesFn(vote))
+		mockDB.EXPECT().Update(ctx, q)
+		mockDB.EXPECT().Create(ctx, vote)
+		expectDeliveryFn(mockDB)
+		err := w.create(ctx, newCreateFn(vote))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		got := option.(replieser).GetActivityStreamsReplies()
+		if !got.IsIRI() {
+			t.Fatalf("expected replies to remain an IRI")
+		}
+		assertEqual(t, got.GetIRI().String(), testAudienceIRI)
+		assertEqual(t, q.GetTootVotersCount().Get(), 1)
+	})
+	t.Run("ForbidsVoteOnClosedQuestion", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		q := newQuestionFn(false)
+		closed := streams.NewActivityStreamsClosedProperty()
+		closed.AppendXMLSchemaDateTime(now().Add(-time.Hour))
+		q.SetActivityStreamsClosed(closed)
+		expectQuestionFn(mockDB, q)
+		err := w.create(ctx, newCreateFn(newVoteFn(testFederatedActivityIRI2, "yes")))
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+	})
+	t.Run("ForbidsVoteAttributedToAnotherActor", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		q := newQuestionFn(false)
+		expectQuestionFn(mockDB, q)
+		create := newCreateFn(newVoteFn(testFederatedActivityIRI2, "yes"))
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI2))
+		create.SetActivityStreamsActor(actor)
+		err := w.create(ctx, create)
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+	})
+	t.Run("ForbidsVoteNotAttributedToSigner", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		q := newQuestionFn(false)
+		sctx := context.WithValue(ctx, httpSigOwnerKey{}, mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Lock(sctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Unlock(sctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Lock(sctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(sctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(sctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(sctx, mustParse(testNoteId2))
+		mockDB.EXPECT().Owns(sctx, mustParse(testNoteId2)).Return(true, nil)
+		mockDB.EXPECT().Get(sctx, mustParse(testNoteId2)).Return(q, nil)
+		mockDB.EXPECT().Unlock(sctx, mustParse(testNoteId2))
+		err := w.create(sctx, newCreateFn(newVoteFn(testFederatedActivityIRI2, "yes")))
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+	})
+	t.Run("ForbidsVoteForUnknownOption", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		q := newQuestionFn(false)
+		expectQuestionFn(mockDB, q)
+		err := w.create(ctx, newCreateFn(newVoteFn(testFederatedActivityIRI2, "maybe")))
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+	})
+	t.Run("ForbidsSecondVoteOnOneOf", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockVDB := setupFn(ctl)
+		q := newQuestionFn(false)
+		expectQuestionFn(mockDB, q)
+		mockVDB.EXPECT().Votes(ctx, mustParse(testNoteId2)).Return(
+			votesFn(newVoteFn(testFederatedActivityIRI, "no")), nil)
+		err := w.create(ctx, newCreateFn(newVoteFn(testFederatedActivityIRI2, "yes")))
+		if !isForbidden(err) {
+			t.Fatalf("expected ForbiddenError, got %v", err)
+		}
+	})
+	t.Run("AllowsAnyOfVotesForOtherOptions", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockVDB := setupFn(ctl)
+		q := newQuestionFn(true)
+		first := newVoteFn(testFederatedActivityIRI, "no")
+		vote := newVoteFn(testFederatedActivityIRI2, "yes")
+		w.addNewIds = func(c context.Context, a Activity) error {
+			return nil
+		}
+		w.deliver = func(c context.Context, outboxIRI *url.URL, a Activity) error {
+			return nil
+		}
+		expectQuestionFn(mockDB, q)
+		mockVDB.EXPECT().Votes(ctx, mustParse(testNoteId2)).Return(votesFn(first), nil)
+		mockVDB.EXPECT().SetVotes(ctx, mustParse(testNoteId2), votesFn(first, vote))
+		mockDB.EXPECT().Update(ctx, q)
+		mockDB.EXPECT().Create(ctx, vote)
+		expectDeliveryFn(mockDB)
+		err := w.create(ctx, newCreateFn(vote))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, repliesCountFn(q, "yes"), 1)
+		assertEqual(t, q.GetTootVotersCount().Get(), 1)
+	})
+}
+
+func TestFederatedJoin(t *testing.T) {
+	newJoinFn := func() vocab.ActivityStreamsJoin {
+		j := streams.NewActivityStreamsJoin()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		j.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		j.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testPersonIRI))
+		j.SetActivityStreamsObject(op)
+		return j
+	}
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller, accept bool) (w FederatingWrappedCallbacks, mockDB *MockDatabase, delivered *Activity) {
+		mockDB = NewMockDatabase(ctl)
+		w.db = mockDB
+		w.inboxIRI = mustParse(testMyInboxIRI)
+		w.acceptGroupMember = func(c context.Context, groupIRI, actorIRI *url.URL) (bool, error) {
+			assertEqual(t, groupIRI.String(), testPersonIRI)
+			assertEqual(t, actorIRI.String(), testFederatedActorIRI)
+			return accept, nil
+		}
+		w.addNewIds = func(c context.Context, a Activity) error {
+			return nil
+		}
+		delivered = new(Activity)
+		w.deliver = func(c context.Context, outboxIRI *url.URL, a Activity) error {
+			assertEqual(t, outboxIRI.String(), testMyOutboxIRI)
+			*delivered = a
+			return nil
+		}
+		return
+	}
+	expectGroupFn := func(mockDB *MockDatabase, actor vocab.Type) {
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(actor, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+	}
+	expectOutboxFn := func(mockDB *MockDatabase) {
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testMyOutboxIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+	}
+	t.Run("ErrorIfNoObject", func(t *testing.T) {
+		j := newJoinFn()
+		j.SetActivityStreamsObject(nil)
+		var w FederatingWrappedCallbacks
+		err := w.join(ctx, j)
+		if err != ErrObjectRequired {
+			t.Fatalf("expected ErrObjectRequired, got %v", err)
+		}
+	})
+	t.Run("AcceptsMemberOfGroup", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, delivered := setupFn(ctl, true)
+		expectGroupFn(mockDB, newTestGroup())
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDB.EXPECT().Followers(ctx, mustParse(testPersonIRI)).Return(
+			streams.NewActivityStreamsCollection(), nil)
+		mockDB.EXPECT().Update(ctx, gomock.Any()).DoAndReturn(
+			func(c context.Context, col vocab.Type) error {
+				has, err := collectionHasId(col, mustParse(testFederatedActorIRI))
+				assertEqual(t, err, nil)
+				assertEqual(t, has, true)
+				return nil
+			})
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		expectOutboxFn(mockDB)
+		err := w.join(ctx, newJoinFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		if _, ok := (*delivered).(vocab.ActivityStreamsAccept); !ok {
+			t.Fatalf("expected an Accept, got %T", *delivered)
+		}
+	})
+	t.Run("RejectsMemberOfGroup", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, delivered := setupFn(ctl, false)
+		expectGroupFn(mockDB, newTestGroup())
+		expectOutboxFn(mockDB)
+		err := w.join(ctx, newJoinFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		if _, ok := (*delivered).(vocab.ActivityStreamsReject); !ok {
+			t.Fatalf("expected a Reject, got %T", *delivered)
+		}
+	})
+	t.Run("IgnoresActorThatIsNotGroup", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, delivered := setupFn(ctl, true)
+		expectGroupFn(mockDB, testMyPerson)
+		err := w.join(ctx, newJoinFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, *delivered, nil)
+	})
+	t.Run("RecordsGoingToLocalEvent", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockDatabase(ctl)
+		mockEDB := NewMockEventsDatabase(ctl)
+		w := FederatingWrappedCallbacks{db: eventsDatabase{mockDB, mockEDB}}
+		j := newJoinFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testNoteId2))
+		j.SetActivityStreamsObject(op)
+		expectRSVP(ctx, mockDB, mockEDB, nil,
+			map[RSVP]vocab.ActivityStreamsCollection{
+				RSVPGoing: newAttendees(testFederatedActorIRI),
+			})
+		err := w.join(ctx, j)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("CallsCustomCallback", func(t *testing.T) {
+		var w FederatingWrappedCallbacks
+		var gotc context.Context
+		var got vocab.ActivityStreamsJoin
+		w.Join = func(ctx context.Context, v vocab.ActivityStreamsJoin) error {
+			gotc = ctx
+			got = v
+			return nil
+		}
+		j := newJoinFn()
+		err := w.join(ctx, j)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, ctx, gotc)
+		assertEqual(t, j, got)
+	})
+}
+
+func TestFederatedLeave(t *testing.T) {
+	newLeaveFn := func() vocab.ActivityStreamsLeave {
+		l := streams.NewActivityStreamsLeave()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		l.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		l.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testPersonIRI))
+		l.SetActivityStreamsObject(op)
+		return l
+	}
+	ctx := context.Background()
+	t.Run("RemovesMemberOfGroup", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockDatabase(ctl)
+		w := FederatingWrappedCallbacks{
+			db:       mockDB,
+			inboxIRI: mustParse(testMyInboxIRI),
+			acceptGroupMember: func(c context.Context, groupIRI, actorIRI *url.URL) (bool, error) {
+				return true, nil
+			},
+		}
+		followers := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		followers.SetActivityStreamsItems(items)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testPersonIRI)).Times(2)
+		mockDB.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(newTestGroup(), nil)
+		mockDB.EXPECT().Followers(ctx, mustParse(testPersonIRI)).Return(followers, nil)
+		mockDB.EXPECT().Update(ctx, followers)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testPersonIRI)).Times(2)
+		err := w.leave(ctx, newLeaveFn())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, items.Len(), 0)
+	})
+	t.Run("RemovesAttendeeOfLocalEvent", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDB := NewMockDatabase(ctl)
+		mockEDB := NewMockEventsDatabase(ctl)
+		w := FederatingWrappedCallbacks{db: eventsDatabase{mockDB, mockEDB}}
+		l := newLeaveFn()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse(testNoteId2))
+		l.SetActivityStreamsObject(op)
+		expectRSVP(ctx, mockDB, mockEDB,
+			map[RSVP]vocab.ActivityStreamsCollection{
+				RSVPGoing: newAttendees(testFederatedActorIRI),
+			},
+			map[RSVP]vocab.ActivityStreamsCollection{
+				RSVPGoing: newAttendees(),
+			})
+		err := w.leave(ctx, l)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	})
+	t.Run("CallsCustomCallback", func(t *testing.T) {
+		var w FederatingWrappedCallbacks
+		var gotc context.Context
+		var got vocab.ActivityStreamsLeave
+		w.Leave = func(ctx context.Context, v vocab.ActivityStreamsLeave) error {
+			gotc = ctx
+			got = v
+			return nil
+		}
+		l := newLeaveFn()
+		err := w.leave(ctx, l)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		assertEqual(t, ctx, gotc)
+		assertEqual(t, l, got)
+	})
+}
@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
 )
 
 var ErrNotFound = errors.New("go-fed/activity: ActivityStreams data not found")
@@ -82,32 +84,193 @@ func NewActivityStreamsHandlerScheme(db Database, clock Clock, scheme string) Ha
 			err = ErrNotFound
 			return
 		}
-		// Remove sensitive fields.
-		clearSensitiveFields(t)
-		// Serialize the fetched value.
-		m, err := streams.Serialize(t)
-		if err != nil {
+		err = writeActivityStreams(w, clock, t)
+		return
+	}
+}
+
+// NewAuthorizedFetchHandler creates a HandlerFunc to serve ActivityStreams
+// requests only to peers whose requests are signed, which is also known as
+// authorized fetch or secure mode.
+//
+// Defaults to supporting content to be retrieved by HTTPS only.
+func NewAuthorizedFetchHandler(db Database, clock Clock, auth *HttpSigAuthenticator) HandlerFunc {
+	return NewAuthorizedFetchHandlerScheme(db, clock, auth, "https")
+}
+
+// NewAuthorizedFetchHandlerScheme creates a HandlerFunc to serve
+// ActivityStreams requests only to peers whose requests are signed, for data
+// provided by the specified protocol scheme.
+//
+// The HTTP Signature of the request is verified by the HttpSigAuthenticator,
+// and the owner of the signing key is the requesting actor. Unlike the
+// handler created by NewActivityStreamsHandlerScheme, this handler writes the
+// response itself when the request is refused:
+//   - http.StatusUnauthorized if the request is not signed or the signature
+//     does not verify.
+//   - http.StatusNotFound if the database does not retrieve any data, either
+//     returning a nil value or ErrNotFound.
+//   - http.StatusForbidden if the requesting actor may not see the data.
+//
+// The requesting actor may see values that are public, that address it in
+// 'to', 'cc', or 'audience', or that are attributed to it. It may also see
+// values addressed to the followers collection of their local author, when it
+// is one of those followers as determined by the Database's Followers. Values
+// without any addressing, such as actors and collections, and Tombstones are
+// served to any requesting actor.
+//
+// Strips retrieved ActivityStreams values of sensitive fields ('bto' and 'bcc')
+// before responding with them.
+func NewAuthorizedFetchHandlerScheme(db Database, clock Clock, auth *HttpSigAuthenticator, scheme string) HandlerFunc {
+	return func(c context.Context, w http.ResponseWriter, r *http.Request) (isASRequest bool, err error) {
+		// Do nothing if it is not an ActivityPub GET request
+		if !isActivityPubGet(r) {
 			return
 		}
-		raw, err := json.Marshal(m)
+		isASRequest = true
+		c, authenticated, err := auth.authenticate(c, w, r)
+		if err != nil || !authenticated {
+			return
+		}
+		requester, _ := HttpSigKeyOwner(c)
+		id := requestId(r, scheme)
+		// Lock and obtain a copy of the requested ActivityStreams value
+		err = db.Lock(c, id)
 		if err != nil {
 			return
 		}
-		// Construct the response.
-		addResponseHeaders(w.Header(), clock, raw)
-		// Write the response.
-		if streams.IsOrExtendsActivityStreamsTombstone(t) {
-			w.WriteHeader(http.StatusGone)
-		} else {
-			w.WriteHeader(http.StatusOK)
+		// WARNING: Unlock not deferred
+		t, err := db.Get(c, id)
+		if err != nil && err != ErrNotFound {
+			db.Unlock(c, id)
+			return
+		}
+		db.Unlock(c, id)
+		// Unlock must have been called by this point and in every
+		// branch above
+		if err == ErrNotFound || t == nil {
+			err = nil
+			w.WriteHeader(http.StatusNotFound)
+			return
 		}
-		n, err := w.Write(raw)
+		authorized, err := authorizedToFetch(c, db, t, requester)
 		if err != nil {
 			return
-		} else if n != len(raw) {
-			err = fmt.Errorf("only wrote %d of %d bytes", n, len(raw))
+		} else if !authorized {
+			w.WriteHeader(http.StatusForbidden)
 			return
 		}
+		err = writeActivityStreams(w, clock, t)
 		return
 	}
 }
+
+// authorizedToFetch determines whether the requesting actor may see the
+// ActivityStreams value.
+func authorizedToFetch(c context.Context, db Database, t vocab.Type, requester *url.URL) (authorized bool, err error) {
+	if streams.IsOrExtendsActivityStreamsTombstone(t) || !isAddressed(t) {
+		return true, nil
+	}
+	addressees, err := getVisibleAddressees(t)
+	if err != nil {
+		return
+	}
+	if hasPublic(addressees) {
+		return true, nil
+	}
+	addressed := make(map[string]bool, len(addressees))
+	for _, iri := range addressees {
+		addressed[iri.String()] = true
+	}
+	if addressed[requester.String()] {
+		return true, nil
+	}
+	authors, err := getAuthors(t)
+	if err != nil {
+		return
+	}
+	for _, author := range authors {
+		if author.String() == requester.String() {
+			return true, nil
+		}
+	}
+	// Determine if the requester follows a local author, and the followers
+	// are addressed.
+	for _, author := range authors {
+		err = db.Lock(c, author)
+		if err != nil {
+			return
+		}
+		// WARNING: Unlock is not deferred
+		var owns bool
+		owns, err = db.Owns(c, author)
+		if err != nil || !owns {
+			db.Unlock(c, author)
+			if err != nil {
+				return
+			}
+			continue
+		}
+		var followers vocab.ActivityStreamsCollection
+		followers, err = db.Followers(c, author)
+		db.Unlock(c, author)
+		// Unlock must have been called by this point and in every
+		// branch above
+		if err == ErrNotFound {
+			err = nil
+			continue
+		} else if err != nil {
+			return
+		}
+		fid := followers.GetJSONLDId()
+		if fid == nil || !addressed[fid.Get().String()] {
+			continue
+		}
+		items := followers.GetActivityStreamsItems()
+		if items == nil {
+			continue
+		}
+		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+			var id *url.URL
+			id, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			if id.String() == requester.String() {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// writeActivityStreams responds with the ActivityStreams value, without its
+// sensitive fields. Tombstones have the http.StatusGone status code.
+func writeActivityStreams(w http.ResponseWriter, clock Clock, t vocab.Type) error {
+	// Remove sensitive fields.
+	clearSensitiveFields(t)
+	// Serialize the fetched value.
+	m, err := streams.Serialize(t)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	// Construct the response.
+	addResponseHeaders(w.Header(), clock, raw)
+	// Write the response.
+	if streams.IsOrExtendsActivityStreamsTombstone(t) {
+		w.WriteHeader(http.StatusGone)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.Write(raw)
+	if err != nil {
+		return err
+	} else if n != len(raw) {
+		return fmt.Errorf("only wrote %d of %d bytes", n, len(raw))
+	}
+	return nil
+}
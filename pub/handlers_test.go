@@ -8,9 +8,15 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
 	"github.com/golang/mock/gomock"
 )
 
+const (
+	testPersonFollowersIRI = "https://maybe.example.com/person/followers"
+)
+
 // TestActivityStreamsHandler tests the handler for serving ActivityPub
 // requests.
 func TestActivityStreamsHandler(t *testing.T) {
@@ -103,3 +109,165 @@ func TestActivityStreamsHandler(t *testing.T) {
 		assertByteEqual(t, b, mustSerializeToBytes(testMyNote))
 	})
 }
+
+// TestAuthorizedFetchHandler tests the handler for serving ActivityPub
+// requests only to signed requests from actors allowed to see the data.
+func TestAuthorizedFetchHandler(t *testing.T) {
+	ctx := context.Background()
+	key := mustGenerateKey()
+	setupFn := func(ctl *gomock.Controller) (db *MockDatabase, clock *MockClock, tp *MockTransport, hf HandlerFunc) {
+		setupData()
+		db = NewMockDatabase(ctl)
+		clock = NewMockClock(ctl)
+		cm := NewMockCommonBehavior(ctl)
+		tp = NewMockTransport(ctl)
+		clock.EXPECT().Now().Return(now()).AnyTimes()
+		cm.EXPECT().NewTransport(gomock.Any(), mustParse(testFetcherIRI), goFedUserAgent()).Return(tp, nil).AnyTimes()
+		auth := NewHttpSigAuthenticator(cm, mustParse(testFetcherIRI), clock, HttpSigPolicy{})
+		hf = NewAuthorizedFetchHandler(db, clock, auth)
+		return
+	}
+	expectKey := func(tp *MockTransport) {
+		tp.EXPECT().Dereference(gomock.Any(), mustParse(testFederatedKeyId)).Return(mustSerializeToBytes(newActorWithKey(key)), nil)
+	}
+	expectGet := func(db *MockDatabase, t vocab.Type) {
+		db.EXPECT().Lock(gomock.Any(), mustParse(testNoteId1))
+		db.EXPECT().Get(gomock.Any(), mustParse(testNoteId1)).Return(t, nil)
+		db.EXPECT().Unlock(gomock.Any(), mustParse(testNoteId1))
+	}
+	noteFn := func(to string) vocab.ActivityStreamsNote {
+		n := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId1))
+		n.SetJSONLDId(id)
+		attrTo := streams.NewActivityStreamsAttributedToProperty()
+		attrTo.AppendIRI(mustParse(testPersonIRI))
+		n.SetActivityStreamsAttributedTo(attrTo)
+		toProp := streams.NewActivityStreamsToProperty()
+		toProp.AppendIRI(mustParse(to))
+		n.SetActivityStreamsTo(toProp)
+		return n
+	}
+	t.Run("RejectsUnsignedRequest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, _, hf := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		// Run
+		isAPReq, err := hf(ctx, resp, req)
+		// Verify
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("NotFoundWithoutData", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, tp, hf := setupFn(ctl)
+		expectKey(tp)
+		expectGet(db, nil)
+		resp := httptest.NewRecorder()
+		// Run
+		isAPReq, err := hf(ctx, resp, newSignedGetRequest(key, testFederatedKeyId, testNoteId1, now()))
+		// Verify
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusNotFound)
+	})
+	t.Run("NotFoundForMissingId", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, tp, hf := setupFn(ctl)
+		expectKey(tp)
+		db.EXPECT().Lock(gomock.Any(), mustParse(testNoteId1))
+		db.EXPECT().Get(gomock.Any(), mustParse(testNoteId1)).Return(nil, ErrNotFound)
+		db.EXPECT().Unlock(gomock.Any(), mustParse(testNoteId1))
+		resp := httptest.NewRecorder()
+		// Run
+		isAPReq, err := hf(ctx, resp, newSignedGetRequest(key, testFederatedKeyId, testNoteId1, now()))
+		// Verify
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusNotFound)
+	})
+	t.Run("ServesPublicContent", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, tp, hf := setupFn(ctl)
+		note := noteFn(PublicActivityPubIRI)
+		expectKey(tp)
+		expectGet(db, note)
+		resp := httptest.NewRecorder()
+		// Run
+		isAPReq, err := hf(ctx, resp, newSignedGetRequest(key, testFederatedKeyId, testNoteId1, now()))
+		// Verify
+		assertEqual(t, isAPReq, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+		b, err := ioutil.ReadAll(resp.Result().Body)
+		assertEqual(t, err, nil)
+		assertByteEqual(t, b, mustSerializeToBytes(note))
+	})
+	t.Run("ServesContentAddressedToRequester", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, tp, hf := setupFn(ctl)
+		expectKey(tp)
+		expectGet(db, noteFn(testFederatedActorIRI))
+		resp := httptest.NewRecorder()
+		// Run
+		_, err := hf(ctx, resp, newSignedGetRequest(key, testFederatedKeyId, testNoteId1, now()))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("ServesContentToFollowersOfAuthor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, tp, hf := setupFn(ctl)
+		followers := streams.NewActivityStreamsCollection()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testPersonFollowersIRI))
+		followers.SetJSONLDId(id)
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		followers.SetActivityStreamsItems(items)
+		expectKey(tp)
+		expectGet(db, noteFn(testPersonFollowersIRI))
+		db.EXPECT().Lock(gomock.Any(), mustParse(testPersonIRI))
+		db.EXPECT().Owns(gomock.Any(), mustParse(testPersonIRI)).Return(true, nil)
+		db.EXPECT().Followers(gomock.Any(), mustParse(testPersonIRI)).Return(followers, nil)
+		db.EXPECT().Unlock(gomock.Any(), mustParse(testPersonIRI))
+		resp := httptest.NewRecorder()
+		// Run
+		_, err := hf(ctx, resp, newSignedGetRequest(key, testFederatedKeyId, testNoteId1, now()))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("ForbidsContentNotAddressedToRequester", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, tp, hf := setupFn(ctl)
+		expectKey(tp)
+		expectGet(db, noteFn(testPersonFollowersIRI))
+		db.EXPECT().Lock(gomock.Any(), mustParse(testPersonIRI))
+		db.EXPECT().Owns(gomock.Any(), mustParse(testPersonIRI)).Return(true, nil)
+		db.EXPECT().Followers(gomock.Any(), mustParse(testPersonIRI)).Return(nil, ErrNotFound)
+		db.EXPECT().Unlock(gomock.Any(), mustParse(testPersonIRI))
+		resp := httptest.NewRecorder()
+		// Run
+		_, err := hf(ctx, resp, newSignedGetRequest(key, testFederatedKeyId, testNoteId1, now()))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusForbidden)
+	})
+}
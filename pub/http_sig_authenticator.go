@@ -0,0 +1,619 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/httpsig"
+	"golang.org/x/crypto/ed25519"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMaxClockSkew is the default difference allowed between the
+	// Date of a signed request and the current time.
+	defaultMaxClockSkew = time.Hour
+	// defaultKeyCacheTTL is the default duration public keys are cached.
+	defaultKeyCacheTTL = 24 * time.Hour
+	// defaultMaxCachedKeys is the default number of public keys cached.
+	defaultMaxCachedKeys = 10000
+	// signatureHeader is the HTTP Signature header.
+	signatureHeader = "Signature"
+	// authorizationHeader is the Authorization header, which may carry an
+	// HTTP Signature instead of the Signature header.
+	authorizationHeader = "Authorization"
+	// sha512Digest is the SHA-512 string for the Digest header.
+	sha512Digest = "SHA-512"
+	// ownerProperty is the 'owner' of a standalone public key.
+	ownerProperty = "owner"
+	// controllerProperty is the 'controller' of a standalone Multikey.
+	controllerProperty = "controller"
+	// assertionMethodProperty holds the Multikeys of an actor.
+	assertionMethodProperty = "assertionMethod"
+	// multikeyType is the type of Multikey verification methods.
+	multikeyType = "Multikey"
+)
+
+// ed25519PKIXPrefix is the DER encoding of a PKIX Ed25519 public key, before
+// the key itself.
+var ed25519PKIXPrefix = []byte{0x30, 0x2a, 0x30, 0x05, 0x06, 0x03, 0x2b, 0x65, 0x70, 0x03, 0x21, 0x00}
+
+// ed25519MulticodecPrefix is the multicodec varint of an Ed25519 public key,
+// before the key itself in a 'publicKeyMultibase'.
+var ed25519MulticodecPrefix = []byte{0xed, 0x01}
+
+// HttpSigPolicy determines which HTTP Signatures an HttpSigAuthenticator
+// accepts. Zero values are replaced with defaults.
+type HttpSigPolicy struct {
+	// MaxClockSkew is how far the signed Date of a request may be from the
+	// current time, before or after. Defaults to one hour.
+	MaxClockSkew time.Duration
+	// KeyCacheTTL is how long a fetched public key is used before it is
+	// fetched again. Defaults to 24 hours.
+	KeyCacheTTL time.Duration
+	// MaxCachedKeys is the maximum number of public keys kept in the cache.
+	// Defaults to 10000.
+	MaxCachedKeys int
+}
+
+// withDefaults returns a copy of the policy with zero values replaced by the
+// defaults.
+func (p HttpSigPolicy) withDefaults() HttpSigPolicy {
+	if p.MaxClockSkew <= 0 {
+		p.MaxClockSkew = defaultMaxClockSkew
+	}
+	if p.KeyCacheTTL <= 0 {
+		p.KeyCacheTTL = defaultKeyCacheTTL
+	}
+	if p.MaxCachedKeys <= 0 {
+		p.MaxCachedKeys = defaultMaxCachedKeys
+	}
+	return p
+}
+
+// httpSigOwnerKey is the context key of the owner of the key that signed a
+// request.
+type httpSigOwnerKey struct{}
+
+// HttpSigKeyOwner returns the IRI of the actor whose key signed the request,
+// from the context returned by HttpSigAuthenticator when it authenticated the
+// request.
+func HttpSigKeyOwner(c context.Context) (owner *url.URL, ok bool) {
+	owner, ok = c.Value(httpSigOwnerKey{}).(*url.URL)
+	return
+}
+
+// HttpSigAuthenticator verifies the HTTP Signatures of requests from peers,
+// using the public keys their actors publish with the
+// https://w3id.org/security/v1 vocabulary.
+//
+// Its AuthenticatePostInbox method can be called by a FederatingProtocol's own
+// AuthenticatePostInbox to provide the authentication.
+//
+// A request is authentic when:
+//   - It has a draft-cavage HTTP Signature covering the (request-target),
+//     Date, and, if it has a body, Digest headers.
+//   - The signature verifies with the public key identified by its keyId.
+//   - The Date is within the MaxClockSkew of the current time.
+//   - The Digest matches the body.
+//
+// RFC 9421 HTTP Message Signatures are also accepted, when they cover the
+// @method, @target-uri, and, if there is a body, Content-Digest, and were
+// created within the MaxClockSkew of the current time.
+//
+// Public keys are fetched from their owners and cached. When a signature fails
+// to verify with a cached key, the key is fetched again in case the peer has
+// rotated it.
+//
+// It is safe for concurrent use.
+type HttpSigAuthenticator struct {
+	common     CommonBehavior
+	fetcherIRI *url.URL
+	clock      Clock
+	policy     HttpSigPolicy
+	// mu guards keys.
+	mu   sync.Mutex
+	keys map[string]*cachedPublicKey
+}
+
+// cachedPublicKey is a public key fetched from its owner.
+type cachedPublicKey struct {
+	pubKey  crypto.PublicKey
+	owner   *url.URL
+	fetched time.Time
+}
+
+// NewHttpSigAuthenticator creates an HttpSigAuthenticator.
+//
+// Public keys are fetched with the Transport created by the CommonBehavior on
+// behalf of the actor whose inbox or outbox is fetcherIRI. Peers requiring
+// signed fetches will see requests from that actor, which is often an actor
+// representing the server itself.
+func NewHttpSigAuthenticator(common CommonBehavior, fetcherIRI *url.URL, clock Clock, policy HttpSigPolicy) *HttpSigAuthenticator {
+	return &HttpSigAuthenticator{
+		common:     common,
+		fetcherIRI: fetcherIRI,
+		clock:      clock,
+		policy:     policy.withDefaults(),
+		keys:       make(map[string]*cachedPublicKey),
+	}
+}
+
+// AuthenticatePostInbox verifies the HTTP Signature of a POST to an inbox.
+//
+// If the request is authentic, the returned context carries the owner of the
+// signing key, which is obtained with HttpSigKeyOwner. Otherwise, it writes the
+// http.StatusUnauthorized status code in the response and returns false.
+//
+// The request body is read, and replaced so that it may be read again.
+func (h *HttpSigAuthenticator) AuthenticatePostInbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error) {
+	return h.authenticate(c, w, r)
+}
+
+// authenticate verifies the HTTP Signature of the request.
+func (h *HttpSigAuthenticator) authenticate(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error) {
+	out = c
+	owner, err := h.verify(c, r)
+	if err != nil {
+		if _, ok := err.(*unauthenticatedError); ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			err = nil
+		}
+		return
+	}
+	out = context.WithValue(c, httpSigOwnerKey{}, owner)
+	authenticated = true
+	return
+}
+
+// unauthenticatedError is the reason a request is not authentic.
+type unauthenticatedError struct {
+	reason string
+}
+
+// Error returns the reason.
+func (e *unauthenticatedError) Error() string {
+	return e.reason
+}
+
+// unauthenticated creates an unauthenticatedError.
+func unauthenticated(format string, args ...interface{}) error {
+	return &unauthenticatedError{reason: fmt.Sprintf(format, args...)}
+}
+
+// verify checks the HTTP Signature, Date, and Digest of the request, returning
+// the owner of the signing key.
+//
+// Returns an *unauthenticatedError if the request is not authentic.
+func (h *HttpSigAuthenticator) verify(c context.Context, r *http.Request) (*url.URL, error) {
+	if r.Header.Get(signatureInputHeader) != "" {
+		return h.verifyMessageSignature(c, r)
+	}
+	params := signatureParams(r.Header)
+	if params == nil {
+		return nil, unauthenticated("no http signature")
+	}
+	signed := make(map[string]bool)
+	for _, name := range strings.Fields(strings.ToLower(params["headers"])) {
+		signed[name] = true
+	}
+	if !signed["(request-target)"] || !signed["date"] {
+		return nil, unauthenticated("http signature does not cover (request-target) and date")
+	}
+	if err := h.checkDate(r.Header); err != nil {
+		return nil, err
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > 0 || r.Method == http.MethodPost {
+		if !signed["digest"] {
+			return nil, unauthenticated("http signature does not cover digest")
+		} else if !verifyDigest(r.Header, body) {
+			return nil, unauthenticated("digest does not match body")
+		}
+	}
+	v, err := httpsig.NewVerifier(withHostHeader(r))
+	if err != nil {
+		return nil, unauthenticated("malformed http signature: %s", err)
+	}
+	algo := httpsig.RSA_SHA256
+	if strings.EqualFold(params["algorithm"], string(httpsig.RSA_SHA512)) {
+		algo = httpsig.RSA_SHA512
+	}
+	return h.verifyWithKey(c, v.KeyId(), func(pubKey crypto.PublicKey) error {
+		return v.Verify(pubKey, algo)
+	})
+}
+
+// verifyMessageSignature checks the RFC 9421 HTTP Message Signature and
+// Content-Digest of the request, returning the owner of the signing key.
+//
+// Returns an *unauthenticatedError if the request is not authentic.
+func (h *HttpSigAuthenticator) verifyMessageSignature(c context.Context, r *http.Request) (*url.URL, error) {
+	m, err := parseMessageSignature(r.Header)
+	if err != nil {
+		return nil, unauthenticated("malformed message signature: %s", err)
+	}
+	if !m.covers("@method") || !(m.covers("@target-uri") || (m.covers("@authority") && m.covers("@path"))) {
+		return nil, unauthenticated("message signature does not cover @method and @target-uri")
+	}
+	now := h.clock.Now()
+	if skew := now.Sub(m.created); skew > h.policy.MaxClockSkew || -skew > h.policy.MaxClockSkew {
+		return nil, unauthenticated("created is too far from the current time")
+	} else if !m.expires.IsZero() && now.After(m.expires) {
+		return nil, unauthenticated("message signature has expired")
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > 0 || r.Method == http.MethodPost {
+		if !m.covers("content-digest") {
+			return nil, unauthenticated("message signature does not cover content-digest")
+		} else if !verifyContentDigest(r.Header, body) {
+			return nil, unauthenticated("content-digest does not match body")
+		}
+	}
+	base, err := signatureBase(r, m)
+	if err != nil {
+		return nil, unauthenticated("cannot create signature base: %s", err)
+	}
+	return h.verifyWithKey(c, m.keyId, func(pubKey crypto.PublicKey) error {
+		return verifyBase(pubKey, m.alg, base, m.sig)
+	})
+}
+
+// verifyWithKey verifies a signature with the public key with the id,
+// returning the owner of the key. If the signature does not verify with a
+// cached key, the key is fetched again in case the peer has rotated it.
+func (h *HttpSigAuthenticator) verifyWithKey(c context.Context, id string, verifyFn func(crypto.PublicKey) error) (*url.URL, error) {
+	keyId, err := url.Parse(id)
+	if err != nil || !keyId.IsAbs() {
+		return nil, unauthenticated("malformed keyId %q", id)
+	}
+	key, cached, err := h.key(c, keyId, false)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifyFn(key.pubKey); err != nil && cached {
+		// The peer may have rotated its key.
+		key, _, err = h.key(c, keyId, true)
+		if err != nil {
+			return nil, err
+		}
+		err = verifyFn(key.pubKey)
+	}
+	if err != nil {
+		return nil, unauthenticated("signature does not verify: %s", err)
+	}
+	return key.owner, nil
+}
+
+// readBody reads the body of the request, and replaces it so that it may be
+// read again.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// checkDate ensures the Date header is within the allowed clock skew.
+func (h *HttpSigAuthenticator) checkDate(hdr http.Header) error {
+	date, err := http.ParseTime(hdr.Get(dateHeader))
+	if err != nil {
+		return unauthenticated("missing or malformed date")
+	}
+	skew := h.clock.Now().Sub(date)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > h.policy.MaxClockSkew {
+		return unauthenticated("date is too far from the current time")
+	}
+	return nil
+}
+
+// key obtains the public key with the id, from the cache unless refetch is
+// true. Also returns whether the key came from the cache.
+func (h *HttpSigAuthenticator) key(c context.Context, keyId *url.URL, refetch bool) (key *cachedPublicKey, cached bool, err error) {
+	now := h.clock.Now()
+	if !refetch {
+		h.mu.Lock()
+		key = h.keys[keyId.String()]
+		h.mu.Unlock()
+		if key != nil && now.Sub(key.fetched) < h.policy.KeyCacheTTL {
+			return key, true, nil
+		}
+	}
+	pubKey, owner, err := h.fetchKey(c, keyId)
+	if err != nil {
+		return
+	}
+	key = &cachedPublicKey{
+		pubKey:  pubKey,
+		owner:   owner,
+		fetched: now,
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.keys) >= h.policy.MaxCachedKeys {
+		for id, k := range h.keys {
+			if now.Sub(k.fetched) >= h.policy.KeyCacheTTL {
+				delete(h.keys, id)
+			}
+		}
+		// Still full, so make room by dropping any key.
+		for id := range h.keys {
+			if len(h.keys) < h.policy.MaxCachedKeys {
+				break
+			}
+			delete(h.keys, id)
+		}
+	}
+	h.keys[keyId.String()] = key
+	return
+}
+
+// fetchKey dereferences the public key with the id and its owner.
+//
+// The keyId usually refers to the owning actor, with a fragment identifying
+// the key. If it instead refers to a standalone key, which often has no
+// 'type', its owner or controller is fetched to confirm that it has the key.
+// The key is either among the 'publicKey' values of the owner, or is a
+// Multikey among its 'assertionMethod' values.
+//
+// The owner must be served under its own id, on the host of the keyId, or a
+// peer could claim its key belongs to an actor of another server.
+func (h *HttpSigAuthenticator) fetchKey(c context.Context, keyId *url.URL) (pubKey crypto.PublicKey, owner *url.URL, err error) {
+	tp, err := h.common.NewTransport(c, h.fetcherIRI, goFedUserAgent())
+	if err != nil {
+		return
+	}
+	m, err := dereferenceJSON(c, tp, keyId)
+	if err != nil {
+		return
+	}
+	ownerIRI := &url.URL{}
+	*ownerIRI = *keyId
+	ownerIRI.Fragment = ""
+	o, ok := m[ownerProperty].(string)
+	if !ok {
+		o, ok = m[controllerProperty].(string)
+	}
+	if ok {
+		if ownerIRI, err = url.Parse(o); err != nil {
+			err = unauthenticated("key %s has malformed owner %q", keyId, o)
+			return
+		} else if ownerIRI.Host != keyId.Host {
+			err = unauthenticated("key %s is not on the host of its owner %s", keyId, ownerIRI)
+			return
+		} else if m, err = dereferenceJSON(c, tp, ownerIRI); err != nil {
+			return
+		}
+	}
+	// Multikeys are not part of the ActivityStreams vocabulary, so they
+	// are looked up in the JSON.
+	if k, ok := findMultikey(m, keyId); ok {
+		if id, _ := m["id"].(string); id != ownerIRI.String() {
+			err = unauthenticated("key owner %s is served under another id %s", ownerIRI, id)
+			return
+		}
+		if pubKey, err = parseMultikey(k, ownerIRI); err == nil {
+			owner = ownerIRI
+		}
+		return
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		err = unauthenticated("cannot parse key owner: %s", err)
+		return
+	}
+	pubKey, owner, err = findPublicKey(t, keyId)
+	if err == nil && owner.String() != ownerIRI.String() {
+		err = unauthenticated("key owner %s is served under another id %s", ownerIRI, owner)
+		pubKey, owner = nil, nil
+	}
+	return
+}
+
+// dereferenceJSON fetches an IRI with the Transport, as a JSON object.
+//
+// Failures to fetch or parse the value are *unauthenticatedErrors.
+func dereferenceJSON(c context.Context, tp Transport, iri *url.URL) (map[string]interface{}, error) {
+	b, err := tp.Dereference(c, iri)
+	if err != nil {
+		return nil, unauthenticated("cannot fetch %s: %s", iri, err)
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return nil, unauthenticated("cannot parse %s: %s", iri, err)
+	}
+	return m, nil
+}
+
+// findPublicKey finds the key with the id among the 'publicKey' values of an
+// actor, and parses it.
+func findPublicKey(actor vocab.Type, keyId *url.URL) (pubKey crypto.PublicKey, owner *url.URL, err error) {
+	pker, ok := actor.(publicKeyer)
+	if !ok || pker.GetW3IDSecurityV1PublicKey() == nil {
+		err = unauthenticated("%T has no publicKey", actor)
+		return
+	}
+	owner, err = GetId(actor)
+	if err != nil {
+		err = unauthenticated("key owner has no id")
+		return
+	}
+	pkp := pker.GetW3IDSecurityV1PublicKey()
+	for iter := pkp.Begin(); iter != pkp.End(); iter = iter.Next() {
+		pk := iter.Get()
+		if pk == nil || pk.GetJSONLDId() == nil || pk.GetJSONLDId().Get().String() != keyId.String() {
+			continue
+		}
+		if o := pk.GetW3IDSecurityV1Owner(); o != nil && o.Get() != nil && o.Get().String() != owner.String() {
+			err = unauthenticated("key %s is not owned by %s", keyId, owner)
+			return
+		}
+		pemProp := pk.GetW3IDSecurityV1PublicKeyPem()
+		if pemProp == nil {
+			break
+		}
+		pubKey, err = parsePublicKeyPem(pemProp.Get())
+		return
+	}
+	err = unauthenticated("%s does not have key %s", owner, keyId)
+	return
+}
+
+// findMultikey finds the Multikey with the id among the 'assertionMethod'
+// values of the JSON of an actor.
+func findMultikey(actor map[string]interface{}, keyId *url.URL) (map[string]interface{}, bool) {
+	methods, ok := actor[assertionMethodProperty].([]interface{})
+	if !ok {
+		methods = []interface{}{actor[assertionMethodProperty]}
+	}
+	for _, v := range methods {
+		k, ok := v.(map[string]interface{})
+		if ok && k["type"] == multikeyType && k["id"] == keyId.String() {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// parseMultikey parses the 'publicKeyMultibase' of an Ed25519 Multikey
+// controlled by the owner.
+func parseMultikey(k map[string]interface{}, owner *url.URL) (crypto.PublicKey, error) {
+	if k[controllerProperty] != owner.String() {
+		return nil, unauthenticated("key %v is not controlled by %s", k["id"], owner)
+	}
+	value, _ := k["publicKeyMultibase"].(string)
+	if !strings.HasPrefix(value, base58btcPrefix) {
+		return nil, unauthenticated("publicKeyMultibase is not base58btc encoded")
+	}
+	b, err := base58Decode(strings.TrimPrefix(value, base58btcPrefix))
+	if err != nil {
+		return nil, unauthenticated("cannot parse publicKeyMultibase: %s", err)
+	}
+	if len(b) != len(ed25519MulticodecPrefix)+ed25519.PublicKeySize || !bytes.HasPrefix(b, ed25519MulticodecPrefix) {
+		return nil, unauthenticated("publicKeyMultibase is not an Ed25519 key")
+	}
+	return ed25519.PublicKey(b[len(ed25519MulticodecPrefix):]), nil
+}
+
+// parsePublicKeyPem parses a PEM-encoded PKIX or PKCS #1 RSA public key, or a
+// PKIX Ed25519 public key.
+func parsePublicKeyPem(s string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, unauthenticated("publicKeyPem is not PEM encoded")
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		if k, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+			return k, nil
+		}
+	}
+	// Not every version of crypto/x509 parses Ed25519 keys.
+	if len(block.Bytes) == len(ed25519PKIXPrefix)+ed25519.PublicKeySize && bytes.HasPrefix(block.Bytes, ed25519PKIXPrefix) {
+		return ed25519.PublicKey(block.Bytes[len(ed25519PKIXPrefix):]), nil
+	}
+	k, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, unauthenticated("cannot parse publicKeyPem: %s", err)
+	}
+	if _, ok := k.(*rsa.PublicKey); !ok {
+		return nil, unauthenticated("unsupported public key type %T", k)
+	}
+	return k, nil
+}
+
+// withHostHeader returns a shallow copy of a request received by a server,
+// whose Host header is restored so that signatures covering it can be verified.
+func withHostHeader(r *http.Request) *http.Request {
+	if r.Header.Get("Host") != "" || r.Host == "" {
+		return r
+	}
+	vr := *r
+	vr.Header = make(http.Header, len(r.Header)+1)
+	for k, v := range r.Header {
+		vr.Header[k] = v
+	}
+	vr.Header.Set("Host", r.Host)
+	return &vr
+}
+
+// signatureParams parses the parameters of the HTTP Signature in the Signature
+// or Authorization header. Returns nil if there is no signature.
+func signatureParams(h http.Header) map[string]string {
+	s := h.Get(signatureHeader)
+	if s == "" {
+		auth := h.Get(authorizationHeader)
+		prefix := signatureHeader + " "
+		if !strings.HasPrefix(auth, prefix) {
+			return nil
+		}
+		s = strings.TrimPrefix(auth, prefix)
+	}
+	params := make(map[string]string)
+	for _, p := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[strings.ToLower(kv[0])] = strings.Trim(kv[1], "\"")
+	}
+	return params
+}
+
+// verifyDigest determines whether one of the supported digests in the Digest
+// header matches the body. Unsupported digest algorithms are ignored.
+func verifyDigest(h http.Header, body []byte) bool {
+	matched := false
+	for _, d := range strings.Split(h.Get(digestHeader), ",") {
+		kv := strings.SplitN(strings.TrimSpace(d), digestDelimiter, 2)
+		if len(kv) != 2 {
+			continue
+		}
+		var sum []byte
+		switch strings.ToUpper(kv[0]) {
+		case sha256Digest:
+			s := sha256.Sum256(body)
+			sum = s[:]
+		case sha512Digest:
+			s := sha512.Sum512(body)
+			sum = s[:]
+		default:
+			continue
+		}
+		got, err := base64.StdEncoding.DecodeString(kv[1])
+		if err != nil || subtle.ConstantTimeCompare(got, sum) != 1 {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
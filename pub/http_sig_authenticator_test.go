@@ -0,0 +1,343 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/httpsig"
+	"github.com/golang/mock/gomock"
+)
+
+const (
+	testFederatedKeyId = "https://other.example.com/dakota#main-key"
+	testFetcherIRI     = "https://example.com/actor/outbox"
+	testSpoofedKeyId   = "https://evil.example.com/key"
+)
+
+// mustGenerateKey generates an RSA key or panics.
+func mustGenerateKey() *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+// mustPublicKeyPem encodes the public half of the key in PEM.
+func mustPublicKeyPem(k *rsa.PrivateKey) string {
+	der, err := x509.MarshalPKIXPublicKey(&k.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// newPublicKey creates a 'publicKey' value.
+func newPublicKey(keyId, owner string, k *rsa.PrivateKey) vocab.W3IDSecurityV1PublicKey {
+	pk := streams.NewW3IDSecurityV1PublicKey()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(keyId))
+	pk.SetJSONLDId(id)
+	o := streams.NewW3IDSecurityV1OwnerProperty()
+	o.Set(mustParse(owner))
+	pk.SetW3IDSecurityV1Owner(o)
+	p := streams.NewW3IDSecurityV1PublicKeyPemProperty()
+	p.Set(mustPublicKeyPem(k))
+	pk.SetW3IDSecurityV1PublicKeyPem(p)
+	return pk
+}
+
+// newActorWithKey creates a federated Person with the key.
+func newActorWithKey(k *rsa.PrivateKey) vocab.ActivityStreamsPerson {
+	p := streams.NewActivityStreamsPerson()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(testFederatedActorIRI))
+	p.SetJSONLDId(id)
+	pkp := streams.NewW3IDSecurityV1PublicKeyProperty()
+	pkp.AppendW3IDSecurityV1PublicKey(newPublicKey(testFederatedKeyId, testFederatedActorIRI, k))
+	p.SetW3IDSecurityV1PublicKey(pkp)
+	return p
+}
+
+// newSignedRequest creates a POST to an inbox signed by the key, dated at the
+// given time.
+func newSignedRequest(k *rsa.PrivateKey, keyId string, date time.Time, body []byte) *http.Request {
+	r := httptest.NewRequest("POST", testMyInboxIRI, bytes.NewReader(body))
+	r.Header.Set(dateHeader, date.UTC().Format(http.TimeFormat))
+	s, _, err := httpsig.NewSigner(
+		[]httpsig.Algorithm{httpsig.RSA_SHA256},
+		httpsig.DigestSha256,
+		[]string{httpsig.RequestTarget, "host", "date", "digest"},
+		httpsig.Signature)
+	if err != nil {
+		panic(err)
+	}
+	// The pinned httpsig computes the Digest incorrectly, so set it here.
+	sum := sha256.Sum256(body)
+	r.Header.Set(digestHeader, sha256Digest+digestDelimiter+base64.StdEncoding.EncodeToString(sum[:]))
+	// Sign as the client sees the request.
+	r.Header.Set("Host", r.Host)
+	if err = s.SignRequest(k, keyId, r, nil); err != nil {
+		panic(err)
+	}
+	// Servers do not keep the Host header.
+	r.Header.Del("Host")
+	return r
+}
+
+// newSignedGetRequest creates an ActivityPub GET signed by the key, dated at
+// the given time.
+func newSignedGetRequest(k *rsa.PrivateKey, keyId, iri string, date time.Time) *http.Request {
+	r := toAPRequest(httptest.NewRequest("GET", iri, nil))
+	r.Header.Set(dateHeader, date.UTC().Format(http.TimeFormat))
+	s, _, err := httpsig.NewSigner(
+		[]httpsig.Algorithm{httpsig.RSA_SHA256},
+		httpsig.DigestSha256,
+		[]string{httpsig.RequestTarget, "host", "date"},
+		httpsig.Signature)
+	if err != nil {
+		panic(err)
+	}
+	r.Header.Set("Host", r.Host)
+	if err = s.SignRequest(k, keyId, r, nil); err != nil {
+		panic(err)
+	}
+	r.Header.Del("Host")
+	return r
+}
+
+func TestHttpSigAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	key := mustGenerateKey()
+	setupData()
+	body := mustSerializeToBytes(testCreate)
+	setupFn := func(ctl *gomock.Controller) (h *HttpSigAuthenticator, cm *MockCommonBehavior, tp *MockTransport, clock *manualClock) {
+		setupData()
+		cm = NewMockCommonBehavior(ctl)
+		tp = NewMockTransport(ctl)
+		clock = &manualClock{t: now()}
+		h = NewHttpSigAuthenticator(cm, mustParse(testFetcherIRI), clock, HttpSigPolicy{
+			MaxClockSkew: time.Minute,
+		})
+		return
+	}
+	expectFetch := func(cm *MockCommonBehavior, tp *MockTransport, actor vocab.Type) {
+		cm.EXPECT().NewTransport(ctx, mustParse(testFetcherIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, mustParse(testFederatedKeyId)).Return(mustSerializeToBytes(actor), nil)
+	}
+	t.Run("AuthenticatesSignedRequest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h, cm, tp, clock := setupFn(ctl)
+		expectFetch(cm, tp, newActorWithKey(key))
+		req := newSignedRequest(key, testFederatedKeyId, clock.Now(), body)
+		resp := httptest.NewRecorder()
+		// Run
+		c, authenticated, err := h.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, true)
+		owner, ok := HttpSigKeyOwner(c)
+		assertEqual(t, ok, true)
+		assertEqual(t, owner.String(), testFederatedActorIRI)
+		// The body can still be read.
+		b, err := ioutil.ReadAll(req.Body)
+		assertEqual(t, err, nil)
+		assertByteEqual(t, b, body)
+	})
+	t.Run("CachesKeys", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h, cm, tp, clock := setupFn(ctl)
+		expectFetch(cm, tp, newActorWithKey(key))
+		// Run
+		for i := 0; i < 2; i++ {
+			req := newSignedRequest(key, testFederatedKeyId, clock.Now(), body)
+			_, authenticated, err := h.AuthenticatePostInbox(ctx, httptest.NewRecorder(), req)
+			// Verify
+			assertEqual(t, err, nil)
+			assertEqual(t, authenticated, true)
+		}
+	})
+	t.Run("RefetchesRotatedKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h, cm, tp, clock := setupFn(ctl)
+		rotated := mustGenerateKey()
+		gomock.InOrder(
+			cm.EXPECT().NewTransport(ctx, mustParse(testFetcherIRI), goFedUserAgent()).Return(tp, nil),
+			tp.EXPECT().Dereference(ctx, mustParse(testFederatedKeyId)).Return(mustSerializeToBytes(newActorWithKey(key)), nil),
+			cm.EXPECT().NewTransport(ctx, mustParse(testFetcherIRI), goFedUserAgent()).Return(tp, nil),
+			tp.EXPECT().Dereference(ctx, mustParse(testFederatedKeyId)).Return(mustSerializeToBytes(newActorWithKey(rotated)), nil),
+		)
+		_, authenticated, err := h.AuthenticatePostInbox(ctx, httptest.NewRecorder(), newSignedRequest(key, testFederatedKeyId, clock.Now(), body))
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, true)
+		// Run
+		_, authenticated, err = h.AuthenticatePostInbox(ctx, httptest.NewRecorder(), newSignedRequest(rotated, testFederatedKeyId, clock.Now(), body))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, true)
+	})
+	t.Run("FetchesOwnerOfStandaloneKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h, cm, tp, clock := setupFn(ctl)
+		cm.EXPECT().NewTransport(ctx, mustParse(testFetcherIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, mustParse(testFederatedKeyId)).Return(
+			mustSerializeToBytes(newPublicKey(testFederatedKeyId, testFederatedActorIRI, key)), nil)
+		tp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(newActorWithKey(key)), nil)
+		req := newSignedRequest(key, testFederatedKeyId, clock.Now(), body)
+		// Run
+		c, authenticated, err := h.AuthenticatePostInbox(ctx, httptest.NewRecorder(), req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, true)
+		owner, _ := HttpSigKeyOwner(c)
+		assertEqual(t, owner.String(), testFederatedActorIRI)
+	})
+	t.Run("AuthenticatesMessageSignature", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h, cm, tp, _ := setupFn(ctl)
+		expectFetch(cm, tp, newActorWithKey(key))
+		req := newMessageSignedRequest(key, RsaV15Sha256, testFederatedKeyId, body)
+		// Run
+		c, authenticated, err := h.AuthenticatePostInbox(ctx, httptest.NewRecorder(), req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, true)
+		owner, _ := HttpSigKeyOwner(c)
+		assertEqual(t, owner.String(), testFederatedActorIRI)
+	})
+	t.Run("RejectsMessageSignatureWithMismatchedDigest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h, _, _, _ := setupFn(ctl)
+		req := newMessageSignedRequest(key, RsaV15Sha256, testFederatedKeyId, body)
+		req.Body = ioutil.NopCloser(bytes.NewReader(mustSerializeToBytes(testCreate2)))
+		resp := httptest.NewRecorder()
+		// Run
+		_, authenticated, err := h.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("RejectsUnsignedRequest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h, _, _, _ := setupFn(ctl)
+		req := httptest.NewRequest("POST", testMyInboxIRI, bytes.NewReader(body))
+		resp := httptest.NewRecorder()
+		// Run
+		_, authenticated, err := h.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("RejectsSkewedDate", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h, _, _, clock := setupFn(ctl)
+		req := newSignedRequest(key, testFederatedKeyId, clock.Now().Add(-2*time.Minute), body)
+		resp := httptest.NewRecorder()
+		// Run
+		_, authenticated, err := h.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("RejectsMismatchedDigest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h, _, _, clock := setupFn(ctl)
+		req := newSignedRequest(key, testFederatedKeyId, clock.Now(), body)
+		req.Body = ioutil.NopCloser(bytes.NewReader(mustSerializeToBytes(testCreate2)))
+		resp := httptest.NewRecorder()
+		// Run
+		_, authenticated, err := h.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("RejectsWrongKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h, cm, tp, clock := setupFn(ctl)
+		expectFetch(cm, tp, newActorWithKey(key))
+		req := newSignedRequest(mustGenerateKey(), testFederatedKeyId, clock.Now(), body)
+		resp := httptest.NewRecorder()
+		// Run
+		_, authenticated, err := h.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("RejectsOwnerServedUnderAnotherId", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h, cm, tp, clock := setupFn(ctl)
+		// The document at the key claims to be an actor of another server.
+		spoofed := newActorWithKey(key)
+		pkp := streams.NewW3IDSecurityV1PublicKeyProperty()
+		pkp.AppendW3IDSecurityV1PublicKey(newPublicKey(testSpoofedKeyId, testFederatedActorIRI, key))
+		spoofed.SetW3IDSecurityV1PublicKey(pkp)
+		cm.EXPECT().NewTransport(ctx, mustParse(testFetcherIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, mustParse(testSpoofedKeyId)).Return(mustSerializeToBytes(spoofed), nil)
+		req := newSignedRequest(key, testSpoofedKeyId, clock.Now(), body)
+		resp := httptest.NewRecorder()
+		// Run
+		_, authenticated, err := h.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("RejectsStandaloneKeyOwnedOnAnotherHost", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		h, cm, tp, clock := setupFn(ctl)
+		cm.EXPECT().NewTransport(ctx, mustParse(testFetcherIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, mustParse(testSpoofedKeyId)).Return(
+			mustSerializeToBytes(newPublicKey(testSpoofedKeyId, testFederatedActorIRI, key)), nil)
+		req := newSignedRequest(key, testSpoofedKeyId, clock.Now(), body)
+		resp := httptest.NewRecorder()
+		// Run
+		_, authenticated, err := h.AuthenticatePostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, authenticated, false)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+}
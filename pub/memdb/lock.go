@@ -0,0 +1,73 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// lockMap is a set of locks keyed by IRI, which only holds on to the locks
+// that are currently taken or waited upon.
+type lockMap struct {
+	mu    sync.Mutex
+	locks map[string]*refLock
+}
+
+// refLock is a lock that counts how many goroutines hold or wait on it.
+type refLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+// newLockMap creates an empty lockMap.
+func newLockMap() *lockMap {
+	return &lockMap{
+		locks: make(map[string]*refLock),
+	}
+}
+
+// lock blocks until the lock for the key is taken or the context is done.
+func (l *lockMap) lock(c context.Context, key string) error {
+	l.mu.Lock()
+	rl, ok := l.locks[key]
+	if !ok {
+		rl = &refLock{ch: make(chan struct{}, 1)}
+		l.locks[key] = rl
+	}
+	rl.refs++
+	l.mu.Unlock()
+	select {
+	case rl.ch <- struct{}{}:
+		return nil
+	case <-c.Done():
+		l.release(key, rl)
+		return c.Err()
+	}
+}
+
+// unlock frees the lock for the key.
+func (l *lockMap) unlock(key string) error {
+	l.mu.Lock()
+	rl, ok := l.locks[key]
+	l.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unlock of unlocked id %s", key)
+	}
+	select {
+	case <-rl.ch:
+	default:
+		return fmt.Errorf("unlock of unlocked id %s", key)
+	}
+	l.release(key, rl)
+	return nil
+}
+
+// release drops a reference to the lock, forgetting it if it is unused.
+func (l *lockMap) release(key string, rl *refLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rl.refs--
+	if rl.refs == 0 {
+		delete(l.locks, key)
+	}
+}
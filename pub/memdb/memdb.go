@@ -0,0 +1,557 @@
+// Package memdb provides an in-memory implementation of the pub.Database
+// interface.
+//
+// It is intended for prototypes, examples, and integration tests of Actors
+// built with the pub package. All data is lost when the process exits.
+package memdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Database must satisfy the pub.Database, pub.CollectionDatabase, and
+// pub.TransactionalDatabase interfaces.
+var (
+	_ pub.Database              = &Database{}
+	_ pub.CollectionDatabase    = &Database{}
+	_ pub.TransactionalDatabase = &Database{}
+)
+
+// inboxer is an ActivityStreams type with an 'inbox' property
+type inboxer interface {
+	GetActivityStreamsInbox() vocab.ActivityStreamsInboxProperty
+}
+
+// outboxer is an ActivityStreams type with an 'outbox' property
+type outboxer interface {
+	GetActivityStreamsOutbox() vocab.ActivityStreamsOutboxProperty
+}
+
+// followerser is an ActivityStreams type with a 'followers' property
+type followerser interface {
+	GetActivityStreamsFollowers() vocab.ActivityStreamsFollowersProperty
+}
+
+// followinger is an ActivityStreams type with a 'following' property
+type followinger interface {
+	GetActivityStreamsFollowing() vocab.ActivityStreamsFollowingProperty
+}
+
+// likeder is an ActivityStreams type with a 'liked' property
+type likeder interface {
+	GetActivityStreamsLiked() vocab.ActivityStreamsLikedProperty
+}
+
+// itemser is an ActivityStreams type with an 'items' property
+type itemser interface {
+	GetActivityStreamsItems() vocab.ActivityStreamsItemsProperty
+	SetActivityStreamsItems(vocab.ActivityStreamsItemsProperty)
+}
+
+// orderedItemser is an ActivityStreams type with an 'orderedItems' property
+type orderedItemser interface {
+	GetActivityStreamsOrderedItems() vocab.ActivityStreamsOrderedItemsProperty
+	SetActivityStreamsOrderedItems(vocab.ActivityStreamsOrderedItemsProperty)
+}
+
+// Database is a concurrency-safe, in-memory pub.Database.
+//
+// It owns every IRI whose scheme and host match the base IRI it was
+// constructed with, whether or not an entry exists for that IRI yet.
+//
+// Values are stored in their serialized form, so values returned by Get are
+// copies: modifying them has no effect until they are passed to Update.
+//
+// Actors are discovered when they are passed to Create or Update: any value
+// with an 'inbox' or 'outbox' property is indexed so that ActorForInbox,
+// ActorForOutbox, and OutboxForInbox are able to find it. The actor's
+// 'followers', 'following', and 'liked' properties must be IRIs for the
+// Followers, Following, and Liked methods to succeed.
+//
+// Transactions are supported, but are applied one at a time. Writes made
+// outside of a transaction are not isolated from one in progress, as Lock and
+// Unlock do nothing within a transaction, so applications should also write
+// within transactions. Since the pub package handles each activity posted to
+// an inbox in a single transaction, including the peers it dereferences
+// meanwhile, a slow peer delays the handling of every other activity.
+type Database struct {
+	base  *url.URL
+	locks *lockMap
+	// txSem is held by the transaction in progress.
+	txSem chan struct{}
+	// mu guards the fields below.
+	mu sync.RWMutex
+	// data contains the serialized JSON of all entries, keyed by id.
+	data map[string][]byte
+	// inboxes and outboxes contain the 'orderedItems' of each box, with
+	// the most recent item first.
+	inboxes  map[string][]*url.URL
+	outboxes map[string][]*url.URL
+	// inboxActors and outboxActors map a box IRI to its actor's IRI.
+	inboxActors  map[string]*url.URL
+	outboxActors map[string]*url.URL
+	// nextID is used to generate new ids.
+	nextID uint64
+}
+
+// New creates an empty Database owning the data for the scheme and host of
+// the provided base IRI.
+//
+// New ids are created relative to the base IRI.
+func New(base *url.URL) *Database {
+	return &Database{
+		base:         base,
+		locks:        newLockMap(),
+		txSem:        make(chan struct{}, 1),
+		data:         make(map[string][]byte),
+		inboxes:      make(map[string][]*url.URL),
+		outboxes:     make(map[string][]*url.URL),
+		inboxActors:  make(map[string]*url.URL),
+		outboxActors: make(map[string]*url.URL),
+	}
+}
+
+// Lock takes the lock for the object at the specified id, blocking until it is
+// available or the context is done. It does nothing within a transaction.
+func (d *Database) Lock(c context.Context, id *url.URL) error {
+	if d.txFrom(c) != nil {
+		return nil
+	}
+	return d.locks.lock(c, id.String())
+}
+
+// Unlock releases the lock for the object at the specified id. It does nothing
+// within a transaction.
+func (d *Database) Unlock(c context.Context, id *url.URL) error {
+	if d.txFrom(c) != nil {
+		return nil
+	}
+	return d.locks.unlock(id.String())
+}
+
+// InboxContains returns true if the inbox has the id in its 'orderedItems'.
+func (d *Database) InboxContains(c context.Context, inbox, id *url.URL) (contains bool, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return containsIRI(d.inboxes[inbox.String()], id), nil
+}
+
+// GetInbox returns a page containing all of the items in the inbox.
+func (d *Database) GetInbox(c context.Context, inboxIRI *url.URL) (inbox vocab.ActivityStreamsOrderedCollectionPage, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return toPage(inboxIRI, d.inboxes[inboxIRI.String()]), nil
+}
+
+// SetInbox replaces the items in the inbox with those of the page returned by
+// GetInbox.
+func (d *Database) SetInbox(c context.Context, inbox vocab.ActivityStreamsOrderedCollectionPage) error {
+	iri, items, err := fromPage(inbox)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.putBox(c, d.inboxes, iri.String(), items)
+	return nil
+}
+
+// Owns returns true if the id has the scheme and host of the base IRI. Ids
+// that have not been stored yet, such as those of new local collections, are
+// owned as well.
+func (d *Database) Owns(c context.Context, id *url.URL) (owns bool, err error) {
+	return id.Scheme == d.base.Scheme && id.Host == d.base.Host, nil
+}
+
+// ActorForOutbox fetches the IRI of the actor whose outbox is given.
+func (d *Database) ActorForOutbox(c context.Context, outboxIRI *url.URL) (actorIRI *url.URL, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	actorIRI, ok := d.outboxActors[outboxIRI.String()]
+	if !ok {
+		return nil, fmt.Errorf("no actor for outbox %s", outboxIRI)
+	}
+	return actorIRI, nil
+}
+
+// ActorForInbox fetches the IRI of the actor whose inbox is given.
+func (d *Database) ActorForInbox(c context.Context, inboxIRI *url.URL) (actorIRI *url.URL, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	actorIRI, ok := d.inboxActors[inboxIRI.String()]
+	if !ok {
+		return nil, fmt.Errorf("no actor for inbox %s", inboxIRI)
+	}
+	return actorIRI, nil
+}
+
+// OutboxForInbox fetches the outbox IRI of the actor whose inbox is given.
+func (d *Database) OutboxForInbox(c context.Context, inboxIRI *url.URL) (outboxIRI *url.URL, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	actorIRI, ok := d.inboxActors[inboxIRI.String()]
+	if !ok {
+		return nil, fmt.Errorf("no actor for inbox %s", inboxIRI)
+	}
+	for box, a := range d.outboxActors {
+		if a.String() == actorIRI.String() {
+			return url.Parse(box)
+		}
+	}
+	return nil, fmt.Errorf("actor %s has no outbox", actorIRI)
+}
+
+// Exists returns true if there is an entry for the id.
+func (d *Database) Exists(c context.Context, id *url.URL) (exists bool, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, exists = d.data[id.String()]
+	return
+}
+
+// Get returns a copy of the entry for the id, or pub.ErrNotFound if there is
+// no such entry.
+func (d *Database) Get(c context.Context, id *url.URL) (value vocab.Type, err error) {
+	d.mu.RLock()
+	b, ok := d.data[id.String()]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, pub.ErrNotFound
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return streams.ToType(c, m)
+}
+
+// Create adds a new entry keyed by the value's id. Creating an entry that
+// already exists replaces it.
+func (d *Database) Create(c context.Context, asType vocab.Type) error {
+	return d.set(c, asType)
+}
+
+// Update replaces the entry keyed by the value's id.
+func (d *Database) Update(c context.Context, asType vocab.Type) error {
+	return d.set(c, asType)
+}
+
+// Delete removes the entry with the given id.
+func (d *Database) Delete(c context.Context, id *url.URL) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deleteData(c, id.String())
+	d.unindexActor(c, id)
+	return nil
+}
+
+// GetOutbox returns a page containing all of the items in the outbox.
+func (d *Database) GetOutbox(c context.Context, outboxIRI *url.URL) (inbox vocab.ActivityStreamsOrderedCollectionPage, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return toPage(outboxIRI, d.outboxes[outboxIRI.String()]), nil
+}
+
+// SetOutbox replaces the items in the outbox with those of the page returned
+// by GetOutbox.
+func (d *Database) SetOutbox(c context.Context, outbox vocab.ActivityStreamsOrderedCollectionPage) error {
+	iri, items, err := fromPage(outbox)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.putBox(c, d.outboxes, iri.String(), items)
+	return nil
+}
+
+// NewID creates a new IRI relative to the base IRI, based on the name of the
+// value's type. For example: "https://example.com/note/1".
+func (d *Database) NewID(c context.Context, t vocab.Type) (id *url.URL, err error) {
+	d.mu.Lock()
+	d.nextID++
+	n := d.nextID
+	d.mu.Unlock()
+	id = &url.URL{
+		Scheme: d.base.Scheme,
+		Host:   d.base.Host,
+		Path:   fmt.Sprintf("%s/%s/%d", strings.TrimSuffix(d.base.Path, "/"), strings.ToLower(t.GetTypeName()), n),
+	}
+	return
+}
+
+// Followers obtains the Collection at the actor's 'followers' IRI. An empty
+// Collection with that id is returned if it does not yet exist.
+func (d *Database) Followers(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
+	return d.actorCollection(c, actorIRI, "followers", func(t vocab.Type) (pub.IdProperty, bool) {
+		if f, ok := t.(followerser); ok && f.GetActivityStreamsFollowers() != nil {
+			return f.GetActivityStreamsFollowers(), true
+		}
+		return nil, false
+	})
+}
+
+// Following obtains the Collection at the actor's 'following' IRI. An empty
+// Collection with that id is returned if it does not yet exist.
+func (d *Database) Following(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
+	return d.actorCollection(c, actorIRI, "following", func(t vocab.Type) (pub.IdProperty, bool) {
+		if f, ok := t.(followinger); ok && f.GetActivityStreamsFollowing() != nil {
+			return f.GetActivityStreamsFollowing(), true
+		}
+		return nil, false
+	})
+}
+
+// Liked obtains the Collection at the actor's 'liked' IRI. An empty
+// Collection with that id is returned if it does not yet exist.
+func (d *Database) Liked(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
+	return d.actorCollection(c, actorIRI, "liked", func(t vocab.Type) (pub.IdProperty, bool) {
+		if l, ok := t.(likeder); ok && l.GetActivityStreamsLiked() != nil {
+			return l.GetActivityStreamsLiked(), true
+		}
+		return nil, false
+	})
+}
+
+// PrependToCollection adds the id to the front of the inbox, outbox, or
+// collection entry at the IRI. A Collection is created if there is no entry.
+func (d *Database) PrependToCollection(c context.Context, collectionIRI, id *url.URL) error {
+	return d.modifyCollection(c, collectionIRI, func(items []*url.URL) []*url.URL {
+		return append([]*url.URL{id}, items...)
+	})
+}
+
+// AppendToCollection adds the id to the end of the inbox, outbox, or
+// collection entry at the IRI. A Collection is created if there is no entry.
+func (d *Database) AppendToCollection(c context.Context, collectionIRI, id *url.URL) error {
+	return d.modifyCollection(c, collectionIRI, func(items []*url.URL) []*url.URL {
+		return append(items, id)
+	})
+}
+
+// RemoveFromCollection removes the id from the inbox, outbox, or collection
+// entry at the IRI.
+func (d *Database) RemoveFromCollection(c context.Context, collectionIRI, id *url.URL) error {
+	return d.modifyCollection(c, collectionIRI, func(items []*url.URL) []*url.URL {
+		kept := make([]*url.URL, 0, len(items))
+		for _, item := range items {
+			if item.String() != id.String() {
+				kept = append(kept, item)
+			}
+		}
+		return kept
+	})
+}
+
+// modifyCollection replaces the items of the inbox, outbox, or collection
+// entry at the IRI with the result of the function.
+//
+// Items of a collection entry modified this way are stored as IRIs.
+func (d *Database) modifyCollection(c context.Context, colIRI *url.URL, fn func(items []*url.URL) []*url.URL) error {
+	key := colIRI.String()
+	d.mu.Lock()
+	if isBox(d.inboxes, d.inboxActors, key) {
+		d.putBox(c, d.inboxes, key, fn(d.inboxes[key]))
+		d.mu.Unlock()
+		return nil
+	} else if isBox(d.outboxes, d.outboxActors, key) {
+		d.putBox(c, d.outboxes, key, fn(d.outboxes[key]))
+		d.mu.Unlock()
+		return nil
+	}
+	d.mu.Unlock()
+	t, err := d.Get(c, colIRI)
+	if err == pub.ErrNotFound {
+		col := streams.NewActivityStreamsCollection()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(colIRI)
+		col.SetJSONLDId(id)
+		t = col
+	} else if err != nil {
+		return err
+	}
+	if oi, ok := t.(orderedItemser); ok {
+		var items []*url.URL
+		if prop := oi.GetActivityStreamsOrderedItems(); prop != nil {
+			for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+				id, err := pub.ToId(iter)
+				if err != nil {
+					return err
+				}
+				items = append(items, id)
+			}
+		}
+		prop := streams.NewActivityStreamsOrderedItemsProperty()
+		for _, id := range fn(items) {
+			prop.AppendIRI(id)
+		}
+		oi.SetActivityStreamsOrderedItems(prop)
+	} else if i, ok := t.(itemser); ok {
+		var items []*url.URL
+		if prop := i.GetActivityStreamsItems(); prop != nil {
+			for iter := prop.Begin(); iter != prop.End(); iter = iter.Next() {
+				id, err := pub.ToId(iter)
+				if err != nil {
+					return err
+				}
+				items = append(items, id)
+			}
+		}
+		prop := streams.NewActivityStreamsItemsProperty()
+		for _, id := range fn(items) {
+			prop.AppendIRI(id)
+		}
+		i.SetActivityStreamsItems(prop)
+	} else {
+		return fmt.Errorf("%s is neither a Collection nor an OrderedCollection: %T", colIRI, t)
+	}
+	return d.set(c, t)
+}
+
+// isBox returns true if the key is in either of the box maps.
+func isBox(items map[string][]*url.URL, actors map[string]*url.URL, key string) bool {
+	if _, ok := items[key]; ok {
+		return true
+	}
+	_, ok := actors[key]
+	return ok
+}
+
+// actorCollection loads the Collection found at the IRI of an actor's
+// property, obtained with the provided function.
+func (d *Database) actorCollection(c context.Context, actorIRI *url.URL, name string, prop func(vocab.Type) (pub.IdProperty, bool)) (vocab.ActivityStreamsCollection, error) {
+	actor, err := d.Get(c, actorIRI)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := prop(actor)
+	if !ok {
+		return nil, fmt.Errorf("actor %s has no %q property", actorIRI, name)
+	}
+	colIRI, err := pub.ToId(p)
+	if err != nil {
+		return nil, err
+	}
+	t, err := d.Get(c, colIRI)
+	if err == pub.ErrNotFound {
+		col := streams.NewActivityStreamsCollection()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(colIRI)
+		col.SetJSONLDId(id)
+		return col, nil
+	} else if err != nil {
+		return nil, err
+	}
+	col, ok := t.(vocab.ActivityStreamsCollection)
+	if !ok {
+		return nil, fmt.Errorf("%s collection of actor %s is not a Collection: %T", name, actorIRI, t)
+	}
+	return col, nil
+}
+
+// set serializes and stores the value, indexing it if it is an actor.
+func (d *Database) set(c context.Context, t vocab.Type) error {
+	id, err := pub.GetId(t)
+	if err != nil {
+		return err
+	}
+	m, err := streams.Serialize(t)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var inbox, outbox *url.URL
+	if ib, ok := t.(inboxer); ok && ib.GetActivityStreamsInbox() != nil {
+		if inbox, err = pub.ToId(ib.GetActivityStreamsInbox()); err != nil {
+			return err
+		}
+	}
+	if ob, ok := t.(outboxer); ok && ob.GetActivityStreamsOutbox() != nil {
+		if outbox, err = pub.ToId(ob.GetActivityStreamsOutbox()); err != nil {
+			return err
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.putData(c, id.String(), b)
+	d.unindexActor(c, id)
+	if inbox != nil {
+		d.putIndex(c, d.inboxActors, inbox.String(), id)
+	}
+	if outbox != nil {
+		d.putIndex(c, d.outboxActors, outbox.String(), id)
+	}
+	return nil
+}
+
+// unindexActor removes the box indexes pointing to the actor id.
+//
+// Must be called with mu held.
+func (d *Database) unindexActor(c context.Context, id *url.URL) {
+	for box, actor := range d.inboxActors {
+		if actor.String() == id.String() {
+			d.deleteIndex(c, d.inboxActors, box)
+		}
+	}
+	for box, actor := range d.outboxActors {
+		if actor.String() == id.String() {
+			d.deleteIndex(c, d.outboxActors, box)
+		}
+	}
+}
+
+// toPage creates an OrderedCollectionPage for the box containing the items.
+func toPage(boxIRI *url.URL, items []*url.URL) vocab.ActivityStreamsOrderedCollectionPage {
+	page := streams.NewActivityStreamsOrderedCollectionPage()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(boxIRI)
+	page.SetJSONLDId(id)
+	oi := streams.NewActivityStreamsOrderedItemsProperty()
+	for _, item := range items {
+		oi.AppendIRI(item)
+	}
+	page.SetActivityStreamsOrderedItems(oi)
+	return page
+}
+
+// fromPage obtains the box IRI and item ids from a page created by toPage.
+func fromPage(page vocab.ActivityStreamsOrderedCollectionPage) (boxIRI *url.URL, items []*url.URL, err error) {
+	boxIRI, err = pub.GetId(page)
+	if err != nil {
+		return
+	}
+	if oi := page.GetActivityStreamsOrderedItems(); oi != nil {
+		items = make([]*url.URL, 0, oi.Len())
+		for iter := oi.Begin(); iter != oi.End(); iter = iter.Next() {
+			var id *url.URL
+			id, err = pub.ToId(iter)
+			if err != nil {
+				return
+			}
+			items = append(items, id)
+		}
+	}
+	return
+}
+
+// containsIRI returns true if the id is in the list.
+func containsIRI(list []*url.URL, id *url.URL) bool {
+	for _, elem := range list {
+		if elem.String() == id.String() {
+			return true
+		}
+	}
+	return false
+}
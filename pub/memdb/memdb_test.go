@@ -0,0 +1,517 @@
+package memdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+const (
+	testBase      = "https://example.com"
+	testActorIRI  = "https://example.com/addison"
+	testInboxIRI  = "https://example.com/addison/inbox"
+	testOutboxIRI = "https://example.com/addison/outbox"
+	testFollowers = "https://example.com/addison/followers"
+	testNoteIRI   = "https://example.com/note/1"
+	testPeerIRI   = "https://other.example.com/dakota"
+	testPeerNote  = "https://other.example.com/note/1"
+	testPeerAct   = "https://other.example.com/activity/1"
+)
+
+// mustParse parses a URL or panics.
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// newTestActor creates a Person with an inbox, outbox, and followers.
+func newTestActor() vocab.ActivityStreamsPerson {
+	p := streams.NewActivityStreamsPerson()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(testActorIRI))
+	p.SetJSONLDId(id)
+	inbox := streams.NewActivityStreamsInboxProperty()
+	inbox.SetIRI(mustParse(testInboxIRI))
+	p.SetActivityStreamsInbox(inbox)
+	outbox := streams.NewActivityStreamsOutboxProperty()
+	outbox.SetIRI(mustParse(testOutboxIRI))
+	p.SetActivityStreamsOutbox(outbox)
+	followers := streams.NewActivityStreamsFollowersProperty()
+	followers.SetIRI(mustParse(testFollowers))
+	p.SetActivityStreamsFollowers(followers)
+	return p
+}
+
+// newTestNote creates a Note with the given id.
+func newTestNote(iri string) vocab.ActivityStreamsNote {
+	n := streams.NewActivityStreamsNote()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(iri))
+	n.SetJSONLDId(id)
+	content := streams.NewActivityStreamsContentProperty()
+	content.AppendXMLSchemaString("hello")
+	n.SetActivityStreamsContent(content)
+	return n
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	t.Run("BlocksUntilUnlocked", func(t *testing.T) {
+		db := New(mustParse(testBase))
+		id := mustParse(testNoteIRI)
+		if err := db.Lock(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		var mu sync.Mutex
+		acquired := false
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := db.Lock(ctx, id); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			acquired = true
+			mu.Unlock()
+			db.Unlock(ctx, id)
+		}()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		if acquired {
+			t.Fatalf("lock acquired while held")
+		}
+		mu.Unlock()
+		if err := db.Unlock(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		<-done
+		if !acquired {
+			t.Fatalf("lock never acquired")
+		}
+	})
+	t.Run("ReturnsErrorWhenContextDone", func(t *testing.T) {
+		db := New(mustParse(testBase))
+		id := mustParse(testNoteIRI)
+		if err := db.Lock(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := db.Lock(cctx, id); err == nil {
+			t.Fatalf("expected error")
+		}
+		if err := db.Unlock(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		if len(db.locks.locks) != 0 {
+			t.Fatalf("expected no locks to be retained, got %d", len(db.locks.locks))
+		}
+	})
+	t.Run("IndependentIds", func(t *testing.T) {
+		db := New(mustParse(testBase))
+		if err := db.Lock(ctx, mustParse(testNoteIRI)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Lock(ctx, mustParse(testPeerNote)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("ReturnsErrorWhenNotLocked", func(t *testing.T) {
+		db := New(mustParse(testBase))
+		if err := db.Unlock(ctx, mustParse(testNoteIRI)); err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+}
+
+func TestCRUD(t *testing.T) {
+	ctx := context.Background()
+	t.Run("GetsCreatedCopy", func(t *testing.T) {
+		db := New(mustParse(testBase))
+		n := newTestNote(testNoteIRI)
+		if err := db.Create(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+		n.SetActivityStreamsContent(nil)
+		got, err := db.Get(ctx, mustParse(testNoteIRI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		note, ok := got.(vocab.ActivityStreamsNote)
+		if !ok {
+			t.Fatalf("expected Note, got %T", got)
+		}
+		if note.GetActivityStreamsContent() == nil {
+			t.Fatalf("stored value was modified through the original")
+		}
+	})
+	t.Run("ReturnsErrNotFound", func(t *testing.T) {
+		db := New(mustParse(testBase))
+		if _, err := db.Get(ctx, mustParse(testNoteIRI)); err != pub.ErrNotFound {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+	t.Run("Deletes", func(t *testing.T) {
+		db := New(mustParse(testBase))
+		if err := db.Create(ctx, newTestNote(testNoteIRI)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Delete(ctx, mustParse(testNoteIRI)); err != nil {
+			t.Fatal(err)
+		}
+		if exists, err := db.Exists(ctx, mustParse(testNoteIRI)); err != nil {
+			t.Fatal(err)
+		} else if exists {
+			t.Fatalf("expected entry to be deleted")
+		}
+	})
+	t.Run("OwnsOnlyBaseHost", func(t *testing.T) {
+		db := New(mustParse(testBase))
+		if err := db.Create(ctx, newTestNote(testNoteIRI)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(ctx, newTestNote(testPeerNote)); err != nil {
+			t.Fatal(err)
+		}
+		for iri, expect := range map[string]bool{
+			testNoteIRI:                  true,
+			testPeerNote:                 false,
+			"https://example.com/note/2": true,
+			"http://example.com/note/1":  false,
+		} {
+			owns, err := db.Owns(ctx, mustParse(iri))
+			if err != nil {
+				t.Fatal(err)
+			} else if owns != expect {
+				t.Errorf("Owns(%s): expected %v, got %v", iri, expect, owns)
+			}
+		}
+	})
+	t.Run("NewIDs", func(t *testing.T) {
+		db := New(mustParse(testBase))
+		a, err := db.NewID(ctx, streams.NewActivityStreamsNote())
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := db.NewID(ctx, streams.NewActivityStreamsCreate())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.String() != "https://example.com/note/1" {
+			t.Errorf("unexpected id: %s", a)
+		}
+		if b.String() != "https://example.com/create/2" {
+			t.Errorf("unexpected id: %s", b)
+		}
+	})
+}
+
+func TestActors(t *testing.T) {
+	ctx := context.Background()
+	db := New(mustParse(testBase))
+	if err := db.Create(ctx, newTestActor()); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("IndexesBoxes", func(t *testing.T) {
+		if a, err := db.ActorForInbox(ctx, mustParse(testInboxIRI)); err != nil {
+			t.Fatal(err)
+		} else if a.String() != testActorIRI {
+			t.Errorf("unexpected actor: %s", a)
+		}
+		if a, err := db.ActorForOutbox(ctx, mustParse(testOutboxIRI)); err != nil {
+			t.Fatal(err)
+		} else if a.String() != testActorIRI {
+			t.Errorf("unexpected actor: %s", a)
+		}
+		if o, err := db.OutboxForInbox(ctx, mustParse(testInboxIRI)); err != nil {
+			t.Fatal(err)
+		} else if o.String() != testOutboxIRI {
+			t.Errorf("unexpected outbox: %s", o)
+		}
+	})
+	t.Run("UpdatesFollowers", func(t *testing.T) {
+		f, err := db.Followers(ctx, mustParse(testActorIRI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testPeerIRI))
+		f.SetActivityStreamsItems(items)
+		if err := db.Update(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+		f, err = db.Followers(ctx, mustParse(testActorIRI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.GetActivityStreamsItems().Len() != 1 {
+			t.Fatalf("expected one follower")
+		}
+	})
+	t.Run("ReturnsErrorWhenNoLiked", func(t *testing.T) {
+		if _, err := db.Liked(ctx, mustParse(testActorIRI)); err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+	t.Run("PrependsToInbox", func(t *testing.T) {
+		inbox, err := db.GetInbox(ctx, mustParse(testInboxIRI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		inbox.GetActivityStreamsOrderedItems().PrependIRI(mustParse(testPeerAct))
+		if err := db.SetInbox(ctx, inbox); err != nil {
+			t.Fatal(err)
+		}
+		if contains, err := db.InboxContains(ctx, mustParse(testInboxIRI), mustParse(testPeerAct)); err != nil {
+			t.Fatal(err)
+		} else if !contains {
+			t.Fatalf("expected inbox to contain activity")
+		}
+	})
+	t.Run("ModifiesFollowersCollection", func(t *testing.T) {
+		if err := db.AppendToCollection(ctx, mustParse(testFollowers), mustParse(testActorIRI)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.RemoveFromCollection(ctx, mustParse(testFollowers), mustParse(testPeerIRI)); err != nil {
+			t.Fatal(err)
+		}
+		f, err := db.Followers(ctx, mustParse(testActorIRI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		items := f.GetActivityStreamsItems()
+		if items.Len() != 1 || items.At(0).GetIRI().String() != testActorIRI {
+			t.Fatalf("unexpected followers: %v", mustSerialize(t, f))
+		}
+	})
+	t.Run("PrependsToOutboxCollection", func(t *testing.T) {
+		for _, iri := range []string{testNoteIRI, testPeerAct} {
+			if err := db.PrependToCollection(ctx, mustParse(testOutboxIRI), mustParse(iri)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		outbox, err := db.GetOutbox(ctx, mustParse(testOutboxIRI))
+		if err != nil {
+			t.Fatal(err)
+		}
+		oi := outbox.GetActivityStreamsOrderedItems()
+		if oi.Len() != 2 || oi.At(0).GetIRI().String() != testPeerAct {
+			t.Fatalf("unexpected outbox: %v", mustSerialize(t, outbox))
+		}
+	})
+}
+
+func TestTransactions(t *testing.T) {
+	ctx := context.Background()
+	t.Run("RollsBackWrites", func(t *testing.T) {
+		db := New(mustParse(testBase))
+		if err := db.Create(ctx, newTestNote(testNoteIRI)); err != nil {
+			t.Fatal(err)
+		}
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(tx, newTestActor()); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Delete(tx, mustParse(testNoteIRI)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.PrependToCollection(tx, mustParse(testInboxIRI), mustParse(testPeerAct)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Rollback(tx); err != nil {
+			t.Fatal(err)
+		}
+		if exists, _ := db.Exists(ctx, mustParse(testActorIRI)); exists {
+			t.Errorf("expected actor creation to be rolled back")
+		}
+		if exists, _ := db.Exists(ctx, mustParse(testNoteIRI)); !exists {
+			t.Errorf("expected note deletion to be rolled back")
+		}
+		if _, err := db.ActorForInbox(ctx, mustParse(testInboxIRI)); err == nil {
+			t.Errorf("expected actor index to be rolled back")
+		}
+		if contains, _ := db.InboxContains(ctx, mustParse(testInboxIRI), mustParse(testPeerAct)); contains {
+			t.Errorf("expected inbox to be rolled back")
+		}
+	})
+	t.Run("CommitsWrites", func(t *testing.T) {
+		db := New(mustParse(testBase))
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(tx, newTestNote(testNoteIRI)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Commit(tx); err != nil {
+			t.Fatal(err)
+		}
+		if exists, _ := db.Exists(ctx, mustParse(testNoteIRI)); !exists {
+			t.Errorf("expected note to exist")
+		}
+		if err := db.Rollback(tx); err == nil {
+			t.Errorf("expected error ending a transaction twice")
+		}
+	})
+	t.Run("DoesNotLockWithinTransaction", func(t *testing.T) {
+		db := New(mustParse(testBase))
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := db.Lock(tx, mustParse(testNoteIRI)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Commit(tx); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("BeginWaitsForTransaction", func(t *testing.T) {
+		db := New(mustParse(testBase))
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if _, err := db.Begin(cctx); err == nil {
+			t.Fatalf("expected error")
+		}
+		if err := db.Commit(tx); err != nil {
+			t.Fatal(err)
+		}
+		tx, err = db.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Commit(tx); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// mustSerialize serializes the value, failing the test on error.
+func mustSerialize(t *testing.T, v vocab.Type) map[string]interface{} {
+	m, err := streams.Serialize(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// testApp implements the pub interfaces needed to use a federating Actor.
+type testApp struct{}
+
+func (testApp) AuthenticateGetInbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	return c, true, nil
+}
+func (testApp) AuthenticateGetOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	return c, true, nil
+}
+func (testApp) GetOutbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+	return nil, nil
+}
+func (testApp) NewTransport(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (pub.Transport, error) {
+	return nil, nil
+}
+func (testApp) PostInboxRequestBodyHook(c context.Context, r *http.Request, activity pub.Activity) (context.Context, error) {
+	return c, nil
+}
+func (testApp) AuthenticatePostInbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	return c, true, nil
+}
+func (testApp) Blocked(c context.Context, actorIRIs []*url.URL) (bool, error) {
+	return false, nil
+}
+func (testApp) FederatingCallbacks(c context.Context) (pub.FederatingWrappedCallbacks, []interface{}, error) {
+	return pub.FederatingWrappedCallbacks{}, nil, nil
+}
+func (testApp) DefaultCallback(c context.Context, activity pub.Activity) error {
+	return nil
+}
+func (testApp) MaxInboxForwardingRecursionDepth(c context.Context) int {
+	return 1
+}
+func (testApp) MaxDeliveryRecursionDepth(c context.Context) int {
+	return 1
+}
+func (testApp) FilterForwarding(c context.Context, potentialRecipients []*url.URL, a pub.Activity) ([]*url.URL, error) {
+	return nil, nil
+}
+func (testApp) GetInbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+	return nil, nil
+}
+func (testApp) Now() time.Time {
+	return time.Now()
+}
+
+func TestFederatingActor(t *testing.T) {
+	ctx := context.Background()
+	db := New(mustParse(testBase))
+	if err := db.Create(ctx, newTestActor()); err != nil {
+		t.Fatal(err)
+	}
+	actor := pub.NewFederatingActor(testApp{}, testApp{}, db, testApp{})
+	// Build the Create from a peer.
+	create := streams.NewActivityStreamsCreate()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(testPeerAct))
+	create.SetJSONLDId(id)
+	actorProp := streams.NewActivityStreamsActorProperty()
+	actorProp.AppendIRI(mustParse(testPeerIRI))
+	create.SetActivityStreamsActor(actorProp)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendActivityStreamsNote(newTestNote(testPeerNote))
+	create.SetActivityStreamsObject(op)
+	m, err := streams.Serialize(create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", testInboxIRI, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/activity+json")
+	resp := httptest.NewRecorder()
+	// Run & Verify
+	handled, err := actor.PostInbox(ctx, resp, req)
+	if err != nil {
+		t.Fatal(err)
+	} else if !handled {
+		t.Fatalf("expected request to be handled")
+	} else if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.Code)
+	}
+	if contains, err := db.InboxContains(ctx, mustParse(testInboxIRI), mustParse(testPeerAct)); err != nil {
+		t.Fatal(err)
+	} else if !contains {
+		t.Errorf("expected inbox to contain the activity")
+	}
+	for _, iri := range []string{testPeerAct, testPeerNote} {
+		if exists, err := db.Exists(ctx, mustParse(iri)); err != nil {
+			t.Fatal(err)
+		} else if !exists {
+			t.Errorf("expected %s to exist", iri)
+		}
+	}
+}
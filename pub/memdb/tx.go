@@ -0,0 +1,155 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// txKey is the context key for the transaction.
+type txKey struct{}
+
+// transaction journals how to undo each write made within it.
+type transaction struct {
+	db   *Database
+	undo []func()
+}
+
+// Begin starts a transaction, blocking until any other transaction has ended
+// or the context is done.
+//
+// Lock and Unlock are no-ops within the transaction, as transactions are
+// applied one at a time. So a transaction is held for as long as the caller
+// takes, including any network requests it makes before ending it.
+func (d *Database) Begin(c context.Context) (tx context.Context, err error) {
+	if d.txFrom(c) != nil {
+		return nil, fmt.Errorf("transaction already in progress")
+	}
+	select {
+	case d.txSem <- struct{}{}:
+	case <-c.Done():
+		return nil, c.Err()
+	}
+	return context.WithValue(c, txKey{}, &transaction{db: d}), nil
+}
+
+// Commit keeps the writes made within the transaction.
+func (d *Database) Commit(tx context.Context) error {
+	return d.endTx(tx, false)
+}
+
+// Rollback undoes the writes made within the transaction.
+func (d *Database) Rollback(tx context.Context) error {
+	return d.endTx(tx, true)
+}
+
+// endTx ends the transaction carried by the context, undoing its writes if
+// requested, and allows the next transaction to begin.
+func (d *Database) endTx(tx context.Context, rollback bool) error {
+	t := d.txFrom(tx)
+	if t == nil {
+		return fmt.Errorf("no transaction in progress")
+	}
+	if rollback {
+		d.mu.Lock()
+		for i := len(t.undo) - 1; i >= 0; i-- {
+			t.undo[i]()
+		}
+		d.mu.Unlock()
+	}
+	t.db = nil
+	t.undo = nil
+	<-d.txSem
+	return nil
+}
+
+// txFrom returns the transaction of this Database carried by the context, if
+// any.
+func (d *Database) txFrom(c context.Context) *transaction {
+	if t, ok := c.Value(txKey{}).(*transaction); ok && t.db == d {
+		return t
+	}
+	return nil
+}
+
+// journal records the undo function if the context carries a transaction.
+//
+// Must be called with mu held.
+func (d *Database) journal(c context.Context, undo func()) {
+	if t := d.txFrom(c); t != nil {
+		t.undo = append(t.undo, undo)
+	}
+}
+
+// putData sets the serialized entry for the key.
+//
+// Must be called with mu held.
+func (d *Database) putData(c context.Context, key string, b []byte) {
+	old, ok := d.data[key]
+	d.journal(c, func() {
+		if ok {
+			d.data[key] = old
+		} else {
+			delete(d.data, key)
+		}
+	})
+	d.data[key] = b
+}
+
+// deleteData removes the serialized entry for the key.
+//
+// Must be called with mu held.
+func (d *Database) deleteData(c context.Context, key string) {
+	old, ok := d.data[key]
+	if !ok {
+		return
+	}
+	d.journal(c, func() {
+		d.data[key] = old
+	})
+	delete(d.data, key)
+}
+
+// putBox sets the items of the inbox or outbox for the key.
+//
+// Must be called with mu held.
+func (d *Database) putBox(c context.Context, boxes map[string][]*url.URL, key string, items []*url.URL) {
+	old, ok := boxes[key]
+	d.journal(c, func() {
+		if ok {
+			boxes[key] = old
+		} else {
+			delete(boxes, key)
+		}
+	})
+	boxes[key] = items
+}
+
+// putIndex maps the box IRI key to the actor IRI.
+//
+// Must be called with mu held.
+func (d *Database) putIndex(c context.Context, index map[string]*url.URL, key string, actorIRI *url.URL) {
+	old, ok := index[key]
+	d.journal(c, func() {
+		if ok {
+			index[key] = old
+		} else {
+			delete(index, key)
+		}
+	})
+	index[key] = actorIRI
+}
+
+// deleteIndex removes the box IRI key from the index.
+//
+// Must be called with mu held.
+func (d *Database) deleteIndex(c context.Context, index map[string]*url.URL, key string) {
+	old, ok := index[key]
+	if !ok {
+		return
+	}
+	d.journal(c, func() {
+		index[key] = old
+	})
+	delete(index, key)
+}
@@ -0,0 +1,345 @@
+package pub
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// signatureInputHeader is the RFC 9421 Signature-Input header.
+	signatureInputHeader = "Signature-Input"
+	// contentDigestHeader is the RFC 9530 Content-Digest header.
+	contentDigestHeader = "Content-Digest"
+	// messageSignatureLabel labels the RFC 9421 signatures created by this
+	// library.
+	messageSignatureLabel = "sig1"
+	// signatureParamsComponent is the last line of an RFC 9421 signature
+	// base.
+	signatureParamsComponent = "@signature-params"
+)
+
+// MessageSignatureAlgorithm is an RFC 9421 HTTP Message Signature algorithm.
+type MessageSignatureAlgorithm string
+
+const (
+	// RsaV15Sha256 is RSASSA-PKCS1-v1_5 using SHA-256.
+	RsaV15Sha256 MessageSignatureAlgorithm = "rsa-v1_5-sha256"
+	// RsaPssSha512 is RSASSA-PSS using SHA-512.
+	RsaPssSha512 MessageSignatureAlgorithm = "rsa-pss-sha512"
+)
+
+// messageSignature is a parsed RFC 9421 signature of a request.
+type messageSignature struct {
+	// components are the covered component identifiers, in order.
+	components []string
+	// params is the serialized inner list and parameters, as received.
+	params  string
+	created time.Time
+	expires time.Time
+	keyId   string
+	alg     MessageSignatureAlgorithm
+	sig     []byte
+}
+
+// covers determines whether the component is covered by the signature.
+func (m *messageSignature) covers(component string) bool {
+	for _, c := range m.components {
+		if c == component {
+			return true
+		}
+	}
+	return false
+}
+
+// signMessage adds an RFC 9421 signature to the request, covering its method,
+// target URI, and, if there is a body, its Content-Digest, which is set.
+func signMessage(r *http.Request, body []byte, privKey crypto.PrivateKey, keyId string, alg MessageSignatureAlgorithm, created time.Time) error {
+	components := []string{"@method", "@target-uri"}
+	if body != nil {
+		sum := sha256.Sum256(body)
+		r.Header.Set(contentDigestHeader, "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		components = append(components, "content-digest")
+	}
+	var p bytes.Buffer
+	p.WriteString("(")
+	for i, c := range components {
+		if i > 0 {
+			p.WriteString(" ")
+		}
+		p.WriteString(strconv.Quote(c))
+	}
+	p.WriteString(")")
+	fmt.Fprintf(&p, ";created=%d;keyid=%s;alg=%s", created.Unix(), strconv.Quote(keyId), strconv.Quote(string(alg)))
+	m := &messageSignature{
+		components: components,
+		params:     p.String(),
+	}
+	base, err := signatureBase(r, m)
+	if err != nil {
+		return err
+	}
+	sig, err := signBase(privKey, alg, base)
+	if err != nil {
+		return err
+	}
+	r.Header.Set(signatureInputHeader, messageSignatureLabel+"="+m.params)
+	r.Header.Set(signatureHeader, messageSignatureLabel+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+// signBase signs the signature base with the algorithm.
+func signBase(privKey crypto.PrivateKey, alg MessageSignatureAlgorithm, base []byte) ([]byte, error) {
+	k, ok := privKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", privKey)
+	}
+	switch alg {
+	case RsaV15Sha256:
+		sum := sha256.Sum256(base)
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+	case RsaPssSha512:
+		sum := sha512.Sum512(base)
+		return rsa.SignPSS(rand.Reader, k, crypto.SHA512, sum[:], &rsa.PSSOptions{SaltLength: sha512.Size})
+	default:
+		return nil, fmt.Errorf("unsupported message signature algorithm %q", alg)
+	}
+}
+
+// verifyBase verifies the signature of the signature base. When the algorithm
+// is not given, it is determined by the public key.
+func verifyBase(pubKey crypto.PublicKey, alg MessageSignatureAlgorithm, base, sig []byte) error {
+	k, ok := pubKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("unsupported public key type %T", pubKey)
+	}
+	switch alg {
+	case RsaV15Sha256, "":
+		sum := sha256.Sum256(base)
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig)
+	case RsaPssSha512:
+		sum := sha512.Sum512(base)
+		return rsa.VerifyPSS(k, crypto.SHA512, sum[:], sig, &rsa.PSSOptions{SaltLength: sha512.Size})
+	default:
+		return fmt.Errorf("unsupported message signature algorithm %q", alg)
+	}
+}
+
+// signatureBase creates the RFC 9421 signature base of the request.
+func signatureBase(r *http.Request, m *messageSignature) ([]byte, error) {
+	var b bytes.Buffer
+	for _, c := range m.components {
+		v, err := componentValue(r, c)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "%s: %s\n", strconv.Quote(c), v)
+	}
+	fmt.Fprintf(&b, "%s: %s", strconv.Quote(signatureParamsComponent), m.params)
+	return b.Bytes(), nil
+}
+
+// componentValue obtains the value of a covered component of the request.
+//
+// A request received by a server is interpreted as having an HTTPS scheme.
+func componentValue(r *http.Request, component string) (string, error) {
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	scheme := r.URL.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	switch component {
+	case "@method":
+		return r.Method, nil
+	case "@target-uri":
+		return scheme + "://" + host + r.URL.RequestURI(), nil
+	case "@authority":
+		return strings.ToLower(host), nil
+	case "@scheme":
+		return scheme, nil
+	case "@request-target":
+		return r.URL.RequestURI(), nil
+	case "@path":
+		return path, nil
+	case "@query":
+		return "?" + r.URL.RawQuery, nil
+	case "host":
+		return host, nil
+	}
+	if strings.HasPrefix(component, "@") {
+		return "", fmt.Errorf("unsupported derived component %q", component)
+	}
+	values, ok := r.Header[http.CanonicalHeaderKey(component)]
+	if !ok {
+		return "", fmt.Errorf("signed header %q is missing", component)
+	}
+	trimmed := make([]string, len(values))
+	for i, v := range values {
+		trimmed[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(trimmed, ", "), nil
+}
+
+// parseMessageSignature parses the first RFC 9421 signature of the request
+// that has both a Signature-Input and a Signature.
+func parseMessageSignature(h http.Header) (*messageSignature, error) {
+	inputs := splitDictionary(strings.Join(h[http.CanonicalHeaderKey(signatureInputHeader)], ","))
+	sigs := splitDictionary(strings.Join(h[http.CanonicalHeaderKey(signatureHeader)], ","))
+	for _, label := range inputs.labels {
+		sig, ok := sigs.members[label]
+		if !ok {
+			continue
+		}
+		if len(sig) < 2 || sig[0] != ':' || sig[len(sig)-1] != ':' {
+			return nil, fmt.Errorf("signature %q is not a byte sequence", label)
+		}
+		b, err := base64.StdEncoding.DecodeString(sig[1 : len(sig)-1])
+		if err != nil {
+			return nil, fmt.Errorf("signature %q is malformed: %s", label, err)
+		}
+		m, err := parseSignatureInput(inputs.members[label])
+		if err != nil {
+			return nil, err
+		}
+		m.sig = b
+		return m, nil
+	}
+	return nil, fmt.Errorf("no message signature")
+}
+
+// parseSignatureInput parses the covered components and parameters of a
+// Signature-Input member.
+func parseSignatureInput(s string) (*messageSignature, error) {
+	m := &messageSignature{params: s}
+	if !strings.HasPrefix(s, "(") {
+		return nil, fmt.Errorf("signature input is not an inner list")
+	}
+	end := strings.Index(s, ")")
+	if end < 0 {
+		return nil, fmt.Errorf("signature input is not an inner list")
+	}
+	for _, c := range strings.Fields(s[1:end]) {
+		if len(c) < 2 || c[0] != '"' || c[len(c)-1] != '"' {
+			return nil, fmt.Errorf("unsupported component %s", c)
+		}
+		m.components = append(m.components, strings.ToLower(c[1:len(c)-1]))
+	}
+	for _, p := range splitOutsideQuotes(s[end+1:], ';') {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v := strings.Trim(kv[1], "\"")
+		switch kv[0] {
+		case "created", "expires":
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("malformed %s: %s", kv[0], err)
+			}
+			if kv[0] == "created" {
+				m.created = time.Unix(n, 0)
+			} else {
+				m.expires = time.Unix(n, 0)
+			}
+		case "keyid":
+			m.keyId = v
+		case "alg":
+			m.alg = MessageSignatureAlgorithm(v)
+		}
+	}
+	if m.created.IsZero() {
+		return nil, fmt.Errorf("signature input has no created time")
+	} else if m.keyId == "" {
+		return nil, fmt.Errorf("signature input has no keyid")
+	}
+	return m, nil
+}
+
+// dictionary is a structured field dictionary whose member values are kept
+// unparsed.
+type dictionary struct {
+	labels  []string
+	members map[string]string
+}
+
+// splitDictionary splits a structured field dictionary into its members.
+func splitDictionary(s string) dictionary {
+	d := dictionary{members: make(map[string]string)}
+	for _, member := range splitOutsideQuotes(s, ',') {
+		kv := strings.SplitN(strings.TrimSpace(member), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if _, ok := d.members[kv[0]]; !ok {
+			d.labels = append(d.labels, kv[0])
+		}
+		d.members[kv[0]] = kv[1]
+	}
+	return d
+}
+
+// splitOutsideQuotes splits the string on the separator, except where it is
+// within a quoted string.
+func splitOutsideQuotes(s string, sep byte) (parts []string) {
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// verifyContentDigest determines whether one of the supported digests in the
+// Content-Digest header matches the body. Unsupported digest algorithms are
+// ignored.
+func verifyContentDigest(h http.Header, body []byte) bool {
+	matched := false
+	for _, d := range splitOutsideQuotes(h.Get(contentDigestHeader), ',') {
+		kv := strings.SplitN(strings.TrimSpace(d), "=", 2)
+		if len(kv) != 2 || len(kv[1]) < 2 || kv[1][0] != ':' || kv[1][len(kv[1])-1] != ':' {
+			continue
+		}
+		var sum []byte
+		switch strings.ToLower(kv[0]) {
+		case "sha-256":
+			s := sha256.Sum256(body)
+			sum = s[:]
+		case "sha-512":
+			s := sha512.Sum512(body)
+			sum = s[:]
+		default:
+			continue
+		}
+		got, err := base64.StdEncoding.DecodeString(kv[1][1 : len(kv[1])-1])
+		if err != nil || subtle.ConstantTimeCompare(got, sum) != 1 {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
@@ -0,0 +1,84 @@
+package pub
+
+import (
+	"bytes"
+	"crypto"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newMessageSignedRequest creates a request to an inbox signed with an RFC
+// 9421 HTTP Message Signature, as received by a server.
+func newMessageSignedRequest(privKey crypto.PrivateKey, alg MessageSignatureAlgorithm, keyId string, body []byte) *http.Request {
+	sent, err := http.NewRequest("POST", testMyInboxIRI, bytes.NewReader(body))
+	if err != nil {
+		panic(err)
+	}
+	if err = signMessage(sent, body, privKey, keyId, alg, now()); err != nil {
+		panic(err)
+	}
+	r := httptest.NewRequest("POST", testMyInboxIRI, bytes.NewReader(body))
+	for name, v := range sent.Header {
+		r.Header[name] = v
+	}
+	return r
+}
+
+func TestMessageSignature(t *testing.T) {
+	key := mustGenerateKey()
+	body := []byte("test body")
+	t.Run("VerifiesSignedRequest", func(t *testing.T) {
+		for _, alg := range []MessageSignatureAlgorithm{RsaV15Sha256, RsaPssSha512} {
+			// Setup
+			r := newMessageSignedRequest(key, alg, testFederatedKeyId, body)
+			// Run
+			m, err := parseMessageSignature(r.Header)
+			assertEqual(t, err, nil)
+			base, err := signatureBase(r, m)
+			assertEqual(t, err, nil)
+			// Verify
+			assertEqual(t, m.keyId, testFederatedKeyId)
+			assertEqual(t, m.alg, alg)
+			assertEqual(t, m.created.Unix(), now().Unix())
+			assertEqual(t, m.covers("content-digest"), true)
+			assertEqual(t, verifyBase(&key.PublicKey, m.alg, base, m.sig), nil)
+			assertEqual(t, verifyContentDigest(r.Header, body), true)
+		}
+	})
+	t.Run("DoesNotVerifyDifferentTarget", func(t *testing.T) {
+		// Setup
+		r := newMessageSignedRequest(key, RsaV15Sha256, testFederatedKeyId, body)
+		r.URL.Path = "/sam/inbox"
+		// Run
+		m, err := parseMessageSignature(r.Header)
+		assertEqual(t, err, nil)
+		base, err := signatureBase(r, m)
+		assertEqual(t, err, nil)
+		// Verify
+		assertNotEqual(t, verifyBase(&key.PublicKey, m.alg, base, m.sig), nil)
+	})
+	t.Run("DoesNotVerifyDifferentBody", func(t *testing.T) {
+		// Setup
+		r := newMessageSignedRequest(key, RsaV15Sha256, testFederatedKeyId, body)
+		// Run & Verify
+		assertEqual(t, verifyContentDigest(r.Header, []byte("other body")), false)
+	})
+	t.Run("ParsesLabelWithSignature", func(t *testing.T) {
+		// Setup
+		h := make(http.Header)
+		h.Set(signatureInputHeader, `other=("@method");created=1, sig2=("@method" "@target-uri");created=1618884473;keyid="test-key";alg="rsa-pss-sha512"`)
+		h.Set(signatureHeader, `sig2=:dGVzdA==:`)
+		// Run
+		m, err := parseMessageSignature(h)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(m.components), 2)
+		assertEqual(t, m.components[1], "@target-uri")
+		assertEqual(t, m.params, `("@method" "@target-uri");created=1618884473;keyid="test-key";alg="rsa-pss-sha512"`)
+		assertEqual(t, m.keyId, "test-key")
+		assertEqual(t, m.alg, RsaPssSha512)
+		assertEqual(t, m.created.Unix(), int64(1618884473))
+		assertByteEqual(t, m.sig, []byte("test"))
+	})
+}
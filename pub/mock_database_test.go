@@ -327,3 +327,470 @@ func (mr *MockDatabaseMockRecorder) Liked(c, actorIRI interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Liked", reflect.TypeOf((*MockDatabase)(nil).Liked), c, actorIRI)
 }
+
+// MockCollectionDatabase is a mock of CollectionDatabase interface
+type MockCollectionDatabase struct {
+	ctrl     *gomock.Controller
+	recorder *MockCollectionDatabaseMockRecorder
+}
+
+// MockCollectionDatabaseMockRecorder is the mock recorder for MockCollectionDatabase
+type MockCollectionDatabaseMockRecorder struct {
+	mock *MockCollectionDatabase
+}
+
+// NewMockCollectionDatabase creates a new mock instance
+func NewMockCollectionDatabase(ctrl *gomock.Controller) *MockCollectionDatabase {
+	mock := &MockCollectionDatabase{ctrl: ctrl}
+	mock.recorder = &MockCollectionDatabaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockCollectionDatabase) EXPECT() *MockCollectionDatabaseMockRecorder {
+	return m.recorder
+}
+
+// PrependToCollection mocks base method
+func (m *MockCollectionDatabase) PrependToCollection(c context.Context, collectionIRI, id *url.URL) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PrependToCollection", c, collectionIRI, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PrependToCollection indicates an expected call of PrependToCollection
+func (mr *MockCollectionDatabaseMockRecorder) PrependToCollection(c, collectionIRI, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PrependToCollection", reflect.TypeOf((*MockCollectionDatabase)(nil).PrependToCollection), c, collectionIRI, id)
+}
+
+// AppendToCollection mocks base method
+func (m *MockCollectionDatabase) AppendToCollection(c context.Context, collectionIRI, id *url.URL) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AppendToCollection", c, collectionIRI, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AppendToCollection indicates an expected call of AppendToCollection
+func (mr *MockCollectionDatabaseMockRecorder) AppendToCollection(c, collectionIRI, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AppendToCollection", reflect.TypeOf((*MockCollectionDatabase)(nil).AppendToCollection), c, collectionIRI, id)
+}
+
+// RemoveFromCollection mocks base method
+func (m *MockCollectionDatabase) RemoveFromCollection(c context.Context, collectionIRI, id *url.URL) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveFromCollection", c, collectionIRI, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveFromCollection indicates an expected call of RemoveFromCollection
+func (mr *MockCollectionDatabaseMockRecorder) RemoveFromCollection(c, collectionIRI, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveFromCollection", reflect.TypeOf((*MockCollectionDatabase)(nil).RemoveFromCollection), c, collectionIRI, id)
+}
+
+// MockTransactionalDatabase is a mock of TransactionalDatabase interface
+type MockTransactionalDatabase struct {
+	ctrl     *gomock.Controller
+	recorder *MockTransactionalDatabaseMockRecorder
+}
+
+// MockTransactionalDatabaseMockRecorder is the mock recorder for MockTransactionalDatabase
+type MockTransactionalDatabaseMockRecorder struct {
+	mock *MockTransactionalDatabase
+}
+
+// NewMockTransactionalDatabase creates a new mock instance
+func NewMockTransactionalDatabase(ctrl *gomock.Controller) *MockTransactionalDatabase {
+	mock := &MockTransactionalDatabase{ctrl: ctrl}
+	mock.recorder = &MockTransactionalDatabaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockTransactionalDatabase) EXPECT() *MockTransactionalDatabaseMockRecorder {
+	return m.recorder
+}
+
+// Begin mocks base method
+func (m *MockTransactionalDatabase) Begin(c context.Context) (context.Context, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Begin", c)
+	ret0, _ := ret[0].(context.Context)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Begin indicates an expected call of Begin
+func (mr *MockTransactionalDatabaseMockRecorder) Begin(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Begin", reflect.TypeOf((*MockTransactionalDatabase)(nil).Begin), c)
+}
+
+// Commit mocks base method
+func (m *MockTransactionalDatabase) Commit(tx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Commit", tx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Commit indicates an expected call of Commit
+func (mr *MockTransactionalDatabaseMockRecorder) Commit(tx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockTransactionalDatabase)(nil).Commit), tx)
+}
+
+// Rollback mocks base method
+func (m *MockTransactionalDatabase) Rollback(tx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rollback", tx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rollback indicates an expected call of Rollback
+func (mr *MockTransactionalDatabaseMockRecorder) Rollback(tx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rollback", reflect.TypeOf((*MockTransactionalDatabase)(nil).Rollback), tx)
+}
+
+// MockFollowRequestsDatabase is a mock of FollowRequestsDatabase interface
+type MockFollowRequestsDatabase struct {
+	ctrl     *gomock.Controller
+	recorder *MockFollowRequestsDatabaseMockRecorder
+}
+
+// MockFollowRequestsDatabaseMockRecorder is the mock recorder for MockFollowRequestsDatabase
+type MockFollowRequestsDatabaseMockRecorder struct {
+	mock *MockFollowRequestsDatabase
+}
+
+// NewMockFollowRequestsDatabase creates a new mock instance
+func NewMockFollowRequestsDatabase(ctrl *gomock.Controller) *MockFollowRequestsDatabase {
+	mock := &MockFollowRequestsDatabase{ctrl: ctrl}
+	mock.recorder = &MockFollowRequestsDatabaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockFollowRequestsDatabase) EXPECT() *MockFollowRequestsDatabaseMockRecorder {
+	return m.recorder
+}
+
+// FollowRequests mocks base method
+func (m *MockFollowRequestsDatabase) FollowRequests(c context.Context, actorIRI *url.URL) (vocab.ActivityStreamsCollection, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FollowRequests", c, actorIRI)
+	ret0, _ := ret[0].(vocab.ActivityStreamsCollection)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FollowRequests indicates an expected call of FollowRequests
+func (mr *MockFollowRequestsDatabaseMockRecorder) FollowRequests(c, actorIRI interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FollowRequests", reflect.TypeOf((*MockFollowRequestsDatabase)(nil).FollowRequests), c, actorIRI)
+}
+
+// SetFollowRequests mocks base method
+func (m *MockFollowRequestsDatabase) SetFollowRequests(c context.Context, actorIRI *url.URL, followRequests vocab.ActivityStreamsCollection) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetFollowRequests", c, actorIRI, followRequests)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetFollowRequests indicates an expected call of SetFollowRequests
+func (mr *MockFollowRequestsDatabaseMockRecorder) SetFollowRequests(c, actorIRI, followRequests interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetFollowRequests", reflect.TypeOf((*MockFollowRequestsDatabase)(nil).SetFollowRequests), c, actorIRI, followRequests)
+}
+
+// MockActorDeletionDatabase is a mock of ActorDeletionDatabase interface
+type MockActorDeletionDatabase struct {
+	ctrl     *gomock.Controller
+	recorder *MockActorDeletionDatabaseMockRecorder
+}
+
+// MockActorDeletionDatabaseMockRecorder is the mock recorder for MockActorDeletionDatabase
+type MockActorDeletionDatabaseMockRecorder struct {
+	mock *MockActorDeletionDatabase
+}
+
+// NewMockActorDeletionDatabase creates a new mock instance
+func NewMockActorDeletionDatabase(ctrl *gomock.Controller) *MockActorDeletionDatabase {
+	mock := &MockActorDeletionDatabase{ctrl: ctrl}
+	mock.recorder = &MockActorDeletionDatabaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockActorDeletionDatabase) EXPECT() *MockActorDeletionDatabaseMockRecorder {
+	return m.recorder
+}
+
+// ActorReferences mocks base method
+func (m *MockActorDeletionDatabase) ActorReferences(c context.Context, actorIRI *url.URL) (ActorReferences, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ActorReferences", c, actorIRI)
+	ret0, _ := ret[0].(ActorReferences)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ActorReferences indicates an expected call of ActorReferences
+func (mr *MockActorDeletionDatabaseMockRecorder) ActorReferences(c, actorIRI interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ActorReferences", reflect.TypeOf((*MockActorDeletionDatabase)(nil).ActorReferences), c, actorIRI)
+}
+
+// MockBlockedDatabase is a mock of BlockedDatabase interface
+type MockBlockedDatabase struct {
+	ctrl     *gomock.Controller
+	recorder *MockBlockedDatabaseMockRecorder
+}
+
+// MockBlockedDatabaseMockRecorder is the mock recorder for MockBlockedDatabase
+type MockBlockedDatabaseMockRecorder struct {
+	mock *MockBlockedDatabase
+}
+
+// NewMockBlockedDatabase creates a new mock instance
+func NewMockBlockedDatabase(ctrl *gomock.Controller) *MockBlockedDatabase {
+	mock := &MockBlockedDatabase{ctrl: ctrl}
+	mock.recorder = &MockBlockedDatabaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockBlockedDatabase) EXPECT() *MockBlockedDatabaseMockRecorder {
+	return m.recorder
+}
+
+// Blocked mocks base method
+func (m *MockBlockedDatabase) Blocked(c context.Context, actorIRI *url.URL) (vocab.ActivityStreamsCollection, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Blocked", c, actorIRI)
+	ret0, _ := ret[0].(vocab.ActivityStreamsCollection)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Blocked indicates an expected call of Blocked
+func (mr *MockBlockedDatabaseMockRecorder) Blocked(c, actorIRI interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Blocked", reflect.TypeOf((*MockBlockedDatabase)(nil).Blocked), c, actorIRI)
+}
+
+// SetBlocked mocks base method
+func (m *MockBlockedDatabase) SetBlocked(c context.Context, actorIRI *url.URL, blocked vocab.ActivityStreamsCollection) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetBlocked", c, actorIRI, blocked)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetBlocked indicates an expected call of SetBlocked
+func (mr *MockBlockedDatabaseMockRecorder) SetBlocked(c, actorIRI, blocked interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBlocked", reflect.TypeOf((*MockBlockedDatabase)(nil).SetBlocked), c, actorIRI, blocked)
+}
+
+// MockReportsDatabase is a mock of ReportsDatabase interface
+type MockReportsDatabase struct {
+	ctrl     *gomock.Controller
+	recorder *MockReportsDatabaseMockRecorder
+}
+
+// MockReportsDatabaseMockRecorder is the mock recorder for MockReportsDatabase
+type MockReportsDatabaseMockRecorder struct {
+	mock *MockReportsDatabase
+}
+
+// NewMockReportsDatabase creates a new mock instance
+func NewMockReportsDatabase(ctrl *gomock.Controller) *MockReportsDatabase {
+	mock := &MockReportsDatabase{ctrl: ctrl}
+	mock.recorder = &MockReportsDatabaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockReportsDatabase) EXPECT() *MockReportsDatabaseMockRecorder {
+	return m.recorder
+}
+
+// Reports mocks base method
+func (m *MockReportsDatabase) Reports(c context.Context, actorIRI *url.URL) (vocab.ActivityStreamsCollection, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reports", c, actorIRI)
+	ret0, _ := ret[0].(vocab.ActivityStreamsCollection)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reports indicates an expected call of Reports
+func (mr *MockReportsDatabaseMockRecorder) Reports(c, actorIRI interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reports", reflect.TypeOf((*MockReportsDatabase)(nil).Reports), c, actorIRI)
+}
+
+// SetReports mocks base method
+func (m *MockReportsDatabase) SetReports(c context.Context, actorIRI *url.URL, reports vocab.ActivityStreamsCollection) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetReports", c, actorIRI, reports)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetReports indicates an expected call of SetReports
+func (mr *MockReportsDatabaseMockRecorder) SetReports(c, actorIRI, reports interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReports", reflect.TypeOf((*MockReportsDatabase)(nil).SetReports), c, actorIRI, reports)
+}
+
+// MockVotesDatabase is a mock of VotesDatabase interface
+type MockVotesDatabase struct {
+	ctrl     *gomock.Controller
+	recorder *MockVotesDatabaseMockRecorder
+}
+
+// MockVotesDatabaseMockRecorder is the mock recorder for MockVotesDatabase
+type MockVotesDatabaseMockRecorder struct {
+	mock *MockVotesDatabase
+}
+
+// NewMockVotesDatabase creates a new mock instance
+func NewMockVotesDatabase(ctrl *gomock.Controller) *MockVotesDatabase {
+	mock := &MockVotesDatabase{ctrl: ctrl}
+	mock.recorder = &MockVotesDatabaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockVotesDatabase) EXPECT() *MockVotesDatabaseMockRecorder {
+	return m.recorder
+}
+
+// Votes mocks base method
+func (m *MockVotesDatabase) Votes(c context.Context, questionIRI *url.URL) (vocab.ActivityStreamsCollection, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Votes", c, questionIRI)
+	ret0, _ := ret[0].(vocab.ActivityStreamsCollection)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Votes indicates an expected call of Votes
+func (mr *MockVotesDatabaseMockRecorder) Votes(c, questionIRI interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Votes", reflect.TypeOf((*MockVotesDatabase)(nil).Votes), c, questionIRI)
+}
+
+// SetVotes mocks base method
+func (m *MockVotesDatabase) SetVotes(c context.Context, questionIRI *url.URL, votes vocab.ActivityStreamsCollection) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetVotes", c, questionIRI, votes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetVotes indicates an expected call of SetVotes
+func (mr *MockVotesDatabaseMockRecorder) SetVotes(c, questionIRI, votes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetVotes", reflect.TypeOf((*MockVotesDatabase)(nil).SetVotes), c, questionIRI, votes)
+}
+
+// MockEventsDatabase is a mock of EventsDatabase interface
+type MockEventsDatabase struct {
+	ctrl     *gomock.Controller
+	recorder *MockEventsDatabaseMockRecorder
+}
+
+// MockEventsDatabaseMockRecorder is the mock recorder for MockEventsDatabase
+type MockEventsDatabaseMockRecorder struct {
+	mock *MockEventsDatabase
+}
+
+// NewMockEventsDatabase creates a new mock instance
+func NewMockEventsDatabase(ctrl *gomock.Controller) *MockEventsDatabase {
+	mock := &MockEventsDatabase{ctrl: ctrl}
+	mock.recorder = &MockEventsDatabaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockEventsDatabase) EXPECT() *MockEventsDatabaseMockRecorder {
+	return m.recorder
+}
+
+// Attendees mocks base method
+func (m *MockEventsDatabase) Attendees(c context.Context, eventIRI *url.URL, rsvp RSVP) (vocab.ActivityStreamsCollection, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Attendees", c, eventIRI, rsvp)
+	ret0, _ := ret[0].(vocab.ActivityStreamsCollection)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Attendees indicates an expected call of Attendees
+func (mr *MockEventsDatabaseMockRecorder) Attendees(c, eventIRI, rsvp interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Attendees", reflect.TypeOf((*MockEventsDatabase)(nil).Attendees), c, eventIRI, rsvp)
+}
+
+// SetAttendees mocks base method
+func (m *MockEventsDatabase) SetAttendees(c context.Context, eventIRI *url.URL, rsvp RSVP, attendees vocab.ActivityStreamsCollection) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetAttendees", c, eventIRI, rsvp, attendees)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetAttendees indicates an expected call of SetAttendees
+func (mr *MockEventsDatabaseMockRecorder) SetAttendees(c, eventIRI, rsvp, attendees interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAttendees", reflect.TypeOf((*MockEventsDatabase)(nil).SetAttendees), c, eventIRI, rsvp, attendees)
+}
+
+// MockFollowingDatabase is a mock of FollowingDatabase interface
+type MockFollowingDatabase struct {
+	ctrl     *gomock.Controller
+	recorder *MockFollowingDatabaseMockRecorder
+}
+
+// MockFollowingDatabaseMockRecorder is the mock recorder for MockFollowingDatabase
+type MockFollowingDatabaseMockRecorder struct {
+	mock *MockFollowingDatabase
+}
+
+// NewMockFollowingDatabase creates a new mock instance
+func NewMockFollowingDatabase(ctrl *gomock.Controller) *MockFollowingDatabase {
+	mock := &MockFollowingDatabase{ctrl: ctrl}
+	mock.recorder = &MockFollowingDatabaseMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockFollowingDatabase) EXPECT() *MockFollowingDatabaseMockRecorder {
+	return m.recorder
+}
+
+// LocalFollowers mocks base method
+func (m *MockFollowingDatabase) LocalFollowers(c context.Context, actorIRI *url.URL) ([]*url.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LocalFollowers", c, actorIRI)
+	ret0, _ := ret[0].([]*url.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LocalFollowers indicates an expected call of LocalFollowers
+func (mr *MockFollowingDatabaseMockRecorder) LocalFollowers(c, actorIRI interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LocalFollowers", reflect.TypeOf((*MockFollowingDatabase)(nil).LocalFollowers), c, actorIRI)
+}
@@ -260,3 +260,200 @@ func (mr *MockDelegateActorMockRecorder) GetInbox(c, r interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInbox", reflect.TypeOf((*MockDelegateActor)(nil).GetInbox), c, r)
 }
+
+// MockSharedInboxDelegateActor is a mock of SharedInboxDelegateActor interface
+type MockSharedInboxDelegateActor struct {
+	ctrl     *gomock.Controller
+	recorder *MockSharedInboxDelegateActorMockRecorder
+}
+
+// MockSharedInboxDelegateActorMockRecorder is the mock recorder for MockSharedInboxDelegateActor
+type MockSharedInboxDelegateActorMockRecorder struct {
+	mock *MockSharedInboxDelegateActor
+}
+
+// NewMockSharedInboxDelegateActor creates a new mock instance
+func NewMockSharedInboxDelegateActor(ctrl *gomock.Controller) *MockSharedInboxDelegateActor {
+	mock := &MockSharedInboxDelegateActor{ctrl: ctrl}
+	mock.recorder = &MockSharedInboxDelegateActorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockSharedInboxDelegateActor) EXPECT() *MockSharedInboxDelegateActorMockRecorder {
+	return m.recorder
+}
+
+// SharedInboxRecipients mocks base method
+func (m *MockSharedInboxDelegateActor) SharedInboxRecipients(c context.Context, activity Activity) ([]*url.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SharedInboxRecipients", c, activity)
+	ret0, _ := ret[0].([]*url.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SharedInboxRecipients indicates an expected call of SharedInboxRecipients
+func (mr *MockSharedInboxDelegateActorMockRecorder) SharedInboxRecipients(c, activity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SharedInboxRecipients", reflect.TypeOf((*MockSharedInboxDelegateActor)(nil).SharedInboxRecipients), c, activity)
+}
+
+// MockFollowRequestsDelegateActor is a mock of FollowRequestsDelegateActor interface
+type MockFollowRequestsDelegateActor struct {
+	ctrl     *gomock.Controller
+	recorder *MockFollowRequestsDelegateActorMockRecorder
+}
+
+// MockFollowRequestsDelegateActorMockRecorder is the mock recorder for MockFollowRequestsDelegateActor
+type MockFollowRequestsDelegateActorMockRecorder struct {
+	mock *MockFollowRequestsDelegateActor
+}
+
+// NewMockFollowRequestsDelegateActor creates a new mock instance
+func NewMockFollowRequestsDelegateActor(ctrl *gomock.Controller) *MockFollowRequestsDelegateActor {
+	mock := &MockFollowRequestsDelegateActor{ctrl: ctrl}
+	mock.recorder = &MockFollowRequestsDelegateActorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockFollowRequestsDelegateActor) EXPECT() *MockFollowRequestsDelegateActorMockRecorder {
+	return m.recorder
+}
+
+// FollowRequests mocks base method
+func (m *MockFollowRequestsDelegateActor) FollowRequests(c context.Context, outboxIRI *url.URL) ([]vocab.ActivityStreamsFollow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FollowRequests", c, outboxIRI)
+	ret0, _ := ret[0].([]vocab.ActivityStreamsFollow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FollowRequests indicates an expected call of FollowRequests
+func (mr *MockFollowRequestsDelegateActorMockRecorder) FollowRequests(c, outboxIRI interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FollowRequests", reflect.TypeOf((*MockFollowRequestsDelegateActor)(nil).FollowRequests), c, outboxIRI)
+}
+
+// ResolveFollowRequest mocks base method
+func (m *MockFollowRequestsDelegateActor) ResolveFollowRequest(c context.Context, outboxIRI, followIRI *url.URL, approve bool) (Activity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResolveFollowRequest", c, outboxIRI, followIRI, approve)
+	ret0, _ := ret[0].(Activity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResolveFollowRequest indicates an expected call of ResolveFollowRequest
+func (mr *MockFollowRequestsDelegateActorMockRecorder) ResolveFollowRequest(c, outboxIRI, followIRI, approve interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResolveFollowRequest", reflect.TypeOf((*MockFollowRequestsDelegateActor)(nil).ResolveFollowRequest), c, outboxIRI, followIRI, approve)
+}
+
+// MockReportsDelegateActor is a mock of ReportsDelegateActor interface
+type MockReportsDelegateActor struct {
+	ctrl     *gomock.Controller
+	recorder *MockReportsDelegateActorMockRecorder
+}
+
+// MockReportsDelegateActorMockRecorder is the mock recorder for MockReportsDelegateActor
+type MockReportsDelegateActorMockRecorder struct {
+	mock *MockReportsDelegateActor
+}
+
+// NewMockReportsDelegateActor creates a new mock instance
+func NewMockReportsDelegateActor(ctrl *gomock.Controller) *MockReportsDelegateActor {
+	mock := &MockReportsDelegateActor{ctrl: ctrl}
+	mock.recorder = &MockReportsDelegateActorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockReportsDelegateActor) EXPECT() *MockReportsDelegateActorMockRecorder {
+	return m.recorder
+}
+
+// Reports mocks base method
+func (m *MockReportsDelegateActor) Reports(c context.Context, outboxIRI *url.URL) ([]vocab.ActivityStreamsFlag, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reports", c, outboxIRI)
+	ret0, _ := ret[0].([]vocab.ActivityStreamsFlag)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reports indicates an expected call of Reports
+func (mr *MockReportsDelegateActorMockRecorder) Reports(c, outboxIRI interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reports", reflect.TypeOf((*MockReportsDelegateActor)(nil).Reports), c, outboxIRI)
+}
+
+// ResolveReport mocks base method
+func (m *MockReportsDelegateActor) ResolveReport(c context.Context, outboxIRI, flagIRI *url.URL) (vocab.ActivityStreamsFlag, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResolveReport", c, outboxIRI, flagIRI)
+	ret0, _ := ret[0].(vocab.ActivityStreamsFlag)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResolveReport indicates an expected call of ResolveReport
+func (mr *MockReportsDelegateActorMockRecorder) ResolveReport(c, outboxIRI, flagIRI interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResolveReport", reflect.TypeOf((*MockReportsDelegateActor)(nil).ResolveReport), c, outboxIRI, flagIRI)
+}
+
+// NewReport mocks base method
+func (m *MockReportsDelegateActor) NewReport(c context.Context, outboxIRI, instanceActorIRI *url.URL, objects []*url.URL, content string) (vocab.ActivityStreamsFlag, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewReport", c, outboxIRI, instanceActorIRI, objects, content)
+	ret0, _ := ret[0].(vocab.ActivityStreamsFlag)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewReport indicates an expected call of NewReport
+func (mr *MockReportsDelegateActorMockRecorder) NewReport(c, outboxIRI, instanceActorIRI, objects, content interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewReport", reflect.TypeOf((*MockReportsDelegateActor)(nil).NewReport), c, outboxIRI, instanceActorIRI, objects, content)
+}
+
+// MockRelayDelegateActor is a mock of RelayDelegateActor interface
+type MockRelayDelegateActor struct {
+	ctrl     *gomock.Controller
+	recorder *MockRelayDelegateActorMockRecorder
+}
+
+// MockRelayDelegateActorMockRecorder is the mock recorder for MockRelayDelegateActor
+type MockRelayDelegateActorMockRecorder struct {
+	mock *MockRelayDelegateActor
+}
+
+// NewMockRelayDelegateActor creates a new mock instance
+func NewMockRelayDelegateActor(ctrl *gomock.Controller) *MockRelayDelegateActor {
+	mock := &MockRelayDelegateActor{ctrl: ctrl}
+	mock.recorder = &MockRelayDelegateActorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockRelayDelegateActor) EXPECT() *MockRelayDelegateActorMockRecorder {
+	return m.recorder
+}
+
+// NewRelayFollow mocks base method
+func (m *MockRelayDelegateActor) NewRelayFollow(c context.Context, outboxIRI, relayIRI *url.URL) (vocab.ActivityStreamsFollow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewRelayFollow", c, outboxIRI, relayIRI)
+	ret0, _ := ret[0].(vocab.ActivityStreamsFollow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewRelayFollow indicates an expected call of NewRelayFollow
+func (mr *MockRelayDelegateActorMockRecorder) NewRelayFollow(c, outboxIRI, relayIRI interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewRelayFollow", reflect.TypeOf((*MockRelayDelegateActor)(nil).NewRelayFollow), c, outboxIRI, relayIRI)
+}
@@ -169,3 +169,260 @@ func (mr *MockFederatingProtocolMockRecorder) GetInbox(c, r interface{}) *gomock
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInbox", reflect.TypeOf((*MockFederatingProtocol)(nil).GetInbox), c, r)
 }
+
+// MockSharedInboxDirectory is a mock of SharedInboxDirectory interface
+type MockSharedInboxDirectory struct {
+	ctrl     *gomock.Controller
+	recorder *MockSharedInboxDirectoryMockRecorder
+}
+
+// MockSharedInboxDirectoryMockRecorder is the mock recorder for MockSharedInboxDirectory
+type MockSharedInboxDirectoryMockRecorder struct {
+	mock *MockSharedInboxDirectory
+}
+
+// NewMockSharedInboxDirectory creates a new mock instance
+func NewMockSharedInboxDirectory(ctrl *gomock.Controller) *MockSharedInboxDirectory {
+	mock := &MockSharedInboxDirectory{ctrl: ctrl}
+	mock.recorder = &MockSharedInboxDirectoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockSharedInboxDirectory) EXPECT() *MockSharedInboxDirectoryMockRecorder {
+	return m.recorder
+}
+
+// KnownSharedInboxes mocks base method
+func (m *MockSharedInboxDirectory) KnownSharedInboxes(c context.Context, outboxIRI *url.URL) ([]*url.URL, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "KnownSharedInboxes", c, outboxIRI)
+	ret0, _ := ret[0].([]*url.URL)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// KnownSharedInboxes indicates an expected call of KnownSharedInboxes
+func (mr *MockSharedInboxDirectoryMockRecorder) KnownSharedInboxes(c, outboxIRI interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "KnownSharedInboxes", reflect.TypeOf((*MockSharedInboxDirectory)(nil).KnownSharedInboxes), c, outboxIRI)
+}
+
+// MockActivityProofSigner is a mock of ActivityProofSigner interface
+type MockActivityProofSigner struct {
+	ctrl     *gomock.Controller
+	recorder *MockActivityProofSignerMockRecorder
+}
+
+// MockActivityProofSignerMockRecorder is the mock recorder for MockActivityProofSigner
+type MockActivityProofSignerMockRecorder struct {
+	mock *MockActivityProofSigner
+}
+
+// NewMockActivityProofSigner creates a new mock instance
+func NewMockActivityProofSigner(ctrl *gomock.Controller) *MockActivityProofSigner {
+	mock := &MockActivityProofSigner{ctrl: ctrl}
+	mock.recorder = &MockActivityProofSignerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockActivityProofSigner) EXPECT() *MockActivityProofSignerMockRecorder {
+	return m.recorder
+}
+
+// SignActivity mocks base method
+func (m *MockActivityProofSigner) SignActivity(c context.Context, outboxIRI *url.URL, activity map[string]interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SignActivity", c, outboxIRI, activity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SignActivity indicates an expected call of SignActivity
+func (mr *MockActivityProofSignerMockRecorder) SignActivity(c, outboxIRI, activity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignActivity", reflect.TypeOf((*MockActivityProofSigner)(nil).SignActivity), c, outboxIRI, activity)
+}
+
+// MockOriginAuthorizer is a mock of OriginAuthorizer interface
+type MockOriginAuthorizer struct {
+	ctrl     *gomock.Controller
+	recorder *MockOriginAuthorizerMockRecorder
+}
+
+// MockOriginAuthorizerMockRecorder is the mock recorder for MockOriginAuthorizer
+type MockOriginAuthorizerMockRecorder struct {
+	mock *MockOriginAuthorizer
+}
+
+// NewMockOriginAuthorizer creates a new mock instance
+func NewMockOriginAuthorizer(ctrl *gomock.Controller) *MockOriginAuthorizer {
+	mock := &MockOriginAuthorizer{ctrl: ctrl}
+	mock.recorder = &MockOriginAuthorizerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockOriginAuthorizer) EXPECT() *MockOriginAuthorizerMockRecorder {
+	return m.recorder
+}
+
+// AuthorizeOrigin mocks base method
+func (m *MockOriginAuthorizer) AuthorizeOrigin(c context.Context, activity Activity, objectId *url.URL) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AuthorizeOrigin", c, activity, objectId)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AuthorizeOrigin indicates an expected call of AuthorizeOrigin
+func (mr *MockOriginAuthorizerMockRecorder) AuthorizeOrigin(c, activity, objectId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthorizeOrigin", reflect.TypeOf((*MockOriginAuthorizer)(nil).AuthorizeOrigin), c, activity, objectId)
+}
+
+// MockCollectionAuthorizer is a mock of CollectionAuthorizer interface
+type MockCollectionAuthorizer struct {
+	ctrl     *gomock.Controller
+	recorder *MockCollectionAuthorizerMockRecorder
+}
+
+// MockCollectionAuthorizerMockRecorder is the mock recorder for MockCollectionAuthorizer
+type MockCollectionAuthorizerMockRecorder struct {
+	mock *MockCollectionAuthorizer
+}
+
+// NewMockCollectionAuthorizer creates a new mock instance
+func NewMockCollectionAuthorizer(ctrl *gomock.Controller) *MockCollectionAuthorizer {
+	mock := &MockCollectionAuthorizer{ctrl: ctrl}
+	mock.recorder = &MockCollectionAuthorizerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockCollectionAuthorizer) EXPECT() *MockCollectionAuthorizerMockRecorder {
+	return m.recorder
+}
+
+// AuthorizeCollectionChange mocks base method
+func (m *MockCollectionAuthorizer) AuthorizeCollectionChange(c context.Context, activity Activity, collectionId *url.URL) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AuthorizeCollectionChange", c, activity, collectionId)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AuthorizeCollectionChange indicates an expected call of AuthorizeCollectionChange
+func (mr *MockCollectionAuthorizerMockRecorder) AuthorizeCollectionChange(c, activity, collectionId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthorizeCollectionChange", reflect.TypeOf((*MockCollectionAuthorizer)(nil).AuthorizeCollectionChange), c, activity, collectionId)
+}
+
+// MockGroupModerator is a mock of GroupModerator interface
+type MockGroupModerator struct {
+	ctrl     *gomock.Controller
+	recorder *MockGroupModeratorMockRecorder
+}
+
+// MockGroupModeratorMockRecorder is the mock recorder for MockGroupModerator
+type MockGroupModeratorMockRecorder struct {
+	mock *MockGroupModerator
+}
+
+// NewMockGroupModerator creates a new mock instance
+func NewMockGroupModerator(ctrl *gomock.Controller) *MockGroupModerator {
+	mock := &MockGroupModerator{ctrl: ctrl}
+	mock.recorder = &MockGroupModeratorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockGroupModerator) EXPECT() *MockGroupModeratorMockRecorder {
+	return m.recorder
+}
+
+// AcceptGroupActivity mocks base method
+func (m *MockGroupModerator) AcceptGroupActivity(c context.Context, groupIRI *url.URL, activity Activity) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcceptGroupActivity", c, groupIRI, activity)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcceptGroupActivity indicates an expected call of AcceptGroupActivity
+func (mr *MockGroupModeratorMockRecorder) AcceptGroupActivity(c, groupIRI, activity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptGroupActivity", reflect.TypeOf((*MockGroupModerator)(nil).AcceptGroupActivity), c, groupIRI, activity)
+}
+
+// AcceptGroupMember mocks base method
+func (m *MockGroupModerator) AcceptGroupMember(c context.Context, groupIRI, actorIRI *url.URL) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcceptGroupMember", c, groupIRI, actorIRI)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcceptGroupMember indicates an expected call of AcceptGroupMember
+func (mr *MockGroupModeratorMockRecorder) AcceptGroupMember(c, groupIRI, actorIRI interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptGroupMember", reflect.TypeOf((*MockGroupModerator)(nil).AcceptGroupMember), c, groupIRI, actorIRI)
+}
+
+// MockRelay is a mock of Relay interface
+type MockRelay struct {
+	ctrl     *gomock.Controller
+	recorder *MockRelayMockRecorder
+}
+
+// MockRelayMockRecorder is the mock recorder for MockRelay
+type MockRelayMockRecorder struct {
+	mock *MockRelay
+}
+
+// NewMockRelay creates a new mock instance
+func NewMockRelay(ctrl *gomock.Controller) *MockRelay {
+	mock := &MockRelay{ctrl: ctrl}
+	mock.recorder = &MockRelayMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockRelay) EXPECT() *MockRelayMockRecorder {
+	return m.recorder
+}
+
+// IsRelay mocks base method
+func (m *MockRelay) IsRelay(c context.Context, actorIRI *url.URL) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsRelay", c, actorIRI)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsRelay indicates an expected call of IsRelay
+func (mr *MockRelayMockRecorder) IsRelay(c, actorIRI interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsRelay", reflect.TypeOf((*MockRelay)(nil).IsRelay), c, actorIRI)
+}
+
+// AcceptRelayActivity mocks base method
+func (m *MockRelay) AcceptRelayActivity(c context.Context, relayIRI *url.URL, activity Activity) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcceptRelayActivity", c, relayIRI, activity)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcceptRelayActivity indicates an expected call of AcceptRelayActivity
+func (mr *MockRelayMockRecorder) AcceptRelayActivity(c, relayIRI, activity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcceptRelayActivity", reflect.TypeOf((*MockRelay)(nil).AcceptRelayActivity), c, relayIRI, activity)
+}
@@ -0,0 +1,499 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	// proofProperty is the Data Integrity 'proof' of a document.
+	proofProperty = "proof"
+	// signatureProperty is the Linked Data Signatures 'signature' of a
+	// document.
+	signatureProperty = "signature"
+	// dataIntegrityProofType is the type of Data Integrity proofs.
+	dataIntegrityProofType = "DataIntegrityProof"
+	// eddsaJcs2022Cryptosuite is the Data Integrity cryptosuite using
+	// Ed25519 and the JSON Canonicalization Scheme.
+	eddsaJcs2022Cryptosuite = "eddsa-jcs-2022"
+	// assertionMethodPurpose is the purpose of proofs asserting a document.
+	assertionMethodPurpose = "assertionMethod"
+	// rsaSignature2017Type is the type of Linked Data Signatures used by
+	// Mastodon.
+	rsaSignature2017Type = "RsaSignature2017"
+	// identityV1Context is the JSON-LD context of RsaSignature2017 options.
+	identityV1Context = "https://w3id.org/identity/v1"
+	// proofTimeFormat is the XML Schema dateTime format of proof creation
+	// times.
+	proofTimeFormat = "2006-01-02T15:04:05Z"
+	// base58Alphabet is the Bitcoin base58 alphabet used by base58btc
+	// multibase values.
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	// base58btcPrefix is the multibase prefix of base58btc values.
+	base58btcPrefix = "z"
+)
+
+var (
+	// ErrNoProof indicates that a document has no proof that can be
+	// verified.
+	ErrNoProof = errors.New("go-fed/activity: no supported proof")
+	// ErrProofSignerNotActor indicates that a document's proof was not
+	// created by its actor.
+	ErrProofSignerNotActor = errors.New("go-fed/activity: proof was not created by the actor")
+)
+
+// Canonicalizer canonicalizes a JSON-LD document into N-Quads using the
+// URDNA2015 algorithm, as needed by RsaSignature2017 Linked Data Signatures.
+//
+// No JSON-LD processor is provided by this library, so applications supply
+// their own, such as one built with github.com/piprate/json-gold.
+type Canonicalizer interface {
+	Canonicalize(c context.Context, doc map[string]interface{}) ([]byte, error)
+}
+
+// AddEddsaJcs2022Proof adds a Data Integrity 'proof' to the document, using
+// the eddsa-jcs-2022 cryptosuite with the assertionMethod purpose.
+//
+// The keyId identifies the public key among the 'publicKey' values, or the
+// Multikey among the 'assertionMethod' values, of the document's actor, so
+// that peers are able to verify the proof.
+func AddEddsaJcs2022Proof(doc map[string]interface{}, privKey ed25519.PrivateKey, keyId *url.URL, created time.Time) error {
+	proof := map[string]interface{}{
+		"type":               dataIntegrityProofType,
+		"cryptosuite":        eddsaJcs2022Cryptosuite,
+		"verificationMethod": keyId.String(),
+		"proofPurpose":       assertionMethodPurpose,
+		"created":            created.UTC().Format(proofTimeFormat),
+	}
+	hashData, err := eddsaJcs2022HashData(doc, proof)
+	if err != nil {
+		return err
+	}
+	sig := ed25519.Sign(privKey, hashData)
+	proof["proofValue"] = base58btcPrefix + base58Encode(sig)
+	doc[proofProperty] = proof
+	return nil
+}
+
+// AddRsaSignature2017 adds an RsaSignature2017 Linked Data 'signature' to the
+// document, as created by Mastodon.
+//
+// The keyId identifies the public key among the 'publicKey' values of the
+// document's actor, so that peers are able to verify the signature.
+func AddRsaSignature2017(c context.Context, canonicalizer Canonicalizer, doc map[string]interface{}, privKey *rsa.PrivateKey, keyId *url.URL, created time.Time) error {
+	sig := map[string]interface{}{
+		"type":    rsaSignature2017Type,
+		"creator": keyId.String(),
+		"created": created.UTC().Format(proofTimeFormat),
+	}
+	toBeSigned, err := rsaSignature2017Data(c, canonicalizer, doc, sig)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(toBeSigned)
+	b, err := rsa.SignPKCS1v15(rand.Reader, privKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return err
+	}
+	sig["signatureValue"] = base64.StdEncoding.EncodeToString(b)
+	doc[signatureProperty] = sig
+	return nil
+}
+
+// ProofVerifier verifies the proofs embedded in activities, so that
+// activities forwarded by a peer other than their author may be trusted
+// without fetching them again from their origin.
+//
+// Both eddsa-jcs-2022 Data Integrity proofs and RsaSignature2017 Linked Data
+// Signatures are supported. The latter requires a Canonicalizer. Ed25519 keys
+// are read from either the 'publicKeyPem' of a 'publicKey' or the
+// 'publicKeyMultibase' of a Multikey in the actor's 'assertionMethod'.
+//
+// Public keys are obtained, cached, and refetched on failure in the same way
+// as the HttpSigAuthenticator it is created with, and share its cache.
+type ProofVerifier struct {
+	keys          *HttpSigAuthenticator
+	canonicalizer Canonicalizer
+}
+
+// NewProofVerifier creates a ProofVerifier. The canonicalizer may be nil, in
+// which case RsaSignature2017 signatures are not verified.
+func NewProofVerifier(keys *HttpSigAuthenticator, canonicalizer Canonicalizer) *ProofVerifier {
+	return &ProofVerifier{
+		keys:          keys,
+		canonicalizer: canonicalizer,
+	}
+}
+
+// Verify verifies the proof embedded in the JSON of an activity, returning the
+// actor that created it.
+//
+// An eddsa-jcs-2022 'proof' is preferred over an RsaSignature2017 'signature'.
+// Returns ErrNoProof if there is neither, and ErrProofSignerNotActor if the
+// owner of the key is not the 'actor' of the activity. Other errors indicate
+// that the proof is invalid or that its key could not be obtained.
+func (p *ProofVerifier) Verify(c context.Context, doc map[string]interface{}) (signer *url.URL, err error) {
+	if proof := findEddsaJcs2022Proof(doc[proofProperty]); proof != nil {
+		signer, err = p.verifyEddsaJcs2022(c, doc, proof)
+	} else if sig, ok := doc[signatureProperty].(map[string]interface{}); ok && sig["type"] == rsaSignature2017Type && p.canonicalizer != nil {
+		signer, err = p.verifyRsaSignature2017(c, doc, sig)
+	} else {
+		return nil, ErrNoProof
+	}
+	if err != nil {
+		return nil, err
+	}
+	actor, ok := jsonId(doc["actor"])
+	if !ok || actor != signer.String() {
+		return nil, ErrProofSignerNotActor
+	}
+	return signer, nil
+}
+
+// verifyEddsaJcs2022 verifies an eddsa-jcs-2022 proof of the document.
+func (p *ProofVerifier) verifyEddsaJcs2022(c context.Context, doc, proof map[string]interface{}) (*url.URL, error) {
+	value, _ := proof["proofValue"].(string)
+	if !strings.HasPrefix(value, base58btcPrefix) {
+		return nil, fmt.Errorf("proofValue is not base58btc encoded")
+	}
+	sig, err := base58Decode(strings.TrimPrefix(value, base58btcPrefix))
+	if err != nil {
+		return nil, err
+	}
+	if proof["proofPurpose"] != assertionMethodPurpose {
+		return nil, fmt.Errorf("unsupported proofPurpose %v", proof["proofPurpose"])
+	}
+	unsecured := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		if k != proofProperty {
+			unsecured[k] = v
+		}
+	}
+	config := make(map[string]interface{}, len(proof))
+	for k, v := range proof {
+		if k != "proofValue" {
+			config[k] = v
+		}
+	}
+	hashData, err := eddsaJcs2022HashData(unsecured, config)
+	if err != nil {
+		return nil, err
+	}
+	keyId, _ := proof["verificationMethod"].(string)
+	return p.keys.verifyWithKey(c, keyId, func(pubKey crypto.PublicKey) error {
+		k, ok := pubKey.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("key is %T, not Ed25519", pubKey)
+		} else if !ed25519.Verify(k, hashData, sig) {
+			return fmt.Errorf("invalid proofValue")
+		}
+		return nil
+	})
+}
+
+// verifyRsaSignature2017 verifies an RsaSignature2017 signature of the
+// document.
+func (p *ProofVerifier) verifyRsaSignature2017(c context.Context, doc, sig map[string]interface{}) (*url.URL, error) {
+	value, _ := sig["signatureValue"].(string)
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("malformed signatureValue: %s", err)
+	}
+	unsigned := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		if k != signatureProperty {
+			unsigned[k] = v
+		}
+	}
+	toBeVerified, err := rsaSignature2017Data(c, p.canonicalizer, unsigned, sig)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(toBeVerified)
+	keyId, _ := sig["creator"].(string)
+	return p.keys.verifyWithKey(c, keyId, func(pubKey crypto.PublicKey) error {
+		k, ok := pubKey.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key is %T, not RSA", pubKey)
+		}
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], b)
+	})
+}
+
+// findEddsaJcs2022Proof finds an eddsa-jcs-2022 proof among one or more
+// 'proof' values.
+func findEddsaJcs2022Proof(v interface{}) map[string]interface{} {
+	var proofs []interface{}
+	if arr, ok := v.([]interface{}); ok {
+		proofs = arr
+	} else if v != nil {
+		proofs = []interface{}{v}
+	}
+	for _, elem := range proofs {
+		if proof, ok := elem.(map[string]interface{}); ok &&
+			proof["type"] == dataIntegrityProofType &&
+			proof["cryptosuite"] == eddsaJcs2022Cryptosuite {
+			return proof
+		}
+	}
+	return nil
+}
+
+// jsonId obtains the id of a JSON value that is either an IRI or an object.
+func jsonId(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case map[string]interface{}:
+		id, ok := t["id"].(string)
+		return id, ok
+	}
+	return "", false
+}
+
+// eddsaJcs2022HashData creates the data signed by an eddsa-jcs-2022 proof:
+// the hash of the canonical proof configuration followed by the hash of the
+// canonical unsecured document.
+func eddsaJcs2022HashData(unsecured, config map[string]interface{}) ([]byte, error) {
+	if ctx, ok := unsecured["@context"]; ok {
+		withCtx := make(map[string]interface{}, len(config)+1)
+		for k, v := range config {
+			withCtx[k] = v
+		}
+		withCtx["@context"] = ctx
+		config = withCtx
+	}
+	canonicalConfig, err := canonicalJSON(config)
+	if err != nil {
+		return nil, err
+	}
+	canonicalDoc, err := canonicalJSON(unsecured)
+	if err != nil {
+		return nil, err
+	}
+	configHash := sha256.Sum256(canonicalConfig)
+	docHash := sha256.Sum256(canonicalDoc)
+	return append(configHash[:], docHash[:]...), nil
+}
+
+// rsaSignature2017Data creates the data signed by an RsaSignature2017
+// signature: the hex SHA-256 hash of the canonical signature options followed
+// by that of the canonical unsigned document.
+func rsaSignature2017Data(c context.Context, canonicalizer Canonicalizer, unsigned, sig map[string]interface{}) ([]byte, error) {
+	options := map[string]interface{}{
+		"@context": identityV1Context,
+		"creator":  sig["creator"],
+		"created":  sig["created"],
+	}
+	canonicalOptions, err := canonicalizer.Canonicalize(c, options)
+	if err != nil {
+		return nil, err
+	}
+	canonicalDoc, err := canonicalizer.Canonicalize(c, unsigned)
+	if err != nil {
+		return nil, err
+	}
+	optionsHash := sha256.Sum256(canonicalOptions)
+	docHash := sha256.Sum256(canonicalDoc)
+	return []byte(hex.EncodeToString(optionsHash[:]) + hex.EncodeToString(docHash[:])), nil
+}
+
+// canonicalJSON serializes the value with the JSON Canonicalization Scheme of
+// RFC 8785.
+func canonicalJSON(v interface{}) ([]byte, error) {
+	// Normalize the value into the types decoded from JSON.
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var normalized interface{}
+	if err = d.Decode(&normalized); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = writeCanonicalJSON(&buf, normalized); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCanonicalJSON writes a decoded JSON value with the JSON
+// Canonicalization Scheme.
+func writeCanonicalJSON(b *bytes.Buffer, v interface{}) error {
+	switch t := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(t))
+	case json.Number:
+		f, err := t.Float64()
+		if err != nil {
+			return err
+		}
+		s, err := canonicalNumber(f)
+		if err != nil {
+			return err
+		}
+		b.WriteString(s)
+	case string:
+		writeCanonicalString(b, t)
+	case []interface{}:
+		b.WriteByte('[')
+		for i, elem := range t {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeCanonicalJSON(b, elem); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		// Properties are sorted by their UTF-16 code units.
+		sort.Slice(keys, func(i, j int) bool {
+			return lessUTF16(keys[i], keys[j])
+		})
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeCanonicalString(b, k)
+			b.WriteByte(':')
+			if err := writeCanonicalJSON(b, t[k]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	default:
+		return fmt.Errorf("cannot canonicalize JSON value of type %T", v)
+	}
+	return nil
+}
+
+// canonicalNumber formats the number like ECMAScript's Number.toString.
+func canonicalNumber(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("cannot canonicalize JSON number %v", f)
+	} else if f == 0 {
+		return "0", nil
+	}
+	if abs := math.Abs(f); abs >= 1e21 || abs < 1e-6 {
+		s := strconv.FormatFloat(f, 'e', -1, 64)
+		// ECMAScript does not pad the exponent.
+		i := strings.IndexByte(s, 'e')
+		mantissa, sign, exp := s[:i], s[i+1:i+2], strings.TrimLeft(s[i+2:], "0")
+		return mantissa + "e" + sign + exp, nil
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64), nil
+}
+
+// writeCanonicalString writes the string like ECMAScript's JSON.stringify.
+func writeCanonicalString(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
+
+// lessUTF16 compares the strings by their UTF-16 code units.
+func lessUTF16(a, b string) bool {
+	ua := utf16.Encode([]rune(a))
+	ub := utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// base58Encode encodes the bytes with the Bitcoin base58 alphabet.
+func base58Encode(b []byte) string {
+	n := new(big.Int).SetBytes(b)
+	radix := big.NewInt(int64(len(base58Alphabet)))
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	// Leading zero bytes are each encoded as the first character.
+	for i := 0; i < len(b) && b[i] == 0; i++ {
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// base58Decode decodes a string in the Bitcoin base58 alphabet.
+func base58Decode(s string) ([]byte, error) {
+	if !utf8.ValidString(s) {
+		return nil, fmt.Errorf("invalid base58 string")
+	}
+	n := new(big.Int)
+	radix := big.NewInt(int64(len(base58Alphabet)))
+	for _, r := range s {
+		i := strings.IndexRune(base58Alphabet, r)
+		if i < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", r)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(i)))
+	}
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
@@ -0,0 +1,227 @@
+package pub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	testFederatedEd25519KeyId = "https://other.example.com/dakota#ed25519-key"
+)
+
+// jcsCanonicalizer canonicalizes with the JSON Canonicalization Scheme, which
+// stands in for URDNA2015 in tests.
+type jcsCanonicalizer struct{}
+
+// Canonicalize canonicalizes the document.
+func (jcsCanonicalizer) Canonicalize(c context.Context, doc map[string]interface{}) ([]byte, error) {
+	return canonicalJSON(doc)
+}
+
+// newActorWithEd25519Key creates a federated Person with the Ed25519 key.
+func newActorWithEd25519Key(k ed25519.PublicKey) vocab.ActivityStreamsPerson {
+	p := streams.NewActivityStreamsPerson()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(testFederatedActorIRI))
+	p.SetJSONLDId(id)
+	pk := streams.NewW3IDSecurityV1PublicKey()
+	pkId := streams.NewJSONLDIdProperty()
+	pkId.Set(mustParse(testFederatedEd25519KeyId))
+	pk.SetJSONLDId(pkId)
+	pem := streams.NewW3IDSecurityV1PublicKeyPemProperty()
+	pem.Set(mustEd25519PublicKeyPem(k))
+	pk.SetW3IDSecurityV1PublicKeyPem(pem)
+	pkp := streams.NewW3IDSecurityV1PublicKeyProperty()
+	pkp.AppendW3IDSecurityV1PublicKey(pk)
+	p.SetW3IDSecurityV1PublicKey(pkp)
+	return p
+}
+
+// newActorWithMultikey creates the JSON of a federated Person with the Ed25519
+// key as a Multikey controlled by the controller.
+func newActorWithMultikey(k ed25519.PublicKey, controller string) map[string]interface{} {
+	m := mustSerialize(newActorWithEd25519Key(k))
+	delete(m, "publicKey")
+	m[assertionMethodProperty] = []interface{}{
+		map[string]interface{}{
+			"id":                 testFederatedEd25519KeyId,
+			"type":               multikeyType,
+			"controller":         controller,
+			"publicKeyMultibase": base58btcPrefix + base58Encode(append(append([]byte{}, ed25519MulticodecPrefix...), k...)),
+		},
+	}
+	return m
+}
+
+// mustEd25519PublicKeyPem encodes the Ed25519 key in PEM.
+func mustEd25519PublicKeyPem(k ed25519.PublicKey) string {
+	der := append(append([]byte{}, ed25519PKIXPrefix...), k...)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	t.Run("CanonicalizesRFC8785Example", func(t *testing.T) {
+		// Setup
+		var doc map[string]interface{}
+		err := json.Unmarshal([]byte(`{"numbers":[333333333.33333329,1E30,4.50,2e-3,0.000000000000000000000000001],"string":"\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/","literals":[null,true,false]}`), &doc)
+		assertEqual(t, err, nil)
+		// Run
+		b, err := canonicalJSON(doc)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, string(b), `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`)
+	})
+	t.Run("SortsByUTF16CodeUnits", func(t *testing.T) {
+		// Run
+		b, err := canonicalJSON(map[string]interface{}{
+			"\U0001F600": 1,
+			"דּ":          2,
+			"a":          3,
+		})
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, string(b), "{\"a\":3,\"\U0001F600\":1,\"דּ\":2}")
+	})
+}
+
+func TestBase58(t *testing.T) {
+	for _, s := range []string{"", "Hello World!", "\x00\x00\x01"} {
+		enc := base58Encode([]byte(s))
+		dec, err := base58Decode(enc)
+		assertEqual(t, err, nil)
+		assertEqual(t, string(dec), s)
+	}
+	assertEqual(t, base58Encode([]byte("Hello World!")), "2NEpo7TZRRrLZSi2U")
+	assertEqual(t, base58Encode([]byte("\x00\x00\x01")), "112")
+}
+
+func TestProofVerifier(t *testing.T) {
+	ctx := context.Background()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey := mustGenerateKey()
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	setupFn := func(ctl *gomock.Controller) (p *ProofVerifier, cm *MockCommonBehavior, tp *MockTransport, doc map[string]interface{}) {
+		setupData()
+		cm = NewMockCommonBehavior(ctl)
+		tp = NewMockTransport(ctl)
+		auth := NewHttpSigAuthenticator(cm, mustParse(testFetcherIRI), &manualClock{t: now()}, HttpSigPolicy{})
+		p = NewProofVerifier(auth, jcsCanonicalizer{})
+		doc = mustSerialize(testCreate)
+		return
+	}
+	expectFetch := func(cm *MockCommonBehavior, tp *MockTransport, keyId string, actor vocab.Type) {
+		cm.EXPECT().NewTransport(ctx, mustParse(testFetcherIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, mustParse(keyId)).Return(mustSerializeToBytes(actor), nil)
+	}
+	t.Run("VerifiesEddsaJcs2022Proof", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		p, cm, tp, doc := setupFn(ctl)
+		expectFetch(cm, tp, testFederatedEd25519KeyId, newActorWithEd25519Key(pub))
+		err := AddEddsaJcs2022Proof(doc, priv, mustParse(testFederatedEd25519KeyId), created)
+		assertEqual(t, err, nil)
+		// Run
+		signer, err := p.Verify(ctx, doc)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, signer.String(), testFederatedActorIRI)
+	})
+	t.Run("VerifiesEddsaJcs2022ProofWithMultikey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		p, cm, tp, doc := setupFn(ctl)
+		actor, err := json.Marshal(newActorWithMultikey(pub, testFederatedActorIRI))
+		assertEqual(t, err, nil)
+		cm.EXPECT().NewTransport(ctx, mustParse(testFetcherIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, mustParse(testFederatedEd25519KeyId)).Return(actor, nil)
+		err = AddEddsaJcs2022Proof(doc, priv, mustParse(testFederatedEd25519KeyId), created)
+		assertEqual(t, err, nil)
+		// Run
+		signer, err := p.Verify(ctx, doc)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, signer.String(), testFederatedActorIRI)
+	})
+	t.Run("RejectsMultikeyOfOtherController", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		p, cm, tp, doc := setupFn(ctl)
+		actor, err := json.Marshal(newActorWithMultikey(pub, testFederatedActorIRI2))
+		assertEqual(t, err, nil)
+		cm.EXPECT().NewTransport(ctx, mustParse(testFetcherIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, mustParse(testFederatedEd25519KeyId)).Return(actor, nil)
+		err = AddEddsaJcs2022Proof(doc, priv, mustParse(testFederatedEd25519KeyId), created)
+		assertEqual(t, err, nil)
+		// Run
+		_, err = p.Verify(ctx, doc)
+		// Verify
+		assertNotEqual(t, err, nil)
+	})
+	t.Run("VerifiesRsaSignature2017", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		p, cm, tp, doc := setupFn(ctl)
+		expectFetch(cm, tp, testFederatedKeyId, newActorWithKey(rsaKey))
+		err := AddRsaSignature2017(ctx, jcsCanonicalizer{}, doc, rsaKey, mustParse(testFederatedKeyId), created)
+		assertEqual(t, err, nil)
+		// Run
+		signer, err := p.Verify(ctx, doc)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, signer.String(), testFederatedActorIRI)
+	})
+	t.Run("RejectsModifiedActivity", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		p, cm, tp, doc := setupFn(ctl)
+		expectFetch(cm, tp, testFederatedEd25519KeyId, newActorWithEd25519Key(pub))
+		err := AddEddsaJcs2022Proof(doc, priv, mustParse(testFederatedEd25519KeyId), created)
+		assertEqual(t, err, nil)
+		doc["type"] = "Delete"
+		// Run
+		_, err = p.Verify(ctx, doc)
+		// Verify
+		assertNotEqual(t, err, nil)
+	})
+	t.Run("RejectsProofByOtherActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		p, cm, tp, doc := setupFn(ctl)
+		expectFetch(cm, tp, testFederatedEd25519KeyId, newActorWithEd25519Key(pub))
+		doc["actor"] = testFederatedActorIRI2
+		err := AddEddsaJcs2022Proof(doc, priv, mustParse(testFederatedEd25519KeyId), created)
+		assertEqual(t, err, nil)
+		// Run
+		_, err = p.Verify(ctx, doc)
+		// Verify
+		assertEqual(t, err, ErrProofSignerNotActor)
+	})
+	t.Run("ReturnsErrNoProof", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		p, _, _, doc := setupFn(ctl)
+		// Run
+		_, err := p.Verify(ctx, doc)
+		// Verify
+		assertEqual(t, err, ErrNoProof)
+	})
+}
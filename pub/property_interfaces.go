@@ -115,3 +115,62 @@ type actorer interface {
 type appendIRIer interface {
 	AppendIRI(v *url.URL)
 }
+
+// followerser is an ActivityStreams type with a 'followers' property
+type followerser interface {
+	GetActivityStreamsFollowers() vocab.ActivityStreamsFollowersProperty
+}
+
+// followinger is an ActivityStreams type with a 'following' property
+type followinger interface {
+	GetActivityStreamsFollowing() vocab.ActivityStreamsFollowingProperty
+}
+
+// alsoKnownAser is an ActivityStreams type with an 'alsoKnownAs' property
+type alsoKnownAser interface {
+	GetActivityStreamsAlsoKnownAs() vocab.ActivityStreamsAlsoKnownAsProperty
+}
+
+// movedToer is an ActivityStreams type with a 'movedTo' property
+type movedToer interface {
+	GetActivityStreamsMovedTo() vocab.ActivityStreamsMovedToProperty
+	SetActivityStreamsMovedTo(i vocab.ActivityStreamsMovedToProperty)
+}
+
+// namer is an ActivityStreams type with a 'name' property
+type namer interface {
+	GetActivityStreamsName() vocab.ActivityStreamsNameProperty
+}
+
+// replieser is an ActivityStreams type with a 'replies' property
+type replieser interface {
+	GetActivityStreamsReplies() vocab.ActivityStreamsRepliesProperty
+	SetActivityStreamsReplies(i vocab.ActivityStreamsRepliesProperty)
+}
+
+// totalItemser is an ActivityStreams type with a 'totalItems' property
+type totalItemser interface {
+	GetActivityStreamsTotalItems() vocab.ActivityStreamsTotalItemsProperty
+	SetActivityStreamsTotalItems(i vocab.ActivityStreamsTotalItemsProperty)
+}
+
+// likeder is an ActivityStreams type with a 'liked' property
+type likeder interface {
+	GetActivityStreamsLiked() vocab.ActivityStreamsLikedProperty
+}
+
+// featureder is an ActivityStreams type with a 'featured' property
+type featureder interface {
+	GetTootFeatured() vocab.TootFeaturedProperty
+}
+
+// unknownPropertieser is an ActivityStreams type that keeps properties outside
+// of its vocabulary.
+type unknownPropertieser interface {
+	GetUnknownProperties() map[string]interface{}
+}
+
+// publicKeyer is an ActivityStreams type with a 'publicKey' property
+type publicKeyer interface {
+	GetW3IDSecurityV1PublicKey() vocab.W3IDSecurityV1PublicKeyProperty
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -18,6 +19,7 @@ import (
 const (
 	testMyInboxIRI            = "https://example.com/addison/inbox"
 	testMyOutboxIRI           = "https://example.com/addison/outbox"
+	testMyInboxIRI2           = "https://example.com/sam/inbox"
 	testFederatedActivityIRI  = "https://other.example.com/activity/1"
 	testFederatedActivityIRI2 = "https://other.example.com/activity/2"
 	testFederatedActorIRI     = "https://other.example.com/dakota"
@@ -26,6 +28,9 @@ const (
 	testFederatedActorIRI4    = "https://other.example.com/jessie"
 	testFederatedInboxIRI     = "https://other.example.com/dakota/inbox"
 	testFederatedInboxIRI2    = "https://other.example.com/addison/inbox"
+	testFederatedFollowersIRI = "https://other.example.com/dakota/followers"
+	testFederatedSharedInbox  = "https://other.example.com/inbox"
+	testKnownSharedInbox      = "https://known.example.com/inbox"
 	testNoteId1               = "https://example.com/note/1"
 	testNoteId2               = "https://example.com/note/2"
 	testNewActivityIRI        = "https://example.com/new/1"
@@ -38,6 +43,8 @@ const (
 	testAudienceIRI           = "https://maybe.example.com/audience/1"
 	testAudienceIRI2          = "https://maybe.example.com/audience/2"
 	testPersonIRI             = "https://maybe.example.com/person"
+	testPersonIRI2            = "https://maybe.example.com/person2"
+	testGroupFollowersIRI     = "https://maybe.example.com/person/followers"
 	testServiceIRI            = "https://maybe.example.com/service"
 	testTagIRI                = "https://example.com/tag/1"
 	testTagIRI2               = "https://example.com/tag/2"
@@ -130,6 +137,8 @@ var (
 	testPerson vocab.ActivityStreamsPerson
 	// testMyPerson is my Person.
 	testMyPerson vocab.ActivityStreamsPerson
+	// testMyPerson2 is another Person on my server.
+	testMyPerson2 vocab.ActivityStreamsPerson
 	// testFederatedPerson1 is a federated Person.
 	testFederatedPerson1 vocab.ActivityStreamsPerson
 	// testFederatedPerson2 is a federated Person.
@@ -366,6 +375,16 @@ func setupData() {
 		outbox.SetIRI(mustParse(testMyOutboxIRI))
 		testMyPerson.SetActivityStreamsOutbox(outbox)
 	}()
+	// testMyPerson2
+	func() {
+		testMyPerson2 = streams.NewActivityStreamsPerson()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testPersonIRI2))
+		testMyPerson2.SetJSONLDId(id)
+		inbox := streams.NewActivityStreamsInboxProperty()
+		inbox.SetIRI(mustParse(testMyInboxIRI2))
+		testMyPerson2.SetActivityStreamsInbox(inbox)
+	}()
 	// testFederatedPerson1
 	func() {
 		testFederatedPerson1 = streams.NewActivityStreamsPerson()
@@ -479,6 +498,30 @@ func mustSerializeToBytes(t vocab.Type) []byte {
 	return b
 }
 
+// withInboxJSON adds the JSON of an activity posted to an inbox to the
+// context, as given to the PostInboxRequestBodyHook.
+func withInboxJSON(c context.Context, t vocab.Type) context.Context {
+	var m map[string]interface{}
+	if err := json.Unmarshal(mustSerializeToBytes(t), &m); err != nil {
+		panic(err)
+	}
+	return context.WithValue(c, inboxJSONKey{}, m)
+}
+
+// mustSerializeWithSharedInbox serializes an actor with a sharedInbox endpoint
+// to bytes or panics.
+func mustSerializeWithSharedInbox(t vocab.Type, sharedInbox string) []byte {
+	m := mustSerialize(t)
+	m["endpoints"] = map[string]interface{}{
+		"sharedInbox": sharedInbox,
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
 // mustSerialize serializes a type or panics.
 func mustSerialize(t vocab.Type) map[string]interface{} {
 	m, err := streams.Serialize(t)
@@ -705,3 +748,286 @@ func newActivityWithId(id string) vocab.ActivityStreamsActivity {
 	a.SetJSONLDId(i)
 	return a
 }
+
+// collectionDatabase is a mock Database that also implements the optional
+// CollectionDatabase interface.
+type collectionDatabase struct {
+	*MockDatabase
+	*MockCollectionDatabase
+}
+
+// followRequestsDatabase is a mock Database that also implements the optional
+// FollowRequestsDatabase interface.
+type followRequestsDatabase struct {
+	*MockDatabase
+	*MockFollowRequestsDatabase
+}
+
+// actorDeletionDatabase is a mock Database that also implements the optional
+// ActorDeletionDatabase interface.
+type actorDeletionDatabase struct {
+	*MockDatabase
+	*MockActorDeletionDatabase
+}
+
+// reportsDatabase is a mock Database that also implements the optional
+// ReportsDatabase interface.
+type reportsDatabase struct {
+	*MockDatabase
+	*MockReportsDatabase
+}
+
+// newTestFlag creates a Flag of the local note by the federated actor.
+func newTestFlag() vocab.ActivityStreamsFlag {
+	f := streams.NewActivityStreamsFlag()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(testFederatedActivityIRI))
+	f.SetJSONLDId(id)
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(mustParse(testFederatedActorIRI))
+	f.SetActivityStreamsActor(actor)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(mustParse(testNoteId1))
+	f.SetActivityStreamsObject(op)
+	return f
+}
+
+// newReportsCollection creates a collection of the Flags awaiting moderation.
+func newReportsCollection(flags ...vocab.ActivityStreamsFlag) vocab.ActivityStreamsCollection {
+	col := streams.NewActivityStreamsCollection()
+	items := streams.NewActivityStreamsItemsProperty()
+	for _, f := range flags {
+		items.AppendActivityStreamsFlag(f)
+	}
+	col.SetActivityStreamsItems(items)
+	return col
+}
+
+// votesDatabase is a mock Database that also implements the optional
+// VotesDatabase interface.
+type votesDatabase struct {
+	*MockDatabase
+	*MockVotesDatabase
+}
+
+// eventsDatabase is a mock Database that also implements the optional
+// EventsDatabase interface.
+type eventsDatabase struct {
+	*MockDatabase
+	*MockEventsDatabase
+}
+
+// newTestEvent creates a local Event.
+func newTestEvent() vocab.ActivityStreamsEvent {
+	e := streams.NewActivityStreamsEvent()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(testNoteId2))
+	e.SetJSONLDId(id)
+	return e
+}
+
+// newAttendees creates a collection of the actors that responded to an Event.
+func newAttendees(ids ...string) vocab.ActivityStreamsCollection {
+	col := streams.NewActivityStreamsCollection()
+	items := streams.NewActivityStreamsItemsProperty()
+	for _, id := range ids {
+		items.AppendIRI(mustParse(id))
+	}
+	col.SetActivityStreamsItems(items)
+	return col
+}
+
+// expectRSVP expects the response of the federated actor to the local Event to
+// be recorded, starting from the attendees with each response.
+func expectRSVP(ctx context.Context, db *MockDatabase, edb *MockEventsDatabase, before, after map[RSVP]vocab.ActivityStreamsCollection) {
+	db.EXPECT().Lock(ctx, mustParse(testNoteId2)).Times(2)
+	db.EXPECT().Owns(ctx, mustParse(testNoteId2)).Return(true, nil)
+	db.EXPECT().Get(ctx, mustParse(testNoteId2)).Return(newTestEvent(), nil)
+	db.EXPECT().Unlock(ctx, mustParse(testNoteId2)).Times(2)
+	for _, r := range []RSVP{RSVPGoing, RSVPInterested, RSVPDeclined} {
+		col, ok := before[r]
+		if !ok {
+			col = newAttendees()
+		}
+		edb.EXPECT().Attendees(ctx, mustParse(testNoteId2), r).Return(col, nil)
+		if a, ok := after[r]; ok {
+			want := string(mustSerializeToBytes(a))
+			edb.EXPECT().SetAttendees(ctx, mustParse(testNoteId2), r, gomock.Any()).DoAndReturn(
+				func(c context.Context, eventIRI *url.URL, rsvp RSVP, got vocab.ActivityStreamsCollection) error {
+					if g := string(mustSerializeToBytes(got)); g != want {
+						return fmt.Errorf("attendees for %d: got %s, want %s", rsvp, g, want)
+					}
+					return nil
+				})
+		}
+	}
+}
+
+// blockedDatabase is a mock Database that also implements the optional
+// BlockedDatabase interface.
+type blockedDatabase struct {
+	*MockDatabase
+	*MockBlockedDatabase
+}
+
+// followingDatabase is a mock Database that also implements the optional
+// FollowingDatabase interface.
+type followingDatabase struct {
+	*MockDatabase
+	*MockFollowingDatabase
+}
+
+// newBlockedCollection creates a collection of the blocked actors.
+func newBlockedCollection(ids ...string) vocab.ActivityStreamsCollection {
+	col := streams.NewActivityStreamsCollection()
+	items := streams.NewActivityStreamsItemsProperty()
+	for _, id := range ids {
+		items.AppendIRI(mustParse(id))
+	}
+	col.SetActivityStreamsItems(items)
+	return col
+}
+
+// authorizeAnyOrigin authorizes any change, for tests not concerned with the
+// origin of the objects.
+func authorizeAnyOrigin(c context.Context, activity Activity, objectId *url.URL) (bool, error) {
+	return true, nil
+}
+
+// authorizeAnyCollectionChange authorizes any change, for tests not concerned
+// with the owners of the collections.
+func authorizeAnyCollectionChange(c context.Context, activity Activity, collectionId *url.URL) (bool, error) {
+	return true, nil
+}
+
+// originAuthorizingFederatingProtocol is a mock FederatingProtocol that also
+// implements the optional OriginAuthorizer interface, authorizing any change.
+type originAuthorizingFederatingProtocol struct {
+	*MockFederatingProtocol
+}
+
+// AuthorizeOrigin authorizes the change.
+func (o originAuthorizingFederatingProtocol) AuthorizeOrigin(c context.Context, activity Activity, objectId *url.URL) (bool, error) {
+	return authorizeAnyOrigin(c, activity, objectId)
+}
+
+// transactionalDatabase is a mock Database that also implements the optional
+// TransactionalDatabase interface.
+type transactionalDatabase struct {
+	*MockDatabase
+	*MockTransactionalDatabase
+}
+
+// transactionalReportsDatabase is a mock Database that also implements the
+// optional ReportsDatabase and TransactionalDatabase interfaces.
+type transactionalReportsDatabase struct {
+	*MockDatabase
+	*MockReportsDatabase
+	*MockTransactionalDatabase
+}
+
+// txKey is the context key of the transaction begun by a mock
+// TransactionalDatabase.
+type txKey struct{}
+
+// groupModeratorFederatingProtocol is a mock FederatingProtocol that also
+// implements the optional GroupModerator interface.
+type groupModeratorFederatingProtocol struct {
+	*MockFederatingProtocol
+	*MockGroupModerator
+}
+
+// newTestGroup creates a local Group actor whose followers are its members.
+func newTestGroup() vocab.ActivityStreamsGroup {
+	g := streams.NewActivityStreamsGroup()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(testPersonIRI))
+	g.SetJSONLDId(id)
+	inbox := streams.NewActivityStreamsInboxProperty()
+	inbox.SetIRI(mustParse(testMyInboxIRI))
+	g.SetActivityStreamsInbox(inbox)
+	followers := streams.NewActivityStreamsFollowersProperty()
+	followers.SetIRI(mustParse(testGroupFollowersIRI))
+	g.SetActivityStreamsFollowers(followers)
+	return g
+}
+
+// relayFederatingProtocol is a mock FederatingProtocol that also implements the
+// optional Relay interface.
+type relayFederatingProtocol struct {
+	*MockFederatingProtocol
+	*MockRelay
+}
+
+// newTestRelay creates a local relay.
+func newTestRelay() vocab.ActivityStreamsApplication {
+	r := streams.NewActivityStreamsApplication()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(testPersonIRI))
+	r.SetJSONLDId(id)
+	inbox := streams.NewActivityStreamsInboxProperty()
+	inbox.SetIRI(mustParse(testMyInboxIRI))
+	r.SetActivityStreamsInbox(inbox)
+	followers := streams.NewActivityStreamsFollowersProperty()
+	followers.SetIRI(mustParse(testGroupFollowersIRI))
+	r.SetActivityStreamsFollowers(followers)
+	return r
+}
+
+// sharedInboxFederatingProtocol is a mock FederatingProtocol that also
+// implements the optional SharedInboxDirectory interface.
+type sharedInboxFederatingProtocol struct {
+	*MockFederatingProtocol
+	known []*url.URL
+}
+
+// KnownSharedInboxes returns the known sharedInbox IRIs.
+func (s sharedInboxFederatingProtocol) KnownSharedInboxes(c context.Context, outboxIRI *url.URL) ([]*url.URL, error) {
+	return s.known, nil
+}
+
+// proofSigningFederatingProtocol is a mock FederatingProtocol that also
+// implements the optional ActivityProofSigner interface.
+type proofSigningFederatingProtocol struct {
+	*MockFederatingProtocol
+	proof string
+}
+
+// SignActivity sets the proof.
+func (p proofSigningFederatingProtocol) SignActivity(c context.Context, outboxIRI *url.URL, activity map[string]interface{}) error {
+	activity[proofProperty] = p.proof
+	return nil
+}
+
+// proofAuthenticatingFederatingProtocol is a mock FederatingProtocol that also
+// implements the optional ProofAuthenticator interface.
+type proofAuthenticatingFederatingProtocol struct {
+	*MockFederatingProtocol
+	verifier *ProofVerifier
+}
+
+// ProofVerifier returns the ProofVerifier.
+func (p proofAuthenticatingFederatingProtocol) ProofVerifier(c context.Context) *ProofVerifier {
+	return p.verifier
+}
+
+// sharedInboxDelegateActor is a mock DelegateActor that also implements the
+// optional SharedInboxDelegateActor interface.
+type sharedInboxDelegateActor struct {
+	*MockDelegateActor
+	*MockSharedInboxDelegateActor
+}
+
+// followRequestsDelegateActor is a mock DelegateActor that also implements the
+// optional FollowRequestsDelegateActor interface.
+type followRequestsDelegateActor struct {
+	*MockDelegateActor
+	*MockFollowRequestsDelegateActor
+}
+
+// reportsDelegateActor is a mock DelegateActor that also implements the
+// optional ReportsDelegateActor interface.
+type reportsDelegateActor struct {
+	*MockDelegateActor
+	*MockReportsDelegateActor
+}
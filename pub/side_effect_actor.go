@@ -30,9 +30,43 @@ type sideEffectActor struct {
 
 // PostInboxRequestBodyHook defers to the delegate.
 func (a *sideEffectActor) PostInboxRequestBodyHook(c context.Context, r *http.Request, activity Activity) (context.Context, error) {
+	c, err := a.authenticateProof(c, activity)
+	if err != nil {
+		return c, err
+	}
 	return a.s2s.PostInboxRequestBodyHook(c, r, activity)
 }
 
+// authenticateProof makes the actor of the activity its signer if the request
+// was not signed by the actor, but the proof embedded in the activity is
+// verified by the ProofVerifier of a ProofAuthenticator.
+func (a *sideEffectActor) authenticateProof(c context.Context, activity Activity) (context.Context, error) {
+	pa, ok := a.s2s.(ProofAuthenticator)
+	if !ok {
+		return c, nil
+	}
+	pv := pa.ProofVerifier(c)
+	m, hasJSON := c.Value(inboxJSONKey{}).(map[string]interface{})
+	if pv == nil || !hasJSON {
+		return c, nil
+	}
+	if signer, signed := HttpSigKeyOwner(c); signed {
+		actors, err := activityActorIds(activity)
+		if err != nil {
+			return c, err
+		} else if containsIRI(actors, signer) {
+			return c, nil
+		}
+	}
+	// An activity without a valid proof is left to be authorized with
+	// the signer of the request.
+	signer, err := pv.Verify(c, m)
+	if err != nil {
+		return c, nil
+	}
+	return context.WithValue(c, httpSigOwnerKey{}, signer), nil
+}
+
 // PostOutboxRequestBodyHook defers to the delegate.
 func (a *sideEffectActor) PostOutboxRequestBodyHook(c context.Context, r *http.Request, data vocab.Type) (context.Context, error) {
 	return a.c2s.PostOutboxRequestBodyHook(c, r, data)
@@ -104,7 +138,17 @@ func (a *sideEffectActor) AuthorizePostInbox(c context.Context, w http.ResponseW
 // PostInbox handles the side effects of determining whether to block the peer's
 // request, adding the activity to the actor's inbox, and triggering side
 // effects based on the activity's type.
+//
+// When the Database is a TransactionalDatabase, this is done within a single
+// transaction.
 func (a *sideEffectActor) PostInbox(c context.Context, inboxIRI *url.URL, activity Activity) error {
+	return a.transact(c, func(c context.Context) error {
+		return a.postInbox(c, inboxIRI, activity)
+	})
+}
+
+// postInbox implements PostInbox, without any transaction.
+func (a *sideEffectActor) postInbox(c context.Context, inboxIRI *url.URL, activity Activity) error {
 	isNew, err := a.addToInboxIfNew(c, inboxIRI, activity)
 	if err != nil {
 		return err
@@ -120,6 +164,22 @@ func (a *sideEffectActor) PostInbox(c context.Context, inboxIRI *url.URL, activi
 		wrapped.newTransport = a.common.NewTransport
 		wrapped.deliver = a.Deliver
 		wrapped.addNewIds = a.AddNewIDs
+		wrapped.clock = a.clock
+		wrapped.repeated, _ = c.Value(sharedInboxRepeatKey{}).(bool)
+		if oa, ok := a.s2s.(OriginAuthorizer); ok {
+			wrapped.authorizeOrigin = oa.AuthorizeOrigin
+		}
+		if ca, ok := a.s2s.(CollectionAuthorizer); ok {
+			wrapped.authorizeCollectionChange = ca.AuthorizeCollectionChange
+		}
+		gm, isGroupModerator := a.s2s.(GroupModerator)
+		if isGroupModerator {
+			wrapped.acceptGroupMember = gm.AcceptGroupMember
+		}
+		r, isRelay := a.s2s.(Relay)
+		if isRelay {
+			wrapped.isRelay = r.IsRelay
+		}
 		res, err := streams.NewTypeResolver(wrapped.callbacks(other)...)
 		if err != nil {
 			return err
@@ -132,16 +192,364 @@ func (a *sideEffectActor) PostInbox(c context.Context, inboxIRI *url.URL, activi
 				return err
 			}
 		}
+		if isGroupModerator && isGroupActivity(activity) {
+			return a.announceToGroup(c, gm, inboxIRI, activity)
+		}
+		if isRelay && isRelayActivity(activity) {
+			return a.announceToRelay(c, r, inboxIRI, activity)
+		}
 	}
 	return nil
 }
 
+// announceToGroup redistributes an activity addressed to the local Group owning
+// the inbox by one of its members, wrapped in an Announce by the Group, to the
+// Group's followers.
+func (a *sideEffectActor) announceToGroup(c context.Context, gm GroupModerator, inboxIRI *url.URL, activity Activity) error {
+	err := a.db.Lock(c, inboxIRI)
+	if err != nil {
+		return err
+	}
+	// WARNING: Unlock is not deferred
+	groupIRI, err := a.db.ActorForInbox(c, inboxIRI)
+	if err != nil {
+		a.db.Unlock(c, inboxIRI)
+		return err
+	}
+	outboxIRI, err := a.db.OutboxForInbox(c, inboxIRI)
+	a.db.Unlock(c, inboxIRI)
+	if err != nil {
+		return err
+	}
+	// Unlock must be called by now and every branch above.
+	addressees, err := getAddressees(activity)
+	if err != nil {
+		return err
+	} else if !containsIRI(addressees, groupIRI) {
+		return nil
+	}
+	group, err := getGroup(c, a.db, groupIRI)
+	if err != nil || group == nil {
+		return err
+	}
+	fp := followersProperty(group)
+	if fp == nil {
+		return fmt.Errorf("cannot announce to the followers of group %s: it has no followers collection", groupIRI)
+	}
+	followersIRI, err := ToId(fp)
+	if err != nil {
+		return err
+	}
+	// Only the activities of members are redistributed.
+	followers, err := a.followers(c, groupIRI)
+	if err != nil || followers == nil {
+		return err
+	}
+	actorIRIs, err := activityActorIds(activity)
+	if err != nil || len(actorIRIs) == 0 {
+		return err
+	}
+	for _, actorIRI := range actorIRIs {
+		if isMember, err := collectionHasId(followers, actorIRI); err != nil || !isMember {
+			return err
+		}
+	}
+	if accept, err := gm.AcceptGroupActivity(c, groupIRI, activity); err != nil || !accept {
+		return err
+	}
+	announce, err := newGroupAnnounce(groupIRI, followersIRI, activity, hasPublic(addressees))
+	if err != nil {
+		return err
+	}
+	if err := a.AddNewIDs(c, announce); err != nil {
+		return err
+	}
+	return a.Deliver(c, outboxIRI, announce)
+}
+
+// announceToRelay redistributes the objects of a public activity received by
+// the local relay owning the inbox from the instance of one of its followers.
+// The relay announces them to all of its followers.
+func (a *sideEffectActor) announceToRelay(c context.Context, r Relay, inboxIRI *url.URL, activity Activity) error {
+	err := a.db.Lock(c, inboxIRI)
+	if err != nil {
+		return err
+	}
+	// WARNING: Unlock is not deferred
+	relayIRI, err := a.db.ActorForInbox(c, inboxIRI)
+	if err != nil {
+		a.db.Unlock(c, inboxIRI)
+		return err
+	}
+	outboxIRI, err := a.db.OutboxForInbox(c, inboxIRI)
+	a.db.Unlock(c, inboxIRI)
+	if err != nil {
+		return err
+	}
+	// Unlock must be called by now and every branch above.
+	if relay, err := r.IsRelay(c, relayIRI); err != nil || !relay {
+		return err
+	}
+	addressees, err := getAddressees(activity)
+	if err != nil || !hasPublic(addressees) {
+		return err
+	}
+	objectIRIs, err := objectIds(activity)
+	if err != nil || len(objectIRIs) == 0 {
+		return err
+	}
+	t, err := func() (vocab.Type, error) {
+		if err := a.db.Lock(c, relayIRI); err != nil {
+			return nil, err
+		}
+		defer a.db.Unlock(c, relayIRI)
+		return a.db.Get(c, relayIRI)
+	}()
+	if err != nil {
+		return err
+	}
+	fp := followersProperty(t)
+	if fp == nil {
+		return fmt.Errorf("cannot announce to the followers of relay %s: it has no followers collection", relayIRI)
+	}
+	followersIRI, err := ToId(fp)
+	if err != nil {
+		return err
+	}
+	// Subscriptions are made by an actor of each instance, on behalf of
+	// all of the actors of that instance.
+	followers, err := a.followers(c, relayIRI)
+	if err != nil || followers == nil {
+		return err
+	}
+	actorIRIs, err := activityActorIds(activity)
+	if err != nil || len(actorIRIs) == 0 {
+		return err
+	}
+	for _, actorIRI := range actorIRIs {
+		if subscribed, err := collectionHasHost(followers, actorIRI.Host); err != nil || !subscribed {
+			return err
+		}
+	}
+	if accept, err := r.AcceptRelayActivity(c, relayIRI, activity); err != nil || !accept {
+		return err
+	}
+	announce, err := newRelayAnnounce(relayIRI, followersIRI, objectIRIs)
+	if err != nil {
+		return err
+	}
+	if err := a.AddNewIDs(c, announce); err != nil {
+		return err
+	}
+	return a.Deliver(c, outboxIRI, announce)
+}
+
+// SharedInboxRecipients determines the inboxes of the actors on this server
+// that an activity received in the shared inbox is for: the actors it is
+// addressed to, and the local followers of its actors if it is addressed to the
+// Public collection or to the followers collection of one of its actors. The
+// local followers are only found if the Database implements FollowingDatabase.
+//
+// Activities that already exist in the database have been received before, so
+// no inboxes are returned for them. If the Database implements BlockedDatabase,
+// the inboxes of actors that blocked an actor of the activity are left out.
+func (a *sideEffectActor) SharedInboxRecipients(c context.Context, activity Activity) (inboxIRIs []*url.URL, err error) {
+	id := activity.GetJSONLDId().Get()
+	err = a.db.Lock(c, id)
+	if err != nil {
+		return
+	}
+	// WARNING: Unlock is not deferred
+	exists, err := a.db.Exists(c, id)
+	a.db.Unlock(c, id)
+	if err != nil || exists {
+		return
+	}
+	addressees, err := getAddressees(activity)
+	if err != nil {
+		return
+	}
+	isPublic := hasPublic(addressees)
+	addressees = filterURLs(addressees, IsPublic)
+	var actorIRIs []*url.URL
+	addressed := make(map[string]bool, len(addressees))
+	var local []*url.URL
+	for _, iri := range addressees {
+		addressed[iri.String()] = true
+		var owns bool
+		if owns, err = a.owns(c, iri); err != nil {
+			return
+		} else if owns {
+			local = append(local, iri)
+		}
+	}
+	// Find the local followers of the actors, if they are addressed.
+	fdb, hasFollowing := a.db.(FollowingDatabase)
+	if actor := activity.GetActivityStreamsActor(); actor != nil {
+		for iter := actor.Begin(); iter != actor.End(); iter = iter.Next() {
+			var actorIRI *url.URL
+			actorIRI, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			actorIRIs = append(actorIRIs, actorIRI)
+			if !hasFollowing {
+				continue
+			}
+			err = a.db.Lock(c, actorIRI)
+			if err != nil {
+				return
+			}
+			var followers []*url.URL
+			followers, err = fdb.LocalFollowers(c, actorIRI)
+			a.db.Unlock(c, actorIRI)
+			if err != nil {
+				return
+			} else if len(followers) == 0 {
+				continue
+			}
+			if !isPublic {
+				var ok bool
+				ok, err = a.addressesFollowers(c, followers[0], actorIRI, addressed)
+				if err != nil {
+					return
+				} else if !ok {
+					continue
+				}
+			}
+			local = append(local, followers...)
+		}
+	}
+	// Only actors have inboxes; other values owned by this server, such as
+	// collections, are left to inbox forwarding.
+	bdb, hasBlocks := a.db.(BlockedDatabase)
+	for _, iri := range dedupeIRIs(local, nil) {
+		err = a.db.Lock(c, iri)
+		if err != nil {
+			return
+		}
+		// WARNING: Unlock is not deferred
+		var t vocab.Type
+		t, err = a.db.Get(c, iri)
+		if err != nil {
+			a.db.Unlock(c, iri)
+			return
+		}
+		blocked := false
+		if _, ok := t.(inboxer); ok && hasBlocks {
+			blocked, err = hasBlocked(c, bdb, iri, actorIRIs)
+		}
+		a.db.Unlock(c, iri)
+		if err != nil {
+			return
+		} else if blocked {
+			continue
+		}
+		if _, ok := t.(inboxer); !ok {
+			continue
+		}
+		var inbox *url.URL
+		inbox, err = getInbox(t)
+		if err != nil {
+			return
+		}
+		inboxIRIs = append(inboxIRIs, inbox)
+	}
+	return
+}
+
+// addressesFollowers determines whether the addressees include the followers
+// collection of the peer actor, dereferencing the peer on behalf of the local
+// actor.
+func (a *sideEffectActor) addressesFollowers(c context.Context, localIRI, actorIRI *url.URL, addressed map[string]bool) (bool, error) {
+	if err := a.db.Lock(c, localIRI); err != nil {
+		return false, err
+	}
+	// WARNING: Unlock is not deferred
+	t, err := a.db.Get(c, localIRI)
+	a.db.Unlock(c, localIRI)
+	if err != nil {
+		return false, err
+	}
+	// Unlock must be called by now and every branch above.
+	inboxIRI, err := getInbox(t)
+	if err != nil {
+		return false, err
+	}
+	tport, err := a.common.NewTransport(c, inboxIRI, goFedUserAgent())
+	if err != nil {
+		return false, err
+	}
+	b, err := tport.Dereference(c, actorIRI)
+	if err != nil {
+		return false, err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return false, err
+	}
+	t, err = streams.ToType(c, m)
+	if err != nil {
+		return false, err
+	}
+	if id, err := GetId(t); err != nil {
+		return false, err
+	} else if id.String() != actorIRI.String() {
+		return false, nil
+	}
+	f, ok := t.(followerser)
+	if !ok || f.GetActivityStreamsFollowers() == nil {
+		return false, nil
+	}
+	followersIRI, err := ToId(f.GetActivityStreamsFollowers())
+	if err != nil {
+		return false, err
+	}
+	return addressed[followersIRI.String()], nil
+}
+
+// owns determines whether this server owns the IRI.
+func (a *sideEffectActor) owns(c context.Context, iri *url.URL) (owns bool, err error) {
+	err = a.db.Lock(c, iri)
+	if err != nil {
+		return
+	}
+	owns, err = a.db.Owns(c, iri)
+	a.db.Unlock(c, iri)
+	return
+}
+
+// followers obtains the followers of an actor, or nil if the database does not
+// have them.
+func (a *sideEffectActor) followers(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
+	err = a.db.Lock(c, actorIRI)
+	if err != nil {
+		return
+	}
+	followers, err = a.db.Followers(c, actorIRI)
+	a.db.Unlock(c, actorIRI)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	return
+}
+
 // InboxForwarding implements the 3-part inbox forwarding algorithm specified in
 // the ActivityPub specification. Does not modify the Activity, but may send
 // outbound requests as a side effect.
 //
 // InboxForwarding sets the federated data in the database.
+//
+// When the Database is a TransactionalDatabase, this is done within a single
+// transaction.
 func (a *sideEffectActor) InboxForwarding(c context.Context, inboxIRI *url.URL, activity Activity) error {
+	return a.transact(c, func(c context.Context) error {
+		return a.inboxForwarding(c, inboxIRI, activity)
+	})
+}
+
+// inboxForwarding implements InboxForwarding, without any transaction.
+func (a *sideEffectActor) inboxForwarding(c context.Context, inboxIRI *url.URL, activity Activity) error {
 	// 1. Must be first time we have seen this Activity.
 	//
 	// Obtain the id of the activity
@@ -321,7 +729,19 @@ func (a *sideEffectActor) InboxForwarding(c context.Context, inboxIRI *url.URL,
 //
 // This implementation assumes all types are meant to be delivered except for
 // the ActivityStreams Block type.
+//
+// When the Database is a TransactionalDatabase, this is done within a single
+// transaction.
 func (a *sideEffectActor) PostOutbox(c context.Context, activity Activity, outboxIRI *url.URL, rawJSON map[string]interface{}) (deliverable bool, err error) {
+	err = a.transact(c, func(c context.Context) (err error) {
+		deliverable, err = a.postOutbox(c, activity, outboxIRI, rawJSON)
+		return
+	})
+	return
+}
+
+// postOutbox implements PostOutbox, without any transaction.
+func (a *sideEffectActor) postOutbox(c context.Context, activity Activity, outboxIRI *url.URL, rawJSON map[string]interface{}) (deliverable bool, err error) {
 	// TODO: Determine this if c2s is nil
 	deliverable = true
 	if a.c2s != nil {
@@ -403,7 +823,188 @@ func (a *sideEffectActor) Deliver(c context.Context, outboxIRI *url.URL, activit
 	if err != nil {
 		return err
 	}
-	return a.deliverToRecipients(c, outboxIRI, activity, recipients)
+	ps, ok := a.s2s.(ActivityProofSigner)
+	if !ok {
+		return a.deliverToRecipients(c, outboxIRI, activity, recipients)
+	}
+	m, err := streams.Serialize(activity)
+	if err != nil {
+		return err
+	}
+	if err = ps.SignActivity(c, outboxIRI, m); err != nil {
+		return err
+	}
+	return a.deliverSerialized(c, outboxIRI, m, recipients)
+}
+
+// FollowRequests returns the Follow requests awaiting approval by the actor
+// owning the outbox.
+//
+// When the Database is a TransactionalDatabase, they are read within a
+// transaction.
+func (a *sideEffectActor) FollowRequests(c context.Context, outboxIRI *url.URL) (follows []vocab.ActivityStreamsFollow, err error) {
+	frdb, ok := a.db.(FollowRequestsDatabase)
+	if !ok {
+		return nil, fmt.Errorf("database does not implement FollowRequestsDatabase")
+	}
+	actorIRI, err := a.actorForOutbox(c, outboxIRI)
+	if err != nil {
+		return
+	}
+	err = a.transact(c, func(c context.Context) error {
+		if err := a.db.Lock(c, actorIRI); err != nil {
+			return err
+		}
+		defer a.db.Unlock(c, actorIRI)
+		col, err := frdb.FollowRequests(c, actorIRI)
+		if err != nil {
+			return err
+		}
+		items := col.GetActivityStreamsItems()
+		if items == nil {
+			return nil
+		}
+		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+			if iter.IsActivityStreamsFollow() {
+				follows = append(follows, iter.GetActivityStreamsFollow())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// ResolveFollowRequest removes a Follow from the requests awaiting approval by
+// the actor owning the outbox, adding its actors to the followers collection
+// when approved. It returns the Accept or Reject to send.
+func (a *sideEffectActor) ResolveFollowRequest(c context.Context, outboxIRI, followIRI *url.URL, approve bool) (response Activity, err error) {
+	frdb, ok := a.db.(FollowRequestsDatabase)
+	if !ok {
+		return nil, fmt.Errorf("database does not implement FollowRequestsDatabase")
+	}
+	actorIRI, err := a.actorForOutbox(c, outboxIRI)
+	if err != nil {
+		return
+	}
+	err = a.transact(c, func(c context.Context) error {
+		if err := a.db.Lock(c, actorIRI); err != nil {
+			return err
+		}
+		defer a.db.Unlock(c, actorIRI)
+		follow, err := removeFollowRequest(c, frdb, actorIRI, followIRI)
+		if err != nil {
+			return err
+		}
+		var recipients []*url.URL
+		response, recipients, err = newResponse(approve, actorIRI, follow)
+		if err != nil || !approve {
+			return err
+		}
+		return prependToActorCollection(c, a.db, actorIRI, recipients, followersProperty, a.db.Followers)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Reports returns the Flags awaiting moderation by the actor owning the outbox.
+//
+// When the Database is a TransactionalDatabase, they are read within a
+// transaction.
+func (a *sideEffectActor) Reports(c context.Context, outboxIRI *url.URL) (reports []vocab.ActivityStreamsFlag, err error) {
+	rdb, ok := a.db.(ReportsDatabase)
+	if !ok {
+		return nil, fmt.Errorf("database does not implement ReportsDatabase")
+	}
+	actorIRI, err := a.actorForOutbox(c, outboxIRI)
+	if err != nil {
+		return
+	}
+	err = a.transact(c, func(c context.Context) error {
+		if err := a.db.Lock(c, actorIRI); err != nil {
+			return err
+		}
+		defer a.db.Unlock(c, actorIRI)
+		col, err := rdb.Reports(c, actorIRI)
+		if err != nil {
+			return err
+		}
+		items := col.GetActivityStreamsItems()
+		if items == nil {
+			return nil
+		}
+		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+			if iter.IsActivityStreamsFlag() {
+				reports = append(reports, iter.GetActivityStreamsFlag())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// ResolveReport removes a Flag from the ones awaiting moderation by the actor
+// owning the outbox, and returns it.
+//
+// When the Database is a TransactionalDatabase, this is done within a single
+// transaction.
+func (a *sideEffectActor) ResolveReport(c context.Context, outboxIRI, flagIRI *url.URL) (report vocab.ActivityStreamsFlag, err error) {
+	rdb, ok := a.db.(ReportsDatabase)
+	if !ok {
+		return nil, fmt.Errorf("database does not implement ReportsDatabase")
+	}
+	actorIRI, err := a.actorForOutbox(c, outboxIRI)
+	if err != nil {
+		return
+	}
+	err = a.transact(c, func(c context.Context) error {
+		if err := a.db.Lock(c, actorIRI); err != nil {
+			return err
+		}
+		defer a.db.Unlock(c, actorIRI)
+		report, err = removeReport(c, rdb, actorIRI, flagIRI)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// NewReport creates a Flag of the objects by the actor owning the outbox,
+// addressed to the instance actor of a peer.
+func (a *sideEffectActor) NewReport(c context.Context, outboxIRI, instanceActorIRI *url.URL, objects []*url.URL, content string) (report vocab.ActivityStreamsFlag, err error) {
+	actorIRI, err := a.actorForOutbox(c, outboxIRI)
+	if err != nil {
+		return
+	}
+	return newReport(actorIRI, instanceActorIRI, objects, content), nil
+}
+
+// NewRelayFollow creates a Follow of the relay by the actor owning the outbox.
+func (a *sideEffectActor) NewRelayFollow(c context.Context, outboxIRI, relayIRI *url.URL) (follow vocab.ActivityStreamsFollow, err error) {
+	actorIRI, err := a.actorForOutbox(c, outboxIRI)
+	if err != nil {
+		return
+	}
+	return newRelayFollow(actorIRI, relayIRI), nil
+}
+
+// actorForOutbox obtains the IRI of the actor owning the outbox.
+func (a *sideEffectActor) actorForOutbox(c context.Context, outboxIRI *url.URL) (actorIRI *url.URL, err error) {
+	err = a.db.Lock(c, outboxIRI)
+	if err != nil {
+		return
+	}
+	defer a.db.Unlock(c, outboxIRI)
+	return a.db.ActorForOutbox(c, outboxIRI)
 }
 
 // WrapInCreate wraps an object with a Create activity.
@@ -425,15 +1026,45 @@ func (a *sideEffectActor) WrapInCreate(c context.Context, obj vocab.Type, outbox
 
 // deliverToRecipients will take a prepared Activity and send it to specific
 // recipients on behalf of an actor.
+//
+// If the FederatingProtocol provides a DeliveryQueue, the deliveries are
+// enqueued instead of being attempted immediately.
 func (a *sideEffectActor) deliverToRecipients(c context.Context, boxIRI *url.URL, activity Activity, recipients []*url.URL) error {
 	m, err := streams.Serialize(activity)
 	if err != nil {
 		return err
 	}
+	return a.deliverSerialized(c, boxIRI, m, recipients)
+}
+
+// deliverSerialized sends an already serialized Activity to specific
+// recipients on behalf of an actor.
+//
+// Within a transaction, the delivery is held back until it commits.
+func (a *sideEffectActor) deliverSerialized(c context.Context, boxIRI *url.URL, m map[string]interface{}, recipients []*url.URL) error {
 	b, err := json.Marshal(m)
 	if err != nil {
 		return err
 	}
+	if p, ok := c.Value(pendingDeliveriesKey{}).(*pendingDeliveries); ok {
+		p.deliveries = append(p.deliveries, pendingDelivery{
+			boxIRI:     boxIRI,
+			b:          b,
+			recipients: recipients,
+		})
+		return nil
+	}
+	return a.send(c, boxIRI, b, recipients)
+}
+
+// send hands a serialized Activity to the DeliveryQueue, if any, or to a
+// Transport to deliver it to the recipients.
+func (a *sideEffectActor) send(c context.Context, boxIRI *url.URL, b []byte, recipients []*url.URL) error {
+	if dq, ok := a.s2s.(DeliveryQueuer); ok {
+		if q := dq.DeliveryQueue(c); q != nil {
+			return q.Enqueue(c, boxIRI, b, recipients)
+		}
+	}
 	tp, err := a.common.NewTransport(c, boxIRI, goFedUserAgent())
 	if err != nil {
 		return err
@@ -441,6 +1072,58 @@ func (a *sideEffectActor) deliverToRecipients(c context.Context, boxIRI *url.URL
 	return tp.BatchDeliver(c, b, recipients)
 }
 
+// pendingDeliveriesKey is the context key of the deliveries made within a
+// transaction.
+type pendingDeliveriesKey struct{}
+
+// pendingDeliveries are the deliveries held back until a transaction commits,
+// so that peers never receive activities whose side effects were rolled back.
+type pendingDeliveries struct {
+	deliveries []pendingDelivery
+}
+
+// pendingDelivery is a serialized Activity to deliver to the recipients on
+// behalf of the actor owning the box.
+type pendingDelivery struct {
+	boxIRI     *url.URL
+	b          []byte
+	recipients []*url.URL
+}
+
+// transact calls the function within a transaction if the Database is a
+// TransactionalDatabase, passing it the context carrying the transaction.
+// Otherwise, the function is called with the given context.
+//
+// The transaction is committed if the function succeeds, and rolled back if
+// it returns an error. The deliveries the function makes are only sent once the
+// transaction is committed, and are dropped if it is rolled back.
+func (a *sideEffectActor) transact(c context.Context, fn func(c context.Context) error) error {
+	tdb, ok := a.db.(TransactionalDatabase)
+	if !ok {
+		return fn(c)
+	}
+	tx, err := tdb.Begin(c)
+	if err != nil {
+		return err
+	}
+	pending := &pendingDeliveries{}
+	if err = fn(context.WithValue(tx, pendingDeliveriesKey{}, pending)); err != nil {
+		if rErr := tdb.Rollback(tx); rErr != nil {
+			return fmt.Errorf("%s; rollback failed: %s", err, rErr)
+		}
+		return err
+	}
+	if err = tdb.Commit(tx); err != nil {
+		return err
+	}
+	for _, d := range pending.deliveries {
+		if err = a.send(c, d.boxIRI, d.b, d.recipients); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // addToOutbox adds the activity to the outbox and creates the activity in the
 // internal database as its own entry.
 func (a *sideEffectActor) addToOutbox(c context.Context, outboxIRI *url.URL, activity Activity) error {
@@ -466,6 +1149,9 @@ func (a *sideEffectActor) addToOutbox(c context.Context, outboxIRI *url.URL, act
 		return err
 	}
 	defer a.db.Unlock(c, outboxIRI)
+	if cdb, ok := a.db.(CollectionDatabase); ok {
+		return cdb.PrependToCollection(c, outboxIRI, id.Get())
+	}
 	outbox, err := a.db.GetOutbox(c, outboxIRI)
 	if err != nil {
 		return err
@@ -506,6 +1192,10 @@ func (a *sideEffectActor) addToInboxIfNew(c context.Context, inboxIRI *url.URL,
 	}
 	// It is a new id, acquire the inbox.
 	isNew = true
+	if cdb, ok := a.db.(CollectionDatabase); ok {
+		err = cdb.PrependToCollection(c, inboxIRI, id.Get())
+		return
+	}
 	inbox, err := a.db.GetInbox(c, inboxIRI)
 	if err != nil {
 		return
@@ -616,7 +1306,10 @@ func (a *sideEffectActor) hasInboxForwardingValues(c context.Context, inboxIRI *
 //
 // Only call if both the social and federated protocol are supported.
 func (a *sideEffectActor) prepare(c context.Context, outboxIRI *url.URL, activity Activity) (r []*url.URL, err error) {
-	// Get inboxes of recipients
+	// Get inboxes of recipients. Hidden recipients are kept apart, since
+	// they cannot share a sharedInbox delivery: once 'bto' and 'bcc' are
+	// stripped, the receiving server could not tell they were addressed.
+	var hidden []*url.URL
 	if to := activity.GetActivityStreamsTo(); to != nil {
 		for iter := to.Begin(); iter != to.End(); iter = iter.Next() {
 			var val *url.URL
@@ -634,7 +1327,7 @@ func (a *sideEffectActor) prepare(c context.Context, outboxIRI *url.URL, activit
 			if err != nil {
 				return
 			}
-			r = append(r, val)
+			hidden = append(hidden, val)
 		}
 	}
 	if cc := activity.GetActivityStreamsCc(); cc != nil {
@@ -654,7 +1347,7 @@ func (a *sideEffectActor) prepare(c context.Context, outboxIRI *url.URL, activit
 			if err != nil {
 				return
 			}
-			r = append(r, val)
+			hidden = append(hidden, val)
 		}
 	}
 	if audience := activity.GetActivityStreamsAudience(); audience != nil {
@@ -675,19 +1368,39 @@ func (a *sideEffectActor) prepare(c context.Context, outboxIRI *url.URL, activit
 	// 2. If an object is addressed to the Public special collection, a
 	//    server MAY deliver that object to all known sharedInbox endpoints
 	//    on the network.
+	isPublic := hasPublic(r) || hasPublic(hidden)
 	r = filterURLs(r, IsPublic)
+	hidden = filterURLs(hidden, IsPublic)
 	t, err := a.common.NewTransport(c, outboxIRI, goFedUserAgent())
 	if err != nil {
 		return nil, err
 	}
-	receiverActors, err := a.resolveInboxes(c, t, r, 0, a.s2s.MaxDeliveryRecursionDepth(c))
+	maxDepth := a.s2s.MaxDeliveryRecursionDepth(c)
+	receiverActors, err := a.resolveInboxes(c, t, r, 0, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	hiddenActors, err := a.resolveInboxes(c, t, hidden, 0, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := getDeliveryInboxes(receiverActors)
 	if err != nil {
 		return nil, err
 	}
-	targets, err := getInboxes(receiverActors)
+	hiddenTargets, err := getInboxes(hiddenActors)
 	if err != nil {
 		return nil, err
 	}
+	targets = append(targets, hiddenTargets...)
+	if sid, ok := a.s2s.(SharedInboxDirectory); ok && isPublic {
+		var known []*url.URL
+		known, err = sid.KnownSharedInboxes(c, outboxIRI)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, known...)
+	}
 	// Get inboxes of sender.
 	err = a.db.Lock(c, outboxIRI)
 	if err != nil {
@@ -2,7 +2,10 @@ package pub
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
@@ -11,6 +14,7 @@ import (
 	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
 	"github.com/golang/mock/gomock"
+	"golang.org/x/crypto/ed25519"
 )
 
 // TestPassThroughMethods tests the methods that pass-through to other
@@ -187,6 +191,116 @@ func TestAuthorizePostInbox(t *testing.T) {
 	})
 }
 
+// TestAuthenticateProof ensures the actor of an activity forwarded with a
+// verified proof is treated as its signer.
+func TestAuthenticateProof(t *testing.T) {
+	ctx := context.Background()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	setupFn := func(ctl *gomock.Controller) (c *MockCommonBehavior, fp *MockFederatingProtocol, tp *MockTransport, a DelegateActor) {
+		setupData()
+		c = NewMockCommonBehavior(ctl)
+		fp = NewMockFederatingProtocol(ctl)
+		tp = NewMockTransport(ctl)
+		auth := NewHttpSigAuthenticator(c, mustParse(testFetcherIRI), &manualClock{t: now()}, HttpSigPolicy{})
+		a = &sideEffectActor{
+			common: c,
+			s2s: proofAuthenticatingFederatingProtocol{
+				MockFederatingProtocol: fp,
+				verifier:               NewProofVerifier(auth, jcsCanonicalizer{}),
+			},
+		}
+		return
+	}
+	// forwardedCtx is the context of testCreate forwarded by another actor.
+	forwardedCtx := func(doc map[string]interface{}) context.Context {
+		c := context.WithValue(ctx, httpSigOwnerKey{}, mustParse(testFederatedActorIRI3))
+		return context.WithValue(c, inboxJSONKey{}, doc)
+	}
+	expectHook := func(fp *MockFederatingProtocol, req *http.Request, owner **url.URL) {
+		fp.EXPECT().PostInboxRequestBodyHook(gomock.Any(), req, testCreate).DoAndReturn(func(c context.Context, r *http.Request, activity Activity) (context.Context, error) {
+			*owner, _ = HttpSigKeyOwner(c)
+			return c, nil
+		})
+	}
+	// Run tests
+	t.Run("VerifiedProofAuthenticatesActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, fp, tp, a := setupFn(ctl)
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		doc := mustSerialize(testCreate)
+		err := AddEddsaJcs2022Proof(doc, priv, mustParse(testFederatedEd25519KeyId), created)
+		assertEqual(t, err, nil)
+		c.EXPECT().NewTransport(gomock.Any(), mustParse(testFetcherIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(gomock.Any(), mustParse(testFederatedEd25519KeyId)).Return(mustSerializeToBytes(newActorWithEd25519Key(pub)), nil)
+		var owner *url.URL
+		expectHook(fp, req, &owner)
+		// Run
+		_, err = a.PostInboxRequestBodyHook(forwardedCtx(doc), req, testCreate)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, owner.String(), testFederatedActorIRI)
+	})
+	t.Run("KeepsSignerWithoutProof", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, fp, _, a := setupFn(ctl)
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		var owner *url.URL
+		expectHook(fp, req, &owner)
+		// Run
+		_, err := a.PostInboxRequestBodyHook(forwardedCtx(mustSerialize(testCreate)), req, testCreate)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, owner.String(), testFederatedActorIRI3)
+	})
+	t.Run("KeepsSignerWithInvalidProof", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, fp, tp, a := setupFn(ctl)
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		doc := mustSerialize(testCreate)
+		err := AddEddsaJcs2022Proof(doc, priv, mustParse(testFederatedEd25519KeyId), created)
+		assertEqual(t, err, nil)
+		doc["type"] = "Delete"
+		c.EXPECT().NewTransport(gomock.Any(), mustParse(testFetcherIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(gomock.Any(), mustParse(testFederatedEd25519KeyId)).Return(mustSerializeToBytes(newActorWithEd25519Key(pub)), nil)
+		var owner *url.URL
+		expectHook(fp, req, &owner)
+		// Run
+		_, err = a.PostInboxRequestBodyHook(forwardedCtx(doc), req, testCreate)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, owner.String(), testFederatedActorIRI3)
+	})
+	t.Run("DoesNotVerifyIfSignedByActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, fp, _, a := setupFn(ctl)
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		doc := mustSerialize(testCreate)
+		err := AddEddsaJcs2022Proof(doc, priv, mustParse(testFederatedEd25519KeyId), created)
+		assertEqual(t, err, nil)
+		c := context.WithValue(ctx, httpSigOwnerKey{}, mustParse(testFederatedActorIRI))
+		c = context.WithValue(c, inboxJSONKey{}, doc)
+		var owner *url.URL
+		expectHook(fp, req, &owner)
+		// Run
+		_, err = a.PostInboxRequestBodyHook(c, req, testCreate)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, owner.String(), testFederatedActorIRI)
+	})
+}
+
 // TestPostInbox ensures that the main application side effects of receiving a
 // federated message occur.
 func TestPostInbox(t *testing.T) {
@@ -321,6 +435,7 @@ func TestPostInbox(t *testing.T) {
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
 		_, fp, _, db, _, a := setupFn(ctl)
+		a.(*sideEffectActor).s2s = originAuthorizingFederatingProtocol{fp}
 		inboxIRI := mustParse(testMyInboxIRI)
 		gomock.InOrder(
 			db.EXPECT().Lock(ctx, inboxIRI),
@@ -345,6 +460,452 @@ func TestPostInbox(t *testing.T) {
 		assertEqual(t, err, nil)
 		assertEqual(t, pass, true)
 	})
+	t.Run("PrependsToInboxCollection", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, fp, _, db, _, a := setupFn(ctl)
+		cdb := NewMockCollectionDatabase(ctl)
+		a.(*sideEffectActor).db = collectionDatabase{db, cdb}
+		inboxIRI := mustParse(testMyInboxIRI)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, inboxIRI),
+			db.EXPECT().InboxContains(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(false, nil),
+			cdb.EXPECT().PrependToCollection(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(nil),
+			db.EXPECT().Unlock(ctx, inboxIRI),
+		)
+		fp.EXPECT().FederatingCallbacks(ctx).Return(FederatingWrappedCallbacks{}, nil, nil)
+		fp.EXPECT().DefaultCallback(ctx, testListen).Return(nil)
+		// Run
+		err := a.PostInbox(ctx, inboxIRI, testListen)
+		// Verify
+		assertEqual(t, err, nil)
+	})
+	t.Run("CommitsTransaction", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, fp, _, db, _, a := setupFn(ctl)
+		tdb := NewMockTransactionalDatabase(ctl)
+		a.(*sideEffectActor).db = transactionalDatabase{db, tdb}
+		inboxIRI := mustParse(testMyInboxIRI)
+		tx := context.WithValue(ctx, txKey{}, 1)
+		inTx := context.WithValue(tx, pendingDeliveriesKey{}, &pendingDeliveries{})
+		gomock.InOrder(
+			tdb.EXPECT().Begin(ctx).Return(tx, nil),
+			db.EXPECT().Lock(inTx, inboxIRI),
+			db.EXPECT().InboxContains(inTx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(false, nil),
+			db.EXPECT().GetInbox(inTx, inboxIRI).Return(testEmptyOrderedCollection, nil),
+			db.EXPECT().SetInbox(inTx, testOrderedCollectionWithFederatedId).Return(nil),
+			db.EXPECT().Unlock(inTx, inboxIRI),
+			fp.EXPECT().FederatingCallbacks(inTx).Return(FederatingWrappedCallbacks{}, nil, nil),
+			fp.EXPECT().DefaultCallback(inTx, testListen).Return(nil),
+			tdb.EXPECT().Commit(tx).Return(nil),
+		)
+		// Run
+		err := a.PostInbox(ctx, inboxIRI, testListen)
+		// Verify
+		assertEqual(t, err, nil)
+	})
+	t.Run("RollsBackTransactionOnError", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, fp, _, db, _, a := setupFn(ctl)
+		tdb := NewMockTransactionalDatabase(ctl)
+		a.(*sideEffectActor).db = transactionalDatabase{db, tdb}
+		inboxIRI := mustParse(testMyInboxIRI)
+		tx := context.WithValue(ctx, txKey{}, 1)
+		inTx := context.WithValue(tx, pendingDeliveriesKey{}, &pendingDeliveries{})
+		expectErr := fmt.Errorf("expected")
+		gomock.InOrder(
+			tdb.EXPECT().Begin(ctx).Return(tx, nil),
+			db.EXPECT().Lock(inTx, inboxIRI),
+			db.EXPECT().InboxContains(inTx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(false, nil),
+			db.EXPECT().GetInbox(inTx, inboxIRI).Return(testEmptyOrderedCollection, nil),
+			db.EXPECT().SetInbox(inTx, testOrderedCollectionWithFederatedId).Return(nil),
+			db.EXPECT().Unlock(inTx, inboxIRI),
+			fp.EXPECT().FederatingCallbacks(inTx).Return(FederatingWrappedCallbacks{}, nil, nil),
+			fp.EXPECT().DefaultCallback(inTx, testListen).Return(expectErr),
+			tdb.EXPECT().Rollback(tx).Return(nil),
+		)
+		// Run
+		err := a.PostInbox(ctx, inboxIRI, testListen)
+		// Verify
+		assertEqual(t, err, expectErr)
+	})
+}
+
+// TestTransact ensures that deliveries made within a transaction are only sent
+// once it is committed.
+func TestTransact(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (c *MockCommonBehavior, tdb *MockTransactionalDatabase, a *sideEffectActor) {
+		setupData()
+		c = NewMockCommonBehavior(ctl)
+		tdb = NewMockTransactionalDatabase(ctl)
+		a = &sideEffectActor{
+			common: c,
+			s2s:    NewMockFederatingProtocol(ctl),
+			db:     transactionalDatabase{NewMockDatabase(ctl), tdb},
+			clock:  NewMockClock(ctl),
+		}
+		return
+	}
+	outboxIRI := mustParse(testMyOutboxIRI)
+	recipients := []*url.URL{mustParse(testFederatedInboxIRI)}
+	t.Run("DeliversAfterCommit", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, tdb, a := setupFn(ctl)
+		tp := NewMockTransport(ctl)
+		tx := context.WithValue(ctx, txKey{}, 1)
+		gomock.InOrder(
+			tdb.EXPECT().Begin(ctx).Return(tx, nil),
+			tdb.EXPECT().Commit(tx).Return(nil),
+			c.EXPECT().NewTransport(ctx, outboxIRI, goFedUserAgent()).Return(tp, nil),
+			tp.EXPECT().BatchDeliver(ctx, mustSerializeToBytes(testListen), recipients).Return(nil),
+		)
+		// Run
+		err := a.transact(ctx, func(c context.Context) error {
+			return a.deliverToRecipients(c, outboxIRI, testListen, recipients)
+		})
+		// Verify
+		assertEqual(t, err, nil)
+	})
+	t.Run("DropsDeliveriesOnRollback", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, tdb, a := setupFn(ctl)
+		tx := context.WithValue(ctx, txKey{}, 1)
+		expectErr := fmt.Errorf("expected")
+		gomock.InOrder(
+			tdb.EXPECT().Begin(ctx).Return(tx, nil),
+			tdb.EXPECT().Rollback(tx).Return(nil),
+		)
+		// Run
+		err := a.transact(ctx, func(c context.Context) error {
+			if err := a.deliverToRecipients(c, outboxIRI, testListen, recipients); err != nil {
+				return err
+			}
+			return expectErr
+		})
+		// Verify
+		assertEqual(t, err, expectErr)
+	})
+}
+
+// TestAnnounceToGroup ensures a local Group announces the activities addressed
+// to it by its members.
+func TestAnnounceToGroup(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (c *MockCommonBehavior, fp *MockFederatingProtocol, gm *MockGroupModerator, db *MockDatabase, a *sideEffectActor) {
+		setupData()
+		c = NewMockCommonBehavior(ctl)
+		fp = NewMockFederatingProtocol(ctl)
+		gm = NewMockGroupModerator(ctl)
+		db = NewMockDatabase(ctl)
+		a = &sideEffectActor{
+			common: c,
+			s2s:    groupModeratorFederatingProtocol{fp, gm},
+			db:     db,
+			clock:  NewMockClock(ctl),
+		}
+		return
+	}
+	newCreateFn := func() vocab.ActivityStreamsCreate {
+		c := streams.NewActivityStreamsCreate()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		c.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		c.SetActivityStreamsActor(actor)
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testPersonIRI))
+		c.SetActivityStreamsTo(to)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsNote(testFederatedNote)
+		c.SetActivityStreamsObject(op)
+		return c
+	}
+	newMembersFn := func(ids ...string) vocab.ActivityStreamsCollection {
+		col := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		for _, id := range ids {
+			items.AppendIRI(mustParse(id))
+		}
+		col.SetActivityStreamsItems(items)
+		return col
+	}
+	expectGroupFn := func(db *MockDatabase, members vocab.ActivityStreamsCollection) {
+		db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		db.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		db.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testMyOutboxIRI), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		db.EXPECT().Lock(ctx, mustParse(testPersonIRI)).Times(2)
+		db.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(newTestGroup(), nil)
+		db.EXPECT().Followers(ctx, mustParse(testPersonIRI)).Return(members, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testPersonIRI)).Times(2)
+	}
+	t.Run("AnnouncesActivityOfMember", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, fp, gm, db, a := setupFn(ctl)
+		mockTp := NewMockTransport(ctl)
+		create := newCreateFn()
+		// Mock
+		expectGroupFn(db, newMembersFn(testFederatedActorIRI))
+		gm.EXPECT().AcceptGroupActivity(ctx, mustParse(testPersonIRI), create).Return(true, nil)
+		db.EXPECT().NewID(ctx, gomock.Any()).Return(mustParse(testNewActivityIRI), nil)
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil).Times(2)
+		fp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(2)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testGroupFollowersIRI)).Return(
+			mustSerializeToBytes(newMembersFn(testFederatedActorIRI)), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(testFederatedPerson1), nil)
+		db.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		db.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		db.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		db.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(newTestGroup(), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		var delivered []byte
+		mockTp.EXPECT().BatchDeliver(ctx, gomock.Any(), []*url.URL{mustParse(testFederatedInboxIRI)}).DoAndReturn(
+			func(c context.Context, b []byte, recipients []*url.URL) error {
+				delivered = b
+				return nil
+			})
+		// Run
+		err := a.announceToGroup(ctx, a.s2s.(GroupModerator), mustParse(testMyInboxIRI), create)
+		// Verify
+		assertEqual(t, err, nil)
+		var m map[string]interface{}
+		if err := json.Unmarshal(delivered, &m); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, m["type"], "Announce")
+		assertEqual(t, m["actor"], testPersonIRI)
+		assertEqual(t, m["to"], testGroupFollowersIRI)
+	})
+	t.Run("IgnoresActivityOfNonMember", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, _, db, a := setupFn(ctl)
+		// Mock
+		expectGroupFn(db, newMembersFn(testFederatedActorIRI2))
+		// Run
+		err := a.announceToGroup(ctx, a.s2s.(GroupModerator), mustParse(testMyInboxIRI), newCreateFn())
+		// Verify
+		assertEqual(t, err, nil)
+	})
+	t.Run("IgnoresActivityRejectedByModerator", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, gm, db, a := setupFn(ctl)
+		create := newCreateFn()
+		// Mock
+		expectGroupFn(db, newMembersFn(testFederatedActorIRI))
+		gm.EXPECT().AcceptGroupActivity(ctx, mustParse(testPersonIRI), create).Return(false, nil)
+		// Run
+		err := a.announceToGroup(ctx, a.s2s.(GroupModerator), mustParse(testMyInboxIRI), create)
+		// Verify
+		assertEqual(t, err, nil)
+	})
+	t.Run("IgnoresActivityNotAddressedToGroup", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, _, db, a := setupFn(ctl)
+		create := newCreateFn()
+		create.SetActivityStreamsTo(nil)
+		// Mock
+		db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		db.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		db.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testMyOutboxIRI), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		// Run
+		err := a.announceToGroup(ctx, a.s2s.(GroupModerator), mustParse(testMyInboxIRI), create)
+		// Verify
+		assertEqual(t, err, nil)
+	})
+}
+
+func TestAnnounceToRelay(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (c *MockCommonBehavior, fp *MockFederatingProtocol, r *MockRelay, db *MockDatabase, a *sideEffectActor) {
+		setupData()
+		c = NewMockCommonBehavior(ctl)
+		fp = NewMockFederatingProtocol(ctl)
+		r = NewMockRelay(ctl)
+		db = NewMockDatabase(ctl)
+		a = &sideEffectActor{
+			common: c,
+			s2s:    relayFederatingProtocol{fp, r},
+			db:     db,
+			clock:  NewMockClock(ctl),
+		}
+		return
+	}
+	newCreateFn := func() vocab.ActivityStreamsCreate {
+		c := streams.NewActivityStreamsCreate()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		c.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		c.SetActivityStreamsActor(actor)
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(PublicActivityPubIRI))
+		c.SetActivityStreamsTo(to)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsNote(testFederatedNote)
+		c.SetActivityStreamsObject(op)
+		return c
+	}
+	newSubscribersFn := func(ids ...string) vocab.ActivityStreamsCollection {
+		col := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		for _, id := range ids {
+			items.AppendIRI(mustParse(id))
+		}
+		col.SetActivityStreamsItems(items)
+		return col
+	}
+	expectInboxFn := func(db *MockDatabase) {
+		db.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		db.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		db.EXPECT().OutboxForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testMyOutboxIRI), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+	}
+	expectRelayFn := func(db *MockDatabase, subscribers vocab.ActivityStreamsCollection) {
+		expectInboxFn(db)
+		db.EXPECT().Lock(ctx, mustParse(testPersonIRI)).Times(2)
+		db.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(newTestRelay(), nil)
+		db.EXPECT().Followers(ctx, mustParse(testPersonIRI)).Return(subscribers, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testPersonIRI)).Times(2)
+	}
+	t.Run("AnnouncesObjectsFromSubscribedInstance", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, fp, r, db, a := setupFn(ctl)
+		mockTp := NewMockTransport(ctl)
+		create := newCreateFn()
+		// Mock
+		r.EXPECT().IsRelay(ctx, mustParse(testPersonIRI)).Return(true, nil)
+		expectRelayFn(db, newSubscribersFn(testFederatedActorIRI2))
+		r.EXPECT().AcceptRelayActivity(ctx, mustParse(testPersonIRI), create).Return(true, nil)
+		db.EXPECT().NewID(ctx, gomock.Any()).Return(mustParse(testNewActivityIRI), nil)
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil).Times(2)
+		fp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(2)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testGroupFollowersIRI)).Return(
+			mustSerializeToBytes(newSubscribersFn(testFederatedActorIRI)), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(testFederatedPerson1), nil)
+		db.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		db.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		db.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		db.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(newTestRelay(), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		var delivered []byte
+		mockTp.EXPECT().BatchDeliver(ctx, gomock.Any(), []*url.URL{mustParse(testFederatedInboxIRI)}).DoAndReturn(
+			func(c context.Context, b []byte, recipients []*url.URL) error {
+				delivered = b
+				return nil
+			})
+		// Run
+		err := a.announceToRelay(ctx, r, mustParse(testMyInboxIRI), create)
+		// Verify
+		assertEqual(t, err, nil)
+		var m map[string]interface{}
+		if err := json.Unmarshal(delivered, &m); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, m["type"], "Announce")
+		assertEqual(t, m["actor"], testPersonIRI)
+		assertEqual(t, m["object"], testNoteId1)
+		assertEqual(t, m["to"], testGroupFollowersIRI)
+		assertEqual(t, m["cc"], PublicActivityPubIRI)
+	})
+	t.Run("IgnoresActivityFromUnsubscribedInstance", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, r, db, a := setupFn(ctl)
+		// Mock
+		r.EXPECT().IsRelay(ctx, mustParse(testPersonIRI)).Return(true, nil)
+		expectRelayFn(db, newSubscribersFn(testToIRI))
+		// Run
+		err := a.announceToRelay(ctx, r, mustParse(testMyInboxIRI), newCreateFn())
+		// Verify
+		assertEqual(t, err, nil)
+	})
+	t.Run("IgnoresActivityNotPublic", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, r, db, a := setupFn(ctl)
+		create := newCreateFn()
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testPersonIRI))
+		create.SetActivityStreamsTo(to)
+		// Mock
+		expectInboxFn(db)
+		r.EXPECT().IsRelay(ctx, mustParse(testPersonIRI)).Return(true, nil)
+		// Run
+		err := a.announceToRelay(ctx, r, mustParse(testMyInboxIRI), create)
+		// Verify
+		assertEqual(t, err, nil)
+	})
+	t.Run("IgnoresActivityToActorNotRelay", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, r, db, a := setupFn(ctl)
+		// Mock
+		expectInboxFn(db)
+		r.EXPECT().IsRelay(ctx, mustParse(testPersonIRI)).Return(false, nil)
+		// Run
+		err := a.announceToRelay(ctx, r, mustParse(testMyInboxIRI), newCreateFn())
+		// Verify
+		assertEqual(t, err, nil)
+	})
+	t.Run("NewRelayFollowFollowsRelay", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, _, db, a := setupFn(ctl)
+		// Mock
+		db.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		db.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		// Run
+		follow, err := a.NewRelayFollow(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActorIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		m := mustSerialize(follow)
+		assertEqual(t, m["actor"], testPersonIRI)
+		assertEqual(t, m["object"], testFederatedActorIRI)
+		assertEqual(t, m["to"], testFederatedActorIRI)
+	})
 }
 
 // TestInboxForwarding ensures that the inbox forwarding logic is correct.
@@ -816,14 +1377,206 @@ func TestInboxForwarding(t *testing.T) {
 			db.EXPECT().Unlock(ctx, mustParse(testAudienceIRI)),
 		)
 		// Run
-		err := a.InboxForwarding(ctx, mustParse(testMyInboxIRI), input)
+		err := a.InboxForwarding(ctx, mustParse(testMyInboxIRI), input)
+		// Verify
+		assertEqual(t, err, nil)
+	})
+}
+
+// TestPostOutbox ensures that the main application side effects of receiving a
+// social protocol message occur.
+func TestSharedInboxRecipients(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (db *MockDatabase, a *sideEffectActor) {
+		setupData()
+		db = NewMockDatabase(ctl)
+		a = &sideEffectActor{
+			common: NewMockCommonBehavior(ctl),
+			s2s:    NewMockFederatingProtocol(ctl),
+			db:     db,
+			clock:  NewMockClock(ctl),
+		}
+		return
+	}
+	activityFn := func(to ...string) vocab.ActivityStreamsCreate {
+		act := streams.NewActivityStreamsCreate()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		act.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testFederatedActorIRI))
+		act.SetActivityStreamsActor(actor)
+		toProp := streams.NewActivityStreamsToProperty()
+		for _, iri := range to {
+			toProp.AppendIRI(mustParse(iri))
+		}
+		act.SetActivityStreamsTo(toProp)
+		return act
+	}
+	peerFn := func() vocab.ActivityStreamsPerson {
+		p := streams.NewActivityStreamsPerson()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActorIRI))
+		p.SetJSONLDId(id)
+		followers := streams.NewActivityStreamsFollowersProperty()
+		followers.SetIRI(mustParse(testFederatedFollowersIRI))
+		p.SetActivityStreamsFollowers(followers)
+		return p
+	}
+	expectLocalFollowers := func(db *MockDatabase, fdb *MockFollowingDatabase, followers ...string) {
+		var iris []*url.URL
+		for _, iri := range followers {
+			iris = append(iris, mustParse(iri))
+		}
+		db.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI))
+		fdb.EXPECT().LocalFollowers(ctx, mustParse(testFederatedActorIRI)).Return(iris, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI))
+	}
+	expectDereferencePeer := func(a *sideEffectActor, ctl *gomock.Controller) {
+		tp := NewMockTransport(ctl)
+		a.common.(*MockCommonBehavior).EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI2), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(mustSerializeToBytes(peerFn()), nil)
+	}
+	expectOwns := func(db *MockDatabase, iri string, owns bool) {
+		db.EXPECT().Lock(ctx, mustParse(iri))
+		db.EXPECT().Owns(ctx, mustParse(iri)).Return(owns, nil)
+		db.EXPECT().Unlock(ctx, mustParse(iri))
+	}
+	expectGet := func(db *MockDatabase, iri string, t vocab.Type) {
+		db.EXPECT().Lock(ctx, mustParse(iri))
+		db.EXPECT().Get(ctx, mustParse(iri)).Return(t, nil)
+		db.EXPECT().Unlock(ctx, mustParse(iri))
+	}
+	expectNotExists := func(db *MockDatabase) {
+		db.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		db.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI)).Return(false, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+	}
+	t.Run("NoneIfReceivedBefore", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, a := setupFn(ctl)
+		db.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		db.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI)).Return(true, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+		// Run
+		inboxes, err := a.SharedInboxRecipients(ctx, activityFn(testPersonIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 0)
+	})
+	t.Run("AddressedActorsAndFollowers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, a := setupFn(ctl)
+		fdb := NewMockFollowingDatabase(ctl)
+		a.db = followingDatabase{db, fdb}
+		expectNotExists(db)
+		expectOwns(db, testPersonIRI, true)
+		expectOwns(db, testFederatedFollowersIRI, false)
+		expectOwns(db, testFederatedActorIRI2, false)
+		expectLocalFollowers(db, fdb, testPersonIRI2)
+		expectGet(db, testPersonIRI2, testMyPerson2)
+		expectDereferencePeer(a, ctl)
+		expectGet(db, testPersonIRI, testMyPerson)
+		expectGet(db, testPersonIRI2, testMyPerson2)
+		// Run
+		inboxes, err := a.SharedInboxRecipients(ctx, activityFn(testPersonIRI, testFederatedFollowersIRI, testFederatedActorIRI2))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 2)
+		assertEqual(t, inboxes[0].String(), testMyInboxIRI)
+		assertEqual(t, inboxes[1].String(), testMyInboxIRI2)
+	})
+	t.Run("FollowersOfPublicActivity", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, a := setupFn(ctl)
+		fdb := NewMockFollowingDatabase(ctl)
+		a.db = followingDatabase{db, fdb}
+		expectNotExists(db)
+		expectLocalFollowers(db, fdb, testPersonIRI2)
+		expectGet(db, testPersonIRI2, testMyPerson2)
+		// Run
+		inboxes, err := a.SharedInboxRecipients(ctx, activityFn(PublicActivityPubIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 1)
+		assertEqual(t, inboxes[0].String(), testMyInboxIRI2)
+	})
+	t.Run("NotFollowersIfUnaddressed", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, a := setupFn(ctl)
+		fdb := NewMockFollowingDatabase(ctl)
+		a.db = followingDatabase{db, fdb}
+		expectNotExists(db)
+		expectOwns(db, testPersonIRI, true)
+		expectLocalFollowers(db, fdb, testPersonIRI2)
+		expectGet(db, testPersonIRI2, testMyPerson2)
+		expectDereferencePeer(a, ctl)
+		expectGet(db, testPersonIRI, testMyPerson)
+		// Run
+		inboxes, err := a.SharedInboxRecipients(ctx, activityFn(testPersonIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 1)
+		assertEqual(t, inboxes[0].String(), testMyInboxIRI)
+	})
+	t.Run("NoFollowersWithoutLocalFollowers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, a := setupFn(ctl)
+		fdb := NewMockFollowingDatabase(ctl)
+		a.db = followingDatabase{db, fdb}
+		expectNotExists(db)
+		expectLocalFollowers(db, fdb)
+		// Run
+		inboxes, err := a.SharedInboxRecipients(ctx, activityFn(PublicActivityPubIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 0)
+	})
+	t.Run("NoFollowersWithoutFollowingDatabase", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, a := setupFn(ctl)
+		expectNotExists(db)
+		// Run
+		inboxes, err := a.SharedInboxRecipients(ctx, activityFn(PublicActivityPubIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 0)
+	})
+	t.Run("LeavesOutActorsThatBlockedActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, a := setupFn(ctl)
+		bdb := NewMockBlockedDatabase(ctl)
+		a.db = blockedDatabase{db, bdb}
+		expectNotExists(db)
+		expectOwns(db, testPersonIRI, true)
+		expectOwns(db, testPersonIRI2, true)
+		expectGet(db, testPersonIRI, testMyPerson)
+		bdb.EXPECT().Blocked(ctx, mustParse(testPersonIRI)).Return(newBlockedCollection(testFederatedActorIRI), nil)
+		expectGet(db, testPersonIRI2, testMyPerson2)
+		bdb.EXPECT().Blocked(ctx, mustParse(testPersonIRI2)).Return(newBlockedCollection(), nil)
+		// Run
+		inboxes, err := a.SharedInboxRecipients(ctx, activityFn(testPersonIRI, testPersonIRI2))
 		// Verify
 		assertEqual(t, err, nil)
+		assertEqual(t, len(inboxes), 1)
+		assertEqual(t, inboxes[0].String(), testMyInboxIRI2)
 	})
 }
 
-// TestPostOutbox ensures that the main application side effects of receiving a
-// social protocol message occur.
 func TestPostOutbox(t *testing.T) {
 	ctx := context.Background()
 	setupFn := func(ctl *gomock.Controller) (c *MockCommonBehavior, fp *MockFederatingProtocol, sp *MockSocialProtocol, db *MockDatabase, cl *MockClock, a DelegateActor) {
@@ -1331,6 +2084,172 @@ func TestDeliver(t *testing.T) {
 		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
 		assertEqual(t, err, nil)
 	})
+	t.Run("CollapsesRecipientsOntoSharedInbox", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, mockFp, _, mockDb, _, a := setupFn(ctl)
+		mockTp := NewMockTransport(ctl)
+		act := baseActivityFn()
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testFederatedActorIRI))
+		to.AppendIRI(mustParse(testFederatedActorIRI2))
+		act.SetActivityStreamsTo(to)
+		expectRecip := []*url.URL{
+			mustParse(testFederatedSharedInbox),
+		}
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeWithSharedInbox(testFederatedPerson1, testFederatedSharedInbox), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
+			mustSerializeWithSharedInbox(testFederatedPerson2, testFederatedSharedInbox), nil)
+		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDb.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			testMyPerson, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockTp.EXPECT().BatchDeliver(ctx, mustSerializeToBytes(act), expectRecip)
+		// Run & Verify
+		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
+		assertEqual(t, err, nil)
+	})
+	t.Run("DeliversHiddenRecipientsToTheirInbox", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, mockFp, _, mockDb, _, a := setupFn(ctl)
+		mockTp := NewMockTransport(ctl)
+		act := baseActivityFn()
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testFederatedActorIRI))
+		act.SetActivityStreamsTo(to)
+		bcc := streams.NewActivityStreamsBccProperty()
+		bcc.AppendIRI(mustParse(testFederatedActorIRI2))
+		act.SetActivityStreamsBcc(bcc)
+		expectAct := baseActivityFn() // Ensure Bcc is stripped
+		expectAct.SetActivityStreamsTo(to)
+		expectRecip := []*url.URL{
+			mustParse(testFederatedSharedInbox),
+			mustParse(testFederatedInboxIRI2),
+		}
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeWithSharedInbox(testFederatedPerson1, testFederatedSharedInbox), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI2)).Return(
+			mustSerializeWithSharedInbox(testFederatedPerson2, testFederatedSharedInbox), nil)
+		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDb.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			testMyPerson, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockTp.EXPECT().BatchDeliver(ctx, mustSerializeToBytes(expectAct), expectRecip)
+		// Run & Verify
+		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
+		assertEqual(t, err, nil)
+	})
+	t.Run("SendsPublicToKnownSharedInboxes", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, mockFp, _, mockDb, _, _ := setupFn(ctl)
+		a := &sideEffectActor{
+			common: c,
+			s2s: sharedInboxFederatingProtocol{
+				mockFp,
+				[]*url.URL{mustParse(testKnownSharedInbox), mustParse(testFederatedSharedInbox)},
+			},
+			db: mockDb,
+		}
+		mockTp := NewMockTransport(ctl)
+		act := baseActivityFn()
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testFederatedActorIRI))
+		to.AppendIRI(mustParse(PublicActivityPubIRI))
+		act.SetActivityStreamsTo(to)
+		expectRecip := []*url.URL{
+			mustParse(testFederatedSharedInbox),
+			mustParse(testKnownSharedInbox),
+		}
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeWithSharedInbox(testFederatedPerson1, testFederatedSharedInbox), nil)
+		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDb.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			testMyPerson, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockTp.EXPECT().BatchDeliver(ctx, mustSerializeToBytes(act), expectRecip)
+		// Run & Verify
+		err := a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
+		assertEqual(t, err, nil)
+	})
+	t.Run("SignsActivityProof", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, mockFp, _, mockDb, _, _ := setupFn(ctl)
+		a := &sideEffectActor{
+			common: c,
+			s2s:    proofSigningFederatingProtocol{mockFp, "test proof"},
+			db:     mockDb,
+		}
+		mockTp := NewMockTransport(ctl)
+		act := baseActivityFn()
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testFederatedActorIRI))
+		act.SetActivityStreamsTo(to)
+		m := mustSerialize(act)
+		m[proofProperty] = "test proof"
+		expectBytes, err := json.Marshal(m)
+		assertEqual(t, err, nil)
+		expectRecip := []*url.URL{
+			mustParse(testFederatedInboxIRI),
+		}
+		// Mock
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockFp.EXPECT().MaxDeliveryRecursionDepth(ctx).Return(1)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActorIRI)).Return(
+			mustSerializeToBytes(testFederatedPerson1), nil)
+		mockDb.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+		mockDb.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		mockDb.EXPECT().Get(ctx, mustParse(testPersonIRI)).Return(
+			testMyPerson, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(
+			mockTp, nil)
+		mockTp.EXPECT().BatchDeliver(ctx, expectBytes, expectRecip)
+		// Run & Verify
+		err = a.Deliver(ctx, mustParse(testMyOutboxIRI), act)
+		assertEqual(t, err, nil)
+	})
 	t.Run("RecursivelyResolveCollectionActors", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
@@ -1654,6 +2573,244 @@ func TestDeliver(t *testing.T) {
 
 // TestWrapInCreate ensures an object received by the Social Protocol is
 // properly wrapped in a Create Activity.
+func TestFollowRequests(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (db *MockDatabase, frdb *MockFollowRequestsDatabase, a *sideEffectActor) {
+		setupData()
+		db = NewMockDatabase(ctl)
+		frdb = NewMockFollowRequestsDatabase(ctl)
+		a = &sideEffectActor{
+			common: NewMockCommonBehavior(ctl),
+			s2s:    NewMockFederatingProtocol(ctl),
+			db:     followRequestsDatabase{db, frdb},
+			clock:  NewMockClock(ctl),
+		}
+		return
+	}
+	pendingFn := func(follows ...vocab.ActivityStreamsFollow) vocab.ActivityStreamsCollection {
+		col := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		for _, f := range follows {
+			items.AppendActivityStreamsFollow(f)
+		}
+		col.SetActivityStreamsItems(items)
+		return col
+	}
+	expectActorFn := func(db *MockDatabase) {
+		db.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		db.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+	}
+	t.Run("ListsFollowRequests", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, frdb, a := setupFn(ctl)
+		// Mock
+		expectActorFn(db)
+		db.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		frdb.EXPECT().FollowRequests(ctx, mustParse(testPersonIRI)).Return(
+			pendingFn(testFollow), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		// Run
+		follows, err := a.FollowRequests(ctx, mustParse(testMyOutboxIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(follows), 1)
+		assertByteEqual(t, mustSerializeToBytes(follows[0]), mustSerializeToBytes(testFollow))
+	})
+	t.Run("ApprovingAddsFollowers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, frdb, a := setupFn(ctl)
+		expectFollowers := streams.NewActivityStreamsCollection()
+		expectItems := streams.NewActivityStreamsItemsProperty()
+		expectItems.AppendIRI(mustParse(testFederatedActorIRI2))
+		expectFollowers.SetActivityStreamsItems(expectItems)
+		// Mock
+		expectActorFn(db)
+		db.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		frdb.EXPECT().FollowRequests(ctx, mustParse(testPersonIRI)).Return(
+			pendingFn(testFollow), nil)
+		frdb.EXPECT().SetFollowRequests(ctx, mustParse(testPersonIRI), gomock.Any()).DoAndReturn(
+			func(c context.Context, actorIRI *url.URL, col vocab.ActivityStreamsCollection) error {
+				assertEqual(t, col.GetActivityStreamsItems().Len(), 0)
+				return nil
+			})
+		db.EXPECT().Followers(ctx, mustParse(testPersonIRI)).Return(
+			streams.NewActivityStreamsCollection(), nil)
+		db.EXPECT().Update(ctx, expectFollowers)
+		db.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		// Run
+		response, err := a.ResolveFollowRequest(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI), true)
+		// Verify
+		assertEqual(t, err, nil)
+		expect, _, _ := newResponse(true, mustParse(testPersonIRI), testFollow)
+		assertEqual(t, streams.IsOrExtendsActivityStreamsAccept(response), true)
+		assertByteEqual(t, mustSerializeToBytes(response), mustSerializeToBytes(expect))
+	})
+	t.Run("RejectingDoesNotAddFollowers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, frdb, a := setupFn(ctl)
+		// Mock
+		expectActorFn(db)
+		db.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		frdb.EXPECT().FollowRequests(ctx, mustParse(testPersonIRI)).Return(
+			pendingFn(testFollow), nil)
+		frdb.EXPECT().SetFollowRequests(ctx, mustParse(testPersonIRI), gomock.Any()).DoAndReturn(
+			func(c context.Context, actorIRI *url.URL, col vocab.ActivityStreamsCollection) error {
+				assertEqual(t, col.GetActivityStreamsItems().Len(), 0)
+				return nil
+			})
+		db.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		// Run
+		response, err := a.ResolveFollowRequest(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI), false)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, streams.IsOrExtendsActivityStreamsReject(response), true)
+	})
+	t.Run("ErrorsIfNotPending", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, frdb, a := setupFn(ctl)
+		// Mock
+		expectActorFn(db)
+		db.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		frdb.EXPECT().FollowRequests(ctx, mustParse(testPersonIRI)).Return(
+			pendingFn(), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		// Run
+		_, err := a.ResolveFollowRequest(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI), true)
+		// Verify
+		assertEqual(t, err, ErrNotFound)
+	})
+}
+
+func TestReports(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (db *MockDatabase, rdb *MockReportsDatabase, a *sideEffectActor) {
+		setupData()
+		db = NewMockDatabase(ctl)
+		rdb = NewMockReportsDatabase(ctl)
+		a = &sideEffectActor{
+			common: NewMockCommonBehavior(ctl),
+			s2s:    NewMockFederatingProtocol(ctl),
+			db:     reportsDatabase{db, rdb},
+			clock:  NewMockClock(ctl),
+		}
+		return
+	}
+	expectActorFn := func(db *MockDatabase) {
+		db.EXPECT().Lock(ctx, mustParse(testMyOutboxIRI))
+		db.EXPECT().ActorForOutbox(ctx, mustParse(testMyOutboxIRI)).Return(
+			mustParse(testPersonIRI), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testMyOutboxIRI))
+	}
+	t.Run("ListsReports", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, rdb, a := setupFn(ctl)
+		f := newTestFlag()
+		// Mock
+		expectActorFn(db)
+		db.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		rdb.EXPECT().Reports(ctx, mustParse(testPersonIRI)).Return(newReportsCollection(f), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		// Run
+		reports, err := a.Reports(ctx, mustParse(testMyOutboxIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(reports), 1)
+		assertEqual(t, reports[0], f)
+	})
+	t.Run("ResolvingRemovesReport", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, rdb, a := setupFn(ctl)
+		f := newTestFlag()
+		// Mock
+		expectActorFn(db)
+		db.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		rdb.EXPECT().Reports(ctx, mustParse(testPersonIRI)).Return(newReportsCollection(f), nil)
+		rdb.EXPECT().SetReports(ctx, mustParse(testPersonIRI), gomock.Any()).DoAndReturn(
+			func(c context.Context, actorIRI *url.URL, col vocab.ActivityStreamsCollection) error {
+				assertEqual(t, col.GetActivityStreamsItems().Len(), 0)
+				return nil
+			})
+		db.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		// Run
+		report, err := a.ResolveReport(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, report, f)
+	})
+	t.Run("ResolvesWithinTransaction", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, rdb, a := setupFn(ctl)
+		tdb := NewMockTransactionalDatabase(ctl)
+		a.db = transactionalReportsDatabase{db, rdb, tdb}
+		tx := context.WithValue(ctx, txKey{}, 1)
+		inTx := context.WithValue(tx, pendingDeliveriesKey{}, &pendingDeliveries{})
+		f := newTestFlag()
+		// Mock
+		expectActorFn(db)
+		gomock.InOrder(
+			tdb.EXPECT().Begin(ctx).Return(tx, nil),
+			db.EXPECT().Lock(inTx, mustParse(testPersonIRI)),
+			rdb.EXPECT().Reports(inTx, mustParse(testPersonIRI)).Return(newReportsCollection(f), nil),
+			rdb.EXPECT().SetReports(inTx, mustParse(testPersonIRI), gomock.Any()).Return(nil),
+			db.EXPECT().Unlock(inTx, mustParse(testPersonIRI)),
+			tdb.EXPECT().Commit(tx).Return(nil),
+		)
+		// Run
+		report, err := a.ResolveReport(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, report, f)
+	})
+	t.Run("ErrorsIfNotPending", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, rdb, a := setupFn(ctl)
+		// Mock
+		expectActorFn(db)
+		db.EXPECT().Lock(ctx, mustParse(testPersonIRI))
+		rdb.EXPECT().Reports(ctx, mustParse(testPersonIRI)).Return(newReportsCollection(), nil)
+		db.EXPECT().Unlock(ctx, mustParse(testPersonIRI))
+		// Run
+		_, err := a.ResolveReport(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActivityIRI))
+		// Verify
+		assertEqual(t, err, ErrNotFound)
+	})
+	t.Run("NewReportIsAddressedToInstanceActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, _, a := setupFn(ctl)
+		// Mock
+		expectActorFn(db)
+		// Run
+		report, err := a.NewReport(ctx, mustParse(testMyOutboxIRI), mustParse(testFederatedActorIRI2),
+			[]*url.URL{mustParse(testFederatedActorIRI), mustParse(testNoteId2)}, "spam")
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, report.GetActivityStreamsActor().At(0).GetIRI().String(), testPersonIRI)
+		assertEqual(t, report.GetActivityStreamsTo().At(0).GetIRI().String(), testFederatedActorIRI2)
+		assertEqual(t, report.GetActivityStreamsObject().Len(), 2)
+		assertEqual(t, report.GetActivityStreamsContent().At(0).GetXMLSchemaString(), "spam")
+	})
+}
+
 func TestWrapInCreate(t *testing.T) {
 	baseNoteFn := func() (vocab.ActivityStreamsNote, vocab.ActivityStreamsCreate) {
 		n := streams.NewActivityStreamsNote()
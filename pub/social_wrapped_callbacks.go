@@ -18,7 +18,9 @@ type SocialWrappedCallbacks struct {
 	//
 	// The wrapping callback copies the actor(s) to the 'attributedTo'
 	// property and copies recipients between the Create activity and all
-	// objects. It then saves the entry in the database.
+	// objects. It then saves the entry in the database, and adds replies
+	// to the 'replies' collection of the objects on this server they are
+	// in reply to.
 	Create func(context.Context, vocab.ActivityStreamsCreate) error
 	// Update handles additional side effects for the Update ActivityStreams
 	// type.
@@ -31,7 +33,8 @@ type SocialWrappedCallbacks struct {
 	// type.
 	//
 	// The wrapping callback replaces the object(s) with tombstones in the
-	// database.
+	// database, and removes them from the 'replies' collection of the
+	// objects they were in reply to.
 	Delete func(context.Context, vocab.ActivityStreamsDelete) error
 	// Follow handles additional side effects for the Follow ActivityStreams
 	// type.
@@ -69,20 +72,39 @@ type SocialWrappedCallbacks struct {
 	// It enforces that the actors on the Undo must correspond to all of the
 	// 'object' actors in some manner.
 	//
+	// If the Database implements BlockedDatabase, the 'object' of undone
+	// Blocks are removed from this actor's blocked collection. Like the
+	// Blocks themselves, an Undo of only Blocks is not federated.
+	//
 	// It is expected that the application will implement the proper
 	// reversal of activities that are being undone.
 	Undo func(context.Context, vocab.ActivityStreamsUndo) error
 	// Block handles additional side effects for the Block ActivityStreams
 	// type.
 	//
-	// The wrapping callback only ensures the 'Block' has at least one
-	// 'object' entry, but otherwise has no default side effect. It is up
-	// to the wrapped application function to properly enforce the new
-	// blocking behavior.
+	// The wrapping callback ensures the 'Block' has at least one 'object'
+	// entry. If the Database implements BlockedDatabase, the 'object'
+	// entries are added to this actor's blocked collection, which a
+	// Blocker enforces. Otherwise it is up to the wrapped application
+	// function to properly enforce the new blocking behavior.
 	//
 	// Note that go-fed does not federate 'Block' activities received in the
 	// Social Protocol.
 	Block func(context.Context, vocab.ActivityStreamsBlock) error
+	// Move handles additional side effects for the Move ActivityStreams
+	// type.
+	//
+	// The wrapping callback ensures this actor moves itself to an actor
+	// that lists it in 'alsoKnownAs'. It then sets the 'movedTo' property
+	// of this actor in the database, and addresses the Move to this
+	// actor's followers so they are notified.
+	Move func(context.Context, vocab.ActivityStreamsMove) error
+	// Invite handles additional side effects for the Invite
+	// ActivityStreams type.
+	//
+	// The wrapping callback ensures the 'target' actors being invited are
+	// addressed, so that the Invite is delivered to them.
+	Invite func(context.Context, vocab.ActivityStreamsInvite) error
 
 	// Sidechannel data -- this is set at request handling time. These must
 	// be set before the callbacks are used.
@@ -122,6 +144,8 @@ func (w SocialWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 	enableLike := true
 	enableUndo := true
 	enableBlock := true
+	enableMove := true
+	enableInvite := true
 	for _, fn := range fns {
 		switch fn.(type) {
 		default:
@@ -144,6 +168,10 @@ func (w SocialWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 			enableUndo = false
 		case func(context.Context, vocab.ActivityStreamsBlock) error:
 			enableBlock = false
+		case func(context.Context, vocab.ActivityStreamsMove) error:
+			enableMove = false
+		case func(context.Context, vocab.ActivityStreamsInvite) error:
+			enableInvite = false
 		}
 	}
 	if enableCreate {
@@ -173,6 +201,12 @@ func (w SocialWrappedCallbacks) callbacks(fns []interface{}) []interface{} {
 	if enableBlock {
 		fns = append(fns, w.block)
 	}
+	if enableMove {
+		fns = append(fns, w.move)
+	}
+	if enableInvite {
+		fns = append(fns, w.invite)
+	}
 	return fns
 }
 
@@ -266,7 +300,7 @@ func (w SocialWrappedCallbacks) create(c context.Context, a vocab.ActivityStream
 		if err := w.db.Create(c, obj); err != nil {
 			return err
 		}
-		return nil
+		return addToReplies(c, w.db, obj)
 	}
 	// Persist all objects we've created, which will include sensitive
 	// recipients such as 'bcc' and 'bto'.
@@ -383,7 +417,7 @@ func (w SocialWrappedCallbacks) deleteFn(c context.Context, a vocab.ActivityStre
 		if err := w.db.Update(c, tomb); err != nil {
 			return err
 		}
-		return nil
+		return removeFromReplies(c, w.db, t)
 	}
 	for i, id := range objIds {
 		if err := loopFn(i, id); err != nil {
@@ -420,7 +454,7 @@ func (w SocialWrappedCallbacks) add(c context.Context, a vocab.ActivityStreamsAd
 	if target == nil || target.Len() == 0 {
 		return ErrTargetRequired
 	}
-	if err := add(c, op, target, w.db); err != nil {
+	if err := add(c, op, target, w.db, nil); err != nil {
 		return err
 	}
 	if w.Add != nil {
@@ -440,7 +474,7 @@ func (w SocialWrappedCallbacks) remove(c context.Context, a vocab.ActivityStream
 	if target == nil || target.Len() == 0 {
 		return ErrTargetRequired
 	}
-	if err := remove(c, op, target, w.db); err != nil {
+	if err := remove(c, op, target, w.db, nil); err != nil {
 		return err
 	}
 	if w.Remove != nil {
@@ -474,24 +508,15 @@ func (w SocialWrappedCallbacks) like(c context.Context, a vocab.ActivityStreamsL
 		return err
 	}
 	defer w.db.Unlock(c, actorIRI)
-	liked, err := w.db.Liked(c, actorIRI)
-	if err != nil {
-		return err
-	}
-	likedItems := liked.GetActivityStreamsItems()
-	if likedItems == nil {
-		likedItems = streams.NewActivityStreamsItemsProperty()
-		liked.SetActivityStreamsItems(likedItems)
-	}
+	objIds := make([]*url.URL, 0, op.Len())
 	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
 		objId, err := ToId(iter)
 		if err != nil {
 			return err
 		}
-		likedItems.PrependIRI(objId)
+		objIds = append(objIds, objId)
 	}
-	err = w.db.Update(c, liked)
-	if err != nil {
+	if err := prependToActorCollection(c, w.db, actorIRI, objIds, likedProperty, w.db.Liked); err != nil {
 		return err
 	}
 	if w.Like != nil {
@@ -508,9 +533,58 @@ func (w SocialWrappedCallbacks) undo(c context.Context, a vocab.ActivityStreamsU
 		return ErrObjectRequired
 	}
 	actors := a.GetActivityStreamsActor()
-	if err := mustHaveActivityActorsMatchObjectActors(c, actors, op, w.newTransport, w.outboxIRI); err != nil {
+	undone, err := mustHaveActivityActorsMatchObjectActors(c, actors, op, w.newTransport, w.outboxIRI)
+	if err != nil {
 		return err
 	}
+	// Lift undone Blocks.
+	var unblocked []*url.URL
+	onlyBlocks := len(undone) > 0
+	for _, t := range undone {
+		if !streams.IsOrExtendsActivityStreamsBlock(t) {
+			onlyBlocks = false
+			continue
+		}
+		o, ok := t.(objecter)
+		if !ok {
+			continue
+		}
+		blockOp := o.GetActivityStreamsObject()
+		if blockOp == nil {
+			continue
+		}
+		for iter := blockOp.Begin(); iter != blockOp.End(); iter = iter.Next() {
+			id, err := ToId(iter)
+			if err != nil {
+				return err
+			}
+			unblocked = append(unblocked, id)
+		}
+	}
+	*w.undeliverable = onlyBlocks
+	if bdb, ok := w.db.(BlockedDatabase); ok && len(unblocked) > 0 {
+		if err := w.db.Lock(c, w.outboxIRI); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		actorIRI, err := w.db.ActorForOutbox(c, w.outboxIRI)
+		if err != nil {
+			w.db.Unlock(c, w.outboxIRI)
+			return err
+		}
+		w.db.Unlock(c, w.outboxIRI)
+		// Unlock must be called by now and every branch above.
+		if err := w.db.Lock(c, actorIRI); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		if err := removeFromBlocked(c, bdb, actorIRI, unblocked); err != nil {
+			w.db.Unlock(c, actorIRI)
+			return err
+		}
+		w.db.Unlock(c, actorIRI)
+		// Unlock must be called by now and every branch above.
+	}
 	if w.Undo != nil {
 		return w.Undo(c, a)
 	}
@@ -524,8 +598,146 @@ func (w SocialWrappedCallbacks) block(c context.Context, a vocab.ActivityStreams
 	if op == nil || op.Len() == 0 {
 		return ErrObjectRequired
 	}
+	if bdb, ok := w.db.(BlockedDatabase); ok {
+		ids := make([]*url.URL, 0, op.Len())
+		for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+			id, err := ToId(iter)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		if err := w.db.Lock(c, w.outboxIRI); err != nil {
+			return err
+		}
+		// WARNING: Unlock not deferred.
+		actorIRI, err := w.db.ActorForOutbox(c, w.outboxIRI)
+		if err != nil {
+			w.db.Unlock(c, w.outboxIRI)
+			return err
+		}
+		w.db.Unlock(c, w.outboxIRI)
+		// Unlock must be called by now and every branch above.
+		if err := w.db.Lock(c, actorIRI); err != nil {
+			return err
+		}
+		defer w.db.Unlock(c, actorIRI)
+		if err := prependToBlocked(c, bdb, actorIRI, ids); err != nil {
+			return err
+		}
+	}
 	if w.Block != nil {
 		return w.Block(c, a)
 	}
 	return nil
 }
+
+// move implements the social Move activity side effects.
+func (w SocialWrappedCallbacks) move(c context.Context, a vocab.ActivityStreamsMove) error {
+	*w.undeliverable = false
+	from, to, err := verifyMove(c, a, w.newTransport, w.outboxIRI)
+	if err != nil {
+		return err
+	}
+	// Get this actor's IRI.
+	if err := w.db.Lock(c, w.outboxIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := w.db.ActorForOutbox(c, w.outboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.outboxIRI)
+		return err
+	}
+	w.db.Unlock(c, w.outboxIRI)
+	// Unlock must be called by now and every branch above.
+	if from.String() != actorIRI.String() {
+		return fmt.Errorf("cannot move %s from the outbox of %s", from, actorIRI)
+	}
+	// Mark this actor as moved.
+	if err := w.db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	defer w.db.Unlock(c, actorIRI)
+	t, err := w.db.Get(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	mt, ok := t.(movedToer)
+	if !ok {
+		return fmt.Errorf("cannot move actor: %T has no 'movedTo' property", t)
+	}
+	movedTo := streams.NewActivityStreamsMovedToProperty()
+	movedTo.SetIRI(to)
+	mt.SetActivityStreamsMovedTo(movedTo)
+	if err := w.db.Update(c, t); err != nil {
+		return err
+	}
+	// Notify this actor's followers.
+	if p := followersProperty(t); p != nil {
+		followersIRI, err := ToId(p)
+		if err != nil {
+			return err
+		}
+		addressees, err := getAddressees(a)
+		if err != nil {
+			return err
+		}
+		addressed := false
+		for _, addressee := range addressees {
+			if addressee.String() == followersIRI.String() {
+				addressed = true
+				break
+			}
+		}
+		if !addressed {
+			toProp := a.GetActivityStreamsTo()
+			if toProp == nil {
+				toProp = streams.NewActivityStreamsToProperty()
+				a.SetActivityStreamsTo(toProp)
+			}
+			toProp.AppendIRI(followersIRI)
+		}
+	}
+	if w.Move != nil {
+		return w.Move(c, a)
+	}
+	return nil
+}
+
+// invite implements the social Invite activity side effects.
+func (w SocialWrappedCallbacks) invite(c context.Context, a vocab.ActivityStreamsInvite) error {
+	*w.undeliverable = false
+	op := a.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		return ErrObjectRequired
+	}
+	target := a.GetActivityStreamsTarget()
+	if target == nil || target.Len() == 0 {
+		return ErrTargetRequired
+	}
+	addressees, err := getAddressees(a)
+	if err != nil {
+		return err
+	}
+	for iter := target.Begin(); iter != target.End(); iter = iter.Next() {
+		id, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		if containsIRI(addressees, id) {
+			continue
+		}
+		toProp := a.GetActivityStreamsTo()
+		if toProp == nil {
+			toProp = streams.NewActivityStreamsToProperty()
+			a.SetActivityStreamsTo(toProp)
+		}
+		toProp.AppendIRI(id)
+		addressees = append(addressees, id)
+	}
+	if w.Invite != nil {
+		return w.Invite(c, a)
+	}
+	return nil
+}
@@ -6,17 +6,23 @@ import (
 	"crypto"
 	"fmt"
 	"github.com/go-fed/httpsig"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
 	// acceptHeaderValue is the Accept header value indicating that the
 	// response should contain an ActivityStreams object.
 	acceptHeaderValue = "application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\""
+	// maxExcerptLength is the maximum number of bytes of an unsuccessful
+	// response body kept in a DeliveryError.
+	maxExcerptLength = 512
 )
 
 // isSuccess returns true if the HTTP status code is either OK, Created, or
@@ -54,9 +60,9 @@ var _ Transport = &HttpSigTransport{}
 // HttpSigTransport makes a dereference call using HTTP signatures to
 // authenticate the request on behalf of a particular actor.
 //
-// No rate limiting is applied.
+// No rate limiting is applied, unless it is created with a DeliveryLimiter.
 //
-// Only one request is tried per call.
+// Only one request is tried per call, unless it double knocks.
 type HttpSigTransport struct {
 	client       HttpClient
 	appAgent     string
@@ -68,6 +74,10 @@ type HttpSigTransport struct {
 	postSignerMu *sync.Mutex
 	pubKeyId     string
 	privKey      crypto.PrivateKey
+	limiter      *DeliveryLimiter
+	scheme       SignatureScheme
+	msgAlg       MessageSignatureAlgorithm
+	knownSchemes *KnownSignatureSchemes
 }
 
 // NewHttpSigTransport returns a new Transport.
@@ -106,25 +116,137 @@ func NewHttpSigTransport(
 	}
 }
 
+// NewHttpSigTransportWithLimiter returns a new Transport like
+// NewHttpSigTransport, whose deliveries wait for permission from the
+// DeliveryLimiter.
+//
+// The limiter is meant to be shared by all of the Transports created by the
+// application, so that its limits apply across all deliveries.
+func NewHttpSigTransportWithLimiter(
+	client HttpClient,
+	appAgent string,
+	clock Clock,
+	getSigner, postSigner httpsig.Signer,
+	pubKeyId string,
+	privKey crypto.PrivateKey,
+	limiter *DeliveryLimiter) *HttpSigTransport {
+	h := NewHttpSigTransport(client, appAgent, clock, getSigner, postSigner, pubKeyId, privKey)
+	h.limiter = limiter
+	return h
+}
+
+// NewRFC9421Transport returns a new Transport like NewHttpSigTransport, which
+// signs requests with RFC 9421 HTTP Message Signatures instead of the
+// draft-cavage Signature header.
+//
+// Requests are signed with the algorithm, and cover the method, target URI,
+// and, if there is a body, the Content-Digest of the body.
+//
+// The limiter may be nil.
+func NewRFC9421Transport(
+	client HttpClient,
+	appAgent string,
+	clock Clock,
+	alg MessageSignatureAlgorithm,
+	pubKeyId string,
+	privKey crypto.PrivateKey,
+	limiter *DeliveryLimiter) *HttpSigTransport {
+	h := NewHttpSigTransport(client, appAgent, clock, nil, nil, pubKeyId, privKey)
+	h.scheme = RFC9421Signatures
+	h.msgAlg = alg
+	h.limiter = limiter
+	return h
+}
+
+// NewDoubleKnockTransport returns a new Transport which signs each request
+// with the SignatureScheme the peer host is known to accept. When a peer
+// refuses a request with http.StatusUnauthorized, it is tried once more with
+// the other scheme, which is remembered for the host if it is not refused.
+//
+// The draft-cavage signers and the RFC 9421 algorithm are used with the same
+// key. The KnownSignatureSchemes is meant to be shared by all of the
+// Transports created by the application, so that what is learned about a host
+// is not forgotten.
+//
+// The limiter may be nil.
+func NewDoubleKnockTransport(
+	client HttpClient,
+	appAgent string,
+	clock Clock,
+	getSigner, postSigner httpsig.Signer,
+	alg MessageSignatureAlgorithm,
+	pubKeyId string,
+	privKey crypto.PrivateKey,
+	known *KnownSignatureSchemes,
+	limiter *DeliveryLimiter) *HttpSigTransport {
+	h := NewHttpSigTransport(client, appAgent, clock, getSigner, postSigner, pubKeyId, privKey)
+	h.msgAlg = alg
+	h.knownSchemes = known
+	h.limiter = limiter
+	return h
+}
+
+// SignatureScheme is a way of signing HTTP requests.
+type SignatureScheme int
+
+const (
+	// DraftCavageSignatures signs requests with the Signature header of
+	// draft-cavage-http-signatures.
+	DraftCavageSignatures SignatureScheme = iota
+	// RFC9421Signatures signs requests with the Signature-Input and
+	// Signature headers of RFC 9421.
+	RFC9421Signatures
+)
+
+// other returns the SignatureScheme that is not this one.
+func (s SignatureScheme) other() SignatureScheme {
+	if s == RFC9421Signatures {
+		return DraftCavageSignatures
+	}
+	return RFC9421Signatures
+}
+
+// KnownSignatureSchemes remembers which SignatureScheme each peer host
+// accepts, for Transports that double knock.
+//
+// It is safe for concurrent use.
+type KnownSignatureSchemes struct {
+	preferred SignatureScheme
+	// mu guards hosts.
+	mu    sync.Mutex
+	hosts map[string]SignatureScheme
+}
+
+// NewKnownSignatureSchemes creates a KnownSignatureSchemes, which tries the
+// preferred SignatureScheme first with hosts it has not learned about.
+func NewKnownSignatureSchemes(preferred SignatureScheme) *KnownSignatureSchemes {
+	return &KnownSignatureSchemes{
+		preferred: preferred,
+		hosts:     make(map[string]SignatureScheme),
+	}
+}
+
+// lookup returns the SignatureScheme to try first with the host.
+func (k *KnownSignatureSchemes) lookup(host string) SignatureScheme {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if s, ok := k.hosts[host]; ok {
+		return s
+	}
+	return k.preferred
+}
+
+// remember records that the host accepts the SignatureScheme.
+func (k *KnownSignatureSchemes) remember(host string, s SignatureScheme) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.hosts[host] = s
+}
+
 // Dereference sends a GET request signed with an HTTP Signature to obtain an
 // ActivityStreams value.
 func (h HttpSigTransport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
-	req, err := http.NewRequest("GET", iri.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	req = req.WithContext(c)
-	req.Header.Add(acceptHeader, acceptHeaderValue)
-	req.Header.Add("Accept-Charset", "utf-8")
-	req.Header.Add("Date", h.clock.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05")+" GMT")
-	req.Header.Add("User-Agent", fmt.Sprintf("%s %s", h.appAgent, h.gofedAgent))
-	h.getSignerMu.Lock()
-	err = h.getSigner.SignRequest(h.privKey, h.pubKeyId, req, nil)
-	h.getSignerMu.Unlock()
-	if err != nil {
-		return nil, err
-	}
-	resp, err := h.client.Do(req)
+	resp, _, err := h.send(c, "GET", iri, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -136,64 +258,231 @@ func (h HttpSigTransport) Dereference(c context.Context, iri *url.URL) ([]byte,
 }
 
 // Deliver sends a POST request with an HTTP Signature.
+//
+// If the transport has a DeliveryLimiter, Deliver first waits until the
+// delivery is permitted.
 func (h HttpSigTransport) Deliver(c context.Context, b []byte, to *url.URL) error {
-	req, err := http.NewRequest("POST", to.String(), bytes.NewReader(b))
-	if err != nil {
+	if h.limiter != nil {
+		release, err := h.limiter.Acquire(c, to)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	resp, sent, err := h.send(c, "POST", to, b)
+	if err != nil && !sent {
 		return err
+	} else if err != nil {
+		return &DeliveryError{
+			Recipient: to,
+			Err:       err,
+		}
+	}
+	defer resp.Body.Close()
+	if !isSuccess(resp.StatusCode) {
+		excerpt, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxExcerptLength))
+		return &DeliveryError{
+			Recipient:  to,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Excerpt:    string(excerpt),
+			RetryAfter: retryAfter(resp.Header.Get("Retry-After"), h.clock),
+		}
+	}
+	return nil
+}
+
+// send issues a signed request, with a body if b is not nil. The returned
+// sent is false if the error occurred before the request could be sent.
+//
+// When double knocking, a request refused with http.StatusUnauthorized is sent
+// once more signed with the other SignatureScheme. The scheme that is not
+// refused is remembered for the host.
+func (h HttpSigTransport) send(c context.Context, method string, iri *url.URL, b []byte) (resp *http.Response, sent bool, err error) {
+	scheme := h.scheme
+	if h.knownSchemes != nil {
+		scheme = h.knownSchemes.lookup(iri.Host)
+	}
+	resp, sent, err = h.sendWithScheme(c, method, iri, b, scheme)
+	if err != nil || h.knownSchemes == nil {
+		return
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		scheme = scheme.other()
+		resp, sent, err = h.sendWithScheme(c, method, iri, b, scheme)
+		if err != nil {
+			return
+		}
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		h.knownSchemes.remember(iri.Host, scheme)
+	}
+	return
+}
+
+// sendWithScheme issues a request signed with the SignatureScheme.
+func (h HttpSigTransport) sendWithScheme(c context.Context, method string, iri *url.URL, b []byte, scheme SignatureScheme) (resp *http.Response, sent bool, err error) {
+	var body io.Reader
+	if b != nil {
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, iri.String(), body)
+	if err != nil {
+		return
 	}
 	req = req.WithContext(c)
-	req.Header.Add(contentTypeHeader, contentTypeHeaderValue)
+	if b != nil {
+		req.Header.Add(contentTypeHeader, contentTypeHeaderValue)
+	} else {
+		req.Header.Add(acceptHeader, acceptHeaderValue)
+	}
 	req.Header.Add("Accept-Charset", "utf-8")
-	req.Header.Add("Date", h.clock.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05")+" GMT")
+	now := h.clock.Now()
+	req.Header.Add("Date", now.UTC().Format("Mon, 02 Jan 2006 15:04:05")+" GMT")
 	req.Header.Add("User-Agent", fmt.Sprintf("%s %s", h.appAgent, h.gofedAgent))
-	h.postSignerMu.Lock()
-	err = h.postSigner.SignRequest(h.privKey, h.pubKeyId, req, b)
-	h.postSignerMu.Unlock()
-	if err != nil {
-		return err
+	switch {
+	case scheme == RFC9421Signatures:
+		err = signMessage(req, b, h.privKey, h.pubKeyId, h.msgAlg, now)
+	case b != nil:
+		h.postSignerMu.Lock()
+		err = h.postSigner.SignRequest(h.privKey, h.pubKeyId, req, b)
+		h.postSignerMu.Unlock()
+	default:
+		h.getSignerMu.Lock()
+		err = h.getSigner.SignRequest(h.privKey, h.pubKeyId, req, nil)
+		h.getSignerMu.Unlock()
 	}
-	resp, err := h.client.Do(req)
 	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if !isSuccess(resp.StatusCode) {
-		return fmt.Errorf("POST request to %s failed (%d): %s", to.String(), resp.StatusCode, resp.Status)
+		return
 	}
-	return nil
+	resp, err = h.client.Do(req)
+	return resp, true, err
 }
 
-// BatchDeliver sends concurrent POST requests. Returns an error if any of the
-// requests had an error.
+// BatchDeliver sends concurrent POST requests. Returns a *BatchDeliveryError
+// listing the recipients whose requests had an error, if any.
+//
+// If the transport has a DeliveryLimiter with a global concurrency limit, only
+// that many goroutines are used to deliver to the recipients.
 func (h HttpSigTransport) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error {
+	workers := len(recipients)
+	if h.limiter != nil && h.limiter.limits.MaxConcurrent > 0 && h.limiter.limits.MaxConcurrent < workers {
+		workers = h.limiter.limits.MaxConcurrent
+	}
 	var wg sync.WaitGroup
-	errCh := make(chan error, len(recipients))
-	for _, recipient := range recipients {
+	toCh := make(chan *url.URL)
+	errCh := make(chan *DeliveryError, len(recipients))
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
-		go func(r *url.URL) {
+		go func() {
 			defer wg.Done()
-			if err := h.Deliver(c, b, r); err != nil {
-				errCh <- err
+			for r := range toCh {
+				if err := h.Deliver(c, b, r); err != nil {
+					de, ok := err.(*DeliveryError)
+					if !ok {
+						de = &DeliveryError{
+							Recipient: r,
+							Err:       err,
+						}
+					}
+					errCh <- de
+				}
 			}
-		}(recipient)
+		}()
+	}
+	for _, recipient := range recipients {
+		toCh <- recipient
 	}
+	close(toCh)
 	wg.Wait()
-	errs := make([]string, 0, len(recipients))
-outer:
-	for {
-		select {
-		case e := <-errCh:
-			errs = append(errs, e.Error())
-		default:
-			break outer
-		}
+	close(errCh)
+	var failures []*DeliveryError
+	for de := range errCh {
+		failures = append(failures, de)
 	}
-	if len(errs) > 0 {
-		return fmt.Errorf("batch deliver had at least one failure: %s", strings.Join(errs, "; "))
+	if len(failures) > 0 {
+		return &BatchDeliveryError{Failures: failures}
 	}
 	return nil
 }
 
+// DeliveryError is returned by HttpSigTransport when a delivery to a peer
+// fails, either because the request could not be completed or because the peer
+// responded with an unsuccessful HTTP status code.
+type DeliveryError struct {
+	// Recipient is the IRI the activity was delivered to.
+	Recipient *url.URL
+	// StatusCode is the HTTP status code of the response, or zero if no
+	// response was received.
+	StatusCode int
+	// Status is the HTTP status line of the response.
+	Status string
+	// Excerpt is the beginning of the response body, which may explain
+	// why the peer refused the delivery.
+	Excerpt string
+	// RetryAfter is when the peer asked for the delivery to be retried, as
+	// given in the Retry-After header. It is the zero Time if the peer did
+	// not ask.
+	RetryAfter time.Time
+	// Err is the reason no response was received, if StatusCode is zero.
+	Err error
+}
+
+// Error returns a description of the failed delivery.
+func (e *DeliveryError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("POST request to %s failed: %s", e.Recipient.String(), e.Err)
+	}
+	return fmt.Sprintf("POST request to %s failed (%d): %s", e.Recipient.String(), e.StatusCode, e.Status)
+}
+
+// Retryable returns true if the same delivery may succeed when retried later.
+//
+// Failures to receive a response, and responses indicating a timeout, rate
+// limiting, or a server error are retryable. Other unsuccessful responses,
+// such as the recipient being gone or refusing the activity, are permanent.
+func (e *DeliveryError) Retryable() bool {
+	if e.StatusCode == 0 {
+		return true
+	}
+	return e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode >= 500
+}
+
+// BatchDeliveryError is returned by HttpSigTransport when at least one of the
+// deliveries in a batch fails. Recipients not listed were delivered to.
+type BatchDeliveryError struct {
+	// Failures has an entry for each recipient whose delivery failed.
+	Failures []*DeliveryError
+}
+
+// Error returns a description of all of the failed deliveries.
+func (e *BatchDeliveryError) Error() string {
+	errs := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		errs = append(errs, f.Error())
+	}
+	return fmt.Sprintf("batch deliver had at least one failure: %s", strings.Join(errs, "; "))
+}
+
+// retryAfter parses the value of a Retry-After header, which is either a
+// number of seconds from now or an HTTP date. Returns the zero Time if the
+// value is empty or malformed.
+func retryAfter(v string, clock Clock) time.Time {
+	if v == "" {
+		return time.Time{}
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return clock.Now().Add(time.Duration(secs) * time.Second)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
 // HttpClient sends http requests, and is an abstraction only needed by the
 // HttpSigTransport. The standard library's Client satisfies this interface.
 type HttpClient interface {
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 )
@@ -95,7 +96,12 @@ func TestHttpSigTransportDeliver(t *testing.T) {
 		hc.EXPECT().Do(gomock.Any()).Return(resp, testErr)
 		// Run & Verify
 		err := tp.Deliver(ctx, testRespBody, mustParse(testNoteId1))
-		assertEqual(t, err, testErr)
+		de, ok := err.(*DeliveryError)
+		assertEqual(t, ok, true)
+		assertEqual(t, de.Recipient.String(), testNoteId1)
+		assertEqual(t, de.StatusCode, 0)
+		assertEqual(t, de.Err, testErr)
+		assertEqual(t, de.Retryable(), true)
 	})
 	t.Run("Delivers", func(t *testing.T) {
 		// Setup
@@ -114,6 +120,139 @@ func TestHttpSigTransportDeliver(t *testing.T) {
 		err := tp.Deliver(ctx, testRespBody, mustParse(testFederatedActorIRI))
 		assertEqual(t, err, nil)
 	})
+	t.Run("ReturnsDeliveryErrorWhenHTTPStatusUnsuccessful", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, c, hc, _, ps := httpSigSetupFn(ctl)
+		respR := httptest.NewRecorder()
+		respR.Header().Set("Retry-After", "120")
+		respR.WriteHeader(http.StatusServiceUnavailable)
+		respR.WriteString("try again later")
+		resp := respR.Result()
+		// Mock
+		c.EXPECT().Now().Return(now()).Times(2)
+		ps.EXPECT().SignRequest(testPrivKey, testPubKeyId, gomock.Any(), testRespBody)
+		hc.EXPECT().Do(gomock.Any()).Return(resp, nil)
+		// Run & Verify
+		err := tp.Deliver(ctx, testRespBody, mustParse(testFederatedInboxIRI))
+		de, ok := err.(*DeliveryError)
+		assertEqual(t, ok, true)
+		assertEqual(t, de.Recipient.String(), testFederatedInboxIRI)
+		assertEqual(t, de.StatusCode, http.StatusServiceUnavailable)
+		assertEqual(t, de.RetryAfter.Equal(now().Add(2*time.Minute)), true)
+		assertEqual(t, de.Excerpt, "try again later")
+		assertEqual(t, de.Retryable(), true)
+	})
+}
+
+func TestRFC9421Transport(t *testing.T) {
+	ctx := context.Background()
+	key := mustGenerateKey()
+	t.Run("DeliversWithMessageSignature", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c := NewMockClock(ctl)
+		hc := NewMockHttpClient(ctl)
+		tp := NewRFC9421Transport(hc, testAppAgent, c, RsaPssSha512, testPubKeyId, key, nil)
+		respR := httptest.NewRecorder()
+		respR.WriteHeader(http.StatusOK)
+		var sent *http.Request
+		// Mock
+		c.EXPECT().Now().Return(now())
+		hc.EXPECT().Do(gomock.Any()).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+			sent = r
+			return respR.Result(), nil
+		})
+		// Run
+		err := tp.Deliver(ctx, testRespBody, mustParse(testFederatedInboxIRI))
+		// Verify
+		assertEqual(t, err, nil)
+		m, err := parseMessageSignature(sent.Header)
+		assertEqual(t, err, nil)
+		assertEqual(t, m.keyId, testPubKeyId)
+		base, err := signatureBase(sent, m)
+		assertEqual(t, err, nil)
+		assertEqual(t, verifyBase(&key.PublicKey, m.alg, base, m.sig), nil)
+		assertEqual(t, verifyContentDigest(sent.Header, testRespBody), true)
+	})
+}
+
+func TestDoubleKnockTransport(t *testing.T) {
+	ctx := context.Background()
+	key := mustGenerateKey()
+	setupFn := func(ctl *gomock.Controller) (tp *HttpSigTransport, c *MockClock, hc *MockHttpClient, ps *MockSigner) {
+		c = NewMockClock(ctl)
+		hc = NewMockHttpClient(ctl)
+		ps = NewMockSigner(ctl)
+		known := NewKnownSignatureSchemes(DraftCavageSignatures)
+		tp = NewDoubleKnockTransport(hc, testAppAgent, c, NewMockSigner(ctl), ps, RsaV15Sha256, testPubKeyId, key, known, nil)
+		c.EXPECT().Now().Return(now()).AnyTimes()
+		return
+	}
+	respFn := func(code int) *http.Response {
+		respR := httptest.NewRecorder()
+		respR.WriteHeader(code)
+		return respR.Result()
+	}
+	isMessageSigned := func(r *http.Request) bool {
+		return r.Header.Get(signatureInputHeader) != ""
+	}
+	t.Run("RetriesWithOtherSchemeAndRemembersIt", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, _, hc, ps := setupFn(ctl)
+		var signed []bool
+		// Mock
+		ps.EXPECT().SignRequest(key, testPubKeyId, gomock.Any(), testRespBody)
+		hc.EXPECT().Do(gomock.Any()).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+			signed = append(signed, isMessageSigned(r))
+			if !isMessageSigned(r) {
+				return respFn(http.StatusUnauthorized), nil
+			}
+			return respFn(http.StatusOK), nil
+		}).Times(3)
+		// Run
+		err := tp.Deliver(ctx, testRespBody, mustParse(testFederatedInboxIRI))
+		assertEqual(t, err, nil)
+		err = tp.Deliver(ctx, testRespBody, mustParse(testFederatedInboxIRI2))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(signed), 3)
+		assertEqual(t, signed[0], false)
+		assertEqual(t, signed[1], true)
+		assertEqual(t, signed[2], true)
+	})
+	t.Run("DoesNotRememberRefusedScheme", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, _, hc, ps := setupFn(ctl)
+		// Mock
+		ps.EXPECT().SignRequest(key, testPubKeyId, gomock.Any(), testRespBody).Times(2)
+		hc.EXPECT().Do(gomock.Any()).Return(respFn(http.StatusUnauthorized), nil).Times(4)
+		// Run
+		err := tp.Deliver(ctx, testRespBody, mustParse(testFederatedInboxIRI))
+		de, ok := err.(*DeliveryError)
+		assertEqual(t, ok, true)
+		assertEqual(t, de.StatusCode, http.StatusUnauthorized)
+		err = tp.Deliver(ctx, testRespBody, mustParse(testFederatedInboxIRI))
+		// Verify
+		assertNotEqual(t, err, nil)
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+	c := NewMockClock(ctl)
+	c.EXPECT().Now().Return(now()).AnyTimes()
+	assertEqual(t, retryAfter("", c), time.Time{})
+	assertEqual(t, retryAfter("30", c).Equal(now().Add(30*time.Second)), true)
+	assertEqual(t, retryAfter("Fri, 31 Dec 1999 23:59:59 GMT", c), time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC))
+	assertEqual(t, retryAfter("soon", c), time.Time{})
 }
 
 func TestHttpSigTransportBatchDeliver(t *testing.T) {
@@ -156,4 +295,53 @@ func TestHttpSigTransportBatchDeliver(t *testing.T) {
 		assertNotEqual(t, err, nil)
 
 	})
+	t.Run("ReturnsEachFailedRecipient", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, c, hc, _, ps := httpSigSetupFn(ctl)
+		respR := httptest.NewRecorder()
+		respR.WriteHeader(http.StatusOK)
+		resp := respR.Result()
+		goneR := httptest.NewRecorder()
+		goneR.WriteHeader(http.StatusGone)
+		gone := goneR.Result()
+		// Mock
+		c.EXPECT().Now().Return(now()).Times(2)
+		ps.EXPECT().SignRequest(testPrivKey, testPubKeyId, gomock.Any(), testRespBody).Times(2)
+		hc.EXPECT().Do(gomock.Any()).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+			if r.URL.String() == testFederatedInboxIRI2 {
+				return gone, nil
+			}
+			return resp, nil
+		}).Times(2)
+		// Run
+		err := tp.BatchDeliver(ctx, testRespBody, []*url.URL{mustParse(testFederatedInboxIRI), mustParse(testFederatedInboxIRI2)})
+		// Verify
+		be, ok := err.(*BatchDeliveryError)
+		assertEqual(t, ok, true)
+		assertEqual(t, len(be.Failures), 1)
+		assertEqual(t, be.Failures[0].Recipient.String(), testFederatedInboxIRI2)
+		assertEqual(t, be.Failures[0].StatusCode, http.StatusGone)
+		assertEqual(t, be.Failures[0].Retryable(), false)
+	})
+}
+
+func TestDeliveryErrorRetryable(t *testing.T) {
+	for code, expect := range map[int]bool{
+		0:                              true,
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusNotFound:            false,
+		http.StatusRequestTimeout:      true,
+		http.StatusGone:                false,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+	} {
+		e := &DeliveryError{StatusCode: code}
+		if e.Retryable() != expect {
+			t.Errorf("status %d: expected retryable %v", code, expect)
+		}
+	}
 }
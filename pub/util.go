@@ -27,6 +27,28 @@ var (
 	ErrTargetRequired = errors.New("target property required on the provided activity")
 )
 
+// ForbiddenError indicates a peer is not authorized to make a change with the
+// activity it sent, such as updating an object of another origin. It is
+// returned by the federating side effects, so that a Forbidden response is set
+// when handling a POST to an inbox.
+type ForbiddenError struct {
+	// Object is the id of the object the peer may not change.
+	Object *url.URL
+	// Reason explains why the change is not authorized.
+	Reason string
+}
+
+// Error returns the object and reason.
+func (e *ForbiddenError) Error() string {
+	return fmt.Sprintf("not authorized to change %s: %s", e.Object, e.Reason)
+}
+
+// isForbidden determines whether the error is a ForbiddenError.
+func isForbidden(err error) bool {
+	_, ok := err.(*ForbiddenError)
+	return ok
+}
+
 // activityStreamsMediaTypes contains all of the accepted ActivityStreams media
 // types. Generated at init time.
 var activityStreamsMediaTypes []string
@@ -349,6 +371,12 @@ const (
 	PublicActivityPubIRI = "https://www.w3.org/ns/activitystreams#Public"
 	publicJsonLD         = "Public"
 	publicJsonLDAS       = "as:Public"
+	// endpointsProperty is the ActivityPub actor property holding
+	// server-wide endpoints, such as the sharedInbox.
+	endpointsProperty = "endpoints"
+	// sharedInboxProperty is the endpoint receiving activities for many
+	// actors on the same server.
+	sharedInboxProperty = "sharedInbox"
 )
 
 // IsPublic determines if an IRI string is the Public collection as defined in
@@ -357,6 +385,165 @@ func IsPublic(s string) bool {
 	return s == PublicActivityPubIRI || s == publicJsonLD || s == publicJsonLDAS
 }
 
+// getAddressees obtains the IRIs in the 'to', 'bto', 'cc', 'bcc', and
+// 'audience' properties of an activity.
+func getAddressees(activity Activity) (u []*url.URL, err error) {
+	if to := activity.GetActivityStreamsTo(); to != nil {
+		for iter := to.Begin(); iter != to.End(); iter = iter.Next() {
+			var id *url.URL
+			id, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			u = append(u, id)
+		}
+	}
+	if bto := activity.GetActivityStreamsBto(); bto != nil {
+		for iter := bto.Begin(); iter != bto.End(); iter = iter.Next() {
+			var id *url.URL
+			id, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			u = append(u, id)
+		}
+	}
+	if cc := activity.GetActivityStreamsCc(); cc != nil {
+		for iter := cc.Begin(); iter != cc.End(); iter = iter.Next() {
+			var id *url.URL
+			id, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			u = append(u, id)
+		}
+	}
+	if bcc := activity.GetActivityStreamsBcc(); bcc != nil {
+		for iter := bcc.Begin(); iter != bcc.End(); iter = iter.Next() {
+			var id *url.URL
+			id, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			u = append(u, id)
+		}
+	}
+	if audience := activity.GetActivityStreamsAudience(); audience != nil {
+		for iter := audience.Begin(); iter != audience.End(); iter = iter.Next() {
+			var id *url.URL
+			id, err = ToId(iter)
+			if err != nil {
+				return
+			}
+			u = append(u, id)
+		}
+	}
+	return
+}
+
+// hasPublic determines if any of the IRIs is the Public collection.
+func hasPublic(u []*url.URL) bool {
+	for _, elem := range u {
+		if IsPublic(elem.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAddressed determines if any of the 'to', 'bto', 'cc', 'bcc', or
+// 'audience' properties of the value are set.
+func isAddressed(t vocab.Type) bool {
+	if v, ok := t.(toer); ok && v.GetActivityStreamsTo() != nil && v.GetActivityStreamsTo().Len() > 0 {
+		return true
+	}
+	if v, ok := t.(btoer); ok && v.GetActivityStreamsBto() != nil && v.GetActivityStreamsBto().Len() > 0 {
+		return true
+	}
+	if v, ok := t.(ccer); ok && v.GetActivityStreamsCc() != nil && v.GetActivityStreamsCc().Len() > 0 {
+		return true
+	}
+	if v, ok := t.(bccer); ok && v.GetActivityStreamsBcc() != nil && v.GetActivityStreamsBcc().Len() > 0 {
+		return true
+	}
+	if v, ok := t.(audiencer); ok && v.GetActivityStreamsAudience() != nil && v.GetActivityStreamsAudience().Len() > 0 {
+		return true
+	}
+	return false
+}
+
+// getVisibleAddressees returns the IRIs in the 'to', 'cc', and 'audience'
+// properties of the value, which are not hidden from its recipients.
+func getVisibleAddressees(t vocab.Type) (u []*url.URL, err error) {
+	if v, ok := t.(toer); ok {
+		if to := v.GetActivityStreamsTo(); to != nil {
+			for iter := to.Begin(); iter != to.End(); iter = iter.Next() {
+				var id *url.URL
+				id, err = ToId(iter)
+				if err != nil {
+					return
+				}
+				u = append(u, id)
+			}
+		}
+	}
+	if v, ok := t.(ccer); ok {
+		if cc := v.GetActivityStreamsCc(); cc != nil {
+			for iter := cc.Begin(); iter != cc.End(); iter = iter.Next() {
+				var id *url.URL
+				id, err = ToId(iter)
+				if err != nil {
+					return
+				}
+				u = append(u, id)
+			}
+		}
+	}
+	if v, ok := t.(audiencer); ok {
+		if aud := v.GetActivityStreamsAudience(); aud != nil {
+			for iter := aud.Begin(); iter != aud.End(); iter = iter.Next() {
+				var id *url.URL
+				id, err = ToId(iter)
+				if err != nil {
+					return
+				}
+				u = append(u, id)
+			}
+		}
+	}
+	return
+}
+
+// getAuthors returns the IRIs in the 'attributedTo' and 'actor' properties of
+// the value.
+func getAuthors(t vocab.Type) (u []*url.URL, err error) {
+	if v, ok := t.(attributedToer); ok {
+		if attrTo := v.GetActivityStreamsAttributedTo(); attrTo != nil {
+			for iter := attrTo.Begin(); iter != attrTo.End(); iter = iter.Next() {
+				var id *url.URL
+				id, err = ToId(iter)
+				if err != nil {
+					return
+				}
+				u = append(u, id)
+			}
+		}
+	}
+	if v, ok := t.(actorer); ok {
+		if actor := v.GetActivityStreamsActor(); actor != nil {
+			for iter := actor.Begin(); iter != actor.End(); iter = iter.Next() {
+				var id *url.URL
+				id, err = ToId(iter)
+				if err != nil {
+					return
+				}
+				u = append(u, id)
+			}
+		}
+	}
+	return
+}
+
 // getInboxes extracts the 'inbox' IRIs from actor types.
 func getInboxes(t []vocab.Type) (u []*url.URL, err error) {
 	for _, elem := range t {
@@ -381,6 +568,50 @@ func getInbox(t vocab.Type) (u *url.URL, err error) {
 	return ToId(inbox)
 }
 
+// getSharedInbox extracts the 'sharedInbox' IRI from the 'endpoints' of an
+// actor type. Returns nil if the actor does not have a sharedInbox.
+//
+// The 'endpoints' property is not part of the ActivityStreams vocabulary, so
+// it is read from the unknown properties of the type.
+func getSharedInbox(t vocab.Type) *url.URL {
+	up, ok := t.(unknownPropertieser)
+	if !ok {
+		return nil
+	}
+	endpoints, ok := up.GetUnknownProperties()[endpointsProperty].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	s, ok := endpoints[sharedInboxProperty].(string)
+	if !ok {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() {
+		return nil
+	}
+	return u
+}
+
+// getDeliveryInboxes extracts the IRIs to deliver to for actor types,
+// preferring each actor's 'sharedInbox' over its 'inbox'. Actors that share
+// a sharedInbox collapse into a single delivery when deduplicated.
+func getDeliveryInboxes(t []vocab.Type) (u []*url.URL, err error) {
+	for _, elem := range t {
+		if shared := getSharedInbox(elem); shared != nil {
+			u = append(u, shared)
+			continue
+		}
+		var iri *url.URL
+		iri, err = getInbox(elem)
+		if err != nil {
+			return
+		}
+		u = append(u, iri)
+	}
+	return
+}
+
 // dedupeIRIs will deduplicate final inbox IRIs. The ignore list is applied to
 // the final list.
 func dedupeIRIs(recipients, ignored []*url.URL) (out []*url.URL) {
@@ -443,6 +674,167 @@ func mustHaveActivityOriginMatchObjects(a Activity) error {
 	return nil
 }
 
+// mustBeSameOriginAsObject ensures that the actors of the activity share the
+// origin of the object, or that the object is the actor or is stored with the
+// actor among its authors. If the request was authenticated with an
+// HttpSigAuthenticator, the actors must also share the origin of the signer.
+//
+// The caller must hold the lock for the object.
+func mustBeSameOriginAsObject(c context.Context, db Database, a Activity, objId *url.URL) error {
+	actors := a.GetActivityStreamsActor()
+	if actors == nil || actors.Len() == 0 {
+		return &ForbiddenError{Object: objId, Reason: "activity has no actor"}
+	}
+	signer, signed := HttpSigKeyOwner(c)
+	var authors map[string]bool
+	for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+		actorId, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		if signed && !sameOrigin(signer, actorId) {
+			return &ForbiddenError{
+				Object: objId,
+				Reason: fmt.Sprintf("actor %s does not share the origin of signer %s", actorId, signer),
+			}
+		}
+		if sameOrigin(actorId, objId) || actorId.String() == objId.String() {
+			continue
+		}
+		// Fall back to whether the stored object is attributed to the
+		// actor.
+		if authors == nil {
+			authors = make(map[string]bool)
+			if exists, err := db.Exists(c, objId); err != nil {
+				return err
+			} else if exists {
+				t, err := db.Get(c, objId)
+				if err != nil {
+					return err
+				}
+				ids, err := getAuthors(t)
+				if err != nil {
+					return err
+				}
+				for _, id := range ids {
+					authors[id.String()] = true
+				}
+			}
+		}
+		if !authors[actorId.String()] {
+			return &ForbiddenError{
+				Object: objId,
+				Reason: fmt.Sprintf("actor %s neither shares its origin nor owns it", actorId),
+			}
+		}
+	}
+	return nil
+}
+
+// mustBeCollectionOwner ensures that all the actors of the activity are among
+// the actors the collection is attributed to.
+//
+// Followers, following, liked, and featured collections are rarely attributed
+// to anyone, so when the collection is not, each actor of the activity must
+// instead have it as one of these collections.
+//
+// The caller must hold the lock for the collection.
+func mustBeCollectionOwner(c context.Context, db Database, a Activity, collectionId *url.URL) error {
+	actors := a.GetActivityStreamsActor()
+	if actors == nil || actors.Len() == 0 {
+		return &ForbiddenError{Object: collectionId, Reason: "activity has no actor"}
+	}
+	col, err := db.Get(c, collectionId)
+	if err != nil {
+		return err
+	}
+	ids, err := getAuthors(col)
+	if err != nil {
+		return err
+	} else if len(ids) == 0 {
+		return mustBeActorCollection(c, db, actors, collectionId)
+	}
+	owners := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		owners[id.String()] = true
+	}
+	for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+		actorId, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		if !owners[actorId.String()] {
+			return &ForbiddenError{
+				Object: collectionId,
+				Reason: fmt.Sprintf("collection is not attributed to actor %s", actorId),
+			}
+		}
+	}
+	return nil
+}
+
+// mustBeActorCollection ensures that each of the actors shares the origin of
+// the collection and has it as its followers, following, liked, or featured
+// collection.
+//
+// The caller must hold the lock for the collection.
+func mustBeActorCollection(c context.Context, db Database, actors vocab.ActivityStreamsActorProperty, collectionId *url.URL) error {
+	// Create anonymous loop function to be able to properly scope the defer
+	// for the database lock at each iteration.
+	loopFn := func(actorId *url.URL) error {
+		if !sameOrigin(actorId, collectionId) {
+			return &ForbiddenError{
+				Object: collectionId,
+				Reason: fmt.Sprintf("collection is not attributed to actor %s", actorId),
+			}
+		}
+		if err := db.Lock(c, actorId); err != nil {
+			return err
+		}
+		defer db.Unlock(c, actorId)
+		t, err := db.Get(c, actorId)
+		if err != nil {
+			return err
+		}
+		for _, propFn := range []func(vocab.Type) IdProperty{followersProperty, followingProperty, likedProperty, featuredProperty} {
+			if p := propFn(t); p != nil {
+				if id, err := ToId(p); err == nil && id.String() == collectionId.String() {
+					return nil
+				}
+			}
+		}
+		return &ForbiddenError{
+			Object: collectionId,
+			Reason: fmt.Sprintf("collection is not a collection of actor %s", actorId),
+		}
+	}
+	for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+		actorId, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		if err := loopFn(actorId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containsIRI determines whether the IRI is among the IRIs.
+func containsIRI(u []*url.URL, iri *url.URL) bool {
+	for _, elem := range u {
+		if elem.String() == iri.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// sameOrigin determines whether the IRIs have the same scheme and host.
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host)
+}
+
 // normalizeRecipients ensures the activity and object have the same 'to',
 // 'bto', 'cc', 'bcc', and 'audience' properties. Copy the Activity's recipients
 // to objects, and the objects to the activity, but does NOT copy objects'
@@ -737,67 +1129,81 @@ func toTombstone(obj vocab.Type, id *url.URL, now time.Time) vocab.ActivityStrea
 }
 
 // mustHaveActivityActorsMatchObjectActors ensures that the actors on types in
-// the 'object' property are all listed in the 'actor' property.
+// the 'object' property are all listed in the 'actor' property. It returns the
+// dereferenced values of the 'object' property.
 func mustHaveActivityActorsMatchObjectActors(c context.Context,
 	actors vocab.ActivityStreamsActorProperty,
 	op vocab.ActivityStreamsObjectProperty,
 	newTransport func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (t Transport, err error),
-	boxIRI *url.URL) error {
+	boxIRI *url.URL) ([]vocab.Type, error) {
+	var objs []vocab.Type
 	activityActorMap := make(map[string]bool, actors.Len())
 	for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
 		id, err := ToId(iter)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		activityActorMap[id.String()] = true
 	}
 	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
 		iri, err := ToId(iter)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		// Attempt to dereference the IRI, regardless whether it is a
 		// type or IRI
 		tport, err := newTransport(c, boxIRI, goFedUserAgent())
 		if err != nil {
-			return err
+			return nil, err
 		}
 		b, err := tport.Dereference(c, iri)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		var m map[string]interface{}
 		if err = json.Unmarshal(b, &m); err != nil {
-			return err
+			return nil, err
 		}
 		t, err := streams.ToType(c, m)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		// The value must be the one at the IRI, or a peer could serve
+		// the id of another actor's activity from an IRI it controls.
+		if id, err := GetId(t); err != nil {
+			return nil, err
+		} else if id.String() != iri.String() {
+			return nil, &ForbiddenError{Object: iri, Reason: "object is served under another id"}
 		}
 		ac, ok := t.(actorer)
 		if !ok {
-			return fmt.Errorf("cannot verify actors: object value has no 'actor' property")
+			return nil, fmt.Errorf("cannot verify actors: object value has no 'actor' property")
 		}
+		objs = append(objs, t)
 		objActors := ac.GetActivityStreamsActor()
 		for iter := objActors.Begin(); iter != objActors.End(); iter = iter.Next() {
 			id, err := ToId(iter)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			if !activityActorMap[id.String()] {
-				return fmt.Errorf("activity does not have all actors from its object's actors")
+				return nil, fmt.Errorf("activity does not have all actors from its object's actors")
 			}
 		}
 	}
-	return nil
+	return objs, nil
 }
 
 // add implements the logic of adding object ids to a target Collection or
 // OrderedCollection. This logic is shared by both the C2S and S2S protocols.
+//
+// If authorize is not nil, it is called for each target owned by this server
+// with its lock held, and any error it returns aborts the Add.
 func add(c context.Context,
 	op vocab.ActivityStreamsObjectProperty,
 	target vocab.ActivityStreamsTargetProperty,
-	db Database) error {
+	db Database,
+	authorize func(c context.Context, collectionId *url.URL) error) error {
 	opIds := make([]*url.URL, 0, op.Len())
 	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
 		id, err := ToId(iter)
@@ -826,6 +1232,19 @@ func add(c context.Context,
 		} else if !owns {
 			return nil
 		}
+		if authorize != nil {
+			if err := authorize(c, t); err != nil {
+				return err
+			}
+		}
+		if cdb, ok := db.(CollectionDatabase); ok {
+			for _, objId := range opIds {
+				if err := cdb.AppendToCollection(c, t, objId); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
 		tp, err := db.Get(c, t)
 		if err != nil {
 			return err
@@ -875,17 +1294,22 @@ func add(c context.Context,
 
 // remove implements the logic of removing object ids to a target Collection or
 // OrderedCollection. This logic is shared by both the C2S and S2S protocols.
+//
+// If authorize is not nil, it is called like it is for add.
 func remove(c context.Context,
 	op vocab.ActivityStreamsObjectProperty,
 	target vocab.ActivityStreamsTargetProperty,
-	db Database) error {
+	db Database,
+	authorize func(c context.Context, collectionId *url.URL) error) error {
 	opIds := make(map[string]bool, op.Len())
+	opIRIs := make([]*url.URL, 0, op.Len())
 	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
 		id, err := ToId(iter)
 		if err != nil {
 			return err
 		}
 		opIds[id.String()] = true
+		opIRIs = append(opIRIs, id)
 	}
 	targetIds := make([]*url.URL, 0, op.Len())
 	for iter := target.Begin(); iter != target.End(); iter = iter.Next() {
@@ -907,6 +1331,19 @@ func remove(c context.Context,
 		} else if !owns {
 			return nil
 		}
+		if authorize != nil {
+			if err := authorize(c, t); err != nil {
+				return err
+			}
+		}
+		if cdb, ok := db.(CollectionDatabase); ok {
+			for _, objId := range opIRIs {
+				if err := cdb.RemoveFromCollection(c, t, objId); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
 		tp, err := db.Get(c, t)
 		if err != nil {
 			return err
@@ -993,3 +1430,1243 @@ func requestId(r *http.Request, scheme string) *url.URL {
 	id.Scheme = scheme
 	return id
 }
+
+// followersProperty returns the 'followers' property of an actor, if present.
+func followersProperty(t vocab.Type) IdProperty {
+	if f, ok := t.(followerser); ok && f.GetActivityStreamsFollowers() != nil {
+		return f.GetActivityStreamsFollowers()
+	}
+	return nil
+}
+
+// followingProperty returns the 'following' property of an actor, if present.
+func followingProperty(t vocab.Type) IdProperty {
+	if f, ok := t.(followinger); ok && f.GetActivityStreamsFollowing() != nil {
+		return f.GetActivityStreamsFollowing()
+	}
+	return nil
+}
+
+// likedProperty returns the 'liked' property of an actor, if present.
+func likedProperty(t vocab.Type) IdProperty {
+	if l, ok := t.(likeder); ok && l.GetActivityStreamsLiked() != nil {
+		return l.GetActivityStreamsLiked()
+	}
+	return nil
+}
+
+// featuredProperty returns the 'featured' property of an actor, if present.
+func featuredProperty(t vocab.Type) IdProperty {
+	if f, ok := t.(featureder); ok && f.GetTootFeatured() != nil {
+		return f.GetTootFeatured()
+	}
+	return nil
+}
+
+// likesProperty returns the 'likes' property of an object, if present.
+func likesProperty(t vocab.Type) IdProperty {
+	if l, ok := t.(likeser); ok && l.GetActivityStreamsLikes() != nil {
+		return l.GetActivityStreamsLikes()
+	}
+	return nil
+}
+
+// sharesProperty returns the 'shares' property of an object, if present.
+func sharesProperty(t vocab.Type) IdProperty {
+	if s, ok := t.(shareser); ok && s.GetActivityStreamsShares() != nil {
+		return s.GetActivityStreamsShares()
+	}
+	return nil
+}
+
+// repliesProperty returns the 'replies' property of an object, if present.
+func repliesProperty(t vocab.Type) IdProperty {
+	if r, ok := t.(replieser); ok && r.GetActivityStreamsReplies() != nil {
+		return r.GetActivityStreamsReplies()
+	}
+	return nil
+}
+
+// inReplyToIds returns the ids of the objects the value is in reply to. Votes
+// on Questions are not considered replies.
+func inReplyToIds(t vocab.Type) (u []*url.URL, err error) {
+	if questionIRI, _, _, err := voteOf(t); err != nil || questionIRI != nil {
+		return nil, err
+	}
+	i, ok := t.(inReplyToer)
+	if !ok {
+		return
+	}
+	irt := i.GetActivityStreamsInReplyTo()
+	if irt == nil {
+		return
+	}
+	for iter := irt.Begin(); iter != irt.End(); iter = iter.Next() {
+		var id *url.URL
+		id, err = ToId(iter)
+		if err != nil {
+			return
+		}
+		u = append(u, id)
+	}
+	return
+}
+
+// addToReplies prepends the reply's id to the 'replies' collection of each
+// object it is in reply to that this server owns, creating a Collection if
+// the object has none.
+//
+// If the Database is a CollectionDatabase and the 'replies' property is an
+// IRI, the id is prepended to the collection at that IRI instead.
+func addToReplies(c context.Context, db Database, reply vocab.Type) error {
+	parents, err := inReplyToIds(reply)
+	if err != nil || len(parents) == 0 {
+		return err
+	}
+	id, err := GetId(reply)
+	if err != nil {
+		return err
+	}
+	// Create anonymous loop function to be able to properly scope the defer
+	// for the database lock at each iteration.
+	loopFn := func(parentId *url.URL) error {
+		if err := db.Lock(c, parentId); err != nil {
+			return err
+		}
+		defer db.Unlock(c, parentId)
+		if owns, err := db.Owns(c, parentId); err != nil {
+			return err
+		} else if !owns {
+			return nil
+		}
+		t, err := db.Get(c, parentId)
+		if err != nil {
+			return err
+		}
+		r, ok := t.(replieser)
+		if !ok {
+			return fmt.Errorf("cannot add reply to replies collection for type %T", t)
+		}
+		replies := r.GetActivityStreamsReplies()
+		if cdb, ok := db.(CollectionDatabase); ok && replies != nil && replies.IsIRI() {
+			return cdb.PrependToCollection(c, replies.GetIRI(), id)
+		}
+		if replies == nil {
+			replies = streams.NewActivityStreamsRepliesProperty()
+			r.SetActivityStreamsReplies(replies)
+		}
+		repliesT := replies.GetType()
+		if repliesT == nil {
+			col := streams.NewActivityStreamsCollection()
+			repliesT = col
+			replies.SetActivityStreamsCollection(col)
+		}
+		if col, ok := repliesT.(itemser); ok {
+			items := col.GetActivityStreamsItems()
+			if items == nil {
+				items = streams.NewActivityStreamsItemsProperty()
+				col.SetActivityStreamsItems(items)
+			}
+			items.PrependIRI(id)
+		} else if oCol, ok := repliesT.(orderedItemser); ok {
+			oItems := oCol.GetActivityStreamsOrderedItems()
+			if oItems == nil {
+				oItems = streams.NewActivityStreamsOrderedItemsProperty()
+				oCol.SetActivityStreamsOrderedItems(oItems)
+			}
+			oItems.PrependIRI(id)
+		} else {
+			return fmt.Errorf("replies type is neither a Collection nor an OrderedCollection: %T", repliesT)
+		}
+		return db.Update(c, t)
+	}
+	for _, parentId := range parents {
+		if err := loopFn(parentId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeFromReplies removes the reply's id from the 'replies' collection of
+// each object it is in reply to that this server owns.
+func removeFromReplies(c context.Context, db Database, reply vocab.Type) error {
+	parents, err := inReplyToIds(reply)
+	if err != nil || len(parents) == 0 {
+		return err
+	}
+	id, err := GetId(reply)
+	if err != nil {
+		return err
+	}
+	for _, parentId := range parents {
+		if err := removeFromObjectCollection(c, db, parentId, id, repliesProperty); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prependToActorCollection prepends the ids to one of the actor's collections,
+// such as its followers. The caller must hold the lock for the actor.
+//
+// If the Database is a CollectionDatabase and the actor in the database has
+// the collection property, each id is prepended to the collection at the
+// property's IRI. Otherwise, the whole collection is obtained with the getter,
+// modified, and passed to Update.
+func prependToActorCollection(c context.Context,
+	db Database,
+	actorIRI *url.URL,
+	ids []*url.URL,
+	prop func(t vocab.Type) IdProperty,
+	get func(c context.Context, actorIRI *url.URL) (vocab.ActivityStreamsCollection, error)) error {
+	if cdb, ok := db.(CollectionDatabase); ok {
+		actor, err := db.Get(c, actorIRI)
+		if err != nil {
+			return err
+		}
+		if p := prop(actor); p != nil {
+			colIRI, err := ToId(p)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if err := cdb.PrependToCollection(c, colIRI, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	col, err := get(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	items := col.GetActivityStreamsItems()
+	if items == nil {
+		items = streams.NewActivityStreamsItemsProperty()
+		col.SetActivityStreamsItems(items)
+	}
+	for _, id := range ids {
+		items.PrependIRI(id)
+	}
+	return db.Update(c, col)
+}
+
+// removeFromActorCollection removes the ids from one of the actor's
+// collections, such as its followers. The caller must hold the lock for the
+// actor.
+//
+// It is the counterpart of prependToActorCollection, and modifies the
+// collection in the same manner.
+func removeFromActorCollection(c context.Context,
+	db Database,
+	actorIRI *url.URL,
+	ids []*url.URL,
+	prop func(t vocab.Type) IdProperty,
+	get func(c context.Context, actorIRI *url.URL) (vocab.ActivityStreamsCollection, error)) error {
+	if cdb, ok := db.(CollectionDatabase); ok {
+		actor, err := db.Get(c, actorIRI)
+		if err != nil {
+			return err
+		}
+		if p := prop(actor); p != nil {
+			colIRI, err := ToId(p)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if err := cdb.RemoveFromCollection(c, colIRI, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	col, err := get(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	if err := removeIdsFromCollection(col, ids); err != nil {
+		return err
+	}
+	return db.Update(c, col)
+}
+
+// removeFromObjectCollection removes the id from one of the collections of an
+// object owned by this server, such as its 'likes'. Objects that are not owned
+// or do not have the collection are left untouched.
+//
+// If the Database is a CollectionDatabase and the collection property is an
+// IRI, the id is removed from the collection at that IRI. Otherwise, the
+// collection embedded in the object is modified and the object is passed to
+// Update.
+func removeFromObjectCollection(c context.Context,
+	db Database,
+	objId, id *url.URL,
+	prop func(t vocab.Type) IdProperty) error {
+	if err := db.Lock(c, objId); err != nil {
+		return err
+	}
+	defer db.Unlock(c, objId)
+	if owns, err := db.Owns(c, objId); err != nil {
+		return err
+	} else if !owns {
+		return nil
+	}
+	t, err := db.Get(c, objId)
+	if err != nil {
+		return err
+	}
+	p := prop(t)
+	if p == nil {
+		return nil
+	}
+	if cdb, ok := db.(CollectionDatabase); ok && p.IsIRI() {
+		return cdb.RemoveFromCollection(c, p.GetIRI(), id)
+	}
+	colT := p.GetType()
+	if colT == nil {
+		return nil
+	}
+	if err := removeIdsFromCollection(colT, []*url.URL{id}); err != nil {
+		return err
+	}
+	return db.Update(c, t)
+}
+
+// removeIdsFromCollection removes all occurrences of the ids from the items of
+// a Collection or OrderedCollection.
+func removeIdsFromCollection(t vocab.Type, ids []*url.URL) error {
+	idMap := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		idMap[id.String()] = true
+	}
+	if col, ok := t.(itemser); ok {
+		items := col.GetActivityStreamsItems()
+		if items == nil {
+			return nil
+		}
+		for i := 0; i < items.Len(); /*Conditional*/ {
+			id, err := ToId(items.At(i))
+			if err != nil {
+				return err
+			}
+			if idMap[id.String()] {
+				items.Remove(i)
+			} else {
+				i++
+			}
+		}
+	} else if oCol, ok := t.(orderedItemser); ok {
+		oItems := oCol.GetActivityStreamsOrderedItems()
+		if oItems == nil {
+			return nil
+		}
+		for i := 0; i < oItems.Len(); /*Conditional*/ {
+			id, err := ToId(oItems.At(i))
+			if err != nil {
+				return err
+			}
+			if idMap[id.String()] {
+				oItems.Remove(i)
+			} else {
+				i++
+			}
+		}
+	} else {
+		return fmt.Errorf("cannot remove from type that is neither a Collection nor an OrderedCollection: %T", t)
+	}
+	return nil
+}
+
+// newResponse creates an Accept or Reject of the activity, such as a Follow, by
+// the actor. It is addressed to the actors of the activity, which are also
+// returned.
+func newResponse(accept bool, actorIRI *url.URL, activity Activity) (response Activity, recipients []*url.URL, err error) {
+	if accept {
+		response = streams.NewActivityStreamsAccept()
+	} else {
+		response = streams.NewActivityStreamsReject()
+	}
+	// Set us as the 'actor'.
+	me := streams.NewActivityStreamsActorProperty()
+	response.SetActivityStreamsActor(me)
+	me.AppendIRI(actorIRI)
+	// Set the activity as the 'object' property.
+	op := streams.NewActivityStreamsObjectProperty()
+	response.SetActivityStreamsObject(op)
+	if err = op.AppendType(activity); err != nil {
+		return
+	}
+	// Add all actors on the original activity to the 'to' property.
+	recipients = make([]*url.URL, 0)
+	to := streams.NewActivityStreamsToProperty()
+	response.SetActivityStreamsTo(to)
+	activityActors := activity.GetActivityStreamsActor()
+	if activityActors == nil {
+		return
+	}
+	for iter := activityActors.Begin(); iter != activityActors.End(); iter = iter.Next() {
+		var id *url.URL
+		id, err = ToId(iter)
+		if err != nil {
+			return
+		}
+		to.AppendIRI(id)
+		recipients = append(recipients, id)
+	}
+	return
+}
+
+// prependFollowRequest records the Follow as awaiting approval by the actor.
+// The caller must hold the lock for the actor.
+func prependFollowRequest(c context.Context,
+	frdb FollowRequestsDatabase,
+	actorIRI *url.URL,
+	follow vocab.ActivityStreamsFollow) error {
+	col, err := frdb.FollowRequests(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	items := col.GetActivityStreamsItems()
+	if items == nil {
+		items = streams.NewActivityStreamsItemsProperty()
+		col.SetActivityStreamsItems(items)
+	}
+	items.PrependActivityStreamsFollow(follow)
+	return frdb.SetFollowRequests(c, actorIRI, col)
+}
+
+// removeFollowRequest removes the Follow with the id from the ones awaiting
+// approval by the actor, and returns it. The caller must hold the lock for the
+// actor.
+//
+// Returns ErrNotFound if no such Follow is awaiting approval.
+func removeFollowRequest(c context.Context,
+	frdb FollowRequestsDatabase,
+	actorIRI, followIRI *url.URL) (vocab.ActivityStreamsFollow, error) {
+	col, err := frdb.FollowRequests(c, actorIRI)
+	if err != nil {
+		return nil, err
+	}
+	items := col.GetActivityStreamsItems()
+	if items == nil {
+		return nil, ErrNotFound
+	}
+	for i := 0; i < items.Len(); i++ {
+		iter := items.At(i)
+		if !iter.IsActivityStreamsFollow() {
+			continue
+		}
+		follow := iter.GetActivityStreamsFollow()
+		id, err := GetId(follow)
+		if err != nil {
+			return nil, err
+		}
+		if id.String() == followIRI.String() {
+			items.Remove(i)
+			return follow, frdb.SetFollowRequests(c, actorIRI, col)
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// verifyMove ensures the Move is by the actor it moves, and that the actor it
+// moves to lists the moving actor in its 'alsoKnownAs' property. The 'target'
+// is dereferenced to verify the latter. It returns the ids of both actors.
+func verifyMove(c context.Context,
+	a vocab.ActivityStreamsMove,
+	newTransport func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (t Transport, err error),
+	boxIRI *url.URL) (from, to *url.URL, err error) {
+	op := a.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		return nil, nil, ErrObjectRequired
+	} else if op.Len() > 1 {
+		return nil, nil, fmt.Errorf("a Move must have exactly one object")
+	}
+	target := a.GetActivityStreamsTarget()
+	if target == nil || target.Len() == 0 {
+		return nil, nil, ErrTargetRequired
+	} else if target.Len() > 1 {
+		return nil, nil, fmt.Errorf("a Move must have exactly one target")
+	}
+	if from, err = ToId(op.At(0)); err != nil {
+		return
+	}
+	if to, err = ToId(target.At(0)); err != nil {
+		return
+	}
+	// Ensure the actor moves itself.
+	isActor := false
+	if actors := a.GetActivityStreamsActor(); actors != nil {
+		for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+			id, err := ToId(iter)
+			if err != nil {
+				return nil, nil, err
+			}
+			if id.String() == from.String() {
+				isActor = true
+				break
+			}
+		}
+	}
+	if !isActor {
+		return nil, nil, &ForbiddenError{Object: from, Reason: "only the actor itself may move"}
+	}
+	// Ensure the new actor claims to be the old one.
+	tport, err := newTransport(c, boxIRI, goFedUserAgent())
+	if err != nil {
+		return
+	}
+	b, err := tport.Dereference(c, to)
+	if err != nil {
+		return
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		return
+	}
+	if aka, ok := t.(alsoKnownAser); ok && aka.GetActivityStreamsAlsoKnownAs() != nil {
+		p := aka.GetActivityStreamsAlsoKnownAs()
+		for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+			id, err := ToId(iter)
+			if err != nil {
+				return nil, nil, err
+			}
+			if id.String() == from.String() {
+				return from, to, nil
+			}
+		}
+	}
+	return nil, nil, &ForbiddenError{Object: to, Reason: "the target of the Move does not list the moving actor in alsoKnownAs"}
+}
+
+// mustHaveMovedTo ensures that the actor that moved, once dereferenced, lists
+// the actor it moved to in its 'movedTo' property.
+func mustHaveMovedTo(c context.Context,
+	from, to *url.URL,
+	newTransport func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (t Transport, err error),
+	boxIRI *url.URL) error {
+	tport, err := newTransport(c, boxIRI, goFedUserAgent())
+	if err != nil {
+		return err
+	}
+	b, err := tport.Dereference(c, from)
+	if err != nil {
+		return err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		return err
+	}
+	if id, err := GetId(t); err != nil {
+		return err
+	} else if id.String() != from.String() {
+		return &ForbiddenError{Object: from, Reason: "the moving actor is served under another id"}
+	}
+	if mt, ok := t.(movedToer); ok && mt.GetActivityStreamsMovedTo() != nil {
+		id, err := ToId(mt.GetActivityStreamsMovedTo())
+		if err != nil {
+			return err
+		} else if id.String() == to.String() {
+			return nil
+		}
+	}
+	return &ForbiddenError{Object: from, Reason: "the moving actor does not list the target of the Move in movedTo"}
+}
+
+// collectionHasId determines whether the id is among the items of a Collection
+// or OrderedCollection.
+func collectionHasId(t vocab.Type, id *url.URL) (bool, error) {
+	if col, ok := t.(itemser); ok {
+		items := col.GetActivityStreamsItems()
+		if items == nil {
+			return false, nil
+		}
+		for i := 0; i < items.Len(); i++ {
+			itemId, err := ToId(items.At(i))
+			if err != nil {
+				return false, err
+			}
+			if itemId.String() == id.String() {
+				return true, nil
+			}
+		}
+	} else if oCol, ok := t.(orderedItemser); ok {
+		oItems := oCol.GetActivityStreamsOrderedItems()
+		if oItems == nil {
+			return false, nil
+		}
+		for i := 0; i < oItems.Len(); i++ {
+			itemId, err := ToId(oItems.At(i))
+			if err != nil {
+				return false, err
+			}
+			if itemId.String() == id.String() {
+				return true, nil
+			}
+		}
+	} else {
+		return false, fmt.Errorf("cannot search type that is neither a Collection nor an OrderedCollection: %T", t)
+	}
+	return false, nil
+}
+
+// newFollow creates a Follow of the object by the actor, addressed to the
+// object.
+func newFollow(actorIRI, objectIRI *url.URL) vocab.ActivityStreamsFollow {
+	follow := streams.NewActivityStreamsFollow()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(actorIRI)
+	follow.SetActivityStreamsActor(actor)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(objectIRI)
+	follow.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(objectIRI)
+	follow.SetActivityStreamsTo(to)
+	return follow
+}
+
+// prependToBlocked adds the ids that are not yet blocked by the actor to its
+// blocked collection. The caller must hold the lock for the actor.
+func prependToBlocked(c context.Context,
+	bdb BlockedDatabase,
+	actorIRI *url.URL,
+	ids []*url.URL) error {
+	col, err := bdb.Blocked(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	items := col.GetActivityStreamsItems()
+	if items == nil {
+		items = streams.NewActivityStreamsItemsProperty()
+		col.SetActivityStreamsItems(items)
+	}
+	for _, id := range ids {
+		blocked, err := collectionHasId(col, id)
+		if err != nil {
+			return err
+		} else if !blocked {
+			items.PrependIRI(id)
+		}
+	}
+	return bdb.SetBlocked(c, actorIRI, col)
+}
+
+// removeFromBlocked removes the ids from the actor's blocked collection. The
+// caller must hold the lock for the actor.
+func removeFromBlocked(c context.Context,
+	bdb BlockedDatabase,
+	actorIRI *url.URL,
+	ids []*url.URL) error {
+	col, err := bdb.Blocked(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	if err := removeIdsFromCollection(col, ids); err != nil {
+		return err
+	}
+	return bdb.SetBlocked(c, actorIRI, col)
+}
+
+// hasBlocked determines whether the actor blocked any of the peers. The caller
+// must hold the lock for the actor.
+func hasBlocked(c context.Context,
+	bdb BlockedDatabase,
+	actorIRI *url.URL,
+	peers []*url.URL) (bool, error) {
+	col, err := bdb.Blocked(c, actorIRI)
+	if err != nil {
+		return false, err
+	}
+	for _, peer := range peers {
+		if blocked, err := collectionHasId(col, peer); err != nil || blocked {
+			return blocked, err
+		}
+	}
+	return false, nil
+}
+
+// prependReport records the Flag as awaiting moderation by the actor. The
+// caller must hold the lock for the actor.
+func prependReport(c context.Context,
+	rdb ReportsDatabase,
+	actorIRI *url.URL,
+	flag vocab.ActivityStreamsFlag) error {
+	col, err := rdb.Reports(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	items := col.GetActivityStreamsItems()
+	if items == nil {
+		items = streams.NewActivityStreamsItemsProperty()
+		col.SetActivityStreamsItems(items)
+	}
+	items.PrependActivityStreamsFlag(flag)
+	return rdb.SetReports(c, actorIRI, col)
+}
+
+// removeReport removes the Flag with the id from the ones awaiting moderation
+// by the actor, and returns it. The caller must hold the lock for the actor.
+//
+// Returns ErrNotFound if no such Flag is awaiting moderation.
+func removeReport(c context.Context,
+	rdb ReportsDatabase,
+	actorIRI, flagIRI *url.URL) (vocab.ActivityStreamsFlag, error) {
+	col, err := rdb.Reports(c, actorIRI)
+	if err != nil {
+		return nil, err
+	}
+	items := col.GetActivityStreamsItems()
+	if items == nil {
+		return nil, ErrNotFound
+	}
+	for i := 0; i < items.Len(); i++ {
+		iter := items.At(i)
+		if !iter.IsActivityStreamsFlag() {
+			continue
+		}
+		flag := iter.GetActivityStreamsFlag()
+		id, err := GetId(flag)
+		if err != nil {
+			return nil, err
+		}
+		if id.String() == flagIRI.String() {
+			items.Remove(i)
+			return flag, rdb.SetReports(c, actorIRI, col)
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// newReport creates a Flag of the objects by the actor, addressed to the
+// instance actor of a peer.
+func newReport(actorIRI, instanceActorIRI *url.URL, objects []*url.URL, content string) vocab.ActivityStreamsFlag {
+	flag := streams.NewActivityStreamsFlag()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(actorIRI)
+	flag.SetActivityStreamsActor(actor)
+	op := streams.NewActivityStreamsObjectProperty()
+	for _, id := range objects {
+		op.AppendIRI(id)
+	}
+	flag.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(instanceActorIRI)
+	flag.SetActivityStreamsTo(to)
+	if content != "" {
+		cp := streams.NewActivityStreamsContentProperty()
+		cp.AppendXMLSchemaString(content)
+		flag.SetActivityStreamsContent(cp)
+	}
+	return flag
+}
+
+// voteOf returns the Question the value votes on, the actor voting, and the
+// name of the chosen option. A vote is a Note with a 'name', and a single
+// 'inReplyTo' and 'attributedTo', but no 'content'. The returned Question id is
+// nil if the value is not a vote.
+func voteOf(t vocab.Type) (questionIRI, voterIRI *url.URL, choice string, err error) {
+	note, ok := t.(vocab.ActivityStreamsNote)
+	if !ok {
+		return
+	}
+	if content := note.GetActivityStreamsContent(); content != nil && content.Len() > 0 {
+		return
+	}
+	irt := note.GetActivityStreamsInReplyTo()
+	attrTo := note.GetActivityStreamsAttributedTo()
+	if irt == nil || irt.Len() != 1 || attrTo == nil || attrTo.Len() != 1 {
+		return
+	}
+	names := nameValues(note)
+	if len(names) != 1 {
+		return
+	}
+	if voterIRI, err = ToId(attrTo.At(0)); err != nil {
+		return
+	}
+	questionIRI, err = ToId(irt.At(0))
+	return questionIRI, voterIRI, names[0], err
+}
+
+// nameValues returns the values of the 'name' property, in every language.
+func nameValues(t vocab.Type) (names []string) {
+	v, ok := t.(namer)
+	if !ok {
+		return
+	}
+	name := v.GetActivityStreamsName()
+	if name == nil {
+		return
+	}
+	for iter := name.Begin(); iter != name.End(); iter = iter.Next() {
+		if iter.IsXMLSchemaString() {
+			names = append(names, iter.GetXMLSchemaString())
+		} else if iter.IsRDFLangString() {
+			for _, s := range iter.GetRDFLangString() {
+				names = append(names, s)
+			}
+		}
+	}
+	return
+}
+
+// questionIsClosed determines whether the Question no longer accepts votes,
+// because it is 'closed' or its 'endTime' has passed.
+func questionIsClosed(q vocab.ActivityStreamsQuestion, now time.Time) bool {
+	if end := q.GetActivityStreamsEndTime(); end != nil && end.IsXMLSchemaDateTime() {
+		if !now.Before(end.Get()) {
+			return true
+		}
+	}
+	closed := q.GetActivityStreamsClosed()
+	if closed == nil {
+		return false
+	}
+	for iter := closed.Begin(); iter != closed.End(); iter = iter.Next() {
+		if iter.IsXMLSchemaBoolean() {
+			if iter.GetXMLSchemaBoolean() {
+				return true
+			}
+		} else if iter.IsXMLSchemaDateTime() {
+			if !now.Before(iter.GetXMLSchemaDateTime()) {
+				return true
+			}
+		} else {
+			// An object or link closing the Question means it is closed.
+			return true
+		}
+	}
+	return false
+}
+
+// questionOption finds the option of the Question with the name, and whether
+// the Question allows choosing more than one of its options. The option is
+// nil if there is no such option.
+func questionOption(q vocab.ActivityStreamsQuestion, choice string) (option vocab.Type, anyOf bool) {
+	var options []vocab.Type
+	if oneOf := q.GetActivityStreamsOneOf(); oneOf != nil {
+		for iter := oneOf.Begin(); iter != oneOf.End(); iter = iter.Next() {
+			options = append(options, iter.GetType())
+		}
+	}
+	if anyOfProp := q.GetActivityStreamsAnyOf(); anyOfProp != nil && anyOfProp.Len() > 0 {
+		anyOf = true
+		for iter := anyOfProp.Begin(); iter != anyOfProp.End(); iter = iter.Next() {
+			options = append(options, iter.GetType())
+		}
+	}
+	for _, t := range options {
+		if t == nil {
+			continue
+		}
+		for _, name := range nameValues(t) {
+			if name == choice {
+				return t, anyOf
+			}
+		}
+	}
+	return nil, anyOf
+}
+
+// incrementRepliesCount adds one to the 'totalItems' of the 'replies'
+// collection of the option, creating the collection if it is missing.
+//
+// A 'replies' that is an IRI, or not a collection, is left unchanged rather
+// than replaced, and the vote is not counted in it.
+func incrementRepliesCount(option vocab.Type) error {
+	r, ok := option.(replieser)
+	if !ok {
+		return fmt.Errorf("cannot count votes for %T: no 'replies' property", option)
+	}
+	replies := r.GetActivityStreamsReplies()
+	if replies == nil {
+		replies = streams.NewActivityStreamsRepliesProperty()
+		r.SetActivityStreamsReplies(replies)
+	} else if replies.IsIRI() {
+		return nil
+	}
+	col, ok := replies.GetType().(totalItemser)
+	if !ok && replies.GetType() != nil {
+		return nil
+	} else if !ok {
+		c := streams.NewActivityStreamsCollection()
+		replies.SetActivityStreamsCollection(c)
+		col = c
+	}
+	total := col.GetActivityStreamsTotalItems()
+	if total == nil {
+		total = streams.NewActivityStreamsTotalItemsProperty()
+		total.Set(0)
+		col.SetActivityStreamsTotalItems(total)
+	}
+	total.Set(total.Get() + 1)
+	return nil
+}
+
+// newQuestionUpdate creates an Update of the Question by the actor, addressed
+// to the Question's audience and to the voters.
+func newQuestionUpdate(actorIRI *url.URL, q vocab.ActivityStreamsQuestion, voters []*url.URL) vocab.ActivityStreamsUpdate {
+	update := streams.NewActivityStreamsUpdate()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(actorIRI)
+	update.SetActivityStreamsActor(actor)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendActivityStreamsQuestion(q)
+	update.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	if qTo := q.GetActivityStreamsTo(); qTo != nil {
+		for iter := qTo.Begin(); iter != qTo.End(); iter = iter.Next() {
+			if id, err := ToId(iter); err == nil {
+				to.AppendIRI(id)
+			}
+		}
+	}
+	for _, voter := range voters {
+		to.AppendIRI(voter)
+	}
+	update.SetActivityStreamsTo(to)
+	if qCc := q.GetActivityStreamsCc(); qCc != nil {
+		cc := streams.NewActivityStreamsCcProperty()
+		for iter := qCc.Begin(); iter != qCc.End(); iter = iter.Next() {
+			if id, err := ToId(iter); err == nil {
+				cc.AppendIRI(id)
+			}
+		}
+		update.SetActivityStreamsCc(cc)
+	}
+	return update
+}
+
+// activityActorIds returns the ids of the actors of the activity.
+func activityActorIds(a Activity) (u []*url.URL, err error) {
+	actors := a.GetActivityStreamsActor()
+	if actors == nil {
+		return
+	}
+	for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+		var id *url.URL
+		id, err = ToId(iter)
+		if err != nil {
+			return
+		}
+		u = append(u, id)
+	}
+	return
+}
+
+// getGroup obtains the local actor if it is a Group, or nil otherwise.
+func getGroup(c context.Context, db Database, actorIRI *url.URL) (vocab.ActivityStreamsGroup, error) {
+	if err := db.Lock(c, actorIRI); err != nil {
+		return nil, err
+	}
+	defer db.Unlock(c, actorIRI)
+	t, err := db.Get(c, actorIRI)
+	if err != nil {
+		return nil, err
+	}
+	group, _ := t.(vocab.ActivityStreamsGroup)
+	return group, nil
+}
+
+// isGroupActivity determines whether a Group redistributes activities of the
+// type to its members.
+func isGroupActivity(a Activity) bool {
+	switch a.(type) {
+	case vocab.ActivityStreamsCreate,
+		vocab.ActivityStreamsUpdate,
+		vocab.ActivityStreamsDelete,
+		vocab.ActivityStreamsLike,
+		vocab.ActivityStreamsDislike:
+		return true
+	}
+	return false
+}
+
+// newGroupAnnounce creates an Announce of the activity by the Group, addressed
+// to its followers and, if the activity is public, to the Public collection.
+func newGroupAnnounce(groupIRI, followersIRI *url.URL, activity Activity, public bool) (vocab.ActivityStreamsAnnounce, error) {
+	announce := streams.NewActivityStreamsAnnounce()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(groupIRI)
+	announce.SetActivityStreamsActor(actor)
+	op := streams.NewActivityStreamsObjectProperty()
+	if err := op.AppendType(activity); err != nil {
+		return nil, err
+	}
+	announce.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(followersIRI)
+	announce.SetActivityStreamsTo(to)
+	if public {
+		publicIRI, err := url.Parse(PublicActivityPubIRI)
+		if err != nil {
+			return nil, err
+		}
+		cc := streams.NewActivityStreamsCcProperty()
+		cc.AppendIRI(publicIRI)
+		announce.SetActivityStreamsCc(cc)
+	}
+	return announce, nil
+}
+
+// noRSVP is the lack of a response to an Event, such as after a Leave.
+const noRSVP RSVP = -1
+
+// respondToEvents records the actors of the activity as giving the response to
+// each Event on this server among its objects, either directly or as the
+// object of an Invite. It does nothing unless the Database implements
+// EventsDatabase.
+func respondToEvents(c context.Context, db Database, a Activity, rsvp RSVP) error {
+	edb, ok := db.(EventsDatabase)
+	if !ok {
+		return nil
+	}
+	op := a.GetActivityStreamsObject()
+	if op == nil {
+		return nil
+	}
+	events, err := localEvents(c, db, op)
+	if err != nil || len(events) == 0 {
+		return err
+	}
+	actorIRIs, err := activityActorIds(a)
+	if err != nil {
+		return err
+	}
+	for _, eventIRI := range events {
+		if err := setRSVP(c, db, edb, eventIRI, actorIRIs, rsvp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localEvents returns the ids of the Events on this server among the objects,
+// or among the objects of the Invites among them.
+func localEvents(c context.Context, db Database, op vocab.ActivityStreamsObjectProperty) (events []*url.URL, err error) {
+	var ids []*url.URL
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		if invite, ok := iter.GetType().(vocab.ActivityStreamsInvite); ok {
+			var more []*url.URL
+			if more, err = objectIds(invite); err != nil {
+				return
+			}
+			ids = append(ids, more...)
+			continue
+		}
+		var id *url.URL
+		if id, err = ToId(iter); err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		var t vocab.Type
+		if t, err = getOwned(c, db, id); err != nil {
+			return
+		}
+		switch v := t.(type) {
+		case vocab.ActivityStreamsEvent:
+			events = append(events, id)
+		case vocab.ActivityStreamsInvite:
+			// An Invite sent from this server, responded to by its
+			// id.
+			var inviteObjs []*url.URL
+			if inviteObjs, err = objectIds(v); err != nil {
+				return
+			}
+			for _, objId := range inviteObjs {
+				if t, err = getOwned(c, db, objId); err != nil {
+					return
+				} else if _, ok := t.(vocab.ActivityStreamsEvent); ok {
+					events = append(events, objId)
+				}
+			}
+		}
+	}
+	return
+}
+
+// objectIds returns the ids of the objects of the value.
+func objectIds(o objecter) (u []*url.URL, err error) {
+	op := o.GetActivityStreamsObject()
+	if op == nil {
+		return
+	}
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		var id *url.URL
+		id, err = ToId(iter)
+		if err != nil {
+			return
+		}
+		u = append(u, id)
+	}
+	return
+}
+
+// getOwned obtains the value with the id if this server owns it, or nil
+// otherwise.
+func getOwned(c context.Context, db Database, id *url.URL) (vocab.Type, error) {
+	if err := db.Lock(c, id); err != nil {
+		return nil, err
+	}
+	defer db.Unlock(c, id)
+	if owns, err := db.Owns(c, id); err != nil || !owns {
+		return nil, err
+	}
+	return db.Get(c, id)
+}
+
+// setRSVP records the response of the actors to the local Event, and removes
+// them from the attendees with any other response. With noRSVP, they are only
+// removed.
+func setRSVP(c context.Context,
+	db Database,
+	edb EventsDatabase,
+	eventIRI *url.URL,
+	actorIRIs []*url.URL,
+	rsvp RSVP) error {
+	if err := db.Lock(c, eventIRI); err != nil {
+		return err
+	}
+	defer db.Unlock(c, eventIRI)
+	for _, r := range []RSVP{RSVPGoing, RSVPInterested, RSVPDeclined} {
+		attendees, err := edb.Attendees(c, eventIRI, r)
+		if err != nil {
+			return err
+		}
+		items := attendees.GetActivityStreamsItems()
+		if items == nil {
+			items = streams.NewActivityStreamsItemsProperty()
+			attendees.SetActivityStreamsItems(items)
+		}
+		n := items.Len()
+		changed := false
+		if r == rsvp {
+			for _, actorIRI := range actorIRIs {
+				if has, err := collectionHasId(attendees, actorIRI); err != nil {
+					return err
+				} else if !has {
+					items.PrependIRI(actorIRI)
+					changed = true
+				}
+			}
+		} else {
+			if err := removeIdsFromCollection(attendees, actorIRIs); err != nil {
+				return err
+			}
+			changed = items.Len() != n
+		}
+		if changed {
+			if err := edb.SetAttendees(c, eventIRI, r, attendees); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isRelayActivity determines whether a relay announces the objects of
+// activities of the type to its subscribers.
+func isRelayActivity(a Activity) bool {
+	switch a.(type) {
+	case vocab.ActivityStreamsCreate,
+		vocab.ActivityStreamsAnnounce:
+		return true
+	}
+	return false
+}
+
+// newRelayAnnounce creates a public Announce of the objects by the relay,
+// addressed to its followers. The objects are referred to by id, so that the
+// subscribers fetch them from their origin.
+func newRelayAnnounce(relayIRI, followersIRI *url.URL, objectIRIs []*url.URL) (vocab.ActivityStreamsAnnounce, error) {
+	publicIRI, err := url.Parse(PublicActivityPubIRI)
+	if err != nil {
+		return nil, err
+	}
+	announce := streams.NewActivityStreamsAnnounce()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(relayIRI)
+	announce.SetActivityStreamsActor(actor)
+	op := streams.NewActivityStreamsObjectProperty()
+	for _, id := range objectIRIs {
+		op.AppendIRI(id)
+	}
+	announce.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(followersIRI)
+	announce.SetActivityStreamsTo(to)
+	cc := streams.NewActivityStreamsCcProperty()
+	cc.AppendIRI(publicIRI)
+	announce.SetActivityStreamsCc(cc)
+	return announce, nil
+}
+
+// collectionHasHost determines whether any item of a Collection or
+// OrderedCollection is on the host, such as an instance actor subscribed to a
+// relay for the actors of that instance.
+func collectionHasHost(t vocab.Type, host string) (bool, error) {
+	var ids []*url.URL
+	if col, ok := t.(itemser); ok {
+		items := col.GetActivityStreamsItems()
+		if items == nil {
+			return false, nil
+		}
+		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+			id, err := ToId(iter)
+			if err != nil {
+				return false, err
+			}
+			ids = append(ids, id)
+		}
+	} else if oCol, ok := t.(orderedItemser); ok {
+		oItems := oCol.GetActivityStreamsOrderedItems()
+		if oItems == nil {
+			return false, nil
+		}
+		for iter := oItems.Begin(); iter != oItems.End(); iter = iter.Next() {
+			id, err := ToId(iter)
+			if err != nil {
+				return false, err
+			}
+			ids = append(ids, id)
+		}
+	} else {
+		return false, fmt.Errorf("cannot search type that is neither a Collection nor an OrderedCollection: %T", t)
+	}
+	for _, id := range ids {
+		if id.Host == host {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// newRelayFollow creates a Follow of a relay by the actor, as a LitePub relay
+// expects. The Accept of the relay then adds it to the following collection.
+func newRelayFollow(actorIRI, relayIRI *url.URL) vocab.ActivityStreamsFollow {
+	follow := streams.NewActivityStreamsFollow()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(actorIRI)
+	follow.SetActivityStreamsActor(actor)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(relayIRI)
+	follow.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(relayIRI)
+	follow.SetActivityStreamsTo(to)
+	return follow
+}
@@ -5,6 +5,7 @@ package streams
 import (
 	propertyaccuracy "github.com/go-fed/activity/streams/impl/activitystreams/property_accuracy"
 	propertyactor "github.com/go-fed/activity/streams/impl/activitystreams/property_actor"
+	propertyalsoknownas "github.com/go-fed/activity/streams/impl/activitystreams/property_alsoknownas"
 	propertyaltitude "github.com/go-fed/activity/streams/impl/activitystreams/property_altitude"
 	propertyanyof "github.com/go-fed/activity/streams/impl/activitystreams/property_anyof"
 	propertyattachment "github.com/go-fed/activity/streams/impl/activitystreams/property_attachment"
@@ -42,6 +43,7 @@ import (
 	propertylocation "github.com/go-fed/activity/streams/impl/activitystreams/property_location"
 	propertylongitude "github.com/go-fed/activity/streams/impl/activitystreams/property_longitude"
 	propertymediatype "github.com/go-fed/activity/streams/impl/activitystreams/property_mediatype"
+	propertymovedto "github.com/go-fed/activity/streams/impl/activitystreams/property_movedto"
 	propertyname "github.com/go-fed/activity/streams/impl/activitystreams/property_name"
 	propertynext "github.com/go-fed/activity/streams/impl/activitystreams/property_next"
 	propertyobject "github.com/go-fed/activity/streams/impl/activitystreams/property_object"
@@ -182,6 +184,7 @@ func init() {
 	mgr = &Manager{}
 	propertyaccuracy.SetManager(mgr)
 	propertyactor.SetManager(mgr)
+	propertyalsoknownas.SetManager(mgr)
 	propertyaltitude.SetManager(mgr)
 	propertyanyof.SetManager(mgr)
 	propertyattachment.SetManager(mgr)
@@ -219,6 +222,7 @@ func init() {
 	propertylocation.SetManager(mgr)
 	propertylongitude.SetManager(mgr)
 	propertymediatype.SetManager(mgr)
+	propertymovedto.SetManager(mgr)
 	propertyname.SetManager(mgr)
 	propertynext.SetManager(mgr)
 	propertyobject.SetManager(mgr)
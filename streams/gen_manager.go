@@ -5,6 +5,7 @@ package streams
 import (
 	propertyaccuracy "github.com/go-fed/activity/streams/impl/activitystreams/property_accuracy"
 	propertyactor "github.com/go-fed/activity/streams/impl/activitystreams/property_actor"
+	propertyalsoknownas "github.com/go-fed/activity/streams/impl/activitystreams/property_alsoknownas"
 	propertyaltitude "github.com/go-fed/activity/streams/impl/activitystreams/property_altitude"
 	propertyanyof "github.com/go-fed/activity/streams/impl/activitystreams/property_anyof"
 	propertyattachment "github.com/go-fed/activity/streams/impl/activitystreams/property_attachment"
@@ -42,6 +43,7 @@ import (
 	propertylocation "github.com/go-fed/activity/streams/impl/activitystreams/property_location"
 	propertylongitude "github.com/go-fed/activity/streams/impl/activitystreams/property_longitude"
 	propertymediatype "github.com/go-fed/activity/streams/impl/activitystreams/property_mediatype"
+	propertymovedto "github.com/go-fed/activity/streams/impl/activitystreams/property_movedto"
 	propertyname "github.com/go-fed/activity/streams/impl/activitystreams/property_name"
 	propertynext "github.com/go-fed/activity/streams/impl/activitystreams/property_next"
 	propertyobject "github.com/go-fed/activity/streams/impl/activitystreams/property_object"
@@ -241,6 +243,19 @@ func (this Manager) DeserializeAddActivityStreams() func(map[string]interface{},
 	}
 }
 
+// DeserializeAlsoKnownAsPropertyActivityStreams returns the deserialization
+// method for the "ActivityStreamsAlsoKnownAsProperty" non-functional property
+// in the vocabulary "ActivityStreams"
+func (this Manager) DeserializeAlsoKnownAsPropertyActivityStreams() func(map[string]interface{}, map[string]string) (vocab.ActivityStreamsAlsoKnownAsProperty, error) {
+	return func(m map[string]interface{}, aliasMap map[string]string) (vocab.ActivityStreamsAlsoKnownAsProperty, error) {
+		i, err := propertyalsoknownas.DeserializeAlsoKnownAsProperty(m, aliasMap)
+		if i == nil {
+			return nil, err
+		}
+		return i, err
+	}
+}
+
 // DeserializeAltitudePropertyActivityStreams returns the deserialization method
 // for the "ActivityStreamsAltitudeProperty" non-functional property in the
 // vocabulary "ActivityStreams"
@@ -1362,6 +1377,19 @@ func (this Manager) DeserializeMoveActivityStreams() func(map[string]interface{}
 	}
 }
 
+// DeserializeMovedToPropertyActivityStreams returns the deserialization method
+// for the "ActivityStreamsMovedToProperty" non-functional property in the
+// vocabulary "ActivityStreams"
+func (this Manager) DeserializeMovedToPropertyActivityStreams() func(map[string]interface{}, map[string]string) (vocab.ActivityStreamsMovedToProperty, error) {
+	return func(m map[string]interface{}, aliasMap map[string]string) (vocab.ActivityStreamsMovedToProperty, error) {
+		i, err := propertymovedto.DeserializeMovedToProperty(m, aliasMap)
+		if i == nil {
+			return nil, err
+		}
+		return i, err
+	}
+}
+
 // DeserializeNamePropertyActivityStreams returns the deserialization method for
 // the "ActivityStreamsNameProperty" non-functional property in the vocabulary
 // "ActivityStreams"